@@ -113,6 +113,9 @@ Flags:
 		Write an execution trace to file.
 	-trimpath prefix
 		Remove prefix from recorded source file paths.
+	-tscpreempt
+		Insert preemption checks using the cycle counter, on solo5hvt.
+		Ignored on other targets.
 
 Flags related to debugging information:
 
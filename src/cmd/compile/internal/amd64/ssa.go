@@ -921,6 +921,20 @@ func ssaGenValue(s *gc.SSAGenState, v *ssa.Value) {
 		p.To.Type = obj.TYPE_REG
 		p.To.Reg = v.Reg()
 
+	case ssa.OpAMD64LoweredCputicks:
+		// RDTSC; SHLQ $32, DX; ORQ DX, AX
+		s.Prog(x86.ARDTSC)
+		p := s.Prog(x86.ASHLQ)
+		p.From.Type = obj.TYPE_CONST
+		p.From.Offset = 32
+		p.To.Type = obj.TYPE_REG
+		p.To.Reg = x86.REG_DX
+		p = s.Prog(x86.AORQ)
+		p.From.Type = obj.TYPE_REG
+		p.From.Reg = x86.REG_DX
+		p.To.Type = obj.TYPE_REG
+		p.To.Reg = x86.REG_AX
+
 	case ssa.OpAMD64LoweredGetCallerSP:
 		// caller's SP is the address of the first arg
 		mov := x86.AMOVQ
@@ -221,6 +221,8 @@ var flag_race bool
 
 var flag_msan bool
 
+var flag_tscpreempt bool
+
 var flagDWARF bool
 
 // Whether we are adding any sort of code instrumentation, such as
@@ -297,6 +299,8 @@ var (
 	Duffzero,
 	gcWriteBarrier,
 	goschedguarded,
+	preemptcheck,
+	preemptDeadline,
 	growslice,
 	msanread,
 	msanwrite,
@@ -239,6 +239,7 @@ func Main(archInit func(*Arch)) {
 		flag.BoolVar(&flag_race, "race", false, "enable race detector")
 	}
 	objabi.Flagcount("s", "warn about composite literals that can be simplified", &Debug['s'])
+	flag.BoolVar(&flag_tscpreempt, "tscpreempt", false, "insert preemption checks using the cycle counter (solo5hvt only)")
 	if enableTrace {
 		flag.BoolVar(&trace, "t", false, "trace type-checking")
 	}
@@ -268,10 +269,16 @@ func Main(archInit func(*Arch)) {
 	flag.BoolVar(&Ctxt.UseBASEntries, "dwarfbasentries", Ctxt.UseBASEntries, "use base address selection entries in DWARF")
 	objabi.Flagparse(usage)
 
+	if objabi.GOOS != "solo5hvt" {
+		// Other targets have timer interrupts. They accept -tscpreempt,
+		// so that the same -gcflags work for host builds, and ignore it.
+		flag_tscpreempt = false
+	}
+
 	// Record flags that affect the build result. (And don't
 	// record flags that don't, since that would cause spurious
 	// changes in the binary.)
-	recordFlags("B", "N", "l", "msan", "race", "shared", "dynlink", "dwarflocationlists", "newescape", "dwarfbasentries", "smallframes")
+	recordFlags("B", "N", "l", "msan", "race", "shared", "dynlink", "dwarflocationlists", "newescape", "dwarfbasentries", "smallframes", "tscpreempt")
 
 	if smallFrames {
 		maxStackVarSize = 128 * 1024
@@ -349,6 +356,10 @@ func Main(archInit func(*Arch)) {
 	if flag_race || flag_msan {
 		instrumenting = true
 	}
+	if ispkgin(omit_pkgs) {
+		// The runtime polls for preemption itself.
+		flag_tscpreempt = false
+	}
 
 	if compiling_runtime && Debug['N'] != 0 {
 		log.Fatal("cannot disable optimizations while compiling runtime")
@@ -74,6 +74,8 @@ func initssaconfig() {
 	Duffzero = sysvar("duffzero")             // asm func with special ABI
 	gcWriteBarrier = sysvar("gcWriteBarrier") // asm func with special ABI
 	goschedguarded = sysfunc("goschedguarded")
+	preemptcheck = sysfunc("preemptcheck")
+	preemptDeadline = sysvar("preemptDeadline") // uint64
 	growslice = sysfunc("growslice")
 	msanread = sysfunc("msanread")
 	msanwrite = sysfunc("msanwrite")
@@ -209,6 +211,7 @@ func buildssa(fn *Node, worker int) *ssa.Func {
 	if fn.Func.Pragma&Nosplit != 0 {
 		s.f.NoSplit = true
 	}
+	s.f.TSCPreempt = flag_tscpreempt && !s.f.NoSplit
 	s.panics = map[funcLine]*ssa.Block{}
 	s.softFloat = s.config.SoftFloat
 
@@ -266,6 +269,10 @@ func buildssa(fn *Node, worker int) *ssa.Func {
 		}
 	}
 
+	if s.f.TSCPreempt {
+		s.preemptCheck()
+	}
+
 	// Convert the AST-based IR to the SSA-based IR
 	s.stmtList(fn.Func.Enter)
 	s.stmtList(fn.Nbody)
@@ -4255,6 +4262,29 @@ func (s *state) check(cmp *ssa.Value, fn *obj.LSym) {
 	s.startBlock(bNext)
 }
 
+// preemptCheck generates a call to runtime.preemptcheck if the cycle counter
+// is past runtime.preemptDeadline. With -tscpreempt, it is called at the start
+// of each function. The loop back-edges get the same check in the schedule
+// check pass.
+func (s *state) preemptCheck() {
+	addr := s.entryNewValue1A(ssa.OpAddr, types.NewPtr(types.Types[TUINT64]), preemptDeadline, s.sb)
+	deadline := s.load(types.Types[TUINT64], addr)
+	ticks := s.newValue1(ssa.OpCputicks, types.Types[TUINT64], s.mem())
+	cmp := s.newValue2(ssa.OpLess64U, types.Types[TBOOL], deadline, ticks)
+	b := s.endBlock()
+	b.Kind = ssa.BlockIf
+	b.SetControl(cmp)
+	b.Likely = ssa.BranchUnlikely
+	bCall := s.f.NewBlock(ssa.BlockPlain)
+	bNext := s.f.NewBlock(ssa.BlockPlain)
+	b.AddEdgeTo(bCall)
+	b.AddEdgeTo(bNext)
+	s.startBlock(bCall)
+	s.rtcall(preemptcheck, true, nil)
+	s.endBlock().AddEdgeTo(bNext)
+	s.startBlock(bNext)
+}
+
 func (s *state) intDivide(n *Node, a, b *ssa.Value) *ssa.Value {
 	needcheck := true
 	switch b.Op {
@@ -6177,6 +6207,10 @@ func (e *ssafn) Syslook(name string) *obj.LSym {
 	switch name {
 	case "goschedguarded":
 		return goschedguarded
+	case "preemptcheck":
+		return preemptcheck
+	case "preemptDeadline":
+		return preemptDeadline
 	case "writeBarrier":
 		return writeBarrier
 	case "gcWriteBarrier":
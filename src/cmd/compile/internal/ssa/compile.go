@@ -6,7 +6,6 @@ package ssa
 
 import (
 	"bytes"
-	"cmd/internal/objabi"
 	"cmd/internal/src"
 	"fmt"
 	"hash/crc32"
@@ -420,9 +419,8 @@ var passes = [...]pass{
 	{name: "branchelim", fn: branchelim},
 	{name: "fuse", fn: fuseAll},
 	{name: "dse", fn: dse},
-	{name: "writebarrier", fn: writebarrier, required: true}, // expand write barrier ops
-	{name: "insert resched checks", fn: insertLoopReschedChecks,
-		disabled: objabi.Preemptibleloops_enabled == 0}, // insert resched checks in loops.
+	{name: "writebarrier", fn: writebarrier, required: true},     // expand write barrier ops
+	{name: "insert resched checks", fn: insertLoopReschedChecks}, // insert resched checks in loops, if enabled.
 	{name: "lower", fn: lower, required: true},
 	{name: "lowered cse", fn: cse},
 	{name: "elim unread autos", fn: elimUnreadAutos},
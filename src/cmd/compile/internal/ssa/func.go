@@ -47,6 +47,11 @@ type Func struct {
 	laidout   bool // Blocks are ordered
 	NoSplit   bool // true if function is marked as nosplit.  Used by schedule check pass.
 
+	// TSCPreempt is true if the schedule check pass compares the cycle
+	// counter with runtime.preemptDeadline instead of checking the stack
+	// bound, see -tscpreempt.
+	TSCPreempt bool
+
 	// when register allocation is done, maps value ids to locations
 	RegAlloc []Location
 
@@ -426,10 +426,11 @@ var genericOps = []opData{
 	{name: "NilCheck", argLength: 2, typ: "Void"},        // arg0=ptr, arg1=mem. Panics if arg0 is nil. Returns void.
 
 	// Pseudo-ops
-	{name: "GetG", argLength: 1, zeroWidth: true}, // runtime.getg() (read g pointer). arg0=mem
-	{name: "GetClosurePtr"},                       // get closure pointer from dedicated register
-	{name: "GetCallerPC"},                         // for getcallerpc intrinsic
-	{name: "GetCallerSP"},                         // for getcallersp intrinsic
+	{name: "GetG", argLength: 1, zeroWidth: true},   // runtime.getg() (read g pointer). arg0=mem
+	{name: "GetClosurePtr"},                         // get closure pointer from dedicated register
+	{name: "GetCallerPC"},                           // for getcallerpc intrinsic
+	{name: "GetCallerSP"},                           // for getcallersp intrinsic
+	{name: "Cputicks", argLength: 1, typ: "UInt64"}, // CPU cycle counter, for -tscpreempt checks. arg0=mem
 
 	// Indexing operations
 	{name: "PtrIndex", argLength: 2},             // arg0=ptr, arg1=index. Computes ptr+sizeof(*v.type)*index, where index is extended to ptrwidth type
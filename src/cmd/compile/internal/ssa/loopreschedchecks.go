@@ -6,6 +6,7 @@ package ssa
 
 import (
 	"cmd/compile/internal/types"
+	"cmd/internal/objabi"
 	"fmt"
 )
 
@@ -41,12 +42,17 @@ func (r *rewrite) String() string {
 }
 
 // insertLoopReschedChecks inserts rescheduling checks on loop backedges.
+// It is enabled by GOEXPERIMENT=preemptibleloops, or per function by
+// f.TSCPreempt.
 func insertLoopReschedChecks(f *Func) {
 	// TODO: when split information is recorded in export data, insert checks only on backedges that can be reached on a split-call-free path.
 
 	// Loop reschedule checks compare the stack pointer with
 	// the per-g stack bound.  If the pointer appears invalid,
 	// that means a reschedule check is needed.
+	// With f.TSCPreempt, they compare the cycle counter with
+	// runtime.preemptDeadline instead, and call runtime.preemptcheck
+	// once the deadline has passed.
 	//
 	// Steps:
 	// 1. locate backedges.
@@ -61,6 +67,9 @@ func insertLoopReschedChecks(f *Func) {
 	//    and modify destination phi function appropriately with new
 	//    definitions for mem.
 
+	if objabi.Preemptibleloops_enabled == 0 && !f.TSCPreempt {
+		return
+	}
 	if f.NoSplit { // nosplit functions don't reschedule.
 		return
 	}
@@ -216,18 +225,33 @@ func insertLoopReschedChecks(f *Func) {
 
 		// if sp < g.limit { goto sched }
 		// goto header
+		//
+		// or with f.TSCPreempt:
+		//
+		// if runtime.preemptDeadline < cputicks() { goto sched }
+		// goto header
 
 		cfgtypes := &f.Config.Types
 		pt := cfgtypes.Uintptr
-		g := test.NewValue1(bb.Pos, OpGetG, pt, mem0)
-		sp := test.NewValue0(bb.Pos, OpSP, pt)
-		cmpOp := OpLess64U
-		if pt.Size() == 4 {
-			cmpOp = OpLess32U
+		var cmp *Value
+		if f.TSCPreempt {
+			sb := test.NewValue0(bb.Pos, OpSB, pt)
+			dlsym := f.fe.Syslook("preemptDeadline")
+			dladdr := test.NewValue1A(bb.Pos, OpAddr, types.NewPtr(cfgtypes.UInt64), dlsym, sb)
+			dl := test.NewValue2(bb.Pos, OpLoad, cfgtypes.UInt64, dladdr, mem0)
+			ticks := test.NewValue1(bb.Pos, OpCputicks, cfgtypes.UInt64, mem0)
+			cmp = test.NewValue2(bb.Pos, OpLess64U, cfgtypes.Bool, dl, ticks)
+		} else {
+			g := test.NewValue1(bb.Pos, OpGetG, pt, mem0)
+			sp := test.NewValue0(bb.Pos, OpSP, pt)
+			cmpOp := OpLess64U
+			if pt.Size() == 4 {
+				cmpOp = OpLess32U
+			}
+			limaddr := test.NewValue1I(bb.Pos, OpOffPtr, pt, 2*pt.Size(), g)
+			lim := test.NewValue2(bb.Pos, OpLoad, pt, limaddr, mem0)
+			cmp = test.NewValue2(bb.Pos, cmpOp, cfgtypes.Bool, sp, lim)
 		}
-		limaddr := test.NewValue1I(bb.Pos, OpOffPtr, pt, 2*pt.Size(), g)
-		lim := test.NewValue2(bb.Pos, OpLoad, pt, limaddr, mem0)
-		cmp := test.NewValue2(bb.Pos, cmpOp, cfgtypes.Bool, sp, lim)
 		test.SetControl(cmp)
 
 		// if true, goto sched
@@ -246,6 +270,9 @@ func insertLoopReschedChecks(f *Func) {
 		//    mem1 := call resched (mem0)
 		//    goto header
 		resched := f.fe.Syslook("goschedguarded")
+		if f.TSCPreempt {
+			resched = f.fe.Syslook("preemptcheck")
+		}
 		mem1 := sched.NewValue1A(bb.Pos, OpStaticCall, types.TypeMem, resched, mem0)
 		sched.AddEdgeTo(h)
 		headerMemPhi.AddArg(mem1)
@@ -848,6 +848,7 @@ const (
 	OpAMD64LoweredGetClosurePtr
 	OpAMD64LoweredGetCallerPC
 	OpAMD64LoweredGetCallerSP
+	OpAMD64LoweredCputicks
 	OpAMD64LoweredNilCheck
 	OpAMD64LoweredWB
 	OpAMD64LoweredPanicBoundsA
@@ -2456,6 +2457,7 @@ const (
 	OpGetClosurePtr
 	OpGetCallerPC
 	OpGetCallerSP
+	OpCputicks
 	OpPtrIndex
 	OpOffPtr
 	OpSliceMake
@@ -11221,6 +11223,17 @@ var opcodeTable = [...]opInfo{
 			},
 		},
 	},
+	{
+		name:         "LoweredCputicks",
+		argLen:       1,
+		clobberFlags: true,
+		reg: regInfo{
+			clobbers: 4, // DX
+			outputs: []outputInfo{
+				{0, 1}, // AX
+			},
+		},
+	},
 	{
 		name:           "LoweredNilCheck",
 		argLen:         2,
@@ -30708,6 +30721,11 @@ var opcodeTable = [...]opInfo{
 		argLen:  0,
 		generic: true,
 	},
+	{
+		name:    "Cputicks",
+		argLen:  1,
+		generic: true,
+	},
 	{
 		name:    "PtrIndex",
 		argLen:  2,
@@ -701,6 +701,8 @@ func rewriteValueAMD64(v *Value) bool {
 		return rewriteValueAMD64_OpConstBool_0(v)
 	case OpConstNil:
 		return rewriteValueAMD64_OpConstNil_0(v)
+	case OpCputicks:
+		return rewriteValueAMD64_OpCputicks_0(v)
 	case OpCtz16:
 		return rewriteValueAMD64_OpCtz16_0(v)
 	case OpCtz16NonZero:
@@ -58319,6 +58321,17 @@ func rewriteValueAMD64_OpConstNil_0(v *Value) bool {
 	}
 	return false
 }
+func rewriteValueAMD64_OpCputicks_0(v *Value) bool {
+	// match: (Cputicks mem)
+	// cond:
+	// result: (LoweredCputicks mem)
+	for {
+		mem := v.Args[0]
+		v.reset(OpAMD64LoweredCputicks)
+		v.AddArg(mem)
+		return true
+	}
+}
 func rewriteValueAMD64_OpCtz16_0(v *Value) bool {
 	b := v.Block
 	typ := &b.Func.Config.Types
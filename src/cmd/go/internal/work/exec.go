@@ -1165,6 +1165,11 @@ func (b *Builder) printLinkerConfig(h io.Writer, p *load.Package) {
 		// GO_EXTLINK_ENABLED controls whether the external linker is used.
 		fmt.Fprintf(h, "GO_EXTLINK_ENABLED=%s\n", cfg.Getenv("GO_EXTLINK_ENABLED"))
 
+		// The linker embeds files for solo5hvt.
+		if cfg.Goos == "solo5hvt" {
+			b.printSolo5LinkInputs(h, p)
+		}
+
 		// TODO(rsc): Do cgo settings and flags need to be included?
 		// Or external linker settings and flags?
 
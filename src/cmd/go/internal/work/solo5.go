@@ -0,0 +1,90 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package work
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cmd/go/internal/cfg"
+	"cmd/go/internal/load"
+)
+
+// printSolo5LinkInputs prints the files that the linker reads for
+// GOOS=solo5hvt into the hash h, so a change to them causes a new link: the
+// manifest, the timezone database and the tree of files for the root file
+// system. Names are relative to the directory the linker runs in, the
+// current directory.
+func (b *Builder) printSolo5LinkInputs(h io.Writer, p *load.Package) {
+	flags := map[string]string{
+		"solo5manifest": "manifest.json",
+	}
+	var ldflags []string
+	ldflags = append(ldflags, forcedLdflags...)
+	if p != nil {
+		ldflags = append(ldflags, p.Internal.Ldflags...)
+	}
+	for i := 0; i < len(ldflags); i++ {
+		name := strings.TrimLeft(ldflags[i], "-")
+		if !strings.HasPrefix(name, "solo5") {
+			continue
+		}
+		if eq := strings.Index(name, "="); eq >= 0 {
+			flags[name[:eq]] = name[eq+1:]
+		} else if name == "solo5nozoneinfo" {
+			flags[name] = "true"
+		} else if i+1 < len(ldflags) {
+			flags[name] = ldflags[i+1]
+			i++
+		}
+	}
+
+	fmt.Fprintf(h, "solo5manifest %s\n", b.fileHash(flags["solo5manifest"]))
+	if file := flags["solo5zoneinfo"]; file != "" {
+		fmt.Fprintf(h, "solo5zoneinfo %s\n", b.fileHash(file))
+	} else if flags["solo5nozoneinfo"] != "true" {
+		// The default, which the linker skips if it does not exist.
+		file := filepath.Join(cfg.GOROOT, "lib", "time", "zoneinfo.zip")
+		if _, err := os.Stat(file); err == nil {
+			fmt.Fprintf(h, "solo5zoneinfo %s\n", b.fileHash(file))
+		}
+	}
+	if dir := flags["solo5rootfs"]; dir != "" {
+		fmt.Fprintf(h, "solo5rootfs %q\n", dir)
+		b.printSolo5Rootfs(h, dir)
+	}
+}
+
+// printSolo5Rootfs prints the properties of the tree in dir that the linker
+// embeds with -solo5rootfs into the hash h: names, types and permissions,
+// and the contents of files and symbolic links.
+func (b *Builder) printSolo5Rootfs(h io.Writer, dir string) {
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(path, dir))
+		switch mode := fi.Mode(); {
+		case mode.IsRegular():
+			fmt.Fprintf(h, "file %q %v %s\n", name, mode, b.fileHash(path))
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "symlink %q %v %q\n", name, mode, target)
+		default:
+			fmt.Fprintf(h, "entry %q %v\n", name, mode)
+		}
+		return nil
+	})
+	if err != nil {
+		// Let the linker report the error.
+		fmt.Fprintf(h, "error %q\n", err)
+	}
+}
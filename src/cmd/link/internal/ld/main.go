@@ -91,7 +91,11 @@ var (
 	FlagTextAddr    = flag.Int64("T", -1, "set text segment `address`")
 	flagEntrySymbol = flag.String("E", "", "set `entry` symbol name")
 
-	solo5Manifest = flag.String("solo5manifest", "manifest.json", "path to solo5 manifest.json")
+	solo5Manifest   = flag.String("solo5manifest", "manifest.json", "path to solo5 manifest.json")
+	solo5Zoneinfo   = flag.String("solo5zoneinfo", "", "embed timezone database zip `file` for time.LoadLocation on solo5, instead of $GOROOT/lib/time/zoneinfo.zip")
+	solo5Zones      = flag.String("solo5zones", "", "only embed the timezones in comma-separated `list`, names ending in / select a directory")
+	solo5NoZoneinfo = flag.Bool("solo5nozoneinfo", false, "do not embed a timezone database on solo5")
+	solo5Rootfs     = flag.String("solo5rootfs", "", "embed the files in `dir` in the root file system on solo5")
 
 	cpuprofile     = flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile     = flag.String("memprofile", "", "write memory profile to `file`")
@@ -170,6 +174,8 @@ func Main(arch *sys.Arch, theArch Arch) {
 
 	if objabi.GOOS == "solo5hvt" {
 		parseSolo5Manifest(ctxt)
+		embedSolo5Zoneinfo(ctxt)
+		embedSolo5Rootfs(ctxt)
 	}
 
 	interpreter = *flagInterpreter
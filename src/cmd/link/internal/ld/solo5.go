@@ -1,16 +1,20 @@
 package ld
 
 import (
+	"archive/zip"
 	"bytes"
+	"cmd/internal/objabi"
 	"encoding/binary"
 	"encoding/json"
-	"os"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
 // TODO(mjl): make less ugly. there's probably a better way to map c structures to bytes. perhaps just make them go structs and pack them to bytes?
-// TODO(mjl): add the manifest.json to build dependencies. so we rebuild properly after changing it. for now i'm building with -a, will get annoying fast.
 
 type writer struct {
 	out io.Writer
@@ -95,3 +99,162 @@ func parseSolo5Manifest(ctx *Link) {
 
 	ctx.solo5Manifest = mftbuf.Bytes()
 }
+
+// Embed the timezone database of -solo5zoneinfo, or of $GOROOT/lib/time by
+// default, by setting the string variable time.timezoneZipData. -solo5zones
+// selects the zones to embed, -solo5nozoneinfo embeds none. Without flags,
+// a GOROOT without zoneinfo.zip embeds none either.
+func embedSolo5Zoneinfo(ctxt *Link) {
+	if *solo5NoZoneinfo {
+		if *solo5Zoneinfo != "" || *solo5Zones != "" {
+			Exitf("-solo5nozoneinfo cannot be combined with -solo5zoneinfo or -solo5zones")
+		}
+		return
+	}
+	file := *solo5Zoneinfo
+	if file == "" {
+		file = filepath.Join(objabi.GOROOT, "lib", "time", "zoneinfo.zip")
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && *solo5Zoneinfo == "" && *solo5Zones == "" {
+		return
+	}
+	if err != nil {
+		Exitf("reading solo5 zoneinfo: %v", err)
+	}
+	if *solo5Zones != "" {
+		data, err = filterZoneinfo(data, strings.Split(*solo5Zones, ","))
+		if err != nil {
+			Exitf("solo5 zoneinfo %s: %v", file, err)
+		}
+	}
+	addstrdata1(ctxt, "time.timezoneZipData="+string(data))
+}
+
+// filterZoneinfo returns a zoneinfo zip file with only the zones in the zip
+// file data that are listed in zones. A name ending in a slash selects all
+// zones in that directory. Entries are stored uncompressed, like package time
+// needs them.
+func filterZoneinfo(data []byte, zones []string) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	match := func(name string, zone string) bool {
+		if strings.HasSuffix(zone, "/") {
+			return strings.HasPrefix(name, zone)
+		}
+		return name == zone
+	}
+	used := make([]bool, len(zones))
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		keep := false
+		for i, zone := range zones {
+			if match(f.Name, zone) {
+				keep = true
+				used[i] = true
+			}
+		}
+		if !keep || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		fh := f.FileHeader
+		fh.Method = zip.Store
+		fw, err := w.CreateHeader(&fh)
+		if err == nil {
+			_, err = io.Copy(fw, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, zone := range zones {
+		if !used[i] {
+			return nil, fmt.Errorf("unknown zone %q", zone)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Embed the tree of directory -solo5rootfs, by setting the string variable
+// os.rootfsZip. Package os adds its files to the root file system at startup.
+func embedSolo5Rootfs(ctxt *Link) {
+	if *solo5Rootfs == "" {
+		return
+	}
+	data, err := packRootfs(*solo5Rootfs)
+	if err != nil {
+		Exitf("solo5 rootfs: %v", err)
+	}
+	addstrdata1(ctxt, "os.rootfsZip="+string(data))
+}
+
+// packRootfs returns a zip file with the files, directories and symbolic
+// links in directory dir, and their permissions. Files are stored
+// uncompressed, so package os can use them in place. Symbolic links are
+// stored with their target as contents. Modification times are left out,
+// for reproducible builds. Note that cmd/go hashes the same properties of
+// the tree to decide when to link again.
+func packRootfs(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s: not a directory", dir)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fh := &zip.FileHeader{
+			Name:   filepath.ToSlash(rel),
+			Method: zip.Store,
+		}
+		fh.SetMode(fi.Mode())
+		var data []byte
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			fh.Name += "/"
+		case mode.IsRegular():
+			data, err = ioutil.ReadFile(path)
+		case mode&os.ModeSymlink != 0:
+			var target string
+			target, err = os.Readlink(path)
+			data = []byte(target)
+		default:
+			return fmt.Errorf("%s: unsupported file type %v", path, mode)
+		}
+		if err != nil {
+			return err
+		}
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
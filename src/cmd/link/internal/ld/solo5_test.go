@@ -0,0 +1,130 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFilterZoneinfo(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	out, err := filterZoneinfo(data, []string{"Europe/Amsterdam", "Antarctica/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var amsterdam, antarctica int
+	for _, f := range r.File {
+		if f.Method != zip.Store {
+			t.Errorf("%s: method %d, expected %d", f.Name, f.Method, zip.Store)
+		}
+		switch {
+		case f.Name == "Europe/Amsterdam":
+			amsterdam++
+		case strings.HasPrefix(f.Name, "Antarctica/") && f.Name != "Antarctica/":
+			antarctica++
+		default:
+			t.Errorf("unexpected entry %s", f.Name)
+		}
+	}
+	if amsterdam != 1 || antarctica < 2 {
+		t.Errorf("got %d Europe/Amsterdam and %d Antarctica zones, expected 1 and more than 1", amsterdam, antarctica)
+	}
+
+	if _, err := filterZoneinfo(data, []string{"Europe/Nowhere"}); err == nil {
+		t.Errorf("filterZoneinfo with unknown zone succeeded")
+	}
+}
+
+func TestPackRootfs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string, mode os.FileMode) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), mode); err != nil {
+			t.Fatal(err)
+		}
+		// Undo the umask.
+		if err := os.Chmod(filepath.Join(dir, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "etc", "ssl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write("etc/resolv.conf", "nameserver 10.0.0.1\n", 0644)
+	write("etc/ssl/key.pem", "secret", 0600)
+	write("run.sh", "#!/bin/sh\n", 0755)
+	if err := os.Symlink("etc/resolv.conf", filepath.Join(dir, "resolv.conf")); err != nil {
+		t.Skip(err)
+	}
+
+	data, err := packRootfs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]struct {
+		mode os.FileMode
+		data string
+	}{
+		"etc/":            {os.ModeDir | 0755, ""},
+		"etc/resolv.conf": {0644, "nameserver 10.0.0.1\n"},
+		"etc/ssl/":        {os.ModeDir | 0755, ""},
+		"etc/ssl/key.pem": {0600, "secret"},
+		"resolv.conf":     {os.ModeSymlink | 0777, "etc/resolv.conf"},
+		"run.sh":          {0755, "#!/bin/sh\n"},
+	}
+	for _, f := range r.File {
+		x, ok := expect[f.Name]
+		if !ok {
+			t.Errorf("unexpected entry %s", f.Name)
+			continue
+		}
+		delete(expect, f.Name)
+		if f.Method != zip.Store {
+			t.Errorf("%s: method %d, expected %d", f.Name, f.Method, zip.Store)
+		}
+		if f.Mode() != x.mode {
+			t.Errorf("%s: mode %v, expected %v", f.Name, f.Mode(), x.mode)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(buf) != x.data {
+			t.Errorf("%s: contents %q, %v, expected %q", f.Name, buf, err, x.data)
+		}
+	}
+	for name := range expect {
+		t.Errorf("missing entry %s", name)
+	}
+
+	if _, err := packRootfs(filepath.Join(dir, "run.sh")); err == nil {
+		t.Errorf("packRootfs of a file succeeded")
+	}
+}
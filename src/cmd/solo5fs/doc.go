@@ -0,0 +1,37 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Solo5fs creates and inspects disk images with the persistent file system
+that solo5hvt guests mount from a block device.
+
+Usage:
+	go tool solo5fs format [-size size] image
+	go tool solo5fs put image hostpath [path]
+	go tool solo5fs ls image [path]
+	go tool solo5fs cat image path
+	go tool solo5fs info image
+
+Format writes an empty file system to image, creating the file if needed.
+The size, with an optional K, M or G suffix, defaults to the size of an
+existing image.
+
+Put copies file or directory tree hostpath into the image, as path, which
+defaults to the base name of hostpath in the root directory. Missing parent
+directories of path are created, an existing file is replaced. Modes,
+modification times and symbolic links are kept.
+
+Ls lists a directory of the image, or describes a file. Cat writes the
+contents of a file to standard output. Info prints the size and usage of the
+file system.
+
+Names in the image are slash-separated and start at the root directory.
+Symbolic links in them are not followed.
+
+To mount an image in a guest, attach it as a block device of the tender,
+e.g. with --block:storage=disk.img for a device named storage in the
+manifest, and set SOLO5_MOUNT_storage=/data on the command line of the
+guest.
+*/
+package main
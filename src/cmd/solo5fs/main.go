@@ -0,0 +1,307 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"internal/solo5fs"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: go tool solo5fs format [-size size] image
+       go tool solo5fs put image hostpath [path]
+       go tool solo5fs ls image [path]
+       go tool solo5fs cat image path
+       go tool solo5fs info image
+`)
+	os.Exit(2)
+}
+
+func main() {
+	log.SetPrefix("solo5fs: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "format":
+		format(args)
+	case "put":
+		if len(args) != 2 && len(args) != 3 {
+			usage()
+		}
+		fs, f := mount(args[0], os.O_RDWR)
+		name := "/" + filepath.Base(args[1])
+		if len(args) == 3 {
+			name = args[2]
+		}
+		dir, base := walkParent(fs, name)
+		if err := put(dir, base, args[1]); err != nil {
+			log.Fatal(err)
+		}
+		if err := fs.Sync(); err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	case "ls":
+		if len(args) != 1 && len(args) != 2 {
+			usage()
+		}
+		fs, _ := mount(args[0], os.O_RDONLY)
+		name := "/"
+		if len(args) == 2 {
+			name = args[1]
+		}
+		ls(walk(fs, name), name)
+	case "cat":
+		if len(args) != 2 {
+			usage()
+		}
+		fs, _ := mount(args[0], os.O_RDONLY)
+		n := walk(fs, args[1])
+		if _, err := io.Copy(os.Stdout, io.NewSectionReader(n, 0, n.Size())); err != nil {
+			log.Fatalf("%s: %v", args[1], err)
+		}
+	case "info":
+		if len(args) != 1 {
+			usage()
+		}
+		fs, _ := mount(args[0], os.O_RDONLY)
+		total, free := fs.Blocks()
+		fmt.Printf("block size %d\n", solo5fs.BlockSize)
+		fmt.Printf("blocks %d, used %d, free %d\n", total, total-free, free)
+		fmt.Printf("generation %d\n", fs.Generation())
+	default:
+		usage()
+	}
+}
+
+func format(args []string) {
+	flags := flag.NewFlagSet("format", flag.ExitOnError)
+	flags.Usage = usage
+	size := flags.String("size", "", "size of the `image`, with optional K, M or G suffix")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	image := flags.Arg(0)
+
+	f, err := os.OpenFile(image, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var n int64
+	if *size != "" {
+		n, err = parseSize(*size)
+		if err != nil {
+			log.Fatalf("bad size %q", *size)
+		}
+		if err := f.Truncate(n); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fi, err := f.Stat()
+		if err != nil {
+			log.Fatal(err)
+		}
+		n = fi.Size()
+	}
+	if err := solo5fs.Format(f, n); err != nil {
+		if err == syscall.EINVAL {
+			log.Fatalf("%s: size %d too small", image, n)
+		}
+		log.Fatalf("%s: %v", image, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseSize parses a size in bytes, with an optional K, M or G suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K', 'k':
+			mult = 1 << 10
+		case 'M', 'm':
+			mult = 1 << 20
+		case 'G', 'g':
+			mult = 1 << 30
+		}
+		if mult != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > 1<<62/mult {
+		return 0, fmt.Errorf("bad size")
+	}
+	return n * mult, nil
+}
+
+// mount opens image and mounts its file system.
+func mount(image string, flag int) (*solo5fs.FS, *os.File) {
+	f, err := os.OpenFile(image, flag, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs, err := solo5fs.Mount(f, fi.Size())
+	if err != nil {
+		log.Fatalf("%s: %v", image, err)
+	}
+	return fs, f
+}
+
+// walk returns the inode for name, exiting on errors.
+func walk(fs *solo5fs.FS, name string) *solo5fs.Inode {
+	n := fs.Root()
+	for _, elem := range strings.Split(path.Clean("/"+name), "/") {
+		if elem == "" {
+			continue
+		}
+		c, err := n.Lookup(elem)
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		n = c
+	}
+	return n
+}
+
+// walkParent returns the directory for name, creating it as needed, and the
+// last element of name.
+func walkParent(fs *solo5fs.FS, name string) (*solo5fs.Inode, string) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		log.Fatalf("%s: cannot replace root directory", name)
+	}
+	dir := fs.Root()
+	elems := strings.Split(name[1:], "/")
+	for _, elem := range elems[:len(elems)-1] {
+		c, err := dir.Lookup(elem)
+		if err == syscall.ENOENT {
+			c, err = dir.Create(elem, solo5fs.ModeDir|0755)
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		dir = c
+	}
+	return dir, elems[len(elems)-1]
+}
+
+// put copies host file or directory tree src to name in directory dir.
+func put(dir *solo5fs.Inode, name, src string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	mode := uint32(fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky))
+
+	old, err := dir.Lookup(name)
+	if err == nil && !(fi.IsDir() && old.IsDir()) {
+		if err := dir.Remove(name); err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		old = nil
+	}
+
+	var n *solo5fs.Inode
+	switch {
+	case fi.IsDir():
+		n = old
+		if n == nil {
+			n, err = dir.Create(name, solo5fs.ModeDir|mode)
+			if err != nil {
+				return fmt.Errorf("%s: %v", src, err)
+			}
+		}
+		n.Chmod(mode)
+		names, err := readDirNames(src)
+		if err != nil {
+			return err
+		}
+		for _, elem := range names {
+			if err := put(n, elem, filepath.Join(src, elem)); err != nil {
+				return err
+			}
+		}
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if n, err = dir.Symlink(name, filepath.ToSlash(target)); err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+	case fi.Mode().IsRegular():
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if n, err = dir.Create(name, mode); err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		if _, err := n.WriteAt(data, 0); err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+	default:
+		log.Printf("%s: skipping %v", src, fi.Mode().String())
+		return nil
+	}
+	n.SetModTime(fi.ModTime())
+	return nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// ls prints inode n, or the entries of directory n, in the style of ls -l.
+func ls(n *solo5fs.Inode, name string) {
+	if !n.IsDir() {
+		printInode(n, path.Base(name))
+		return
+	}
+	for _, elem := range n.Names() {
+		c, _ := n.Lookup(elem)
+		printInode(c, elem)
+	}
+}
+
+func printInode(n *solo5fs.Inode, name string) {
+	if n.Mode()&solo5fs.ModeSymlink != 0 {
+		target, _ := n.Readlink()
+		name += " -> " + target
+	}
+	mtime := n.ModTime().Format("2006-01-02 15:04:05")
+	fmt.Printf("%s %3d %10d %s %s\n", os.FileMode(n.Mode()), n.Nlink(), n.Size(), mtime, name)
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Solo5pcap extracts the network frames captured by a solo5hvt guest from the
+image of a block device, as a pcap file for tcpdump or Wireshark.
+
+Usage:
+	go tool solo5pcap [-o file] image
+
+The pcap file is written to standard output, or to the file named by -o.
+The number of frames is printed on standard error.
+
+A guest captures the frames it reads and writes on its network devices when
+GODEBUG has setting solo5pcap=<name>, with <name> a block device from the
+manifest. The capture starts at the beginning of the device each time the
+guest starts, and stops when the device is full. For example:
+
+	dd if=/dev/zero of=capture.img bs=1M count=16
+	solo5-hvt --net:net0=tap0 --block:capture=capture.img unikernel \
+		GODEBUG=solo5pcap=capture,solo5pcapfilter=tcp+port=80
+	go tool solo5pcap -o capture.pcap capture.img
+
+Setting solo5pcapsnap=<n> limits the bytes captured per frame. Setting
+solo5pcapfilter selects the frames to capture, with terms joined by "+" that
+must all match: a network device name, "in" or "out", "arp", "ip", "ip6",
+"tcp", "udp", "icmp" and "port=<n>".
+
+With solo5pcap=mem, frames are captured in a ring buffer in memory instead,
+the guest retrieves them with syscall/solo5.WriteCapture.
+
+Frames written to the device go through the block cache of the guest. They
+reach the image when the cache is synced, which happens at the latest when
+the program exits normally.
+*/
+package main
@@ -0,0 +1,126 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: go tool solo5pcap [-o file] image\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetPrefix("solo5pcap: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	output := flag.String("o", "", "write pcap to `file` instead of standard output")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+	image := flag.Arg(0)
+
+	f, err := os.Open(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	n, err := extract(w, io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		log.Fatalf("%s: %v", image, err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d frames\n", n)
+}
+
+const (
+	pcapMagic     = 0xa1b2c3d4
+	pcapHeaderLen = 24
+	pcapRecordLen = 16
+)
+
+var (
+	errNoCapture = errors.New("no capture found")
+	errCorrupt   = errors.New("corrupt capture")
+)
+
+// extract copies the pcap file header and the frames from the capture in r
+// to w, until the end marker or the end of r. It returns the number of
+// frames.
+func extract(w io.Writer, r io.Reader) (int, error) {
+	hdr := make([]byte, pcapHeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, errNoCapture
+		}
+		return 0, err
+	}
+	if binary.LittleEndian.Uint32(hdr) != pcapMagic {
+		return 0, errNoCapture
+	}
+	snap := binary.LittleEndian.Uint32(hdr[16:])
+	if _, err := w.Write(hdr); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	rec := make([]byte, pcapRecordLen)
+	var zero [pcapRecordLen]byte
+	for {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// Device full.
+				return n, nil
+			}
+			return n, err
+		}
+		if string(rec) == string(zero[:]) {
+			return n, nil
+		}
+		caplen := binary.LittleEndian.Uint32(rec[8:])
+		if caplen > snap || caplen > binary.LittleEndian.Uint32(rec[12:]) {
+			return n, errCorrupt
+		}
+		frame := make([]byte, caplen)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return n, errCorrupt
+			}
+			return n, err
+		}
+		if _, err := w.Write(rec); err != nil {
+			return n, err
+		}
+		if _, err := w.Write(frame); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
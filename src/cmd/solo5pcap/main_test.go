@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// capture returns a capture as a guest writes it, with records for frames,
+// followed by an end marker and padding up to size.
+func capture(size int, frames ...[]byte) []byte {
+	b := make([]byte, pcapHeaderLen)
+	binary.LittleEndian.PutUint32(b[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(b[4:], 2)
+	binary.LittleEndian.PutUint16(b[6:], 4)
+	binary.LittleEndian.PutUint32(b[16:], 65535)
+	binary.LittleEndian.PutUint32(b[20:], 1)
+	for i, f := range frames {
+		rec := make([]byte, pcapRecordLen)
+		binary.LittleEndian.PutUint32(rec[0:], uint32(1500000000+i))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(f)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(f)))
+		b = append(b, rec...)
+		b = append(b, f...)
+	}
+	if len(b) < size {
+		b = append(b, make([]byte, size-len(b))...)
+	}
+	return b
+}
+
+func TestExtract(t *testing.T) {
+	frames := [][]byte{
+		bytes.Repeat([]byte{1}, 60),
+		bytes.Repeat([]byte{2}, 1514),
+	}
+	img := capture(0, frames...)
+
+	// A new, shorter capture over an old one: its end marker is followed
+	// by stale data.
+	short := capture(0, bytes.Repeat([]byte{3}, 60))
+	stale := append([]byte(nil), img...)
+	copy(stale, short)
+	copy(stale[len(short):], make([]byte, pcapRecordLen))
+
+	tests := []struct {
+		name   string
+		image  []byte
+		frames int
+		want   []byte
+		err    error
+	}{
+		{"padded", capture(4096, frames...), 2, img, nil},
+		{"full", img, 2, img, nil},
+		{"stale", stale, 1, short, nil},
+		{"empty", make([]byte, 4096), 0, nil, errNoCapture},
+		{"truncated", img[:len(img)-1], 1, nil, errCorrupt},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		n, err := extract(&out, bytes.NewReader(tt.image))
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if n != tt.frames {
+			t.Errorf("%s: got %d frames, want %d", tt.name, n, tt.frames)
+		}
+		if tt.want != nil && !bytes.Equal(out.Bytes(), tt.want) {
+			t.Errorf("%s: output differs", tt.name)
+		}
+	}
+}
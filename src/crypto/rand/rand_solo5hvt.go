@@ -0,0 +1,21 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rand
+
+import "syscall"
+
+func init() {
+	Reader = &reader{}
+}
+
+// reader implements a pseudorandom generator using the ChaCha20-based
+// generator of the runtime, which is seeded with RDSEED or RDRAND, or with
+// time stamp counter jitter if the CPU has neither.
+type reader struct{}
+
+func (r *reader) Read(b []byte) (int, error) {
+	syscall.GetRandom(b)
+	return len(b), nil
+}
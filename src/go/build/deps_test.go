@@ -168,8 +168,11 @@ var pkgDeps = map[string][]string{
 
 	"internal/cfg":     {"L0"},
 	"internal/poll":    {"L0", "internal/oserror", "internal/race", "syscall", "time", "unicode/utf16", "unicode/utf8", "internal/syscall/windows"},
+	"syscall/solo5":    {"L0", "internal/poll", "internal/solo5lease", "syscall", "time"},
+	"internal/solo5fs": {"L1", "syscall", "time"},
+	"internal/rofs":    {"L1", "syscall", "time"},
 	"internal/testlog": {"L0"},
-	"os":               {"L1", "os", "syscall", "time", "internal/oserror", "internal/poll", "internal/syscall/windows", "internal/syscall/unix", "internal/testlog"},
+	"os":               {"L1", "os", "syscall", "time", "internal/oserror", "internal/poll", "internal/syscall/windows", "internal/syscall/unix", "internal/testlog", "internal/solo5fs", "internal/rofs", "syscall/solo5"},
 	"path/filepath":    {"L2", "os", "syscall", "internal/syscall/windows"},
 	"io/ioutil":        {"L2", "os", "path/filepath", "time"},
 	"os/exec":          {"L2", "os", "context", "path/filepath", "syscall"},
@@ -320,14 +323,22 @@ var pkgDeps = map[string][]string{
 	// Internal package used only for testing.
 	"os/signal/internal/pty": {"CGO", "fmt", "os", "syscall"},
 
+	// internal/solo5lease passes DHCP leases from internal/netstack to
+	// syscall/solo5.
+	"internal/solo5lease": {"L0", "time"},
+
 	// Basic networking.
 	// Because net must be used by any package that wants to
 	// do networking portably, it must have a small dependency set: just L0+basic os.
+	// internal/netstack is the TCP/IP stack for solo5hvt.
+	"internal/netstack": {"L2", "context", "internal/poll", "internal/solo5lease", "math/rand", "syscall", "syscall/solo5", "time"},
+
 	"net": {
 		"L0", "CGO",
 		"context", "math/rand", "os", "sort", "syscall", "time",
 		"internal/nettrace", "internal/poll", "internal/syscall/unix",
 		"internal/syscall/windows", "internal/singleflight", "internal/race",
+		"internal/netstack",
 		"golang.org/x/net/dns/dnsmessage", "golang.org/x/net/lif", "golang.org/x/net/route",
 	},
 
@@ -0,0 +1,174 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"time"
+)
+
+const (
+	ethHeaderLen  = 14
+	ethTypeIPv4   = 0x0800
+	ethTypeARP    = 0x0806
+	ethTypeIPv6   = 0x86dd
+	arpPacketLen  = 28
+	arpOpRequest  = 1
+	arpOpReply    = 2
+	arpLifetime   = 5 * time.Minute
+	arpRetry      = time.Second
+	arpTries      = 3
+	arpMaxPending = 16
+)
+
+var broadcastMAC = [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// An arpEntry is a neighbor in the ARP cache of an interface, also used for
+// IPv6 neighbors. While the address is being resolved, frames to the
+// neighbor are queued.
+type arpEntry struct {
+	mac     [6]byte
+	valid   bool
+	expires time.Time
+	pending [][]byte
+	tries   int
+	timer   *time.Timer
+}
+
+// input processes an Ethernet frame received on ifi.
+func (ifi *Interface) input(frame []byte) {
+	if len(frame) < ethHeaderLen {
+		return
+	}
+	var dst [6]byte
+	copy(dst[:], frame)
+	// IPv6 multicast frames are filtered by destination address.
+	if dst != ifi.MAC && dst != broadcastMAC && (dst[0] != 0x33 || dst[1] != 0x33) {
+		return
+	}
+	switch be16(frame[12:]) {
+	case ethTypeARP:
+		ifi.inputARP(frame[ethHeaderLen:])
+	case ethTypeIPv4:
+		ifi.s.inputIPv4(ifi, frame[ethHeaderLen:])
+	case ethTypeIPv6:
+		ifi.s.inputIPv6(ifi, frame[ethHeaderLen:])
+	}
+}
+
+// newFrame returns a frame with room for n bytes of payload, with the
+// Ethernet header filled in, except for the destination.
+func (ifi *Interface) newFrame(ethType uint16, n int) []byte {
+	frame := make([]byte, ethHeaderLen+n)
+	copy(frame[6:], ifi.MAC[:])
+	put16(frame[12:], ethType)
+	return frame
+}
+
+// send sends frame to the neighbor with address nexthop, resolving its
+// hardware address first if needed.
+func (ifi *Interface) send(nexthop IP, frame []byte) error {
+	e := ifi.arp[nexthop]
+	if e != nil && e.valid && time.Now().Before(e.expires) {
+		copy(frame, e.mac[:])
+		return ifi.link.WriteFrame(frame)
+	}
+	if e == nil || e.valid {
+		e = &arpEntry{}
+		ifi.arp[nexthop] = e
+		ifi.resolve(nexthop, e)
+	}
+	if len(e.pending) < arpMaxPending {
+		e.pending = append(e.pending, frame)
+	}
+	return nil
+}
+
+// resolve sends an ARP request or IPv6 neighbor solicitation for ip, and
+// schedules a retry. After arpTries requests without reply, the entry and its
+// pending frames are dropped.
+func (ifi *Interface) resolve(ip IP, e *arpEntry) {
+	if e.tries >= arpTries {
+		delete(ifi.arp, ip)
+		return
+	}
+	e.tries++
+	if ip.Is4() {
+		src, _ := ifi.addr4()
+		ifi.arpRequest(src.IP, ip)
+	} else if src, ok := ifi.addr6(ip); ok {
+		ifi.sendNS(src, solicitedNode(ip), ip)
+	}
+	e.timer = time.AfterFunc(arpRetry, func() {
+		s := ifi.s
+		s.mu.Lock()
+		defer s.unlock()
+		if ifi.arp[ip] == e && !e.valid {
+			ifi.resolve(ip, e)
+		}
+	})
+}
+
+func (ifi *Interface) arpRequest(src, target IP) {
+	ifi.sendARP(arpOpRequest, broadcastMAC, src, [6]byte{}, target)
+}
+
+func (ifi *Interface) sendARP(op uint16, dstMAC [6]byte, spa IP, tha [6]byte, tpa IP) {
+	frame := ifi.newFrame(ethTypeARP, arpPacketLen)
+	copy(frame, dstMAC[:])
+	b := frame[ethHeaderLen:]
+	put16(b[0:], 1) // Ethernet
+	put16(b[2:], ethTypeIPv4)
+	b[4] = 6
+	b[5] = 4
+	put16(b[6:], op)
+	copy(b[8:], ifi.MAC[:])
+	copy(b[14:], spa[12:])
+	copy(b[18:], tha[:])
+	copy(b[24:], tpa[12:])
+	ifi.link.WriteFrame(frame)
+}
+
+func (ifi *Interface) inputARP(b []byte) {
+	if len(b) < arpPacketLen || be16(b[0:]) != 1 || be16(b[2:]) != ethTypeIPv4 || b[4] != 6 || b[5] != 4 {
+		return
+	}
+	op := be16(b[6:])
+	var sha [6]byte
+	copy(sha[:], b[8:])
+	spa := IPv4(b[14], b[15], b[16], b[17])
+	tpa := IPv4(b[24], b[25], b[26], b[27])
+
+	// As in RFC 826, update an existing entry for the sender, and add an
+	// entry if the request is for us.
+	mine := ifi.hasAddr(tpa)
+	if !spa.IsUnspecified() && (mine || ifi.arp[spa] != nil) {
+		ifi.learn(spa, sha)
+	}
+	if op == arpOpRequest && mine {
+		ifi.sendARP(arpOpReply, sha, tpa, sha, spa)
+	}
+}
+
+// learn records the hardware address for ip, and sends the frames waiting
+// for it.
+func (ifi *Interface) learn(ip IP, mac [6]byte) {
+	e := ifi.arp[ip]
+	if e == nil {
+		e = &arpEntry{}
+		ifi.arp[ip] = e
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.mac = mac
+	e.valid = true
+	e.expires = time.Now().Add(arpLifetime)
+	for _, frame := range e.pending {
+		copy(frame, mac[:])
+		ifi.link.WriteFrame(frame)
+	}
+	e.pending = nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"context"
+	"internal/poll"
+	"sync"
+	"time"
+)
+
+// deadline is a read or write deadline of an endpoint, like pipeDeadline in
+// package net.
+type deadline struct {
+	mu     sync.Mutex // Guards timer and cancel.
+	timer  *time.Timer
+	cancel chan struct{} // Closed when the deadline has passed, nil until first used.
+}
+
+// set sets the point in time when the deadline will time out.
+// A zero t prevents timeout.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to finish and close cancel.
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline has passed.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	return d.cancel
+}
+
+// expired reports whether the deadline has passed.
+func (d *deadline) expired() bool {
+	return isClosedChan(d.wait())
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// An event wakes up goroutines waiting for a change in the state of an
+// endpoint. It is protected by Stack.mu.
+type event struct {
+	c chan struct{}
+}
+
+func (e *event) signal() {
+	if e.c != nil {
+		close(e.c)
+		e.c = nil
+	}
+}
+
+// wait blocks until e is signaled, d has passed, or ctx is done. It must be
+// called with s.mu held, which it releases while waiting.
+func (s *Stack) wait(ctx context.Context, e *event, d *deadline) error {
+	if e.c == nil {
+		e.c = make(chan struct{})
+	}
+	c := e.c
+	var timeout chan struct{}
+	if d != nil {
+		timeout = d.wait()
+	}
+	s.unlock()
+	defer s.mu.Lock()
+	select {
+	case <-c:
+		return nil
+	case <-timeout:
+		return poll.ErrTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
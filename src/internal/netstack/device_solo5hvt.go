@@ -0,0 +1,190 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"errors"
+	"internal/solo5lease"
+	"sync"
+	"syscall"
+	"syscall/solo5"
+	"time"
+)
+
+var defaultStack struct {
+	once sync.Once
+	s    *Stack
+	err  error
+}
+
+// Default returns the stack with an interface for each network device in the
+// solo5 manifest, creating it on first use. Devices already opened with
+// package syscall/solo5 are skipped.
+//
+// The addresses of a device are configured with environment variable
+// SOLO5_NET_<name>, a comma-separated list, e.g.
+// SOLO5_NET_net0=10.0.0.2/24,2001:db8::2/64. Environment variable
+// SOLO5_GATEWAY configures the IPv4 default gateway. IPv6 link-local
+// addresses, and addresses and default router from router advertisements,
+// are configured automatically.
+//
+// Devices listed in SOLO5_DHCP, e.g. SOLO5_DHCP=net0,net1, are configured
+// with DHCP instead, including gateway and name servers. Default waits for
+// the leases for at most SOLO5_DHCP_TIMEOUT, 10s by default, and uses the
+// static configuration for a device without lease. The leases are recorded
+// for solo5.LookupLease.
+func Default() (*Stack, error) {
+	defaultStack.once.Do(func() {
+		defaultStack.s, defaultStack.err = newDefault()
+	})
+	return defaultStack.s, defaultStack.err
+}
+
+// dhcpDefaultTimeout is the default of SOLO5_DHCP_TIMEOUT.
+const dhcpDefaultTimeout = 10 * time.Second
+
+func newDefault() (*Stack, error) {
+	dhcp := map[string]bool{}
+	if v, ok := syscall.Getenv("SOLO5_DHCP"); ok {
+		for len(v) > 0 {
+			i := 0
+			for i < len(v) && v[i] != ',' {
+				i++
+			}
+			name := v[:i]
+			if _, err := solo5.Lookup(name); err != nil {
+				return nil, &parseError{"dhcp device", name}
+			}
+			dhcp[name] = true
+			if i < len(v) {
+				i++
+			}
+			v = v[i:]
+		}
+	}
+	timeout := dhcpDefaultTimeout
+	if v, ok := syscall.Getenv("SOLO5_DHCP_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, &parseError{"dhcp timeout", v}
+		}
+		timeout = d
+	}
+
+	s := New()
+	type result struct {
+		ifi *Interface
+		err error
+	}
+	results := make(chan result)
+	pending := 0
+	configured := false
+	for _, d := range solo5.Devices() {
+		if d.Type != solo5.NetBasic {
+			continue
+		}
+		l, err := solo5.OpenNet(d.Name)
+		if errors.Is(err, syscall.EBUSY) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ifi := s.AddInterface(d.Name, d.Net.MAC, d.Net.MTU, l)
+		if dhcp[d.Name] {
+			pending++
+			name := d.Name
+			go func() {
+				_, err := ifi.StartDHCP(timeout, func(lease Lease, ok bool) {
+					if ok {
+						solo5lease.Set(name, solo5Lease(lease))
+					} else {
+						solo5lease.Set(name, nil)
+					}
+				})
+				results <- result{ifi, err}
+			}()
+			continue
+		}
+		if err := configureStatic(ifi); err != nil {
+			return nil, err
+		}
+		configured = true
+	}
+	// Interfaces without a lease fall back to their static settings. One
+	// that cannot be configured does not keep the others from being used.
+	var firstErr error
+	for ; pending > 0; pending-- {
+		r := <-results
+		if r.err == nil {
+			configured = true
+			continue
+		}
+		if err := configureStatic(r.ifi); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		configured = true
+	}
+	if !configured && firstErr != nil {
+		return nil, firstErr
+	}
+	// Duplicate address detection for the link-local and static IPv6
+	// addresses takes a second, they are usable when Default returns.
+	s.waitTentative(2 * dadDelay)
+	if v, ok := syscall.Getenv("SOLO5_GATEWAY"); ok && s.Gateway() == (IP{}) {
+		ip, ok := ParseIPv4(v)
+		if !ok {
+			return nil, &parseError{"gateway", v}
+		}
+		s.SetGateway(ip)
+	}
+	return s, nil
+}
+
+// configureStatic adds the addresses of SOLO5_NET_<name> to ifi, if set.
+func configureStatic(ifi *Interface) error {
+	v, _ := syscall.Getenv("SOLO5_NET_" + ifi.Name)
+	for len(v) > 0 {
+		i := 0
+		for i < len(v) && v[i] != ',' {
+			i++
+		}
+		p, err := ParsePrefix(v[:i])
+		if err != nil {
+			return err
+		}
+		if err := ifi.AddAddr(p); err != nil {
+			return err
+		}
+		if i < len(v) {
+			i++
+		}
+		v = v[i:]
+	}
+	return nil
+}
+
+// solo5Lease returns l for solo5.LookupLease.
+func solo5Lease(l Lease) *solo5lease.Lease {
+	ip4 := func(ip IP) (a [4]byte) {
+		copy(a[:], ip[12:])
+		return a
+	}
+	sl := &solo5lease.Lease{
+		Addr:    ip4(l.Addr.IP),
+		Router:  ip4(l.Router),
+		Domain:  l.Domain,
+		Server:  ip4(l.Server),
+		Start:   l.Start,
+		Expires: l.Expires(),
+	}
+	copy(sl.Mask[:], l.Addr.Mask())
+	for _, ip := range l.DNS {
+		sl.DNS = append(sl.DNS, ip4(ip))
+	}
+	return sl
+}
@@ -0,0 +1,465 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"syscall"
+	"time"
+)
+
+// DHCPv4 client, RFC 2131. The client obtains a lease for an interface
+// without address, configures the address, default gateway and name servers
+// of the lease, and renews the lease in the background. A lease that cannot
+// be renewed or rebound before it expires is removed, and the client starts
+// over.
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	dhcpHeaderLen = 236
+	dhcpMagic     = 0x63825363
+	dhcpBroadcast = 0x8000 // Flag asking the server to broadcast its replies.
+
+	dhcpRetryMin = time.Second
+	dhcpRetryMax = 32 * time.Second
+
+	// BOOTP operations.
+	dhcpBootRequest = 1
+	dhcpBootReply   = 2
+
+	// Message types.
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+	dhcpNak      = 6
+
+	// Options.
+	dhcpOptPad         = 0
+	dhcpOptSubnetMask  = 1
+	dhcpOptRouter      = 3
+	dhcpOptDNS         = 6
+	dhcpOptDomainName  = 15
+	dhcpOptRequestedIP = 50
+	dhcpOptLeaseTime   = 51
+	dhcpOptMessageType = 53
+	dhcpOptServerID    = 54
+	dhcpOptParams      = 55
+	dhcpOptMaxSize     = 57
+	dhcpOptRenewalTime = 58
+	dhcpOptRebindTime  = 59
+	dhcpOptClientID    = 61
+	dhcpOptEnd         = 255
+)
+
+// A Lease is the configuration of an interface obtained with DHCP.
+type Lease struct {
+	Addr     Prefix // Address and network of the interface.
+	Router   IP     // Default gateway, zero if none.
+	DNS      []IP   // Name servers.
+	Domain   string // Domain name, empty if none.
+	Server   IP     // The DHCP server that granted the lease.
+	Start    time.Time
+	Duration time.Duration // Zero for a lease that does not expire.
+	Renew    time.Duration // Time after Start to renew the lease with Server.
+	Rebind   time.Duration // Time after Start to renew with any server.
+}
+
+// Expires returns the time the lease expires, zero for a lease that does
+// not expire.
+func (l Lease) Expires() time.Time {
+	if l.Duration == 0 {
+		return time.Time{}
+	}
+	return l.Start.Add(l.Duration)
+}
+
+// A dhcpMessage is a received DHCP reply.
+type dhcpMessage struct {
+	typ     byte
+	xid     uint32
+	yiaddr  IP
+	options map[byte][]byte
+}
+
+type dhcpClient struct {
+	ifi     *Interface
+	changed func(Lease, bool)
+
+	// Protected by the mutex of the stack.
+	xid   uint32 // Of the current exchange, replies for others are ignored.
+	lease Lease
+	bound bool
+	msgs  chan dhcpMessage
+}
+
+// StartDHCP obtains a lease for the interface with DHCP and configures it.
+// It waits until the lease is obtained or timeout passes. The lease is
+// renewed in the background as long as the program runs. If changed is not
+// nil, it is called each time the lease changes, with false when the lease
+// is lost.
+func (ifi *Interface) StartDHCP(timeout time.Duration, changed func(l Lease, ok bool)) (Lease, error) {
+	s := ifi.s
+	s.mu.Lock()
+	if ifi.link == nil || ifi.dhcp != nil {
+		s.unlock()
+		return Lease{}, syscall.EINVAL
+	}
+	c := &dhcpClient{ifi: ifi, changed: changed, msgs: make(chan dhcpMessage, 8)}
+	ifi.dhcp = c
+	s.mu.Unlock()
+
+	l, err := c.acquire(time.Now().Add(timeout))
+	if err != nil {
+		s.mu.Lock()
+		ifi.dhcp = nil
+		s.unlock()
+		return Lease{}, err
+	}
+	c.bind(l)
+	go c.maintain(l)
+	return l, nil
+}
+
+// Lease returns the current DHCP lease of the interface.
+func (ifi *Interface) Lease() (Lease, bool) {
+	s := ifi.s
+	s.mu.Lock()
+	defer s.unlock()
+	if ifi.dhcp == nil || !ifi.dhcp.bound {
+		return Lease{}, false
+	}
+	l := ifi.dhcp.lease
+	l.DNS = append([]IP(nil), l.DNS...)
+	return l, true
+}
+
+// acquire obtains a new lease, trying until deadline, or forever if
+// deadline is zero.
+func (c *dhcpClient) acquire(deadline time.Time) (Lease, error) {
+	for {
+		offer, err := c.exchange(dhcpDiscover, IP{}, nil, deadline)
+		if err != nil {
+			return Lease{}, err
+		}
+		opts := map[byte][]byte{
+			dhcpOptRequestedIP: offer.yiaddr[12:],
+			dhcpOptServerID:    offer.options[dhcpOptServerID],
+		}
+		reply, err := c.exchange(dhcpRequest, IP{}, opts, deadline)
+		if err != nil {
+			return Lease{}, err
+		}
+		if reply.typ == dhcpAck {
+			if l, ok := c.parseLease(reply); ok {
+				return l, nil
+			}
+		}
+		// Declined by the server, or an unusable lease: start over.
+	}
+}
+
+// maintain renews lease l before it expires, and obtains a new lease if
+// it cannot be renewed.
+func (c *dhcpClient) maintain(l Lease) {
+	for l.Duration != 0 {
+		time.Sleep(time.Until(l.Start.Add(l.Renew)))
+
+		// Renew with the server that granted the lease, and if it does
+		// not respond, with any server.
+		reply, err := c.exchange(dhcpRequest, l.Server, nil, l.Start.Add(l.Rebind))
+		if err != nil {
+			reply, err = c.exchange(dhcpRequest, IP{}, nil, l.Expires())
+		}
+		if err == nil && reply.typ == dhcpAck {
+			if nl, ok := c.parseLease(reply); ok {
+				l = nl
+				c.bind(l)
+				continue
+			}
+		}
+		c.unbind()
+		for {
+			if l, err = c.acquire(time.Time{}); err == nil {
+				break
+			}
+			time.Sleep(dhcpRetryMax)
+		}
+		c.bind(l)
+	}
+}
+
+// exchange sends a message of type typ and waits for the reply, sending
+// again with exponential backoff until deadline. A zero server broadcasts
+// the message. A discover is answered by an offer, a request by an
+// acknowledgement or a refusal.
+func (c *dhcpClient) exchange(typ byte, server IP, opts map[byte][]byte, deadline time.Time) (dhcpMessage, error) {
+	s := c.ifi.s
+	s.mu.Lock()
+	c.xid = s.rand.Uint32()
+	xid := c.xid
+	s.unlock()
+	for retry := dhcpRetryMin; ; {
+		s.mu.Lock()
+		wait := retry + time.Duration(s.rand.Int63n(int64(retry/2)))
+		s.unlock()
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return dhcpMessage{}, syscall.ETIMEDOUT
+			}
+			if wait > left {
+				wait = left
+			}
+		}
+		if err := c.send(typ, xid, server, opts); err != nil && err != syscall.ENETUNREACH {
+			return dhcpMessage{}, err
+		}
+		t := time.NewTimer(wait)
+	Wait:
+		for {
+			select {
+			case m := <-c.msgs:
+				if m.xid != xid {
+					continue
+				}
+				if typ == dhcpDiscover && m.typ == dhcpOffer || typ == dhcpRequest && (m.typ == dhcpAck || m.typ == dhcpNak) {
+					t.Stop()
+					return m, nil
+				}
+			case <-t.C:
+				break Wait
+			}
+		}
+		if retry < dhcpRetryMax {
+			retry *= 2
+		}
+	}
+}
+
+// send sends a message of type typ with options opts to server, or as
+// broadcast if server is zero.
+func (c *dhcpClient) send(typ byte, xid uint32, server IP, opts map[byte][]byte) error {
+	ifi := c.ifi
+	s := ifi.s
+	s.mu.Lock()
+	defer s.unlock()
+
+	src := IPv4(0, 0, 0, 0)
+	if c.bound {
+		src = c.lease.Addr.IP
+	}
+	b := make([]byte, udpHeaderLen+dhcpHeaderLen, udpHeaderLen+548)
+	m := b[udpHeaderLen:]
+	m[0] = dhcpBootRequest
+	m[1] = 1 // Ethernet.
+	m[2] = 6 // Length of hardware address.
+	put32(m[4:], xid)
+	if c.bound {
+		copy(m[12:16], src[12:])
+	} else {
+		put16(m[10:], dhcpBroadcast)
+	}
+	copy(m[28:], ifi.MAC[:])
+	b = append(b, 0, 0, 0, 0)
+	put32(b[len(b)-4:], dhcpMagic)
+	b = append(b, dhcpOptMessageType, 1, typ)
+	b = append(b, dhcpOptClientID, 7, 1)
+	b = append(b, ifi.MAC[:]...)
+	b = append(b, dhcpOptMaxSize, 2, byte(ifi.MTU>>8), byte(ifi.MTU))
+	b = append(b, dhcpOptParams, 7, dhcpOptSubnetMask, dhcpOptRouter, dhcpOptDNS, dhcpOptDomainName, dhcpOptLeaseTime, dhcpOptRenewalTime, dhcpOptRebindTime)
+	for _, o := range []byte{dhcpOptRequestedIP, dhcpOptServerID} {
+		if v := opts[o]; len(v) > 0 {
+			b = append(b, o, byte(len(v)))
+			b = append(b, v...)
+		}
+	}
+	b = append(b, dhcpOptEnd)
+
+	dst := server
+	if dst == (IP{}) {
+		dst = IPv4(255, 255, 255, 255)
+	}
+	put16(b[0:], dhcpClientPort)
+	put16(b[2:], dhcpServerPort)
+	put16(b[4:], uint16(len(b)))
+	put16(b[6:], checksum(b, pseudoHeaderSum(src, dst, protoUDP, len(b))))
+	if server == (IP{}) {
+		return s.sendIPv4Via(ifi, dst, src, dst, protoUDP, b)
+	}
+	return s.sendIPv4(src, dst, protoUDP, b)
+}
+
+// input processes a UDP datagram b for the DHCP client port, from src to
+// dst.
+//
+// s.mu must be held.
+func (c *dhcpClient) input(src, dst IP, b []byte) {
+	n := int(be16(b[4:]))
+	if n < udpHeaderLen+dhcpHeaderLen+4 || n > len(b) {
+		return
+	}
+	b = b[:n]
+	if be16(b[6:]) != 0 && checksum(b, pseudoHeaderSum(src, dst, protoUDP, n)) != 0 {
+		return
+	}
+	m := b[udpHeaderLen:]
+	if m[0] != dhcpBootReply || m[1] != 1 || m[2] != 6 || string(m[28:34]) != string(c.ifi.MAC[:]) || be32(m[4:]) != c.xid || be32(m[dhcpHeaderLen:]) != dhcpMagic {
+		return
+	}
+	msg := dhcpMessage{
+		xid:     be32(m[4:]),
+		yiaddr:  IPv4(m[16], m[17], m[18], m[19]),
+		options: map[byte][]byte{},
+	}
+	for o := m[dhcpHeaderLen+4:]; len(o) > 0 && o[0] != dhcpOptEnd; {
+		if o[0] == dhcpOptPad {
+			o = o[1:]
+			continue
+		}
+		if len(o) < 2 || len(o) < 2+int(o[1]) {
+			return
+		}
+		code, v := o[0], o[2:2+int(o[1])]
+		// Options that are too long for one are split, RFC 3396.
+		msg.options[code] = append(msg.options[code], v...)
+		o = o[2+len(v):]
+	}
+	if t := msg.options[dhcpOptMessageType]; len(t) == 1 {
+		msg.typ = t[0]
+	}
+	select {
+	case c.msgs <- msg:
+	default:
+	}
+}
+
+// parseLease returns the lease of acknowledgement m.
+func (c *dhcpClient) parseLease(m dhcpMessage) (Lease, bool) {
+	l := Lease{
+		Addr:  Prefix{m.yiaddr, 24},
+		Start: time.Now(),
+	}
+	if l.Addr.IP.IsUnspecified() || l.Addr.IP.IsBroadcast() || l.Addr.IP.IsMulticast() {
+		return Lease{}, false
+	}
+	if ip, ok := dhcpIPs(m.options[dhcpOptServerID]); ok {
+		l.Server = ip[0]
+	}
+	if mask := m.options[dhcpOptSubnetMask]; len(mask) == 4 {
+		l.Addr.Len = 0
+		for v := be32(mask); v&(1<<31) != 0; v <<= 1 {
+			l.Addr.Len++
+		}
+	}
+	if ip, ok := dhcpIPs(m.options[dhcpOptRouter]); ok {
+		l.Router = ip[0]
+	}
+	l.DNS, _ = dhcpIPs(m.options[dhcpOptDNS])
+	l.Domain = string(m.options[dhcpOptDomainName])
+	for len(l.Domain) > 0 && l.Domain[len(l.Domain)-1] == 0 {
+		l.Domain = l.Domain[:len(l.Domain)-1]
+	}
+
+	seconds := func(code byte) (time.Duration, bool) {
+		v := m.options[code]
+		if len(v) != 4 {
+			return 0, false
+		}
+		return time.Duration(be32(v)) * time.Second, true
+	}
+	d, ok := seconds(dhcpOptLeaseTime)
+	if !ok || d == 0xffffffff*time.Second {
+		// Without lease time, the lease does not expire.
+		return l, true
+	}
+	l.Duration = d
+	l.Renew = l.Duration / 2
+	l.Rebind = l.Duration * 7 / 8
+	if d, ok := seconds(dhcpOptRenewalTime); ok && d < l.Duration {
+		l.Renew = d
+	}
+	if d, ok := seconds(dhcpOptRebindTime); ok && d > l.Renew && d < l.Duration {
+		l.Rebind = d
+	}
+	if l.Rebind < l.Renew {
+		l.Rebind = l.Renew
+	}
+	return l, true
+}
+
+// dhcpIPs returns the IPv4 addresses of option value v.
+func dhcpIPs(v []byte) ([]IP, bool) {
+	if len(v) == 0 || len(v)%4 != 0 {
+		return nil, false
+	}
+	var l []IP
+	for ; len(v) > 0; v = v[4:] {
+		l = append(l, IPv4(v[0], v[1], v[2], v[3]))
+	}
+	return l, true
+}
+
+// bind configures the interface with lease l, replacing a previous lease.
+func (c *dhcpClient) bind(l Lease) {
+	s := c.ifi.s
+	s.mu.Lock()
+	c.remove()
+	c.lease = l
+	c.bound = true
+	c.ifi.addrs = append(c.ifi.addrs, l.Addr)
+	c.ifi.arpRequest(l.Addr.IP, l.Addr.IP)
+	if l.Router != (IP{}) {
+		s.gateway = l.Router
+	}
+	if len(l.DNS) > 0 {
+		s.dns = append([]IP(nil), l.DNS...)
+		s.search = nil
+		if l.Domain != "" {
+			s.search = []string{l.Domain}
+		}
+	}
+	s.unlock()
+	if c.changed != nil {
+		c.changed(l, true)
+	}
+}
+
+// unbind removes the configuration of the lease from the interface.
+func (c *dhcpClient) unbind() {
+	s := c.ifi.s
+	s.mu.Lock()
+	c.remove()
+	s.unlock()
+	if c.changed != nil {
+		c.changed(Lease{}, false)
+	}
+}
+
+// remove removes the configuration of the current lease.
+//
+// s.mu must be held.
+func (c *dhcpClient) remove() {
+	if !c.bound {
+		return
+	}
+	s := c.ifi.s
+	l := c.lease
+	c.bound = false
+	for i, p := range c.ifi.addrs {
+		if p == l.Addr {
+			c.ifi.addrs = append(c.ifi.addrs[:i:i], c.ifi.addrs[i+1:]...)
+			break
+		}
+	}
+	if l.Router != (IP{}) && s.gateway == l.Router {
+		s.gateway = IP{}
+	}
+	if len(l.DNS) > 0 && len(s.dns) == len(l.DNS) && s.dns[0] == l.DNS[0] {
+		s.dns = nil
+		s.search = nil
+	}
+}
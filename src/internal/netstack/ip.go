@@ -0,0 +1,376 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"strconv"
+)
+
+// An IP is an IPv6 address, or an IPv4 address in IPv4-mapped IPv6 form.
+type IP [16]byte
+
+var v4InV6Prefix = [12]byte{10: 0xff, 11: 0xff}
+
+// IPv4 returns the IP for IPv4 address a.b.c.d.
+func IPv4(a, b, c, d byte) IP {
+	var ip IP
+	copy(ip[:], v4InV6Prefix[:])
+	ip[12], ip[13], ip[14], ip[15] = a, b, c, d
+	return ip
+}
+
+// IPFromSlice returns the IP for a 4 or 16 byte address.
+func IPFromSlice(b []byte) (ip IP, ok bool) {
+	switch len(b) {
+	case 4:
+		return IPv4(b[0], b[1], b[2], b[3]), true
+	case 16:
+		copy(ip[:], b)
+		return ip, true
+	}
+	return ip, false
+}
+
+// Is4 reports whether ip is an IPv4 address.
+func (ip IP) Is4() bool {
+	return [12]byte{ip[0], ip[1], ip[2], ip[3], ip[4], ip[5], ip[6], ip[7], ip[8], ip[9], ip[10], ip[11]} == v4InV6Prefix
+}
+
+// IsUnspecified reports whether ip is 0.0.0.0 or ::.
+func (ip IP) IsUnspecified() bool {
+	return ip == IP{} || ip == IPv4(0, 0, 0, 0)
+}
+
+// IsLoopback reports whether ip is in 127.0.0.0/8 or is ::1.
+func (ip IP) IsLoopback() bool {
+	if ip.Is4() {
+		return ip[12] == 127
+	}
+	return ip == IP{15: 1}
+}
+
+// IsBroadcast reports whether ip is the limited broadcast address 255.255.255.255.
+func (ip IP) IsBroadcast() bool {
+	return ip == IPv4(255, 255, 255, 255)
+}
+
+// IsLinkLocal reports whether ip is an IPv6 link-local unicast address, in
+// fe80::/10.
+func (ip IP) IsLinkLocal() bool {
+	return ip[0] == 0xfe && ip[1]&0xc0 == 0x80
+}
+
+// IsMulticast reports whether ip is an IPv4 or IPv6 multicast address.
+func (ip IP) IsMulticast() bool {
+	if ip.Is4() {
+		return ip[12]&0xf0 == 0xe0
+	}
+	return ip[0] == 0xff
+}
+
+// String returns the dotted decimal form of an IPv4 address, or the
+// hexadecimal form of an IPv6 address without zero compression.
+func (ip IP) String() string {
+	if ip.Is4() {
+		b := make([]byte, 0, len("255.255.255.255"))
+		for i := 12; i < 16; i++ {
+			if i > 12 {
+				b = append(b, '.')
+			}
+			b = strconv.AppendUint(b, uint64(ip[i]), 10)
+		}
+		return string(b)
+	}
+	b := make([]byte, 0, len("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))
+	for i := 0; i < 16; i += 2 {
+		if i > 0 {
+			b = append(b, ':')
+		}
+		b = strconv.AppendUint(b, uint64(ip[i])<<8|uint64(ip[i+1]), 16)
+	}
+	return string(b)
+}
+
+// An Addr is an IP address with a port.
+type Addr struct {
+	IP   IP
+	Port int
+}
+
+func (a Addr) String() string {
+	if a.IP.Is4() {
+		return a.IP.String() + ":" + strconv.Itoa(a.Port)
+	}
+	return "[" + a.IP.String() + "]:" + strconv.Itoa(a.Port)
+}
+
+// A Prefix is an IP address with a prefix length, in bits, counted from the
+// start of the IPv4 address for IPv4 addresses.
+type Prefix struct {
+	IP  IP
+	Len int
+}
+
+// Contains reports whether ip is in the network of p.
+func (p Prefix) Contains(ip IP) bool {
+	if p.IP.Is4() != ip.Is4() {
+		return false
+	}
+	bits := p.Len
+	if p.IP.Is4() {
+		bits += 96
+	}
+	for i := 0; bits > 0; i++ {
+		m := byte(0xff)
+		if bits < 8 {
+			m <<= uint(8 - bits)
+		}
+		if p.IP[i]&m != ip[i]&m {
+			return false
+		}
+		bits -= 8
+	}
+	return true
+}
+
+// Mask returns the network mask of p, 4 bytes for IPv4 and 16 bytes for IPv6.
+func (p Prefix) Mask() []byte {
+	n := 16
+	if p.IP.Is4() {
+		n = 4
+	}
+	m := make([]byte, n)
+	for i, bits := 0, p.Len; bits > 0 && i < n; i++ {
+		if bits >= 8 {
+			m[i] = 0xff
+		} else {
+			m[i] = 0xff << uint(8-bits)
+		}
+		bits -= 8
+	}
+	return m
+}
+
+// broadcast returns the directed broadcast address of IPv4 prefix p.
+func (p Prefix) broadcast() IP {
+	ip := p.IP
+	m := p.Mask()
+	for i := range m {
+		ip[12+i] |= ^m[i]
+	}
+	return ip
+}
+
+func (p Prefix) String() string {
+	return p.IP.String() + "/" + strconv.Itoa(p.Len)
+}
+
+// ParsePrefix parses an IPv4 or IPv6 prefix like "10.0.0.2/24" or
+// "2001:db8::2/64".
+func ParsePrefix(s string) (Prefix, error) {
+	i := 0
+	for i < len(s) && s[i] != '/' {
+		i++
+	}
+	ip, ok := ParseIP(s[:i])
+	if !ok || i == len(s) {
+		return Prefix{}, &parseError{"prefix", s}
+	}
+	max := 128
+	if ip.Is4() {
+		max = 32
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	if err != nil || n < 0 || n > max {
+		return Prefix{}, &parseError{"prefix", s}
+	}
+	return Prefix{ip, n}, nil
+}
+
+// ParseIP parses an IPv4 address in dotted decimal form, or an IPv6 address
+// in the forms of RFC 4291, without zone.
+func ParseIP(s string) (IP, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' {
+			return ParseIPv6(s)
+		}
+	}
+	return ParseIPv4(s)
+}
+
+// ParseIPv6 parses an IPv6 address in the forms of RFC 4291, with "::" for
+// zeros and optionally an IPv4 address at the end, without zone.
+func ParseIPv6(s string) (IP, bool) {
+	var ip IP
+	ellipsis := -1 // Position of "::" in ip.
+	if len(s) >= 2 && s[0] == ':' && s[1] == ':' {
+		ellipsis = 0
+		s = s[2:]
+	}
+	i := 0
+	for i < 16 && s != "" {
+		// An IPv4 address in the last 4 bytes.
+		j := 0
+		for j < len(s) && s[j] != ':' && s[j] != '.' {
+			j++
+		}
+		if j < len(s) && s[j] == '.' {
+			if ellipsis < 0 && i != 12 || i > 12 {
+				return IP{}, false
+			}
+			ip4, ok := ParseIPv4(s)
+			if !ok {
+				return IP{}, false
+			}
+			copy(ip[i:], ip4[12:])
+			i += 4
+			s = ""
+			break
+		}
+		n := 0
+		for j = 0; j < len(s) && j < 4; j++ {
+			c := s[j]
+			switch {
+			case '0' <= c && c <= '9':
+				n = n<<4 | int(c-'0')
+			case 'a' <= c && c <= 'f':
+				n = n<<4 | int(c-'a'+10)
+			case 'A' <= c && c <= 'F':
+				n = n<<4 | int(c-'A'+10)
+			default:
+				goto end
+			}
+		}
+	end:
+		if j == 0 {
+			return IP{}, false
+		}
+		ip[i], ip[i+1] = byte(n>>8), byte(n)
+		i += 2
+		s = s[j:]
+		if s == "" {
+			break
+		}
+		if s[0] != ':' || len(s) == 1 {
+			return IP{}, false
+		}
+		s = s[1:]
+		if s[0] == ':' {
+			if ellipsis >= 0 {
+				return IP{}, false
+			}
+			ellipsis = i
+			s = s[1:]
+		}
+	}
+	if s != "" {
+		return IP{}, false
+	}
+	if i < 16 {
+		if ellipsis < 0 {
+			return IP{}, false
+		}
+		n := 16 - i
+		copy(ip[ellipsis+n:], ip[ellipsis:i])
+		for j := ellipsis; j < ellipsis+n; j++ {
+			ip[j] = 0
+		}
+	} else if ellipsis >= 0 {
+		return IP{}, false
+	}
+	return ip, true
+}
+
+// ParseIPv4 parses an IPv4 address in dotted decimal form.
+func ParseIPv4(s string) (IP, bool) {
+	var b [4]byte
+	for i := 0; i < 4; i++ {
+		if i > 0 {
+			if s == "" || s[0] != '.' {
+				return IP{}, false
+			}
+			s = s[1:]
+		}
+		n, j := 0, 0
+		for j < len(s) && j < 3 && s[j] >= '0' && s[j] <= '9' {
+			n = n*10 + int(s[j]-'0')
+			j++
+		}
+		if j == 0 || n > 255 {
+			return IP{}, false
+		}
+		b[i] = byte(n)
+		s = s[j:]
+	}
+	if s != "" {
+		return IP{}, false
+	}
+	return IPv4(b[0], b[1], b[2], b[3]), true
+}
+
+type parseError struct {
+	what string
+	s    string
+}
+
+func (e *parseError) Error() string {
+	return "netstack: invalid " + e.what + " " + strconv.Quote(e.s)
+}
+
+// checksum returns the internet checksum of b, continuing from initial
+// partial sum sum.
+func checksum(b []byte, sum uint32) uint16 {
+	for len(b) >= 2 {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// pseudoHeaderSum returns the partial checksum of the pseudo header for an
+// upper layer protocol.
+func pseudoHeaderSum(src, dst IP, proto byte, length int) uint32 {
+	var sum uint32
+	add := func(ip IP) {
+		b := ip[:]
+		if ip.Is4() {
+			b = b[12:]
+		}
+		for i := 0; i < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+	}
+	add(src)
+	add(dst)
+	sum += uint32(proto)
+	sum += uint32(length>>16) + uint32(length&0xffff)
+	return sum
+}
+
+func be16(b []byte) uint16 {
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func put16(b []byte, v uint16) {
+	b[0] = byte(v >> 8)
+	b[1] = byte(v)
+}
+
+func put32(b []byte, v uint32) {
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v)
+}
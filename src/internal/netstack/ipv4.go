@@ -0,0 +1,188 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"syscall"
+)
+
+const (
+	ipv4HeaderLen  = 20
+	ipv4DefaultTTL = 64
+
+	protoICMP = 1
+	protoTCP  = 6
+	protoUDP  = 17
+
+	icmpEchoReply       = 0
+	icmpDestUnreachable = 3
+	icmpEchoRequest     = 8
+
+	icmpCodePortUnreachable = 3
+)
+
+// inputIPv4 processes an IPv4 packet received on ifi.
+func (s *Stack) inputIPv4(ifi *Interface, b []byte) {
+	if len(b) < ipv4HeaderLen || b[0]>>4 != 4 {
+		return
+	}
+	hlen := int(b[0]&0xf) * 4
+	total := int(be16(b[2:]))
+	if hlen < ipv4HeaderLen || total < hlen || total > len(b) || checksum(b[:hlen], 0) != 0 {
+		return
+	}
+	b = b[:total]
+	if be16(b[6:])&0x3fff != 0 {
+		// Fragments are not reassembled. We send with "don't fragment".
+		return
+	}
+	src := IPv4(b[12], b[13], b[14], b[15])
+	dst := IPv4(b[16], b[17], b[18], b[19])
+	if !s.acceptIPv4(ifi, dst) {
+		return
+	}
+	payload := b[hlen:]
+	if b[9] == protoUDP && ifi.dhcp != nil && len(payload) >= udpHeaderLen && be16(payload[2:]) == dhcpClientPort {
+		ifi.dhcp.input(src, dst, payload)
+		return
+	}
+	switch b[9] {
+	case protoICMP:
+		s.inputICMPv4(src, dst, payload)
+	case protoTCP:
+		s.inputTCP(src, dst, payload)
+	case protoUDP:
+		s.inputUDP(src, dst, payload, b)
+	}
+}
+
+// acceptIPv4 reports whether packets for dst received on ifi are for us.
+func (s *Stack) acceptIPv4(ifi *Interface, dst IP) bool {
+	if ifi.link == nil {
+		return s.isLocal(dst)
+	}
+	if dst.IsBroadcast() || ifi.hasAddr(dst) {
+		return true
+	}
+	p, ok := ifi.addr4()
+	if !ok {
+		// Without an address, e.g. during DHCP, accept everything, only
+		// UDP endpoints bound to the wildcard address will match.
+		return true
+	}
+	return dst == p.broadcast()
+}
+
+// isBroadcast reports whether dst is a broadcast address for one of the
+// interfaces.
+func (s *Stack) isBroadcast(dst IP) bool {
+	if dst.IsBroadcast() {
+		return true
+	}
+	for _, ifi := range s.ifaces[1:] {
+		for _, p := range ifi.addrs {
+			if p.IP.Is4() && p.Len < 31 && dst == p.broadcast() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendIPv4 sends an IPv4 packet with payload b from src to dst.
+func (s *Stack) sendIPv4(src, dst IP, proto byte, b []byte) error {
+	ifi, nexthop, _, err := s.route(dst)
+	if err != nil {
+		return err
+	}
+	return s.sendIPv4Via(ifi, nexthop, src, dst, proto, b)
+}
+
+// sendIPv4Via sends an IPv4 packet with payload b from src to dst on ifi,
+// to neighbor nexthop.
+func (s *Stack) sendIPv4Via(ifi *Interface, nexthop, src, dst IP, proto byte, b []byte) error {
+	n := ipv4HeaderLen + len(b)
+	if n > 0xffff || n > ifi.MTU {
+		return syscall.EMSGSIZE
+	}
+	var frame []byte
+	if ifi.link == nil {
+		frame = make([]byte, n)
+	} else {
+		frame = ifi.newFrame(ethTypeIPv4, n)
+	}
+	p := frame[len(frame)-n:]
+	p[0] = 4<<4 | ipv4HeaderLen/4
+	put16(p[2:], uint16(n))
+	s.ipID++
+	put16(p[4:], s.ipID)
+	put16(p[6:], 0x4000) // Don't fragment.
+	p[8] = ipv4DefaultTTL
+	p[9] = proto
+	copy(p[12:16], src[12:])
+	copy(p[16:20], dst[12:])
+	put16(p[10:], checksum(p[:ipv4HeaderLen], 0))
+	copy(p[ipv4HeaderLen:], b)
+
+	if ifi.link == nil {
+		s.loopq = append(s.loopq, p)
+		return nil
+	}
+	if s.isBroadcast(dst) {
+		copy(frame, broadcastMAC[:])
+		return ifi.link.WriteFrame(frame)
+	}
+	return ifi.send(nexthop, frame)
+}
+
+func (s *Stack) inputICMPv4(src, dst IP, b []byte) {
+	if len(b) < 8 || checksum(b, 0) != 0 {
+		return
+	}
+	switch b[0] {
+	case icmpEchoRequest:
+		if s.isBroadcast(dst) {
+			return
+		}
+		reply := make([]byte, len(b))
+		copy(reply, b)
+		reply[0] = icmpEchoReply
+		put16(reply[2:], 0)
+		put16(reply[2:], checksum(reply, 0))
+		s.sendIPv4(dst, src, protoICMP, reply)
+
+	case icmpDestUnreachable:
+		// The original IP header and the start of its payload follow.
+		orig := b[8:]
+		if b[1] != icmpCodePortUnreachable || len(orig) < ipv4HeaderLen+8 || orig[9] != protoUDP {
+			return
+		}
+		hlen := int(orig[0]&0xf) * 4
+		if hlen < ipv4HeaderLen || len(orig) < hlen+8 {
+			return
+		}
+		osrc := IPv4(orig[12], orig[13], orig[14], orig[15])
+		odst := IPv4(orig[16], orig[17], orig[18], orig[19])
+		u := orig[hlen:]
+		s.udpUnreachable(Addr{osrc, int(be16(u[0:]))}, Addr{odst, int(be16(u[2:]))})
+	}
+}
+
+// sendICMPv4Unreachable sends a destination unreachable message with code
+// in response to IP packet pkt.
+func (s *Stack) sendICMPv4Unreachable(code byte, src, dst IP, pkt []byte) {
+	if s.isBroadcast(dst) || dst.IsMulticast() {
+		return
+	}
+	if len(pkt) > ipv4HeaderLen+8 {
+		pkt = pkt[:ipv4HeaderLen+8]
+	}
+	b := make([]byte, 8+len(pkt))
+	b[0] = icmpDestUnreachable
+	b[1] = code
+	copy(b[8:], pkt)
+	put16(b[2:], checksum(b, 0))
+	s.sendIPv4(dst, src, protoICMP, b)
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"syscall"
+)
+
+const (
+	ipv6HeaderLen       = 40
+	ipv6DefaultHopLimit = 64
+	ipv6MinMTU          = 1280
+
+	protoHopOpts  = 0
+	protoRouting  = 43
+	protoFragment = 44
+	protoICMPv6   = 58
+	protoDestOpts = 60
+
+	icmp6DestUnreachable = 1
+	icmp6ParamProblem    = 4
+	icmp6EchoRequest     = 128
+	icmp6EchoReply       = 129
+
+	icmp6CodeErroneousHeaderField = 0
+	icmp6CodeUnknownNextHeader    = 1
+	icmp6CodePortUnreachable      = 4
+)
+
+// inputIPv6 processes an IPv6 packet received on ifi.
+func (s *Stack) inputIPv6(ifi *Interface, b []byte) {
+	if len(b) < ipv6HeaderLen || b[0]>>4 != 6 {
+		return
+	}
+	n := ipv6HeaderLen + int(be16(b[4:]))
+	if n > len(b) {
+		return
+	}
+	b = b[:n]
+	var src, dst IP
+	copy(src[:], b[8:24])
+	copy(dst[:], b[24:40])
+	if src.IsMulticast() || src.Is4() || dst.Is4() || !s.acceptIPv6(ifi, dst) {
+		return
+	}
+	sendErrors := icmp6ErrorAllowed(src, dst)
+
+	// Skip the extension headers we can ignore. Fragments are not
+	// reassembled, we never send packets larger than the path MTU.
+	next, off := b[6], ipv6HeaderLen
+	ptr := 6 // Offset of the field with the next header.
+	for {
+		switch next {
+		case protoHopOpts, protoDestOpts, protoRouting:
+			if off+8 > len(b) {
+				return
+			}
+			if next == protoRouting && b[off+3] != 0 {
+				// Segments left, we are not the final destination.
+				if sendErrors {
+					s.sendICMPv6Error(icmp6ParamProblem, icmp6CodeErroneousHeaderField, uint32(off+3), src, dst, b)
+				}
+				return
+			}
+			ptr = off
+			next, off = b[off], off+(int(b[off+1])+1)*8
+			if off > len(b) {
+				return
+			}
+			continue
+		case protoFragment:
+			return
+		}
+		break
+	}
+
+	payload := b[off:]
+	switch next {
+	case protoICMPv6:
+		s.inputICMPv6(ifi, src, dst, b[7], payload)
+	case protoTCP:
+		s.inputTCP(src, dst, payload)
+	case protoUDP:
+		s.inputUDP(src, dst, payload, b)
+	default:
+		if sendErrors {
+			s.sendICMPv6Error(icmp6ParamProblem, icmp6CodeUnknownNextHeader, uint32(ptr), src, dst, b)
+		}
+	}
+}
+
+// icmp6ErrorAllowed reports whether ICMPv6 errors may be sent in response
+// to a packet from src to dst. RFC 4443 section 2.4 (e) forbids them for
+// packets to a multicast address, except for the packet too big messages
+// and parameter problems with code 2 that the stack does not send, and for
+// packets from an address that does not identify a single node, such as
+// the unspecified address.
+func icmp6ErrorAllowed(src, dst IP) bool {
+	return !dst.IsMulticast() && src != (IP{})
+}
+
+// acceptIPv6 reports whether packets for dst received on ifi are for us.
+func (s *Stack) acceptIPv6(ifi *Interface, dst IP) bool {
+	if ifi.link == nil {
+		return s.isLocal(dst)
+	}
+	if ifi.hasAddr(dst) || dst == allNodes {
+		return true
+	}
+	if dst.IsMulticast() {
+		for _, p := range ifi.addrs {
+			if dst == solicitedNode(p.IP) {
+				return true
+			}
+		}
+		for ip := range ifi.tentative {
+			if dst == solicitedNode(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendIPv6Via sends an IPv6 packet with payload b from src to dst on ifi, to
+// neighbor nexthop. Packets to multicast addresses are sent to the
+// corresponding multicast hardware address.
+func (s *Stack) sendIPv6Via(ifi *Interface, nexthop, src, dst IP, proto, hopLimit byte, b []byte) error {
+	n := ipv6HeaderLen + len(b)
+	if len(b) > 0xffff || n > ifi.MTU {
+		return syscall.EMSGSIZE
+	}
+	var frame []byte
+	if ifi.link == nil {
+		frame = make([]byte, n)
+	} else {
+		frame = ifi.newFrame(ethTypeIPv6, n)
+	}
+	p := frame[len(frame)-n:]
+	p[0] = 6 << 4
+	put16(p[4:], uint16(len(b)))
+	p[6] = proto
+	p[7] = hopLimit
+	copy(p[8:24], src[:])
+	copy(p[24:40], dst[:])
+	copy(p[ipv6HeaderLen:], b)
+
+	if ifi.link == nil {
+		s.loopq = append(s.loopq, p)
+		return nil
+	}
+	if dst.IsMulticast() {
+		mac := multicastMAC(dst)
+		copy(frame, mac[:])
+		return ifi.link.WriteFrame(frame)
+	}
+	return ifi.send(nexthop, frame)
+}
+
+// sendIP sends an IPv4 or IPv6 packet with payload b from src to dst.
+func (s *Stack) sendIP(src, dst IP, proto byte, b []byte) error {
+	ifi, nexthop, _, err := s.route(dst)
+	if err != nil {
+		return err
+	}
+	if dst.Is4() {
+		return s.sendIPv4Via(ifi, nexthop, src, dst, proto, b)
+	}
+	return s.sendIPv6Via(ifi, nexthop, src, dst, proto, ipv6DefaultHopLimit, b)
+}
+
+// ipHeaderLen returns the length of the IP header without options for
+// packets to ip.
+func ipHeaderLen(ip IP) int {
+	if ip.Is4() {
+		return ipv4HeaderLen
+	}
+	return ipv6HeaderLen
+}
+
+func (s *Stack) inputICMPv6(ifi *Interface, src, dst IP, hopLimit byte, b []byte) {
+	if len(b) < 4 || checksum(b, pseudoHeaderSum(src, dst, protoICMPv6, len(b))) != 0 {
+		return
+	}
+	switch b[0] {
+	case icmp6EchoRequest:
+		if len(b) < 8 {
+			return
+		}
+		from := dst
+		if dst.IsMulticast() {
+			var err error
+			if _, _, from, err = s.route(src); err != nil {
+				return
+			}
+		}
+		reply := make([]byte, len(b))
+		copy(reply, b)
+		reply[0] = icmp6EchoReply
+		put16(reply[2:], 0)
+		put16(reply[2:], checksum(reply, pseudoHeaderSum(from, src, protoICMPv6, len(reply))))
+		s.sendIP(from, src, protoICMPv6, reply)
+
+	case icmp6DestUnreachable:
+		// As much of the original packet as fits follows, we only look
+		// at UDP directly after the IPv6 header.
+		if len(b) < 8+ipv6HeaderLen+8 || b[1] != icmp6CodePortUnreachable {
+			return
+		}
+		orig := b[8:]
+		if orig[6] != protoUDP {
+			return
+		}
+		var osrc, odst IP
+		copy(osrc[:], orig[8:24])
+		copy(odst[:], orig[24:40])
+		u := orig[ipv6HeaderLen:]
+		s.udpUnreachable(Addr{osrc, int(be16(u[0:]))}, Addr{odst, int(be16(u[2:]))})
+
+	case ndpRouterAdvert, ndpNeighborSolicit, ndpNeighborAdvert:
+		if ifi.link != nil {
+			ifi.inputNDP(src, dst, hopLimit, b)
+		}
+	}
+}
+
+// sendICMPv6Error sends an ICMPv6 error message of type typ with code and
+// parameter param in response to IPv6 packet pkt, as much of it as fits in
+// the minimum MTU. As required by RFC 4443, no errors are sent for errors or
+// when icmp6ErrorAllowed forbids them.
+func (s *Stack) sendICMPv6Error(typ, code byte, param uint32, src, dst IP, pkt []byte) {
+	if !icmp6ErrorAllowed(src, dst) || pkt[6] == protoICMPv6 && len(pkt) > ipv6HeaderLen && pkt[ipv6HeaderLen] < 128 {
+		return
+	}
+	if max := ipv6MinMTU - ipv6HeaderLen - 8; len(pkt) > max {
+		pkt = pkt[:max]
+	}
+	b := make([]byte, 8+len(pkt))
+	b[0] = typ
+	b[1] = code
+	put32(b[4:], param)
+	copy(b[8:], pkt)
+	put16(b[2:], checksum(b, pseudoHeaderSum(dst, src, protoICMPv6, len(b))))
+	s.sendIP(dst, src, protoICMPv6, b)
+}
+
+// sendUnreachable sends an ICMP port unreachable message in response to IP
+// packet pkt from src to dst.
+func (s *Stack) sendUnreachable(src, dst IP, pkt []byte) {
+	if src.Is4() {
+		s.sendICMPv4Unreachable(icmpCodePortUnreachable, src, dst, pkt)
+	} else {
+		s.sendICMPv6Error(icmp6DestUnreachable, icmp6CodePortUnreachable, 0, src, dst, pkt)
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"time"
+)
+
+// Neighbor discovery, RFC 4861, and stateless address autoconfiguration,
+// RFC 4862. Each Ethernet interface gets a link-local address derived from
+// its MAC address. Addresses are only used after duplicate address
+// detection. Once the link-local address is usable, routers are solicited,
+// and router advertisements configure the IPv6 default router, addresses
+// for prefixes with the autonomous flag, and name servers (RFC 8106).
+//
+// Multicast listener reports are not sent, links are assumed to deliver all
+// multicast frames. The neighbor cache is the ARP cache, without the
+// reachability states of RFC 4861.
+
+const (
+	ndpRouterSolicit   = 133
+	ndpRouterAdvert    = 134
+	ndpNeighborSolicit = 135
+	ndpNeighborAdvert  = 136
+
+	ndpOptSourceLL = 1
+	ndpOptTargetLL = 2
+	ndpOptPrefix   = 3
+	ndpOptRDNSS    = 25
+
+	ndpHopLimit = 255
+
+	naSolicited = 0x40
+	naOverride  = 0x20
+
+	prefixOnLink     = 0x80
+	prefixAutonomous = 0x40
+
+	rsInterval = 4 * time.Second
+	rsTries    = 3
+)
+
+// dadDelay is how long to wait for a reply to the neighbor solicitation for a
+// tentative address before using it. Tests lower it.
+var dadDelay = time.Second
+
+var (
+	allNodes   = IP{0: 0xff, 1: 2, 15: 1}
+	allRouters = IP{0: 0xff, 1: 2, 15: 2}
+)
+
+// A tentativeAddr is an address for which duplicate address detection is in
+// progress.
+type tentativeAddr struct {
+	p     Prefix
+	valid time.Duration // Lifetime once assigned, zero for infinite.
+	timer *time.Timer
+}
+
+// solicitedNode returns the solicited-node multicast address for ip.
+func solicitedNode(ip IP) IP {
+	return IP{0: 0xff, 1: 2, 11: 1, 12: 0xff, 13: ip[13], 14: ip[14], 15: ip[15]}
+}
+
+// multicastMAC returns the Ethernet address for IPv6 multicast address ip.
+func multicastMAC(ip IP) [6]byte {
+	return [6]byte{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}
+}
+
+// withInterfaceID returns the address in the /64 prefix of ip with the
+// modified EUI-64 interface identifier for mac.
+func withInterfaceID(ip IP, mac [6]byte) IP {
+	ip[8], ip[9], ip[10] = mac[0]^2, mac[1], mac[2]
+	ip[11], ip[12] = 0xff, 0xfe
+	ip[13], ip[14], ip[15] = mac[3], mac[4], mac[5]
+	return ip
+}
+
+// addr6 returns the IPv6 address of ifi to use as source for packets to dst:
+// a global address for a global destination, the link-local address
+// otherwise.
+func (ifi *Interface) addr6(dst IP) (IP, bool) {
+	local := dst.IsLinkLocal() || dst.IsMulticast()
+	for _, p := range ifi.addrs {
+		if !p.IP.Is4() && p.IP.IsLinkLocal() == local {
+			return p.IP, true
+		}
+	}
+	return IP{}, false
+}
+
+// addTentative starts duplicate address detection for p. The address is
+// added to ifi when no other node claims it within dadDelay. An address
+// with a nonzero valid lifetime is removed when it expires.
+func (ifi *Interface) addTentative(p Prefix, valid time.Duration) {
+	if ifi.tentative[p.IP] != nil || ifi.hasAddr(p.IP) {
+		return
+	}
+	t := &tentativeAddr{p: p, valid: valid}
+	ifi.tentative[p.IP] = t
+	ifi.sendNS(IP{}, solicitedNode(p.IP), p.IP)
+	t.timer = time.AfterFunc(dadDelay, func() {
+		s := ifi.s
+		s.mu.Lock()
+		defer s.unlock()
+		if ifi.tentative[p.IP] != t {
+			return
+		}
+		delete(ifi.tentative, p.IP)
+		ifi.addrs = append(ifi.addrs, p)
+		ifi.setLifetime(p.IP, t.valid)
+		if p.IP.IsLinkLocal() {
+			ifi.solicitRouters()
+		}
+	})
+}
+
+// waitTentative waits at most d until no interface has tentative addresses.
+func (s *Stack) waitTentative(d time.Duration) {
+	deadline := time.Now().Add(d)
+	for {
+		s.mu.Lock()
+		n := 0
+		for _, ifi := range s.ifaces {
+			n += len(ifi.tentative)
+		}
+		s.unlock()
+		if n == 0 || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// duplicate drops tentative address ip, another node uses it.
+func (ifi *Interface) duplicate(ip IP) {
+	t := ifi.tentative[ip]
+	t.timer.Stop()
+	delete(ifi.tentative, ip)
+}
+
+// setLifetime schedules removal of address ip after valid, replacing an
+// earlier schedule. A zero valid is an infinite lifetime.
+func (ifi *Interface) setLifetime(ip IP, valid time.Duration) {
+	if t := ifi.expire[ip]; t != nil {
+		t.Stop()
+		delete(ifi.expire, ip)
+	}
+	if valid == 0 {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(valid, func() {
+		s := ifi.s
+		s.mu.Lock()
+		defer s.unlock()
+		if ifi.expire[ip] == t {
+			ifi.removeAddr(ip)
+		}
+	})
+	ifi.expire[ip] = t
+}
+
+// solicitRouters sends router solicitations until a router advertisement
+// is received, at most rsTries.
+func (ifi *Interface) solicitRouters() {
+	if ifi.rsTimer != nil || ifi.routerSeen {
+		return
+	}
+	tries := 0
+	var solicit func()
+	solicit = func() {
+		src, ok := ifi.addr6(allRouters)
+		if !ok || ifi.routerSeen {
+			return
+		}
+		b := make([]byte, 16)
+		b[0] = ndpRouterSolicit
+		ifi.putLLOption(b[8:], ndpOptSourceLL)
+		ifi.sendNDP(src, allRouters, b)
+		tries++
+		if tries == rsTries {
+			return
+		}
+		ifi.rsTimer = time.AfterFunc(rsInterval, func() {
+			s := ifi.s
+			s.mu.Lock()
+			defer s.unlock()
+			solicit()
+		})
+	}
+	solicit()
+}
+
+// putLLOption puts a link-layer address option of type typ with the MAC
+// address of ifi into b.
+func (ifi *Interface) putLLOption(b []byte, typ byte) {
+	b[0] = typ
+	b[1] = 1 // In units of 8 bytes.
+	copy(b[2:8], ifi.MAC[:])
+}
+
+// sendNS sends a neighbor solicitation for target. For duplicate address
+// detection, src is the unspecified address.
+func (ifi *Interface) sendNS(src, dst, target IP) {
+	n := 24
+	if src != (IP{}) {
+		n += 8
+	}
+	b := make([]byte, n)
+	b[0] = ndpNeighborSolicit
+	copy(b[8:24], target[:])
+	if src != (IP{}) {
+		ifi.putLLOption(b[24:], ndpOptSourceLL)
+	}
+	ifi.sendNDP(src, dst, b)
+}
+
+// sendNA sends a neighbor advertisement for target with flags.
+func (ifi *Interface) sendNA(src, dst, target IP, flags byte) {
+	b := make([]byte, 32)
+	b[0] = ndpNeighborAdvert
+	b[4] = flags
+	copy(b[8:24], target[:])
+	ifi.putLLOption(b[24:], ndpOptTargetLL)
+	ifi.sendNDP(src, dst, b)
+}
+
+// sendNDP sends neighbor discovery message b, with the checksum filled in.
+func (ifi *Interface) sendNDP(src, dst IP, b []byte) {
+	put16(b[2:], checksum(b, pseudoHeaderSum(src, dst, protoICMPv6, len(b))))
+	ifi.s.sendIPv6Via(ifi, dst, src, dst, protoICMPv6, ndpHopLimit, b)
+}
+
+// ndpLLOption returns the link-layer address of option typ in options b.
+func ndpLLOption(b []byte, typ byte) (mac [6]byte, ok bool) {
+	for len(b) >= 8 && b[1] > 0 && len(b) >= int(b[1])*8 {
+		if b[0] == typ && b[1] == 1 {
+			copy(mac[:], b[2:8])
+			return mac, true
+		}
+		b = b[int(b[1])*8:]
+	}
+	return mac, false
+}
+
+// inputNDP processes a neighbor discovery message b received on ifi.
+func (ifi *Interface) inputNDP(src, dst IP, hopLimit byte, b []byte) {
+	if hopLimit != ndpHopLimit || b[1] != 0 {
+		// Not from the link.
+		return
+	}
+	switch b[0] {
+	case ndpNeighborSolicit:
+		if len(b) < 24 {
+			return
+		}
+		var target IP
+		copy(target[:], b[8:24])
+		sll, hasSLL := ndpLLOption(b[24:], ndpOptSourceLL)
+		if target.IsMulticast() || src == (IP{}) && (hasSLL || dst != solicitedNode(target)) {
+			return
+		}
+		if ifi.tentative[target] != nil {
+			// Another node is doing duplicate address detection for
+			// the same address.
+			if src == (IP{}) {
+				ifi.duplicate(target)
+			}
+			return
+		}
+		if !ifi.hasAddr(target) {
+			return
+		}
+		if src == (IP{}) {
+			ifi.sendNA(target, allNodes, target, naOverride)
+			return
+		}
+		if hasSLL {
+			ifi.learn(src, sll)
+		}
+		ifi.sendNA(target, src, target, naSolicited|naOverride)
+
+	case ndpNeighborAdvert:
+		if len(b) < 24 {
+			return
+		}
+		var target IP
+		copy(target[:], b[8:24])
+		if target.IsMulticast() || dst.IsMulticast() && b[4]&naSolicited != 0 {
+			return
+		}
+		if ifi.tentative[target] != nil {
+			ifi.duplicate(target)
+			return
+		}
+		tll, ok := ndpLLOption(b[24:], ndpOptTargetLL)
+		if ok && ifi.arp[target] != nil {
+			ifi.learn(target, tll)
+		}
+
+	case ndpRouterAdvert:
+		if len(b) >= 16 && src.IsLinkLocal() {
+			ifi.inputRA(src, b)
+		}
+	}
+}
+
+// inputRA processes router advertisement b from router src.
+func (ifi *Interface) inputRA(src IP, b []byte) {
+	s := ifi.s
+	ifi.routerSeen = true
+	if ifi.rsTimer != nil {
+		ifi.rsTimer.Stop()
+		ifi.rsTimer = nil
+	}
+	s.setRouter6(ifi, src, time.Duration(be16(b[6:]))*time.Second)
+
+	for opts := b[16:]; len(opts) >= 8 && opts[1] > 0 && len(opts) >= int(opts[1])*8; opts = opts[int(opts[1])*8:] {
+		opt := opts[:int(opts[1])*8]
+		switch opt[0] {
+		case ndpOptSourceLL:
+			var mac [6]byte
+			copy(mac[:], opt[2:8])
+			ifi.learn(src, mac)
+
+		case ndpOptPrefix:
+			if len(opt) != 32 {
+				continue
+			}
+			n, flags := int(opt[2]), opt[3]
+			valid, preferred := be32(opt[4:]), be32(opt[8:])
+			var prefix IP
+			copy(prefix[:], opt[16:32])
+			// Addresses are only formed from 64 bit prefixes, with
+			// the interface identifier from the MAC address.
+			if flags&prefixAutonomous == 0 || n != 64 || prefix.IsLinkLocal() || preferred > valid || valid == 0 {
+				continue
+			}
+			ip := withInterfaceID(prefix, ifi.MAC)
+			if flags&prefixOnLink == 0 {
+				// Not on-link, everything goes through the router.
+				n = 128
+			}
+			var d time.Duration
+			if valid != 0xffffffff {
+				d = time.Duration(valid) * time.Second
+			}
+			if ifi.hasAddr(ip) {
+				ifi.setLifetime(ip, d)
+			} else {
+				ifi.addTentative(Prefix{ip, n}, d)
+			}
+
+		case ndpOptRDNSS:
+			if len(opt) < 24 || be32(opt[4:]) == 0 {
+				continue
+			}
+		Servers:
+			for a := opt[8:]; len(a) >= 16; a = a[16:] {
+				var ip IP
+				copy(ip[:], a[:16])
+				for _, x := range s.dns {
+					if x == ip {
+						continue Servers
+					}
+				}
+				s.dns = append(s.dns, ip)
+			}
+		}
+	}
+}
+
+// setRouter6 makes ip on ifi the IPv6 default router for lifetime d, or
+// removes it as default router if d is zero.
+func (s *Stack) setRouter6(ifi *Interface, ip IP, d time.Duration) {
+	if d == 0 {
+		if s.router6 == ip && s.router6ifi == ifi {
+			s.clearRouter6()
+		}
+		return
+	}
+	s.clearRouter6()
+	s.router6 = ip
+	s.router6ifi = ifi
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.unlock()
+		if s.router6timer == t {
+			s.clearRouter6()
+		}
+	})
+	s.router6timer = t
+}
+
+func (s *Stack) clearRouter6() {
+	if s.router6timer != nil {
+		s.router6timer.Stop()
+	}
+	s.router6 = IP{}
+	s.router6ifi = nil
+	s.router6timer = nil
+}
@@ -0,0 +1,787 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"bytes"
+	"context"
+	"internal/poll"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pipeLink is one end of an Ethernet link between two stacks.
+type pipeLink struct {
+	in   chan []byte
+	out  chan []byte
+	drop func() bool // Reports whether to drop a frame.
+}
+
+func (l *pipeLink) ReadFrame(p []byte) (int, error) {
+	return copy(p, <-l.in), nil
+}
+
+func (l *pipeLink) WriteFrame(p []byte) error {
+	if l.drop() {
+		return nil
+	}
+	select {
+	case l.out <- append([]byte(nil), p...):
+	default:
+	}
+	return nil
+}
+
+// newStacks returns two stacks connected by a link, with addresses 10.0.0.1
+// and 10.0.0.2. A fraction loss of the frames is dropped.
+func newStacks(t *testing.T, loss float64) (a, b *Stack) {
+	ab := make(chan []byte, 1024)
+	ba := make(chan []byte, 1024)
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(1))
+	drop := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Float64() < loss
+	}
+	la := &pipeLink{in: ba, out: ab, drop: drop}
+	lb := &pipeLink{in: ab, out: ba, drop: drop}
+	a = New()
+	b = New()
+	ia := a.AddInterface("net0", [6]byte{2, 0, 0, 0, 0, 1}, 1500, la)
+	ib := b.AddInterface("net0", [6]byte{2, 0, 0, 0, 0, 2}, 1500, lb)
+	if err := ia.AddAddr(Prefix{IPv4(10, 0, 0, 1), 24}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ib.AddAddr(Prefix{IPv4(10, 0, 0, 2), 24}); err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+// testTCP transfers n bytes in both directions between a and b.
+func testTCP(t *testing.T, a, b *Stack, raddr Addr, n int) {
+	l, err := b.ListenTCP(Addr{Port: raddr.Port}, 8, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	data := make([]byte, n)
+	rand.Read(data)
+
+	errc := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer c.Close()
+		// Echo everything back.
+		buf, err := ioutil.ReadAll(c)
+		if err != nil {
+			errc <- err
+			return
+		}
+		_, err = c.Write(buf)
+		errc <- err
+	}()
+
+	c, err := a.DialTCP(context.Background(), Addr{}, raddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	go func() {
+		c.Write(data)
+		c.CloseWrite()
+	}()
+	buf, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("received %d bytes, not equal to %d bytes sent", len(buf), len(data))
+	}
+}
+
+func TestTCP(t *testing.T) {
+	a, b := newStacks(t, 0)
+	testTCP(t, a, b, Addr{IPv4(10, 0, 0, 2), 80}, 1<<20)
+}
+
+func TestTCPLoss(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	a, b := newStacks(t, 0.05)
+	testTCP(t, a, b, Addr{IPv4(10, 0, 0, 2), 80}, 128<<10)
+}
+
+func TestTCPLoopback(t *testing.T) {
+	a, _ := newStacks(t, 0)
+	testTCP(t, a, a, Addr{IPv4(127, 0, 0, 1), 80}, 1<<20)
+	testTCP(t, a, a, Addr{IPv4(10, 0, 0, 1), 81}, 1<<20)
+}
+
+func TestTCPRefused(t *testing.T) {
+	a, _ := newStacks(t, 0)
+	_, err := a.DialTCP(context.Background(), Addr{}, Addr{IPv4(10, 0, 0, 2), 80})
+	if err != syscall.ECONNREFUSED {
+		t.Fatalf("dial: got %v, expected %v", err, syscall.ECONNREFUSED)
+	}
+	_, err = a.DialTCP(context.Background(), Addr{}, Addr{IPv4(192, 168, 0, 1), 80})
+	if err != syscall.ENETUNREACH {
+		t.Fatalf("dial: got %v, expected %v", err, syscall.ENETUNREACH)
+	}
+}
+
+func TestTCPDialCancel(t *testing.T) {
+	a, _ := newStacks(t, 0)
+	// No host with this address, ARP will not resolve.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := a.DialTCP(ctx, Addr{}, Addr{IPv4(10, 0, 0, 3), 80})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("dial: got %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTCPReset(t *testing.T) {
+	a, b := newStacks(t, 0)
+	l, err := b.ListenTCP(Addr{Port: 80}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := a.DialTCP(context.Background(), Addr{}, Addr{IPv4(10, 0, 0, 2), 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	// Closing with unread data resets the connection.
+	for {
+		b.mu.Lock()
+		n := len(sc.rcvBuf)
+		b.unlock()
+		if n == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	sc.Close()
+	if _, err := c.Read(make([]byte, 1)); err != syscall.ECONNRESET {
+		t.Fatalf("read: got %v, expected %v", err, syscall.ECONNRESET)
+	}
+}
+
+func TestTCPDeadline(t *testing.T) {
+	a, b := newStacks(t, 0)
+	l, err := b.ListenTCP(Addr{Port: 80}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := a.DialTCP(context.Background(), Addr{}, Addr{IPv4(10, 0, 0, 2), 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 1)); err != poll.ErrTimeout {
+		t.Fatalf("read: got %v, expected %v", err, poll.ErrTimeout)
+	}
+	l.SetDeadline(time.Now().Add(-time.Second))
+	l.Accept() // Connection from the dial above.
+	if _, err := l.Accept(); err != poll.ErrTimeout {
+		t.Fatalf("accept: got %v, expected %v", err, poll.ErrTimeout)
+	}
+}
+
+func TestTCPEOF(t *testing.T) {
+	a, b := newStacks(t, 0)
+	l, err := b.ListenTCP(Addr{Port: 80}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := a.DialTCP(context.Background(), Addr{}, Addr{IPv4(10, 0, 0, 2), 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Write([]byte("hello"))
+	sc.Close()
+	buf, err := ioutil.ReadAll(c)
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("read: got %q, %v, expected %q, nil", buf, err, "hello")
+	}
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read: got %v, expected EOF", err)
+	}
+	c.Close()
+
+	// Both sides go through FIN-WAIT and LAST-ACK.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.Lock()
+		ca := c.state
+		a.unlock()
+		b.mu.Lock()
+		cb := sc.state
+		b.unlock()
+		if ca == tcpClosed && cb == tcpTimeWait {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("states %v and %v, expected CLOSED and TIME-WAIT", ca, cb)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListenInUse(t *testing.T) {
+	a, _ := newStacks(t, 0)
+	l, err := a.ListenTCP(Addr{Port: 80}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ListenTCP(Addr{IPv4(10, 0, 0, 1), 80}, 1, false); err != syscall.EADDRINUSE {
+		t.Fatalf("listen: got %v, expected %v", err, syscall.EADDRINUSE)
+	}
+	l.Close()
+	if _, err := a.ListenTCP(Addr{IPv4(10, 0, 0, 1), 80}, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ListenTCP(Addr{IPv4(10, 0, 0, 9), 80}, 1, false); err != syscall.EADDRNOTAVAIL {
+		t.Fatalf("listen: got %v, expected %v", err, syscall.EADDRNOTAVAIL)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	a, b := newStacks(t, 0)
+	ub, err := b.ListenUDP(Addr{Port: 53}, Addr{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ub.Close()
+	ua, err := a.ListenUDP(Addr{}, Addr{IPv4(10, 0, 0, 2), 53}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ua.Close()
+
+	if _, err := ua.WriteTo([]byte("ping"), Addr{}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	n, from, err := ub.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ping" || from != ua.LocalAddr() {
+		t.Fatalf("got %q from %v, expected %q from %v", buf[:n], from, "ping", ua.LocalAddr())
+	}
+	if _, err := ub.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatal(err)
+	}
+	n, from, err = ua.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "pong" || from != (Addr{IPv4(10, 0, 0, 2), 53}) {
+		t.Fatalf("got %q from %v, expected %q from 10.0.0.2:53", buf[:n], from, "pong")
+	}
+
+	// Datagrams to a closed port are refused with an ICMP message.
+	ub.Close()
+	ua.WriteTo([]byte("ping"), Addr{})
+	ua.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := ua.ReadFrom(buf); err != syscall.ECONNREFUSED {
+		t.Fatalf("read: got %v, expected %v", err, syscall.ECONNREFUSED)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	p, err := ParsePrefix("10.1.2.3/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IP != IPv4(10, 1, 2, 3) || p.Len != 16 {
+		t.Fatalf("got %v, expected 10.1.2.3/16", p)
+	}
+	if !p.Contains(IPv4(10, 1, 200, 1)) || p.Contains(IPv4(10, 2, 0, 1)) {
+		t.Fatalf("bad Contains for %v", p)
+	}
+	if b := p.broadcast(); b != IPv4(10, 1, 255, 255) {
+		t.Fatalf("broadcast %v, expected 10.1.255.255", b)
+	}
+	p, err = ParsePrefix("2001:db8::1:0:0:2/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IP != (IP{0x20, 0x01, 0x0d, 0xb8, 9: 1, 15: 2}) || p.Len != 64 {
+		t.Fatalf("got %v, expected 2001:db8::1:0:0:2/64", p)
+	}
+	if !p.Contains(IP{0x20, 0x01, 0x0d, 0xb8, 15: 9}) || p.Contains(IP{0x20, 0x01, 0x0d, 0xb8, 7: 1}) || p.Contains(IPv4(10, 1, 2, 3)) {
+		t.Fatalf("bad Contains for %v", p)
+	}
+	for s, ip := range map[string]IP{
+		"::":              {},
+		"::1":             {15: 1},
+		"fe80::":          {0: 0xfe, 1: 0x80},
+		"1:2:3:4:5:6:7:8": {1: 1, 3: 2, 5: 3, 7: 4, 9: 5, 11: 6, 13: 7, 15: 8},
+		"::ffff:1.2.3.4":  IPv4(1, 2, 3, 4),
+	} {
+		if x, ok := ParseIP(s); !ok || x != ip {
+			t.Errorf("ParseIP(%q): got %v, %v, expected %v", s, x, ok, ip)
+		}
+	}
+	for _, s := range []string{"10.0.0.1", "10.0.0.1/33", "10.0.0/8", "10.0.0.256/8", "1.2.3.4/x", "::1/129", "1::2::3/64", "1:2:3:4:5:6:7:8:9/64", "12345::/64", "1:/64"} {
+		if _, err := ParsePrefix(s); err == nil {
+			t.Errorf("ParsePrefix(%q) succeeded", s)
+		}
+	}
+}
+
+// dhcpServer answers DHCP requests received on u, leasing 10.0.0.50/24 for
+// lease, with 10.0.0.1 as router and name server. It reports the type of
+// each request on reqs.
+func dhcpServer(u *UDPConn, lease time.Duration, reqs chan<- byte) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := u.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m := buf[:n]
+		if n < dhcpHeaderLen+7 || m[0] != dhcpBootRequest || m[dhcpHeaderLen+4] != dhcpOptMessageType {
+			continue
+		}
+		typ := m[dhcpHeaderLen+6]
+		reqs <- typ
+		reply := make([]byte, dhcpHeaderLen, 300)
+		reply[0] = dhcpBootReply
+		reply[1] = 1
+		reply[2] = 6
+		copy(reply[4:8], m[4:8])
+		copy(reply[16:20], []byte{10, 0, 0, 50})
+		copy(reply[28:34], m[28:34])
+		reply = append(reply, 0x63, 0x82, 0x53, 0x63)
+		rtyp := byte(dhcpOffer)
+		if typ == dhcpRequest {
+			rtyp = dhcpAck
+		}
+		secs := uint32(lease / time.Second)
+		reply = append(reply,
+			dhcpOptMessageType, 1, rtyp,
+			dhcpOptServerID, 4, 10, 0, 0, 1,
+			dhcpOptSubnetMask, 4, 255, 255, 255, 0,
+			dhcpOptRouter, 4, 10, 0, 0, 1,
+			dhcpOptDNS, 4, 10, 0, 0, 1,
+			dhcpOptDomainName, 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+			dhcpOptLeaseTime, 4, byte(secs>>24), byte(secs>>16), byte(secs>>8), byte(secs),
+			dhcpOptEnd)
+		to := Addr{IPv4(255, 255, 255, 255), dhcpClientPort}
+		if m[12] != 0 {
+			// Renewal, answered to the client.
+			to = from
+		}
+		u.WriteTo(reply, to)
+	}
+}
+
+// addrs4 returns the IPv4 addresses of ifi.
+func addrs4(ifi *Interface) []Prefix {
+	var l []Prefix
+	for _, p := range ifi.Addrs() {
+		if p.IP.Is4() {
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+func TestDHCP(t *testing.T) {
+	ab := make(chan []byte, 1024)
+	ba := make(chan []byte, 1024)
+	never := func() bool { return false }
+	a := New()
+	b := New()
+	ia := a.AddInterface("net0", [6]byte{2, 0, 0, 0, 0, 1}, 1500, &pipeLink{in: ba, out: ab, drop: never})
+	ib := b.AddInterface("net0", [6]byte{2, 0, 0, 0, 0, 2}, 1500, &pipeLink{in: ab, out: ba, drop: never})
+	if err := ib.AddAddr(Prefix{IPv4(10, 0, 0, 1), 24}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.ListenUDP(Addr{Port: dhcpServerPort}, Addr{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	reqs := make(chan byte, 16)
+	go dhcpServer(u, 2*time.Second, reqs)
+
+	changes := make(chan Lease, 4)
+	l, err := ia.StartDHCP(10*time.Second, func(l Lease, ok bool) {
+		if ok {
+			changes <- l
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Addr != (Prefix{IPv4(10, 0, 0, 50), 24}) || l.Router != IPv4(10, 0, 0, 1) || l.Server != IPv4(10, 0, 0, 1) || l.Domain != "example" || len(l.DNS) != 1 || l.Duration != 2*time.Second || l.Renew != time.Second {
+		t.Fatalf("got lease %+v", l)
+	}
+	if typ := <-reqs; typ != dhcpDiscover {
+		t.Fatalf("got message type %d, expected discover", typ)
+	}
+	if typ := <-reqs; typ != dhcpRequest {
+		t.Fatalf("got message type %d, expected request", typ)
+	}
+	if a.Gateway() != IPv4(10, 0, 0, 1) {
+		t.Fatalf("gateway %v, expected 10.0.0.1", a.Gateway())
+	}
+	if dns, search := a.DNS(); len(dns) != 1 || len(search) != 1 || search[0] != "example" {
+		t.Fatalf("got name servers %v, search %v", dns, search)
+	}
+	if addrs := addrs4(ia); len(addrs) != 1 || addrs[0] != l.Addr {
+		t.Fatalf("got addresses %v", addrs)
+	}
+	<-changes
+
+	// The lease is renewed with the server after a second.
+	select {
+	case nl := <-changes:
+		if nl.Addr != l.Addr || !nl.Start.After(l.Start) {
+			t.Fatalf("renewed lease %+v", nl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease not renewed")
+	}
+	if typ := <-reqs; typ != dhcpRequest {
+		t.Fatalf("got message type %d, expected request", typ)
+	}
+	if addrs := addrs4(ia); len(addrs) != 1 {
+		t.Fatalf("got addresses %v after renewal", addrs)
+	}
+}
+
+func TestDHCPTimeout(t *testing.T) {
+	a, _ := newStacks(t, 1)
+	ifi := a.Interfaces()[1]
+	if _, err := ifi.StartDHCP(100*time.Millisecond, nil); err != syscall.ETIMEDOUT {
+		t.Fatalf("got %v, expected %v", err, syscall.ETIMEDOUT)
+	}
+	if _, ok := ifi.Lease(); ok {
+		t.Fatal("lease after timeout")
+	}
+}
+
+// newStacks6 returns two stacks connected by a link, with their IPv6
+// link-local addresses assigned, and the link to the second stack.
+func newStacks6(t *testing.T) (a, b *Stack, ll [2]IP) {
+	defer func(d time.Duration) { dadDelay = d }(dadDelay)
+	dadDelay = 10 * time.Millisecond
+	a, b = newStacks(t, 0)
+	for i, s := range []*Stack{a, b} {
+		ifi := s.Interfaces()[1]
+		ll[i] = withInterfaceID(IP{0: 0xfe, 1: 0x80}, ifi.MAC)
+		waitAddr(t, ifi, ll[i], true)
+	}
+	return a, b, ll
+}
+
+// waitAddr waits until ip is, or is not, an address of ifi.
+func waitAddr(t *testing.T, ifi *Interface, ip IP, present bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found := false
+		for _, p := range ifi.Addrs() {
+			found = found || p.IP == ip
+		}
+		if found == present {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("address %v: present %v, expected %v", ip, found, present)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTCPIPv6(t *testing.T) {
+	a, b, ll := newStacks6(t)
+	testTCP(t, a, b, Addr{ll[1], 80}, 1<<20)
+	testTCP(t, a, a, Addr{IP{15: 1}, 80}, 1<<20)
+
+	// A dual-stack listener also accepts IPv4 connections, an IPv6-only
+	// listener does not.
+	testTCP(t, a, b, Addr{IPv4(10, 0, 0, 2), 80}, 1<<10)
+	l, err := b.ListenTCP(Addr{Port: 80}, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := a.DialTCP(context.Background(), Addr{}, Addr{IPv4(10, 0, 0, 2), 80}); err != syscall.ECONNREFUSED {
+		t.Fatalf("dial: got %v, expected %v", err, syscall.ECONNREFUSED)
+	}
+	if _, err := b.ListenTCP(Addr{IPv4(0, 0, 0, 0), 80}, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ListenTCP(Addr{Port: 80}, 1, false); err != syscall.EADDRINUSE {
+		t.Fatalf("listen: got %v, expected %v", err, syscall.EADDRINUSE)
+	}
+}
+
+func TestUDPIPv6(t *testing.T) {
+	a, b, ll := newStacks6(t)
+	ub, err := b.ListenUDP(Addr{Port: 53}, Addr{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua, err := a.ListenUDP(Addr{}, Addr{ll[1], 53}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ua.Close()
+	if _, err := ua.WriteTo([]byte("ping"), Addr{}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	n, from, err := ub.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "ping" || from != ua.LocalAddr() {
+		t.Fatalf("got %q from %v, %v, expected %q from %v", buf[:n], from, err, "ping", ua.LocalAddr())
+	}
+	if _, err := ub.WriteTo([]byte("ping"), Addr{IPv4(10, 0, 0, 1), 53}); err != syscall.EAFNOSUPPORT {
+		t.Fatalf("write to IPv4: got %v, expected %v", err, syscall.EAFNOSUPPORT)
+	}
+
+	// Datagrams to a closed port are refused with an ICMPv6 message.
+	ub.Close()
+	ua.WriteTo([]byte("ping"), Addr{})
+	ua.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := ua.ReadFrom(buf); err != syscall.ECONNREFUSED {
+		t.Fatalf("read: got %v, expected %v", err, syscall.ECONNREFUSED)
+	}
+}
+
+func TestDuplicateAddress(t *testing.T) {
+	defer func(d time.Duration) { dadDelay = d }(dadDelay)
+	dadDelay = 10 * time.Millisecond
+	ab := make(chan []byte, 1024)
+	ba := make(chan []byte, 1024)
+	never := func() bool { return false }
+	mac := [6]byte{2, 0, 0, 0, 0, 1}
+	ll := withInterfaceID(IP{0: 0xfe, 1: 0x80}, mac)
+	ia := New().AddInterface("net0", mac, 1500, &pipeLink{in: ba, out: ab, drop: never})
+	waitAddr(t, ia, ll, true)
+
+	// A second node with the same MAC address does not get the
+	// link-local address.
+	dadDelay = 200 * time.Millisecond
+	ib := New().AddInterface("net0", mac, 1500, &pipeLink{in: ab, out: ba, drop: never})
+	time.Sleep(2 * dadDelay)
+	waitAddr(t, ib, ll, false)
+	waitAddr(t, ia, ll, true)
+}
+
+// routerFrame returns an Ethernet frame with ICMPv6 message b from src with
+// MAC address mac to multicast address dst, filling in the checksum.
+func routerFrame(mac [6]byte, src, dst IP, b []byte) []byte {
+	put16(b[2:], checksum(b, pseudoHeaderSum(src, dst, protoICMPv6, len(b))))
+	f := make([]byte, ethHeaderLen+ipv6HeaderLen+len(b))
+	dmac := multicastMAC(dst)
+	copy(f, dmac[:])
+	copy(f[6:], mac[:])
+	put16(f[12:], ethTypeIPv6)
+	p := f[ethHeaderLen:]
+	p[0] = 6 << 4
+	put16(p[4:], uint16(len(b)))
+	p[6] = protoICMPv6
+	p[7] = ndpHopLimit
+	copy(p[8:], src[:])
+	copy(p[24:], dst[:])
+	copy(p[ipv6HeaderLen:], b)
+	return f
+}
+
+func TestSLAAC(t *testing.T) {
+	defer func(d time.Duration) { dadDelay = d }(dadDelay)
+	dadDelay = 10 * time.Millisecond
+	in := make(chan []byte, 16)
+	out := make(chan []byte, 1024)
+	mac := [6]byte{2, 0, 0, 0, 0, 1}
+	s := New()
+	ifi := s.AddInterface("net0", mac, 1500, &pipeLink{in: in, out: out, drop: func() bool { return false }})
+	waitAddr(t, ifi, withInterfaceID(IP{0: 0xfe, 1: 0x80}, mac), true)
+
+	// The router solicitation.
+	deadline := time.After(5 * time.Second)
+	for rs := false; !rs; {
+		select {
+		case f := <-out:
+			rs = be16(f[12:]) == ethTypeIPv6 && f[ethHeaderLen+6] == protoICMPv6 && f[ethHeaderLen+ipv6HeaderLen] == ndpRouterSolicit
+		case <-deadline:
+			t.Fatal("no router solicitation")
+		}
+	}
+
+	// A router advertisement with a prefix and name server.
+	rmac := [6]byte{2, 0, 0, 0, 0, 0xfe}
+	router := IP{0: 0xfe, 1: 0x80, 15: 1}
+	prefix := IP{0x20, 0x01, 0x0d, 0xb8}
+	ns := IP{0x20, 0x01, 0x0d, 0xb8, 14: 0x53}
+	ra := []byte{ndpRouterAdvert, 0, 0, 0, 64, 0, 0x07, 0x08, 11: 0, 15: 0}
+	ra = append(ra, ndpOptSourceLL, 1, rmac[0], rmac[1], rmac[2], rmac[3], rmac[4], rmac[5])
+	ra = append(ra, ndpOptPrefix, 4, 64, prefixOnLink|prefixAutonomous, 0, 0, 0x0e, 0x10, 0, 0, 0x07, 0x08, 0, 0, 0, 0)
+	ra = append(ra, prefix[:]...)
+	ra = append(ra, ndpOptRDNSS, 3, 0, 0, 0, 0, 0x0e, 0x10)
+	ra = append(ra, ns[:]...)
+	in <- routerFrame(rmac, router, allNodes, ra)
+
+	addr := withInterfaceID(prefix, mac)
+	waitAddr(t, ifi, addr, true)
+	if dns, _ := s.DNS(); len(dns) != 1 || dns[0] != ns {
+		t.Fatalf("got name servers %v, expected %v", dns, ns)
+	}
+	remote := IP{0x20, 0x01, 0x0d, 0xb8, 0, 1, 15: 1}
+	s.mu.Lock()
+	rifi, nexthop, src, err := s.route(remote)
+	s.unlock()
+	if err != nil || rifi != ifi || nexthop != router || src != addr {
+		t.Fatalf("route: got %v, %v, %v, %v, expected %v via %v from %v", rifi, nexthop, src, err, ifi.Name, router, addr)
+	}
+
+	// An echo request from beyond the router is answered through the
+	// router.
+	echo := []byte{icmp6EchoRequest, 0, 0, 0, 0x12, 0x34, 0, 1, 'h', 'i'}
+	f := routerFrame(rmac, remote, addr, echo)
+	copy(f, mac[:])
+	in <- f
+	for {
+		select {
+		case f := <-out:
+			p := f[ethHeaderLen:]
+			if be16(f[12:]) != ethTypeIPv6 || p[6] != protoICMPv6 || p[ipv6HeaderLen] != icmp6EchoReply {
+				continue
+			}
+			if !bytes.Equal(f[:6], rmac[:]) || !bytes.Equal(p[8:24], addr[:]) || !bytes.Equal(p[24:40], remote[:]) || string(p[ipv6HeaderLen+8:]) != "hi" {
+				t.Fatalf("bad echo reply % x", f)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no echo reply")
+		}
+	}
+}
+
+// ipv6Frame returns an Ethernet frame to mac with an IPv6 packet from src to
+// dst, with next header next and payload b.
+func ipv6Frame(mac [6]byte, src, dst IP, next byte, b []byte) []byte {
+	f := make([]byte, ethHeaderLen+ipv6HeaderLen+len(b))
+	if dst.IsMulticast() {
+		mac = multicastMAC(dst)
+	}
+	copy(f, mac[:])
+	put16(f[12:], ethTypeIPv6)
+	p := f[ethHeaderLen:]
+	p[0] = 6 << 4
+	put16(p[4:], uint16(len(b)))
+	p[6] = next
+	p[7] = ipv6DefaultHopLimit
+	copy(p[8:], src[:])
+	copy(p[24:], dst[:])
+	copy(p[ipv6HeaderLen:], b)
+	return f
+}
+
+func TestICMPv6Errors(t *testing.T) {
+	defer func(d time.Duration) { dadDelay = d }(dadDelay)
+	dadDelay = 10 * time.Millisecond
+	in := make(chan []byte, 16)
+	out := make(chan []byte, 1024)
+	mac := [6]byte{2, 0, 0, 0, 0, 1}
+	s := New()
+	ifi := s.AddInterface("net0", mac, 1500, &pipeLink{in: in, out: out, drop: func() bool { return false }})
+	ll := withInterfaceID(IP{0: 0xfe, 1: 0x80}, mac)
+	waitAddr(t, ifi, ll, true)
+	remote := IP{0: 0xfe, 1: 0x80, 15: 2}
+	s.mu.Lock()
+	ifi.learn(remote, [6]byte{2, 0, 0, 0, 0, 2})
+	s.unlock()
+
+	const protoUnknown = 253
+	routing := []byte{protoUnknown, 0, 0, 1, 7: 0} // One segment left.
+	udp := []byte{0x12, 0x34, 0, 9, 0, 8, 0, 0}    // To a closed port, without checksum.
+	tests := []struct {
+		name     string
+		src, dst IP
+		next     byte
+		payload  []byte
+		want     byte // ICMPv6 error type, 0 for none.
+	}{
+		{"unknown next header", remote, ll, protoUnknown, nil, icmp6ParamProblem},
+		{"unknown next header to multicast", remote, allNodes, protoUnknown, nil, 0},
+		{"unknown next header from unspecified", IP{}, ll, protoUnknown, nil, 0},
+		{"segments left", remote, ll, protoRouting, routing, icmp6ParamProblem},
+		{"segments left to multicast", remote, allNodes, protoRouting, routing, 0},
+		{"segments left from unspecified", IP{}, ll, protoRouting, routing, 0},
+		{"closed port", remote, ll, protoUDP, udp, icmp6DestUnreachable},
+		{"closed port to multicast", remote, allNodes, protoUDP, udp, 0},
+		{"closed port from unspecified", IP{}, ll, protoUDP, udp, 0},
+	}
+	deadline := time.After(5 * time.Second)
+	for _, tt := range tests {
+		in <- ipv6Frame(mac, tt.src, tt.dst, tt.next, tt.payload)
+
+		// Frames are processed in order, so errors for the packet are
+		// sent before the reply to the echo request that follows it.
+		echo := []byte{icmp6EchoRequest, 0, 0, 0, 0x12, 0x34, 0, 1}
+		put16(echo[2:], checksum(echo, pseudoHeaderSum(remote, ll, protoICMPv6, len(echo))))
+		in <- ipv6Frame(mac, remote, ll, protoICMPv6, echo)
+		var errors []byte
+	loop:
+		for {
+			select {
+			case f := <-out:
+				p := f[ethHeaderLen:]
+				if be16(f[12:]) != ethTypeIPv6 || p[6] != protoICMPv6 {
+					continue
+				}
+				switch typ := p[ipv6HeaderLen]; {
+				case typ == icmp6EchoReply:
+					break loop
+				case typ < 128:
+					errors = append(errors, typ)
+				}
+			case <-deadline:
+				t.Fatalf("%s: no echo reply", tt.name)
+			}
+		}
+		if tt.want == 0 && len(errors) != 0 || tt.want != 0 && (len(errors) != 1 || errors[0] != tt.want) {
+			t.Errorf("%s: got ICMPv6 errors %v, expected %v", tt.name, errors, tt.want)
+		}
+	}
+}
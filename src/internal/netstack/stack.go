@@ -0,0 +1,413 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netstack implements a small TCP/IP stack on top of Ethernet
+// links, for systems that do not have one, such as solo5hvt. It implements
+// ARP, IPv4, IPv6 with neighbor discovery and address autoconfiguration,
+// ICMP echo and errors, UDP and TCP, and has a loopback interface. It is
+// used by package net.
+package netstack
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Link sends and receives Ethernet frames for an interface.
+type Link interface {
+	// ReadFrame reads a single frame into p, blocking until one is available.
+	ReadFrame(p []byte) (n int, err error)
+
+	// WriteFrame writes frame p. It must not block, and must not retain p.
+	WriteFrame(p []byte) error
+}
+
+// An Interface is a network interface of a Stack.
+type Interface struct {
+	Index int // Starting at 1, the loopback interface.
+	Name  string
+	MAC   [6]byte // Zero for the loopback interface.
+	MTU   int
+
+	s     *Stack
+	link  Link // Nil for the loopback interface.
+	addrs []Prefix
+	arp   map[IP]*arpEntry
+	dhcp  *dhcpClient // Set while DHCP runs on the interface.
+
+	// IPv6 addresses during duplicate address detection, and the timers
+	// for addresses with a limited lifetime.
+	tentative  map[IP]*tentativeAddr
+	expire     map[IP]*time.Timer
+	rsTimer    *time.Timer // Next router solicitation.
+	routerSeen bool        // A router advertisement was received.
+}
+
+// Loopback reports whether ifi is the loopback interface.
+func (ifi *Interface) Loopback() bool {
+	return ifi.link == nil
+}
+
+// Addrs returns the addresses configured on the interface.
+func (ifi *Interface) Addrs() []Prefix {
+	ifi.s.mu.Lock()
+	defer ifi.s.unlock()
+	return append([]Prefix(nil), ifi.addrs...)
+}
+
+// AddAddr adds address p to the interface. An IPv6 address on an Ethernet
+// interface is added after duplicate address detection, about a second
+// later, and not at all if another node on the link has the address.
+func (ifi *Interface) AddAddr(p Prefix) error {
+	s := ifi.s
+	s.mu.Lock()
+	defer s.unlock()
+	max := 128
+	if p.IP.Is4() {
+		max = 32
+	}
+	if p.Len < 0 || p.Len > max || p.IP.IsUnspecified() || p.IP.IsMulticast() {
+		return syscall.EINVAL
+	}
+	if ifi.hasAddr(p.IP) || ifi.tentative[p.IP] != nil {
+		return syscall.EEXIST
+	}
+	switch {
+	case ifi.link == nil:
+		ifi.addrs = append(ifi.addrs, p)
+	case p.IP.Is4():
+		ifi.addrs = append(ifi.addrs, p)
+		// Announce our address with a gratuitous ARP request.
+		ifi.arpRequest(p.IP, p.IP)
+	default:
+		ifi.addTentative(p, 0)
+	}
+	return nil
+}
+
+// RemoveAddr removes address ip from the interface.
+func (ifi *Interface) RemoveAddr(ip IP) error {
+	s := ifi.s
+	s.mu.Lock()
+	defer s.unlock()
+	if ifi.tentative[ip] != nil {
+		ifi.duplicate(ip)
+		return nil
+	}
+	if !ifi.removeAddr(ip) {
+		return syscall.EADDRNOTAVAIL
+	}
+	return nil
+}
+
+// removeAddr removes address ip from the interface, reporting whether it
+// was present.
+func (ifi *Interface) removeAddr(ip IP) bool {
+	if t := ifi.expire[ip]; t != nil {
+		t.Stop()
+		delete(ifi.expire, ip)
+	}
+	for i, x := range ifi.addrs {
+		if x.IP == ip {
+			ifi.addrs = append(ifi.addrs[:i:i], ifi.addrs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// addr4 returns the first IPv4 address of the interface.
+func (ifi *Interface) addr4() (Prefix, bool) {
+	for _, p := range ifi.addrs {
+		if p.IP.Is4() {
+			return p, true
+		}
+	}
+	return Prefix{}, false
+}
+
+func (ifi *Interface) hasAddr(ip IP) bool {
+	for _, p := range ifi.addrs {
+		if p.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// A Stack is a TCP/IP stack with its interfaces and endpoints.
+type Stack struct {
+	// mu protects all state of the stack, its interfaces and endpoints.
+	// Packets are processed with mu held.
+	mu sync.Mutex
+
+	ifaces  []*Interface
+	gateway IP
+	dns     []IP     // Name servers.
+	search  []string // Domains to search.
+
+	// The IPv6 default router, from router advertisements, and the timer
+	// for the end of its lifetime.
+	router6      IP
+	router6ifi   *Interface
+	router6timer *time.Timer
+
+	// Packets sent over the loopback interface, processed when mu is
+	// released by unlock.
+	loopq [][]byte
+
+	rand *rand.Rand
+	ipID uint16
+
+	udp          map[int][]*UDPConn
+	tcpConns     map[tcpKey]*TCPConn
+	tcpListeners map[int][]*TCPListener
+}
+
+// New returns a new stack with only a loopback interface.
+func New() *Stack {
+	s := &Stack{
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		udp:          map[int][]*UDPConn{},
+		tcpConns:     map[tcpKey]*TCPConn{},
+		tcpListeners: map[int][]*TCPListener{},
+	}
+	s.ifaces = []*Interface{{
+		Index: 1,
+		Name:  "lo",
+		MTU:   65536,
+		s:     s,
+		addrs: []Prefix{{IPv4(127, 0, 0, 1), 8}, {IP{15: 1}, 128}},
+	}}
+	return s
+}
+
+// AddInterface adds an Ethernet interface that sends and receives frames
+// over l, and starts reading frames from l. An IPv6 link-local address is
+// configured, after which routers are solicited for autoconfiguration.
+func (s *Stack) AddInterface(name string, mac [6]byte, mtu int, l Link) *Interface {
+	s.mu.Lock()
+	defer s.unlock()
+	ifi := &Interface{
+		Index: len(s.ifaces) + 1,
+		Name:  name,
+		MAC:   mac,
+		MTU:   mtu,
+		s:     s,
+		link:  l,
+		arp:   map[IP]*arpEntry{},
+
+		tentative: map[IP]*tentativeAddr{},
+		expire:    map[IP]*time.Timer{},
+	}
+	s.ifaces = append(s.ifaces, ifi)
+	ifi.addTentative(Prefix{withInterfaceID(IP{0: 0xfe, 1: 0x80}, mac), 64}, 0)
+	go s.readLoop(ifi)
+	return ifi
+}
+
+// Interfaces returns the interfaces of the stack. The first is the loopback
+// interface.
+func (s *Stack) Interfaces() []*Interface {
+	s.mu.Lock()
+	defer s.unlock()
+	return append([]*Interface(nil), s.ifaces...)
+}
+
+// InterfaceByName returns the interface named name, or nil.
+func (s *Stack) InterfaceByName(name string) *Interface {
+	s.mu.Lock()
+	defer s.unlock()
+	for _, ifi := range s.ifaces {
+		if ifi.Name == name {
+			return ifi
+		}
+	}
+	return nil
+}
+
+// SetGateway sets the IPv4 default gateway. A zero ip removes the gateway.
+func (s *Stack) SetGateway(ip IP) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.gateway = ip
+}
+
+// Gateway returns the IPv4 default gateway, zero if none.
+func (s *Stack) Gateway() IP {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.gateway
+}
+
+// SetDNS sets the name servers and the domains to search for names that
+// are not fully qualified, as configured by DHCP.
+func (s *Stack) SetDNS(servers []IP, search []string) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.dns = append([]IP(nil), servers...)
+	s.search = append([]string(nil), search...)
+}
+
+// DNS returns the name servers and search domains set with SetDNS.
+func (s *Stack) DNS() (servers []IP, search []string) {
+	s.mu.Lock()
+	defer s.unlock()
+	return append([]IP(nil), s.dns...), append([]string(nil), s.search...)
+}
+
+// unlock processes packets queued on the loopback interface and releases s.mu.
+func (s *Stack) unlock() {
+	for len(s.loopq) > 0 {
+		pkt := s.loopq[0]
+		s.loopq[0] = nil
+		s.loopq = s.loopq[1:]
+		if pkt[0]>>4 == 6 {
+			s.inputIPv6(s.ifaces[0], pkt)
+		} else {
+			s.inputIPv4(s.ifaces[0], pkt)
+		}
+	}
+	s.loopq = nil
+	s.mu.Unlock()
+}
+
+func (s *Stack) readLoop(ifi *Interface) {
+	buf := make([]byte, ifi.MTU+ethHeaderLen)
+	for {
+		n, err := ifi.link.ReadFrame(buf)
+		if err != nil {
+			if err, ok := err.(interface{ Temporary() bool }); ok && err.Temporary() {
+				continue
+			}
+			return
+		}
+		s.mu.Lock()
+		ifi.input(buf[:n])
+		s.unlock()
+	}
+}
+
+// isLocal reports whether ip is a loopback address or an address of one of
+// the interfaces.
+func (s *Stack) isLocal(ip IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ifi := range s.ifaces {
+		if ifi.hasAddr(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns the interface and next hop for sending a packet to dst, and
+// the source address to use.
+func (s *Stack) route(dst IP) (ifi *Interface, nexthop, src IP, err error) {
+	if s.isLocal(dst) {
+		src = dst
+		if dst.IsLoopback() && dst.Is4() {
+			src = IPv4(127, 0, 0, 1)
+		}
+		return s.ifaces[0], dst, src, nil
+	}
+	for _, ifi := range s.ifaces[1:] {
+		for _, p := range ifi.addrs {
+			if p.Contains(dst) {
+				return ifi, dst, p.IP, nil
+			}
+		}
+	}
+	if dst.IsBroadcast() && len(s.ifaces) > 1 {
+		// Without an address, as used by DHCP, the source is 0.0.0.0.
+		ifi := s.ifaces[1]
+		p, ok := ifi.addr4()
+		if !ok {
+			p.IP = IPv4(0, 0, 0, 0)
+		}
+		return ifi, dst, p.IP, nil
+	}
+	if !dst.Is4() {
+		if dst.IsMulticast() && len(s.ifaces) > 1 {
+			if src, ok := s.ifaces[1].addr6(dst); ok {
+				return s.ifaces[1], dst, src, nil
+			}
+		}
+		if ifi := s.router6ifi; ifi != nil {
+			if src, ok := ifi.addr6(dst); ok {
+				return ifi, s.router6, src, nil
+			}
+		}
+	}
+	if s.gateway != (IP{}) && dst.Is4() {
+		for _, ifi := range s.ifaces[1:] {
+			for _, p := range ifi.addrs {
+				if p.Contains(s.gateway) {
+					return ifi, s.gateway, p.IP, nil
+				}
+			}
+		}
+	}
+	return nil, IP{}, IP{}, syscall.ENETUNREACH
+}
+
+// ephemeralPort returns a free local port for an endpoint, or 0 if none is
+// available. inUse reports whether a port is taken.
+func (s *Stack) ephemeralPort(inUse func(port int) bool) int {
+	const first, last = 32768, 60999
+	const n = last - first + 1
+	start := s.rand.Intn(n)
+	for i := 0; i < n; i++ {
+		port := first + (start+i)%n
+		if !inUse(port) {
+			return port
+		}
+	}
+	return 0
+}
+
+// An endpoint bound to the zero IP, "::", is a dual-stack wildcard endpoint,
+// for IPv4 and IPv6 destinations, unless it is IPv6-only. An endpoint bound
+// to 0.0.0.0 is a wildcard endpoint for IPv4 destinations only.
+
+// familyOK reports whether an endpoint bound to local can exchange packets
+// with peer.
+func familyOK(local IP, v6only bool, peer IP) bool {
+	if local == (IP{}) {
+		return !v6only || !peer.Is4()
+	}
+	return local.Is4() == peer.Is4()
+}
+
+// matchLocal reports whether packets to dst are for an endpoint bound to
+// local.
+func matchLocal(local IP, v6only bool, dst IP) bool {
+	if local.IsUnspecified() {
+		return familyOK(local, v6only, dst)
+	}
+	return local == dst
+}
+
+// bindConflict reports whether endpoints bound to a and b, with the same
+// port, would both match packets for some destination.
+func bindConflict(a IP, a6only bool, b IP, b6only bool) bool {
+	switch {
+	case a.IsUnspecified() && b.IsUnspecified():
+		// Both wildcards, conflicting if both are for IPv4 or IPv6.
+		v4 := IPv4(0, 0, 0, 1)
+		return familyOK(a, a6only, v4) && familyOK(b, b6only, v4) || a == (IP{}) && b == (IP{})
+	case a.IsUnspecified():
+		return matchLocal(a, a6only, b)
+	case b.IsUnspecified():
+		return matchLocal(b, b6only, a)
+	}
+	return a == b
+}
+
+// background is the context for blocking operations without a context.
+var background = context.Background()
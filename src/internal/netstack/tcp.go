@@ -0,0 +1,1264 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"context"
+	"internal/poll"
+	"io"
+	"syscall"
+	"time"
+)
+
+// TCP as in RFC 793, with the retransmission timer of RFC 6298 and the
+// congestion control of RFC 5681. Window scaling, timestamps, SACK and urgent
+// data are not implemented. Segments are acknowledged immediately.
+
+const (
+	tcpFIN = 1 << 0
+	tcpSYN = 1 << 1
+	tcpRST = 1 << 2
+	tcpPSH = 1 << 3
+	tcpACK = 1 << 4
+)
+
+const (
+	tcpHeaderLen       = 20
+	tcpDefaultMSS      = 536
+	tcpRcvBufSize      = 0xffff // Maximum window without window scaling.
+	tcpSndBufSize      = 256 << 10
+	tcpMaxOOO          = 32 // Out of order segments kept.
+	tcpInitialRTO      = time.Second
+	tcpMinRTO          = 200 * time.Millisecond
+	tcpMaxRTO          = 60 * time.Second
+	tcpSynRetries      = 6
+	tcpRetries         = 15
+	tcpTimeWaitTimeout = 60 * time.Second // 2*MSL.
+	tcpFinWait2Timeout = 60 * time.Second
+	tcpInitialCwnd     = 10 // In segments.
+)
+
+type tcpState int
+
+const (
+	tcpClosed tcpState = iota
+	tcpSynSent
+	tcpSynRcvd
+	tcpEstablished
+	tcpFinWait1
+	tcpFinWait2
+	tcpCloseWait
+	tcpClosing
+	tcpLastAck
+	tcpTimeWait
+)
+
+var tcpStateNames = []string{"CLOSED", "SYN-SENT", "SYN-RECEIVED", "ESTABLISHED", "FIN-WAIT-1", "FIN-WAIT-2", "CLOSE-WAIT", "CLOSING", "LAST-ACK", "TIME-WAIT"}
+
+func (st tcpState) String() string {
+	return tcpStateNames[st]
+}
+
+// Sequence number comparisons, modulo 2**32.
+func seqLT(a, b uint32) bool { return int32(a-b) < 0 }
+func seqLE(a, b uint32) bool { return int32(a-b) <= 0 }
+func seqGT(a, b uint32) bool { return int32(a-b) > 0 }
+
+type tcpKey struct {
+	local, remote Addr
+}
+
+type tcpHeader struct {
+	sport, dport int
+	seq, ack     uint32
+	flags        byte
+	wnd          uint32
+	mss          int // From the MSS option, 0 if absent.
+}
+
+func parseTCP(b []byte) (h tcpHeader, data []byte, ok bool) {
+	off := int(b[12]>>4) * 4
+	if off < tcpHeaderLen || off > len(b) {
+		return h, nil, false
+	}
+	h = tcpHeader{
+		sport: int(be16(b[0:])),
+		dport: int(be16(b[2:])),
+		seq:   be32(b[4:]),
+		ack:   be32(b[8:]),
+		flags: b[13],
+		wnd:   uint32(be16(b[14:])),
+	}
+	for opts := b[tcpHeaderLen:off]; len(opts) > 0; {
+		switch opts[0] {
+		case 0: // End of options.
+			opts = nil
+			continue
+		case 1: // No-op.
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || int(opts[1]) < 2 || int(opts[1]) > len(opts) {
+			break
+		}
+		if opts[0] == 2 && opts[1] == 4 {
+			h.mss = int(be16(opts[2:]))
+		}
+		opts = opts[opts[1]:]
+	}
+	return h, b[off:], true
+}
+
+// A TCPConn is a TCP connection.
+type TCPConn struct {
+	s        *Stack
+	laddr    Addr
+	raddr    Addr
+	state    tcpState
+	listener *TCPListener // For passive opens, until queued on the listener.
+
+	// Send state. sndBuf holds the data starting at sndUna, both sent and
+	// not yet sent. After a retransmission timeout, sndNxt goes back to
+	// sndUna, sndMax is the highest sequence number sent.
+	iss      uint32
+	sndUna   uint32
+	sndNxt   uint32
+	sndMax   uint32
+	sndWnd   uint32
+	sndWl1   uint32
+	sndWl2   uint32
+	sndBuf   []byte
+	finQueue bool // FIN to be sent after sndBuf.
+	finSent  bool // FIN has been sent at finSeq.
+	finSeq   uint32
+	mss      int
+	cwnd     int
+	ssthresh int
+	dupAcks  int
+	recover  bool // In fast recovery.
+
+	// Retransmission timer state.
+	rto       time.Duration
+	srtt      time.Duration
+	rttvar    time.Duration
+	rttTiming bool // Timing a segment, ending at rttSeq.
+	rttSeq    uint32
+	rttStart  time.Time
+	retries   int
+	timer     *time.Timer
+	timerGen  int
+	rtxArmed  bool
+
+	// Receive state.
+	irs        uint32
+	rcvNxt     uint32
+	rcvBuf     []byte
+	ooo        []tcpSegment
+	lastAdvWnd int
+	finRcvd    bool
+
+	closed    bool // By Close.
+	readShut  bool // By CloseRead or Close.
+	writeShut bool // By CloseWrite or Close.
+	err       error
+
+	rev       event // Data, EOF or error for readers.
+	wev       event // Send buffer space, connection establishment, or error.
+	rdeadline deadline
+	wdeadline deadline
+}
+
+// tcpSegment is a received segment after a gap in the sequence space.
+type tcpSegment struct {
+	seq  uint32
+	data []byte
+	fin  bool
+}
+
+func (s *Stack) newTCPConn(laddr, raddr Addr, ifi *Interface) *TCPConn {
+	c := &TCPConn{
+		s:        s,
+		laddr:    laddr,
+		raddr:    raddr,
+		mss:      ifi.MTU - ipHeaderLen(raddr.IP) - tcpHeaderLen,
+		ssthresh: 1 << 30,
+		rto:      tcpInitialRTO,
+		iss:      s.rand.Uint32(),
+	}
+	if max := 0xffff - ipv4HeaderLen - tcpHeaderLen; c.mss > max {
+		c.mss = max
+	}
+	c.sndUna = c.iss
+	c.sndNxt = c.iss + 1
+	c.sndMax = c.sndNxt
+	return c
+}
+
+// setPeerMSS limits the segment size to the MSS option of the peer.
+func (c *TCPConn) setPeerMSS(mss int) {
+	if mss == 0 {
+		mss = tcpDefaultMSS
+	}
+	if mss < c.mss {
+		c.mss = mss
+	}
+	c.cwnd = tcpInitialCwnd * c.mss
+}
+
+// tcpPortInUse reports whether a listener or connection uses local port.
+func (s *Stack) tcpPortInUse(port int) bool {
+	if len(s.tcpListeners[port]) > 0 {
+		return true
+	}
+	for k := range s.tcpConns {
+		if k.local.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// DialTCP connects to raddr. If the port of laddr is zero, a port is chosen.
+func (s *Stack) DialTCP(ctx context.Context, laddr, raddr Addr) (*TCPConn, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	if raddr.IP.IsUnspecified() {
+		raddr.IP = IPv4(127, 0, 0, 1)
+	}
+	if s.isBroadcast(raddr.IP) || raddr.IP.IsMulticast() {
+		return nil, syscall.ENETUNREACH
+	}
+	if !familyOK(laddr.IP, false, raddr.IP) {
+		return nil, syscall.EAFNOSUPPORT
+	}
+	ifi, _, src, err := s.route(raddr.IP)
+	if err != nil {
+		return nil, err
+	}
+	if !laddr.IP.IsUnspecified() {
+		if !s.isLocal(laddr.IP) {
+			return nil, syscall.EADDRNOTAVAIL
+		}
+		src = laddr.IP
+	}
+	laddr.IP = src
+	if laddr.Port == 0 {
+		laddr.Port = s.ephemeralPort(s.tcpPortInUse)
+		if laddr.Port == 0 {
+			return nil, syscall.EADDRNOTAVAIL
+		}
+	} else if s.tcpConns[tcpKey{laddr, raddr}] != nil {
+		return nil, syscall.EADDRINUSE
+	}
+
+	c := s.newTCPConn(laddr, raddr, ifi)
+	c.state = tcpSynSent
+	s.tcpConns[tcpKey{laddr, raddr}] = c
+	c.send(tcpSYN, c.iss, nil)
+	c.armRTX()
+
+	for c.state == tcpSynSent || c.state == tcpSynRcvd {
+		if err := s.wait(ctx, &c.wev, nil); err != nil {
+			if c.state == tcpSynSent || c.state == tcpSynRcvd {
+				c.send(tcpRST|tcpACK, c.sndMax, nil)
+				c.remove()
+			}
+			return nil, err
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c, nil
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *TCPConn) LocalAddr() Addr {
+	return c.laddr
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (c *TCPConn) RemoteAddr() Addr {
+	return c.raddr
+}
+
+// Read reads received data into p.
+func (c *TCPConn) Read(p []byte) (int, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	for {
+		if c.closed {
+			return 0, poll.ErrNetClosing
+		}
+		if c.rdeadline.expired() {
+			return 0, poll.ErrTimeout
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if len(c.rcvBuf) > 0 {
+			n := copy(p, c.rcvBuf)
+			c.rcvBuf = c.rcvBuf[n:]
+			if len(c.rcvBuf) == 0 {
+				c.rcvBuf = nil
+			}
+			c.windowUpdate()
+			return n, nil
+		}
+		if c.finRcvd || c.readShut {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if err := s.wait(background, &c.rev, &c.rdeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write queues p for sending, blocking while the send buffer is full.
+func (c *TCPConn) Write(p []byte) (int, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	n := 0
+	for {
+		if c.closed {
+			return n, poll.ErrNetClosing
+		}
+		if c.wdeadline.expired() {
+			return n, poll.ErrTimeout
+		}
+		if c.err != nil {
+			return n, c.err
+		}
+		if c.writeShut || (c.state != tcpEstablished && c.state != tcpCloseWait) {
+			return n, syscall.EPIPE
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		if space := tcpSndBufSize - len(c.sndBuf); space > 0 {
+			m := len(p) - n
+			if m > space {
+				m = space
+			}
+			c.sndBuf = append(c.sndBuf, p[n:n+m]...)
+			n += m
+			c.output()
+			continue
+		}
+		if err := s.wait(background, &c.wev, &c.wdeadline); err != nil {
+			return n, err
+		}
+	}
+}
+
+// CloseRead discards received data, further reads return EOF.
+func (c *TCPConn) CloseRead() error {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	if c.closed {
+		return poll.ErrNetClosing
+	}
+	c.readShut = true
+	c.rcvBuf = nil
+	c.rev.signal()
+	return nil
+}
+
+// CloseWrite sends a FIN after the data written so far.
+func (c *TCPConn) CloseWrite() error {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	if c.closed {
+		return poll.ErrNetClosing
+	}
+	c.shutdownWrite()
+	return nil
+}
+
+func (c *TCPConn) shutdownWrite() {
+	c.writeShut = true
+	c.wev.signal()
+	if !c.finQueue && c.state != tcpClosed {
+		c.finQueue = true
+		c.output()
+	}
+}
+
+// Close closes the connection. Data written before is still sent. If
+// received data was not read, the connection is reset instead.
+func (c *TCPConn) Close() error {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	if c.closed {
+		return poll.ErrNetClosing
+	}
+	c.closed = true
+	c.readShut = true
+	c.rev.signal()
+	switch c.state {
+	case tcpClosed:
+		return nil
+	case tcpSynSent:
+		c.remove()
+		return nil
+	}
+	if len(c.rcvBuf) > 0 {
+		c.send(tcpRST|tcpACK, c.sndMax, nil)
+		c.remove()
+		return nil
+	}
+	c.shutdownWrite()
+	if c.state == tcpFinWait2 {
+		c.setTimer(tcpFinWait2Timeout, c.remove)
+	}
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read.
+func (c *TCPConn) SetReadDeadline(t time.Time) error {
+	c.rdeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write.
+func (c *TCPConn) SetWriteDeadline(t time.Time) error {
+	c.wdeadline.set(t)
+	return nil
+}
+
+// remove removes the connection from the stack.
+func (c *TCPConn) remove() {
+	s := c.s
+	k := tcpKey{c.laddr, c.raddr}
+	if s.tcpConns[k] == c {
+		delete(s.tcpConns, k)
+	}
+	if c.listener != nil {
+		c.listener.pending--
+		c.listener = nil
+	}
+	c.stopTimer()
+	c.state = tcpClosed
+	c.ooo = nil
+	c.rev.signal()
+	c.wev.signal()
+}
+
+// abort closes the connection because of err.
+func (c *TCPConn) abort(err error) {
+	c.err = err
+	c.sndBuf = nil
+	c.rcvBuf = nil
+	c.remove()
+}
+
+func (c *TCPConn) setTimer(d time.Duration, f func()) {
+	c.stopTimer()
+	gen := c.timerGen
+	c.timer = time.AfterFunc(d, func() {
+		s := c.s
+		s.mu.Lock()
+		defer s.unlock()
+		if c.timerGen == gen {
+			c.timer = nil
+			c.rtxArmed = false
+			f()
+		}
+	})
+}
+
+func (c *TCPConn) stopTimer() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.timerGen++
+	c.rtxArmed = false
+}
+
+// armRTX starts the retransmission timer if it is not running.
+func (c *TCPConn) armRTX() {
+	if !c.rtxArmed {
+		c.setTimer(c.rto, c.rtxTimeout)
+		c.rtxArmed = true
+	}
+}
+
+// rcvWindow returns the receive window to advertise.
+func (c *TCPConn) rcvWindow() int {
+	return tcpRcvBufSize - len(c.rcvBuf)
+}
+
+// send sends a segment with flags, starting at sequence number seq.
+func (c *TCPConn) send(flags byte, seq uint32, data []byte) {
+	hlen := tcpHeaderLen
+	if flags&tcpSYN != 0 {
+		hlen += 4
+	}
+	b := make([]byte, hlen+len(data))
+	put16(b[0:], uint16(c.laddr.Port))
+	put16(b[2:], uint16(c.raddr.Port))
+	put32(b[4:], seq)
+	if flags&tcpACK != 0 {
+		put32(b[8:], c.rcvNxt)
+	}
+	b[12] = byte(hlen/4) << 4
+	b[13] = flags
+	wnd := c.rcvWindow()
+	put16(b[14:], uint16(wnd))
+	if flags&tcpSYN != 0 {
+		b[20] = 2 // MSS.
+		b[21] = 4
+		put16(b[22:], uint16(c.mss))
+	}
+	copy(b[hlen:], data)
+	put16(b[16:], checksum(b, pseudoHeaderSum(c.laddr.IP, c.raddr.IP, protoTCP, len(b))))
+	c.lastAdvWnd = wnd
+	c.s.sendIP(c.laddr.IP, c.raddr.IP, protoTCP, b)
+}
+
+func (c *TCPConn) sendACK() {
+	c.send(tcpACK, c.sndNxt, nil)
+}
+
+// windowUpdate sends an ACK after reading from the receive buffer if the
+// window has opened significantly since it was last advertised.
+func (c *TCPConn) windowUpdate() {
+	if c.state != tcpEstablished && c.state != tcpFinWait1 && c.state != tcpFinWait2 {
+		return
+	}
+	min := 2 * c.mss
+	if min > tcpRcvBufSize/2 {
+		min = tcpRcvBufSize / 2
+	}
+	if c.rcvWindow()-c.lastAdvWnd >= min {
+		c.sendACK()
+	}
+}
+
+// output sends as much queued data as the windows allow, and a FIN when
+// all data has been sent.
+func (c *TCPConn) output() {
+	switch c.state {
+	case tcpEstablished, tcpCloseWait, tcpFinWait1, tcpClosing, tcpLastAck:
+	default:
+		return
+	}
+	for {
+		if c.finSent && c.sndNxt == c.finSeq+1 {
+			return
+		}
+		inflight := int(c.sndNxt - c.sndUna)
+		wnd := int(c.sndWnd)
+		if c.cwnd < wnd {
+			wnd = c.cwnd
+		}
+		n := len(c.sndBuf) - inflight
+		if n > c.mss {
+			n = c.mss
+		}
+		if n > wnd-inflight {
+			n = wnd - inflight
+		}
+		if n > 0 {
+			flags := byte(tcpACK)
+			if inflight+n == len(c.sndBuf) {
+				flags |= tcpPSH
+			}
+			if !c.rttTiming {
+				c.rttTiming = true
+				c.rttSeq = c.sndNxt + uint32(n)
+				c.rttStart = time.Now()
+			}
+			c.send(flags, c.sndNxt, c.sndBuf[inflight:inflight+n])
+			c.sndNxt += uint32(n)
+			c.updateMax()
+			c.armRTX()
+			continue
+		}
+		if inflight == len(c.sndBuf) && c.finQueue {
+			c.send(tcpFIN|tcpACK, c.sndNxt, nil)
+			if !c.finSent {
+				c.finSent = true
+				c.finSeq = c.sndNxt
+				switch c.state {
+				case tcpEstablished:
+					c.state = tcpFinWait1
+				case tcpCloseWait:
+					c.state = tcpLastAck
+				}
+			}
+			c.sndNxt++
+			c.updateMax()
+			c.armRTX()
+		} else if inflight < len(c.sndBuf) && inflight == 0 && c.sndWnd == 0 {
+			// Zero window, probe with the retransmission timer.
+			c.armRTX()
+		}
+		return
+	}
+}
+
+// sendFirst sends the first unacknowledged segment, ignoring the windows
+// except for sending at most 1 byte into a zero window.
+func (c *TCPConn) sendFirst() {
+	n := len(c.sndBuf)
+	if n > c.mss {
+		n = c.mss
+	}
+	if n > int(c.sndWnd) {
+		n = int(c.sndWnd)
+		if n == 0 {
+			n = 1
+		}
+	}
+	end := c.sndUna + uint32(n)
+	if n > 0 {
+		c.send(tcpACK|tcpPSH, c.sndUna, c.sndBuf[:n])
+	} else if c.finSent {
+		c.send(tcpFIN|tcpACK, c.sndUna, nil)
+		end++
+	}
+	if seqLT(c.sndNxt, end) {
+		c.sndNxt = end
+	}
+	c.updateMax()
+}
+
+func (c *TCPConn) updateMax() {
+	if seqGT(c.sndNxt, c.sndMax) {
+		c.sndMax = c.sndNxt
+	}
+}
+
+func (c *TCPConn) rtxTimeout() {
+	switch c.state {
+	case tcpSynSent, tcpSynRcvd, tcpEstablished, tcpCloseWait, tcpFinWait1, tcpClosing, tcpLastAck:
+	default:
+		return
+	}
+	max := tcpRetries
+	if c.state == tcpSynSent || c.state == tcpSynRcvd {
+		max = tcpSynRetries
+	}
+	c.retries++
+	if c.retries > max {
+		if c.listener != nil {
+			c.remove()
+		} else {
+			c.abort(syscall.ETIMEDOUT)
+		}
+		return
+	}
+	c.rto *= 2
+	if c.rto > tcpMaxRTO {
+		c.rto = tcpMaxRTO
+	}
+	c.rttTiming = false
+	switch c.state {
+	case tcpSynSent:
+		c.send(tcpSYN, c.iss, nil)
+	case tcpSynRcvd:
+		c.send(tcpSYN|tcpACK, c.iss, nil)
+	default:
+		if c.sndUna == c.sndMax && !(len(c.sndBuf) > 0 && c.sndWnd == 0) {
+			return
+		}
+		if c.sndWnd > 0 {
+			c.ssthresh = c.flightSize() / 2
+			if c.ssthresh < 2*c.mss {
+				c.ssthresh = 2 * c.mss
+			}
+			c.cwnd = c.mss
+			c.recover = false
+			c.dupAcks = 0
+		}
+		// Go back N.
+		c.sndNxt = c.sndUna
+		c.sendFirst()
+		c.output()
+	}
+	c.armRTX()
+}
+
+func (c *TCPConn) flightSize() int {
+	return int(c.sndMax - c.sndUna)
+}
+
+func (s *Stack) inputTCP(src, dst IP, b []byte) {
+	if len(b) < tcpHeaderLen || checksum(b, pseudoHeaderSum(src, dst, protoTCP, len(b))) != 0 {
+		return
+	}
+	h, data, ok := parseTCP(b)
+	if !ok || s.isBroadcast(dst) || dst.IsMulticast() {
+		return
+	}
+	k := tcpKey{Addr{dst, h.dport}, Addr{src, h.sport}}
+	if c := s.tcpConns[k]; c != nil {
+		if c.state != tcpTimeWait || h.flags&(tcpSYN|tcpACK|tcpRST) != tcpSYN || !seqGT(h.seq, c.rcvNxt) {
+			c.input(&h, data)
+			return
+		}
+		// New connection reusing the addresses of a connection in TIME-WAIT.
+		c.remove()
+	}
+	if h.flags&tcpRST != 0 {
+		return
+	}
+	if h.flags&(tcpSYN|tcpACK) == tcpSYN {
+		if l := s.lookupListener(k.local); l != nil {
+			l.inputSYN(k, &h)
+			return
+		}
+	}
+	s.sendTCPReset(k, &h, len(data))
+}
+
+// sendTCPReset sends a reset in response to a segment for which there is
+// no connection.
+func (s *Stack) sendTCPReset(k tcpKey, h *tcpHeader, n int) {
+	c := &TCPConn{s: s, laddr: k.local, raddr: k.remote}
+	if h.flags&tcpACK != 0 {
+		c.send(tcpRST, h.ack, nil)
+		return
+	}
+	if h.flags&tcpSYN != 0 {
+		n++
+	}
+	if h.flags&tcpFIN != 0 {
+		n++
+	}
+	c.rcvNxt = h.seq + uint32(n)
+	c.send(tcpRST|tcpACK, 0, nil)
+}
+
+// input processes a segment for the connection, following "SEGMENT ARRIVES"
+// in RFC 793.
+func (c *TCPConn) input(h *tcpHeader, data []byte) {
+	if c.state == tcpSynSent {
+		c.inputSynSent(h)
+		return
+	}
+
+	// Check the sequence number.
+	n := len(data)
+	if h.flags&tcpSYN != 0 {
+		n++
+	}
+	if h.flags&tcpFIN != 0 {
+		n++
+	}
+	wnd := uint32(c.rcvWindow())
+	if !c.acceptable(h.seq, n, wnd) {
+		if h.flags&tcpRST != 0 {
+			return
+		}
+		if c.state == tcpSynRcvd && h.flags&tcpSYN != 0 && h.seq == c.irs {
+			// Our SYN-ACK was lost.
+			c.send(tcpSYN|tcpACK, c.iss, nil)
+			return
+		}
+		if wnd == 0 && h.seq == c.rcvNxt && h.flags&tcpACK != 0 {
+			// Process the acknowledgment of a segment that does not fit
+			// in our closed window.
+			if !c.inputACK(h, 0) {
+				return
+			}
+		}
+		c.sendACK()
+		return
+	}
+
+	if h.flags&tcpRST != 0 {
+		switch c.state {
+		case tcpSynRcvd:
+			if c.listener != nil {
+				c.remove()
+			} else {
+				c.abort(syscall.ECONNREFUSED)
+			}
+		case tcpEstablished, tcpFinWait1, tcpFinWait2, tcpCloseWait:
+			c.abort(syscall.ECONNRESET)
+		default:
+			c.remove()
+		}
+		return
+	}
+
+	if h.flags&tcpSYN != 0 {
+		c.send(tcpRST|tcpACK, c.sndMax, nil)
+		c.abort(syscall.ECONNRESET)
+		return
+	}
+
+	if h.flags&tcpACK == 0 {
+		return
+	}
+	if c.state == tcpSynRcvd {
+		if !seqLT(c.sndUna, h.ack) || !seqLE(h.ack, c.sndNxt) {
+			(&TCPConn{s: c.s, laddr: c.laddr, raddr: c.raddr}).send(tcpRST, h.ack, nil)
+			return
+		}
+		c.established(h)
+		if c.state == tcpClosed {
+			return
+		}
+	}
+	if !c.inputACK(h, len(data)) {
+		return
+	}
+
+	fin := h.flags&tcpFIN != 0
+	if len(data) > 0 || fin {
+		switch c.state {
+		case tcpEstablished, tcpFinWait1, tcpFinWait2:
+		default:
+			// FIN already received, ignore.
+			return
+		}
+		if c.closed && len(data) > 0 {
+			// Nobody will read the data.
+			c.send(tcpRST|tcpACK, c.sndMax, nil)
+			c.abort(syscall.ECONNRESET)
+			return
+		}
+		c.inputData(h.seq, data, fin)
+		c.sendACK()
+	}
+}
+
+// acceptable reports whether a segment of length n at seq overlaps with the
+// receive window.
+func (c *TCPConn) acceptable(seq uint32, n int, wnd uint32) bool {
+	inWindow := func(x uint32) bool {
+		return seqLE(c.rcvNxt, x) && seqLT(x, c.rcvNxt+wnd)
+	}
+	if n == 0 {
+		if wnd == 0 {
+			return seq == c.rcvNxt
+		}
+		return inWindow(seq)
+	}
+	return wnd > 0 && (inWindow(seq) || inWindow(seq+uint32(n)-1))
+}
+
+func (c *TCPConn) inputSynSent(h *tcpHeader) {
+	if h.flags&tcpACK != 0 && h.ack != c.iss+1 {
+		if h.flags&tcpRST == 0 {
+			(&TCPConn{s: c.s, laddr: c.laddr, raddr: c.raddr}).send(tcpRST, h.ack, nil)
+		}
+		return
+	}
+	if h.flags&tcpRST != 0 {
+		if h.flags&tcpACK != 0 {
+			c.abort(syscall.ECONNREFUSED)
+		}
+		return
+	}
+	if h.flags&tcpSYN == 0 {
+		return
+	}
+	c.irs = h.seq
+	c.rcvNxt = h.seq + 1
+	c.setPeerMSS(h.mss)
+	if h.flags&tcpACK == 0 {
+		// Simultaneous open.
+		c.state = tcpSynRcvd
+		c.sndWnd = h.wnd
+		c.sndWl1 = h.seq
+		c.send(tcpSYN|tcpACK, c.iss, nil)
+		return
+	}
+	c.established(h)
+	c.sendACK()
+}
+
+// established moves the connection to ESTABLISHED after our SYN was
+// acknowledged by h.
+func (c *TCPConn) established(h *tcpHeader) {
+	c.state = tcpEstablished
+	c.sndUna = h.ack
+	c.sndWnd = h.wnd
+	c.sndWl1 = h.seq
+	c.sndWl2 = h.ack
+	c.retries = 0
+	c.rto = tcpInitialRTO
+	c.stopTimer()
+	c.wev.signal()
+	if l := c.listener; l != nil {
+		c.listener = nil
+		l.pending--
+		if l.closed {
+			c.send(tcpRST|tcpACK, c.sndMax, nil)
+			c.remove()
+			return
+		}
+		l.queue = append(l.queue, c)
+		l.ev.signal()
+	}
+}
+
+// inputACK processes the acknowledgment and window of a segment with n
+// bytes of data. It returns false if the segment must not be processed
+// further.
+func (c *TCPConn) inputACK(h *tcpHeader, n int) bool {
+	switch {
+	case seqGT(h.ack, c.sndMax):
+		c.sendACK()
+		return false
+	case h.ack == c.sndUna:
+		if n == 0 && h.flags&(tcpSYN|tcpFIN) == 0 && h.wnd == c.sndWnd && c.sndWnd > 0 && c.sndMax != c.sndUna {
+			c.dupAck()
+		}
+		if c.sndWnd == 0 {
+			// Peer is responding to our window probes.
+			c.retries = 0
+		}
+	case seqGT(h.ack, c.sndUna):
+		c.newAck(h.ack)
+	}
+
+	if seqLT(c.sndWl1, h.seq) || (c.sndWl1 == h.seq && seqLE(c.sndWl2, h.ack)) {
+		c.sndWnd = h.wnd
+		c.sndWl1 = h.seq
+		c.sndWl2 = h.ack
+	}
+
+	if c.finSent && c.sndUna == c.finSeq+1 {
+		switch c.state {
+		case tcpFinWait1:
+			c.state = tcpFinWait2
+			if c.closed {
+				c.setTimer(tcpFinWait2Timeout, c.remove)
+			}
+		case tcpClosing:
+			c.timeWait()
+			return false
+		case tcpLastAck:
+			c.remove()
+			return false
+		}
+	}
+	c.output()
+	return true
+}
+
+// newAck processes an acknowledgment for new data.
+func (c *TCPConn) newAck(ack uint32) {
+	n := int(ack - c.sndUna)
+	if c.finSent && ack == c.finSeq+1 {
+		n--
+	}
+	c.sndBuf = c.sndBuf[n:]
+	if len(c.sndBuf) == 0 {
+		c.sndBuf = nil
+	}
+	c.sndUna = ack
+	if seqLT(c.sndNxt, ack) {
+		c.sndNxt = ack
+	}
+	c.retries = 0
+
+	if c.rttTiming && seqLE(c.rttSeq, ack) {
+		c.rttTiming = false
+		c.updateRTO(time.Since(c.rttStart))
+	}
+
+	if c.recover {
+		c.recover = false
+		c.cwnd = c.ssthresh
+	} else if c.cwnd < c.ssthresh {
+		if n > c.mss {
+			n = c.mss
+		}
+		c.cwnd += n
+	} else {
+		c.cwnd += c.mss * c.mss / c.cwnd
+	}
+	c.dupAcks = 0
+
+	c.stopTimer()
+	if c.sndUna != c.sndMax {
+		c.armRTX()
+	}
+	c.wev.signal()
+}
+
+// dupAck handles a duplicate acknowledgment, starting fast retransmit after
+// three of them.
+func (c *TCPConn) dupAck() {
+	c.dupAcks++
+	switch {
+	case c.dupAcks == 3:
+		c.ssthresh = c.flightSize() / 2
+		if c.ssthresh < 2*c.mss {
+			c.ssthresh = 2 * c.mss
+		}
+		c.rttTiming = false
+		c.sendFirst()
+		c.cwnd = c.ssthresh + 3*c.mss
+		c.recover = true
+	case c.dupAcks > 3:
+		c.cwnd += c.mss
+		c.output()
+	}
+}
+
+func (c *TCPConn) updateRTO(rtt time.Duration) {
+	if c.srtt == 0 {
+		c.srtt = rtt
+		c.rttvar = rtt / 2
+	} else {
+		d := c.srtt - rtt
+		if d < 0 {
+			d = -d
+		}
+		c.rttvar = (3*c.rttvar + d) / 4
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+	c.rto = c.srtt + 4*c.rttvar
+	if c.rto < tcpMinRTO {
+		c.rto = tcpMinRTO
+	}
+	if c.rto > tcpMaxRTO {
+		c.rto = tcpMaxRTO
+	}
+}
+
+// inputData processes the data and FIN of a segment starting at seq.
+func (c *TCPConn) inputData(seq uint32, data []byte, fin bool) {
+	if seqLT(seq, c.rcvNxt) {
+		d := int(c.rcvNxt - seq)
+		if d > len(data) {
+			// Only an old FIN.
+			return
+		}
+		data = data[d:]
+		seq = c.rcvNxt
+	}
+	if wnd := c.rcvWindow(); len(data) > wnd {
+		data = data[:wnd]
+		fin = false
+	}
+	if seq != c.rcvNxt {
+		if len(c.ooo) < tcpMaxOOO {
+			c.ooo = append(c.ooo, tcpSegment{seq, append([]byte(nil), data...), fin})
+		}
+		return
+	}
+	c.deliver(data, fin)
+
+	// Deliver queued segments that are now in order.
+	for progress := true; progress && c.state != tcpClosed; {
+		progress = false
+		for i := 0; i < len(c.ooo); i++ {
+			seg := c.ooo[i]
+			if seqGT(seg.seq, c.rcvNxt) {
+				continue
+			}
+			c.ooo = append(c.ooo[:i], c.ooo[i+1:]...)
+			i--
+			d := int(c.rcvNxt - seg.seq)
+			if d > len(seg.data) || (d == len(seg.data) && !seg.fin) {
+				continue
+			}
+			c.deliver(seg.data[d:], seg.fin)
+			progress = true
+		}
+	}
+}
+
+// deliver adds in order data to the receive buffer, and processes a FIN.
+func (c *TCPConn) deliver(data []byte, fin bool) {
+	if c.finRcvd {
+		return
+	}
+	if len(data) > 0 {
+		if !c.readShut {
+			c.rcvBuf = append(c.rcvBuf, data...)
+		}
+		c.rcvNxt += uint32(len(data))
+		c.rev.signal()
+	}
+	if !fin {
+		return
+	}
+	c.rcvNxt++
+	c.finRcvd = true
+	c.ooo = nil
+	c.rev.signal()
+	switch c.state {
+	case tcpEstablished:
+		c.state = tcpCloseWait
+	case tcpFinWait1:
+		c.state = tcpClosing
+	case tcpFinWait2:
+		c.timeWait()
+	}
+}
+
+func (c *TCPConn) timeWait() {
+	c.state = tcpTimeWait
+	c.setTimer(tcpTimeWaitTimeout, c.remove)
+	c.rev.signal()
+	c.wev.signal()
+}
+
+// A TCPListener accepts TCP connections.
+type TCPListener struct {
+	s        *Stack
+	addr     Addr
+	v6only   bool
+	backlog  int
+	queue    []*TCPConn // Established, not yet accepted.
+	pending  int        // Connections in SYN-RECEIVED.
+	closed   bool
+	ev       event
+	deadline deadline
+}
+
+// ListenTCP returns a listener for connections to laddr. If the port of
+// laddr is zero, a port is chosen. At most backlog connections are queued
+// waiting for Accept. A listener for the zero IP accepts IPv4 and IPv6
+// connections, unless v6only is set, one for 0.0.0.0 only IPv4 connections.
+func (s *Stack) ListenTCP(laddr Addr, backlog int, v6only bool) (*TCPListener, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if !laddr.IP.IsUnspecified() && !s.isLocal(laddr.IP) {
+		return nil, syscall.EADDRNOTAVAIL
+	}
+	if laddr.Port == 0 {
+		laddr.Port = s.ephemeralPort(s.tcpPortInUse)
+		if laddr.Port == 0 {
+			return nil, syscall.EADDRINUSE
+		}
+	}
+	for _, x := range s.tcpListeners[laddr.Port] {
+		if bindConflict(x.addr.IP, x.v6only, laddr.IP, v6only) {
+			return nil, syscall.EADDRINUSE
+		}
+	}
+	if backlog < 1 {
+		backlog = 1
+	}
+	l := &TCPListener{s: s, addr: laddr, v6only: v6only, backlog: backlog}
+	s.tcpListeners[laddr.Port] = append(s.tcpListeners[laddr.Port], l)
+	return l, nil
+}
+
+// lookupListener returns the listener for connections to addr, preferring
+// a listener for the address over a wildcard listener.
+func (s *Stack) lookupListener(addr Addr) *TCPListener {
+	var wildcard *TCPListener
+	for _, l := range s.tcpListeners[addr.Port] {
+		if l.addr.IP == addr.IP {
+			return l
+		}
+		if l.addr.IP.IsUnspecified() && matchLocal(l.addr.IP, l.v6only, addr.IP) {
+			wildcard = l
+		}
+	}
+	return wildcard
+}
+
+func (l *TCPListener) inputSYN(k tcpKey, h *tcpHeader) {
+	if len(l.queue)+l.pending >= l.backlog {
+		// The peer will retransmit its SYN.
+		return
+	}
+	s := l.s
+	ifi, _, _, err := s.route(k.remote.IP)
+	if err != nil {
+		return
+	}
+	c := s.newTCPConn(k.local, k.remote, ifi)
+	c.state = tcpSynRcvd
+	c.listener = l
+	l.pending++
+	c.irs = h.seq
+	c.rcvNxt = h.seq + 1
+	c.sndWnd = h.wnd
+	c.sndWl1 = h.seq
+	c.setPeerMSS(h.mss)
+	s.tcpConns[k] = c
+	c.send(tcpSYN|tcpACK, c.iss, nil)
+	c.armRTX()
+}
+
+// Addr returns the address of the listener.
+func (l *TCPListener) Addr() Addr {
+	return l.addr
+}
+
+// Accept waits for and returns the next connection.
+func (l *TCPListener) Accept() (*TCPConn, error) {
+	s := l.s
+	s.mu.Lock()
+	defer s.unlock()
+	for {
+		if l.closed {
+			return nil, poll.ErrNetClosing
+		}
+		if l.deadline.expired() {
+			return nil, poll.ErrTimeout
+		}
+		if len(l.queue) > 0 {
+			c := l.queue[0]
+			l.queue[0] = nil
+			l.queue = l.queue[1:]
+			return c, nil
+		}
+		if err := s.wait(background, &l.ev, &l.deadline); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close stops listening, and resets connections not yet accepted.
+func (l *TCPListener) Close() error {
+	s := l.s
+	s.mu.Lock()
+	defer s.unlock()
+	if l.closed {
+		return poll.ErrNetClosing
+	}
+	l.closed = true
+	ll := s.tcpListeners[l.addr.Port]
+	for i, x := range ll {
+		if x == l {
+			ll = append(ll[:i:i], ll[i+1:]...)
+			break
+		}
+	}
+	if len(ll) == 0 {
+		delete(s.tcpListeners, l.addr.Port)
+	} else {
+		s.tcpListeners[l.addr.Port] = ll
+	}
+	for _, c := range l.queue {
+		if c.state != tcpClosed {
+			c.send(tcpRST|tcpACK, c.sndMax, nil)
+			c.remove()
+		}
+	}
+	l.queue = nil
+	l.ev.signal()
+	return nil
+}
+
+// SetDeadline sets the deadline for Accept.
+func (l *TCPListener) SetDeadline(t time.Time) error {
+	l.deadline.set(t)
+	return nil
+}
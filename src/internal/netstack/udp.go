@@ -0,0 +1,280 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstack
+
+import (
+	"internal/poll"
+	"syscall"
+	"time"
+)
+
+const (
+	udpHeaderLen  = 8
+	udpMaxPayload = 0xffff - ipv4HeaderLen - udpHeaderLen
+	udpQueueMax   = 256 << 10 // Bytes of received datagrams queued per endpoint.
+)
+
+// A UDPConn is a UDP endpoint.
+type UDPConn struct {
+	s      *Stack
+	laddr  Addr
+	raddr  Addr // Zero if not connected.
+	v6only bool
+	queue  []datagram
+	queued int   // Bytes in queue.
+	err    error // Asynchronous error, returned by the next read.
+	closed bool
+
+	rev       event
+	rdeadline deadline
+	wdeadline deadline
+}
+
+type datagram struct {
+	from Addr
+	data []byte
+}
+
+// ListenUDP returns a UDP endpoint bound to laddr. If the port of laddr is
+// zero, a port is chosen. If the IP of raddr is not zero, the endpoint is
+// connected to raddr, and only receives datagrams from raddr. An endpoint
+// bound to the zero IP is for IPv4 and IPv6, unless v6only is set, one bound
+// to 0.0.0.0 only for IPv4.
+func (s *Stack) ListenUDP(laddr, raddr Addr, v6only bool) (*UDPConn, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	if !laddr.IP.IsUnspecified() && !s.isLocal(laddr.IP) {
+		return nil, syscall.EADDRNOTAVAIL
+	}
+	if raddr.IP != (IP{}) {
+		if raddr.IP.IsUnspecified() {
+			raddr.IP = IPv4(127, 0, 0, 1)
+		}
+		if !familyOK(laddr.IP, v6only, raddr.IP) {
+			return nil, syscall.EAFNOSUPPORT
+		}
+		_, _, src, err := s.route(raddr.IP)
+		if err != nil {
+			return nil, err
+		}
+		if laddr.IP.IsUnspecified() {
+			laddr.IP = src
+		}
+	} else {
+		raddr = Addr{}
+	}
+	if laddr.Port == 0 {
+		laddr.Port = s.ephemeralPort(func(port int) bool {
+			return len(s.udp[port]) > 0
+		})
+		if laddr.Port == 0 {
+			return nil, syscall.EADDRINUSE
+		}
+	}
+	for _, x := range s.udp[laddr.Port] {
+		if bindConflict(x.laddr.IP, x.v6only, laddr.IP, v6only) {
+			return nil, syscall.EADDRINUSE
+		}
+	}
+	c := &UDPConn{s: s, laddr: laddr, raddr: raddr, v6only: v6only}
+	s.udp[laddr.Port] = append(s.udp[laddr.Port], c)
+	return c, nil
+}
+
+// LocalAddr returns the address the endpoint is bound to.
+func (c *UDPConn) LocalAddr() Addr {
+	return c.laddr
+}
+
+// RemoteAddr returns the address the endpoint is connected to, zero if not connected.
+func (c *UDPConn) RemoteAddr() Addr {
+	return c.raddr
+}
+
+// ReadFrom reads a datagram into p. Datagrams larger than p are truncated.
+func (c *UDPConn) ReadFrom(p []byte) (n int, from Addr, err error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	for {
+		if c.closed {
+			return 0, Addr{}, poll.ErrNetClosing
+		}
+		if c.rdeadline.expired() {
+			return 0, Addr{}, poll.ErrTimeout
+		}
+		if c.err != nil {
+			err, c.err = c.err, nil
+			return 0, Addr{}, err
+		}
+		if len(c.queue) > 0 {
+			d := c.queue[0]
+			c.queue[0] = datagram{}
+			c.queue = c.queue[1:]
+			c.queued -= len(d.data)
+			return copy(p, d.data), d.from, nil
+		}
+		if err := s.wait(background, &c.rev, &c.rdeadline); err != nil {
+			return 0, Addr{}, err
+		}
+	}
+}
+
+// WriteTo sends p as a datagram to addr. For a connected endpoint, addr must be zero.
+func (c *UDPConn) WriteTo(p []byte, addr Addr) (int, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	if c.closed {
+		return 0, poll.ErrNetClosing
+	}
+	if c.wdeadline.expired() {
+		return 0, poll.ErrTimeout
+	}
+	if addr == (Addr{}) {
+		if c.raddr == (Addr{}) {
+			return 0, syscall.EDESTADDRREQ
+		}
+		addr = c.raddr
+	} else if c.raddr != (Addr{}) {
+		return 0, syscall.EISCONN
+	}
+	if addr.IP.IsUnspecified() {
+		addr.IP = IPv4(127, 0, 0, 1)
+	}
+	if !familyOK(c.laddr.IP, c.v6only, addr.IP) {
+		return 0, syscall.EAFNOSUPPORT
+	}
+	if len(p) > udpMaxPayload {
+		return 0, syscall.EMSGSIZE
+	}
+	_, _, src, err := s.route(addr.IP)
+	if err != nil {
+		return 0, err
+	}
+	if !c.laddr.IP.IsUnspecified() {
+		src = c.laddr.IP
+	}
+	b := make([]byte, udpHeaderLen+len(p))
+	put16(b[0:], uint16(c.laddr.Port))
+	put16(b[2:], uint16(addr.Port))
+	put16(b[4:], uint16(len(b)))
+	copy(b[udpHeaderLen:], p)
+	sum := checksum(b, pseudoHeaderSum(src, addr.IP, protoUDP, len(b)))
+	if sum == 0 {
+		sum = 0xffff
+	}
+	put16(b[6:], sum)
+	if err := s.sendIP(src, addr.IP, protoUDP, b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the endpoint, unblocking readers.
+func (c *UDPConn) Close() error {
+	s := c.s
+	s.mu.Lock()
+	defer s.unlock()
+	if c.closed {
+		return poll.ErrNetClosing
+	}
+	c.closed = true
+	c.queue = nil
+	l := s.udp[c.laddr.Port]
+	for i, x := range l {
+		if x == c {
+			l = append(l[:i:i], l[i+1:]...)
+			break
+		}
+	}
+	if len(l) == 0 {
+		delete(s.udp, c.laddr.Port)
+	} else {
+		s.udp[c.laddr.Port] = l
+	}
+	c.rev.signal()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for ReadFrom.
+func (c *UDPConn) SetReadDeadline(t time.Time) error {
+	c.rdeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for WriteTo.
+func (c *UDPConn) SetWriteDeadline(t time.Time) error {
+	c.wdeadline.set(t)
+	return nil
+}
+
+// lookupUDP returns the endpoint for a datagram from src to dst. Connected
+// endpoints are preferred over endpoints bound to an address, which are
+// preferred over endpoints bound to the wildcard address.
+func (s *Stack) lookupUDP(src, dst Addr) *UDPConn {
+	var best *UDPConn
+	bestScore := -1
+	for _, c := range s.udp[dst.Port] {
+		score := 0
+		if c.raddr != (Addr{}) {
+			if c.raddr != src {
+				continue
+			}
+			score += 2
+		}
+		if !matchLocal(c.laddr.IP, c.v6only, dst.IP) {
+			continue
+		}
+		if !c.laddr.IP.IsUnspecified() {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// inputUDP processes a UDP datagram b in IP packet pkt.
+func (s *Stack) inputUDP(src, dst IP, b, pkt []byte) {
+	if len(b) < udpHeaderLen {
+		return
+	}
+	n := int(be16(b[4:]))
+	if n < udpHeaderLen || n > len(b) {
+		return
+	}
+	b = b[:n]
+	if be16(b[6:]) != 0 && checksum(b, pseudoHeaderSum(src, dst, protoUDP, n)) != 0 {
+		return
+	}
+	from := Addr{src, int(be16(b[0:]))}
+	to := Addr{dst, int(be16(b[2:]))}
+	c := s.lookupUDP(from, to)
+	if c == nil {
+		s.sendUnreachable(src, dst, pkt)
+		return
+	}
+	data := b[udpHeaderLen:]
+	if c.queued+len(data) > udpQueueMax {
+		return
+	}
+	c.queue = append(c.queue, datagram{from, append([]byte(nil), data...)})
+	c.queued += len(data)
+	c.rev.signal()
+}
+
+// udpUnreachable marks the connected endpoint for local to remote as
+// refused, after an ICMP port unreachable message.
+func (s *Stack) udpUnreachable(local, remote Addr) {
+	for _, c := range s.udp[local.Port] {
+		if c.raddr == remote && matchLocal(c.laddr.IP, c.v6only, local.IP) {
+			c.err = syscall.ECONNREFUSED
+			c.rev.signal()
+		}
+	}
+}
@@ -2,8 +2,6 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build !solo5hvt
-
 package poll
 
 import "sync/atomic"
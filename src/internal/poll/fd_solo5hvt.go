@@ -1,3 +1,193 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
 package poll
 
-type FD struct {}
+import (
+	"syscall"
+)
+
+// FD is a solo5 device handle. The net and os packages use this type as a
+// field of a larger type representing a network interface or block device.
+// Network devices are pollable, reads block the goroutine until a frame
+// arrives. Block devices are not, their reads and writes are synchronous.
+type FD struct {
+	// Lock sysfd and serialize access to Read and Write methods.
+	fdmu fdMutex
+
+	// Solo5 device handle, the index of the device in the manifest.
+	// Immutable until Close.
+	Sysfd int
+
+	// I/O poller.
+	pd pollDesc
+
+	// Semaphore signaled when file is closed.
+	csema uint32
+
+	// Whether this is a file rather than a network device.
+	isFile bool
+}
+
+// Init initializes the FD. The Sysfd field should already be set.
+// The net argument is "file" for block devices, or a network name
+// otherwise.
+// Set pollable to true if fd should be managed by runtime netpoll.
+func (fd *FD) Init(net string, pollable bool) error {
+	if net == "file" {
+		fd.isFile = true
+	}
+	if !pollable {
+		return nil
+	}
+	return fd.pd.init(fd)
+}
+
+// Destroy unregisters the device from the poller. This is called when there
+// are no remaining references. Solo5 devices cannot be closed.
+func (fd *FD) destroy() error {
+	fd.pd.close()
+	fd.Sysfd = -1
+	runtime_Semrelease(&fd.csema)
+	return nil
+}
+
+// Close closes the FD. The device is released by the destroy method when
+// there are no remaining references.
+func (fd *FD) Close() error {
+	if !fd.fdmu.increfAndClose() {
+		return errClosing(fd.isFile)
+	}
+
+	// Unblock any I/O. Any attempts to block in the pollDesc will
+	// return errClosing(fd.isFile).
+	fd.pd.evict()
+
+	// The call to decref will call destroy if there are no other
+	// references.
+	err := fd.decref()
+
+	// Wait until the descriptor is closed. If this was the only
+	// reference, it is already closed.
+	runtime_Semacquire(&fd.csema)
+
+	return err
+}
+
+// Read reads a single frame from a network device into p. If p is too small
+// for the frame, an error is returned.
+func (fd *FD) Read(p []byte) (int, error) {
+	if err := fd.readLock(); err != nil {
+		return 0, err
+	}
+	defer fd.readUnlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := fd.pd.prepareRead(fd.isFile); err != nil {
+		return 0, err
+	}
+	for {
+		n, err := syscall.Netread(fd.Sysfd, p)
+		if err == syscall.EAGAIN && fd.pd.pollable() {
+			if err = fd.pd.waitRead(fd.isFile); err == nil {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+// Write writes p as a single frame to a network device. Writes do not block.
+func (fd *FD) Write(p []byte) (int, error) {
+	if err := fd.writeLock(); err != nil {
+		return 0, err
+	}
+	defer fd.writeUnlock()
+	if err := fd.pd.prepareWrite(fd.isFile); err != nil {
+		return 0, err
+	}
+	return syscall.Netwrite(fd.Sysfd, p)
+}
+
+// Pread reads a block at offset off from a block device into p.
+func (fd *FD) Pread(p []byte, off int64) (int, error) {
+	// Call incref, not readLock, because since pread specifies the
+	// offset it is independent from other reads.
+	if err := fd.incref(); err != nil {
+		return 0, err
+	}
+	defer fd.decref()
+	return syscall.Blkread(fd.Sysfd, p, off)
+}
+
+// Pwrite writes p as a block at offset off to a block device.
+func (fd *FD) Pwrite(p []byte, off int64) (int, error) {
+	// Call incref, not writeLock, because since pwrite specifies the
+	// offset it is independent from other writes.
+	if err := fd.incref(); err != nil {
+		return 0, err
+	}
+	defer fd.decref()
+	return syscall.Blkwrite(fd.Sysfd, p, off)
+}
+
+// Fsync writes the blocks written to a block device that are still in the
+// block cache to the device.
+func (fd *FD) Fsync() error {
+	if err := fd.incref(); err != nil {
+		return err
+	}
+	defer fd.decref()
+	return syscall.Blksync(fd.Sysfd)
+}
+
+// RawControl invokes the user-defined function f for a non-IO
+// operation.
+func (fd *FD) RawControl(f func(uintptr)) error {
+	if err := fd.incref(); err != nil {
+		return err
+	}
+	defer fd.decref()
+	f(uintptr(fd.Sysfd))
+	return nil
+}
+
+// RawRead invokes the user-defined function f for a read operation.
+func (fd *FD) RawRead(f func(uintptr) bool) error {
+	if err := fd.readLock(); err != nil {
+		return err
+	}
+	defer fd.readUnlock()
+	if err := fd.pd.prepareRead(fd.isFile); err != nil {
+		return err
+	}
+	for {
+		if f(uintptr(fd.Sysfd)) {
+			return nil
+		}
+		if err := fd.pd.waitRead(fd.isFile); err != nil {
+			return err
+		}
+	}
+}
+
+// RawWrite invokes the user-defined function f for a write operation.
+func (fd *FD) RawWrite(f func(uintptr) bool) error {
+	if err := fd.writeLock(); err != nil {
+		return err
+	}
+	defer fd.writeUnlock()
+	if err := fd.pd.prepareWrite(fd.isFile); err != nil {
+		return err
+	}
+	for {
+		if f(uintptr(fd.Sysfd)) {
+			return nil
+		}
+		if err := fd.pd.waitWrite(fd.isFile); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rofs
+
+import (
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Feature flags of ext2 and its successors that change the layout of the
+// file system.
+const (
+	ext2IncompatFiletype = 0x2
+	ext2IncompatRecover  = 0x4
+	ext2IncompatExtents  = 0x40
+	ext2Incompat64bit    = 0x80
+	ext2IncompatMMP      = 0x100
+	ext2IncompatFlexBG   = 0x200
+	ext2IncompatCsumSeed = 0x2000
+	ext2IncompatLargedir = 0x4000
+
+	ext2Incompat = ext2IncompatFiletype | ext2IncompatExtents | ext2Incompat64bit |
+		ext2IncompatMMP | ext2IncompatFlexBG | ext2IncompatCsumSeed | ext2IncompatLargedir
+)
+
+const (
+	ext2Magic       = 0xef53
+	ext2RootIno     = 2
+	ext2ExtentsFlag = 0x80000
+	ext2ExtentMagic = 0xf30a
+)
+
+type ext2FS struct {
+	dev            *device
+	bs             int64 // Block size.
+	inodes         uint32
+	inodesPerGroup uint32
+	inodeSize      int64
+	descSize       int64
+	descOff        int64 // Of the group descriptors.
+	rev            uint32
+	incompat       uint32
+	root           *ext2Node
+}
+
+type ext2Node struct {
+	fs      *ext2FS
+	ino     uint32
+	mode    uint32
+	size    int64
+	nlink   int
+	modTime time.Time
+	parent  *ext2Node
+
+	raw     []byte            // The inode.
+	extents []extent          // Of a regular file, directory or slow symbolic link, once read.
+	dir     map[string]uint32 // Inode numbers of the entries of a directory, once read.
+	entries entries           // Of a directory, the entries looked up.
+	target  string            // Of a symbolic link, once read.
+}
+
+func mountExt2(d *device) (FS, error) {
+	if d.size < 2048 {
+		return nil, ErrFormat
+	}
+	sb, err := d.read(1024, 1024)
+	if err != nil {
+		return nil, err
+	}
+	if le16(sb[56:]) != ext2Magic {
+		return nil, ErrFormat
+	}
+	fs := &ext2FS{
+		dev:            d,
+		inodes:         le32(sb[0:]),
+		inodesPerGroup: le32(sb[40:]),
+		inodeSize:      128,
+		descSize:       32,
+		rev:            le32(sb[76:]),
+	}
+	logBlockSize := le32(sb[24:])
+	if logBlockSize > 6 || fs.inodesPerGroup == 0 {
+		return nil, ErrCorrupt
+	}
+	fs.bs = 1024 << logBlockSize
+	if fs.rev >= 1 {
+		fs.inodeSize = int64(le16(sb[88:]))
+		fs.incompat = le32(sb[96:])
+		if fs.inodeSize < 128 || fs.inodeSize > fs.bs || fs.inodeSize&(fs.inodeSize-1) != 0 {
+			return nil, ErrCorrupt
+		}
+	}
+	if fs.incompat&^ext2Incompat != 0 || fs.incompat&ext2IncompatRecover != 0 {
+		return nil, ErrUnsupported
+	}
+	if fs.incompat&ext2Incompat64bit != 0 {
+		fs.descSize = int64(le16(sb[254:]))
+		if fs.descSize < 32 || fs.descSize > fs.bs {
+			return nil, ErrCorrupt
+		}
+	}
+	fs.descOff = (int64(le32(sb[20:])) + 1) * fs.bs
+
+	root, err := fs.inode(ext2RootIno, nil)
+	if err != nil {
+		return nil, err
+	}
+	if root.mode&ModeDir == 0 {
+		return nil, ErrCorrupt
+	}
+	root.parent = root
+	fs.root = root
+	return fs, nil
+}
+
+func (fs *ext2FS) Type() string { return "ext2" }
+func (fs *ext2FS) Root() Node   { return fs.root }
+
+// inode reads inode ino, an entry of directory parent.
+func (fs *ext2FS) inode(ino uint32, parent *ext2Node) (*ext2Node, error) {
+	if ino == 0 || ino > fs.inodes {
+		return nil, ErrCorrupt
+	}
+	group := int64((ino - 1) / fs.inodesPerGroup)
+	index := int64((ino - 1) % fs.inodesPerGroup)
+	desc, err := fs.dev.read(fs.descOff+group*fs.descSize, int(fs.descSize))
+	if err != nil {
+		return nil, err
+	}
+	table := int64(le32(desc[8:]))
+	if fs.descSize >= 64 {
+		table |= int64(le32(desc[0x28:])) << 32
+	}
+	raw, err := fs.dev.read(table*fs.bs+index*fs.inodeSize, 128)
+	if err != nil {
+		return nil, err
+	}
+	n := &ext2Node{
+		fs:      fs,
+		ino:     ino,
+		mode:    unixMode(uint32(le16(raw[0:]))),
+		size:    int64(le32(raw[4:])),
+		modTime: time.Unix(int64(int32(le32(raw[16:]))), 0),
+		nlink:   int(le16(raw[26:])),
+		parent:  parent,
+		raw:     raw,
+	}
+	if fs.rev >= 1 && n.mode&ModeType == 0 {
+		n.size |= int64(le32(raw[108:])) << 32
+	}
+	if n.size < 0 {
+		return nil, ErrCorrupt
+	}
+	return n, nil
+}
+
+func (n *ext2Node) Ino() uint64        { return uint64(n.ino) }
+func (n *ext2Node) Mode() uint32       { return n.mode }
+func (n *ext2Node) Size() int64        { return n.size }
+func (n *ext2Node) Nlink() int         { return n.nlink }
+func (n *ext2Node) ModTime() time.Time { return n.modTime }
+
+// fastSymlink reports whether symbolic link n stores its target in the
+// inode, instead of in a data block.
+func (n *ext2Node) fastSymlink() bool {
+	blocks := int64(le32(n.raw[28:]))
+	if le32(n.raw[104:]) != 0 {
+		// Blocks of extended attributes.
+		blocks -= n.fs.bs / 512
+	}
+	return blocks == 0
+}
+
+// mapBlocks reads the extents of the data of n.
+func (n *ext2Node) mapBlocks() error {
+	if n.extents != nil {
+		return nil
+	}
+	nblocks := (n.size + n.fs.bs - 1) / n.fs.bs
+	extents := []extent{}
+	var err error
+	if le32(n.raw[32:])&ext2ExtentsFlag != 0 {
+		extents, err = n.fs.extentTree(extents, n.raw[40:100], nblocks, 0)
+	} else {
+		extents, err = n.fs.blockMap(extents, n.raw[40:100], nblocks)
+	}
+	if err != nil {
+		return err
+	}
+	n.extents = extents
+	return nil
+}
+
+// blockMap appends the extents of the first nblocks blocks of the classic
+// block map in iblock, with 12 direct, an indirect, a double and a triple
+// indirect block.
+func (fs *ext2FS) blockMap(extents []extent, iblock []byte, nblocks int64) ([]extent, error) {
+	var b int64 // Next logical block.
+	var walk func(blk uint32, depth int) error
+	walk = func(blk uint32, depth int) error {
+		if b >= nblocks {
+			return nil
+		}
+		if depth == 0 || blk == 0 {
+			// A data block, or a hole of a whole indirect block.
+			span := int64(1)
+			for i := 0; i < depth; i++ {
+				span *= fs.bs / 4
+			}
+			if span > nblocks-b {
+				span = nblocks - b
+			}
+			dev := int64(-1)
+			if blk != 0 {
+				dev = int64(blk) * fs.bs
+				if dev+span*fs.bs > fs.dev.size {
+					return ErrCorrupt
+				}
+			}
+			extents = appendExtent(extents, b*fs.bs, dev, span*fs.bs)
+			b += span
+			return nil
+		}
+		ind, err := fs.dev.read(int64(blk)*fs.bs, int(fs.bs))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(ind) && b < nblocks; i += 4 {
+			if err := walk(le32(ind[i:]), depth-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < 15; i++ {
+		depth := 0
+		if i >= 12 {
+			depth = i - 11
+		}
+		if err := walk(le32(iblock[4*i:]), depth); err != nil {
+			return nil, err
+		}
+	}
+	if b < nblocks {
+		return nil, syscall.EFBIG
+	}
+	return extents, nil
+}
+
+// extentTree appends the extents of the extent tree node in b.
+func (fs *ext2FS) extentTree(extents []extent, b []byte, nblocks int64, level int) ([]extent, error) {
+	if len(b) < 12 || le16(b) != ext2ExtentMagic || level > 5 {
+		return nil, ErrCorrupt
+	}
+	count := int(le16(b[2:]))
+	depth := le16(b[6:])
+	if 12+12*count > len(b) {
+		return nil, ErrCorrupt
+	}
+	for i := 0; i < count; i++ {
+		e := b[12+12*i:]
+		if depth > 0 {
+			blk := int64(le32(e[4:])) | int64(le16(e[8:]))<<32
+			child, err := fs.dev.read(blk*fs.bs, int(fs.bs))
+			if err != nil {
+				return nil, err
+			}
+			extents, err = fs.extentTree(extents, child, nblocks, level+1)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		lblk := int64(le32(e))
+		length := int64(le16(e[4:]))
+		start := int64(le32(e[8:])) | int64(le16(e[6:]))<<32
+		dev := start * fs.bs
+		if length > 32768 {
+			// Allocated but not written, reads as zeros.
+			length -= 32768
+			dev = -1
+		}
+		if lblk >= nblocks {
+			continue
+		}
+		if lblk+length > nblocks {
+			length = nblocks - lblk
+		}
+		if l := len(extents); l > 0 && extents[l-1].off+extents[l-1].size > lblk*fs.bs {
+			return nil, ErrCorrupt
+		}
+		if dev >= 0 && dev+length*fs.bs > fs.dev.size {
+			return nil, ErrCorrupt
+		}
+		extents = appendExtent(extents, lblk*fs.bs, dev, length*fs.bs)
+	}
+	return extents, nil
+}
+
+func (n *ext2Node) readData(b []byte, off int64) (int, error) {
+	if err := n.mapBlocks(); err != nil {
+		return 0, err
+	}
+	return readExtents(n.fs.dev, n.extents, n.size, b, off)
+}
+
+func (n *ext2Node) readDir() error {
+	if n.mode&ModeDir == 0 {
+		return syscall.ENOTDIR
+	}
+	if n.dir != nil {
+		return nil
+	}
+	if n.size > 1<<30 {
+		return ErrCorrupt
+	}
+	data := make([]byte, n.size)
+	if _, err := n.readData(data, 0); err != nil && len(data) > 0 {
+		return err
+	}
+	dir := map[string]uint32{}
+	for off := 0; off+8 <= len(data); {
+		ino := le32(data[off:])
+		reclen := int(le16(data[off+4:]))
+		namelen := int(data[off+6])
+		if reclen < 8 || off+reclen > len(data) || 8+namelen > reclen {
+			return ErrCorrupt
+		}
+		name := string(data[off+8 : off+8+namelen])
+		off += reclen
+		if ino == 0 || !validName(name) {
+			continue
+		}
+		if _, ok := dir[name]; !ok {
+			dir[name] = ino
+		}
+	}
+	n.dir = dir
+	n.entries = entries{}
+	return nil
+}
+
+func (n *ext2Node) Lookup(name string) (Node, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case ".":
+		return n, nil
+	case "..":
+		return n.parent, nil
+	}
+	if c, ok := n.entries[name]; ok {
+		return c, nil
+	}
+	ino, ok := n.dir[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	c, err := n.fs.inode(ino, n)
+	if err != nil {
+		return nil, err
+	}
+	n.entries[name] = c
+	return c, nil
+}
+
+func (n *ext2Node) Names() ([]string, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(n.dir))
+	for name := range n.dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (n *ext2Node) ReadAt(b []byte, off int64) (int, error) {
+	if err := checkRead(n.mode); err != nil {
+		return 0, err
+	}
+	return n.readData(b, off)
+}
+
+func (n *ext2Node) Readlink() (string, error) {
+	if n.mode&ModeSymlink == 0 {
+		return "", syscall.EINVAL
+	}
+	if n.target != "" {
+		return n.target, nil
+	}
+	if n.size > n.fs.bs {
+		return "", ErrCorrupt
+	}
+	if n.fastSymlink() {
+		if n.size > 60 {
+			return "", ErrCorrupt
+		}
+		n.target = string(n.raw[40 : 40+n.size])
+		return n.target, nil
+	}
+	b := make([]byte, n.size)
+	if _, err := n.readData(b, 0); err != nil && len(b) > 0 {
+		return "", err
+	}
+	n.target = string(b)
+	return n.target, nil
+}
@@ -0,0 +1,448 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rofs
+
+import (
+	"syscall"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	fatAttrReadOnly = 0x01
+	fatAttrVolumeID = 0x08
+	fatAttrDir      = 0x10
+	fatAttrLongName = 0x0f
+)
+
+type fatFS struct {
+	dev         *device
+	bits        int // Of a FAT entry: 12, 16 or 32.
+	fat         []byte
+	clusterSize int64
+	nclusters   uint32 // Number of data clusters, numbered from 2.
+	dataOff     int64  // Of cluster 2.
+	root        *fatNode
+}
+
+// fatNode is a file or directory. The ino of a directory is the offset of
+// its first cluster, or 1 for the root. The ino of a file is the offset of
+// its directory entry.
+type fatNode struct {
+	fs      *fatFS
+	ino     uint64
+	mode    uint32
+	size    int64
+	modTime time.Time
+	cluster uint32
+	parent  *fatNode
+
+	extents []extent // Once read.
+	entries entries  // Of a directory, once read.
+}
+
+func mountFAT(d *device) (FS, error) {
+	if d.size < 512 {
+		return nil, ErrFormat
+	}
+	bs, err := d.read(0, 512)
+	if err != nil {
+		return nil, err
+	}
+	sectorSize := int64(le16(bs[11:]))
+	secPerClus := int64(bs[13])
+	reserved := int64(le16(bs[14:]))
+	nfats := int64(bs[16])
+	rootEntries := int64(le16(bs[17:]))
+	totalSectors := int64(le16(bs[19:]))
+	fatSize := int64(le16(bs[22:]))
+	if bs[510] != 0x55 || bs[511] != 0xaa || (bs[0] != 0xeb && bs[0] != 0xe9) {
+		return nil, ErrFormat
+	}
+	switch sectorSize {
+	case 512, 1024, 2048, 4096:
+	default:
+		return nil, ErrFormat
+	}
+	if secPerClus == 0 || secPerClus&(secPerClus-1) != 0 || reserved == 0 || nfats == 0 {
+		return nil, ErrFormat
+	}
+	if totalSectors == 0 {
+		totalSectors = int64(le32(bs[32:]))
+	}
+	if fatSize == 0 {
+		fatSize = int64(le32(bs[36:]))
+	}
+	rootSectors := (rootEntries*32 + sectorSize - 1) / sectorSize
+	dataSector := reserved + nfats*fatSize + rootSectors
+	if fatSize == 0 || totalSectors <= dataSector || totalSectors*sectorSize > d.size {
+		return nil, ErrCorrupt
+	}
+
+	fs := &fatFS{
+		dev:         d,
+		clusterSize: secPerClus * sectorSize,
+		nclusters:   uint32((totalSectors - dataSector) / secPerClus),
+		dataOff:     dataSector * sectorSize,
+	}
+	switch {
+	case fs.nclusters < 4085:
+		fs.bits = 12
+	case fs.nclusters < 65525:
+		fs.bits = 16
+	default:
+		fs.bits = 32
+	}
+	fatOff := reserved * sectorSize
+	if fs.bits == 32 {
+		if flags := le16(bs[40:]); flags&0x80 != 0 {
+			// Mirroring disabled, use the active FAT.
+			active := int64(flags & 0xf)
+			if active >= nfats {
+				return nil, ErrCorrupt
+			}
+			fatOff += active * fatSize * sectorSize
+		}
+	}
+	need := (int64(fs.nclusters) + 2) * int64(fs.bits) / 8
+	if need > fatSize*sectorSize {
+		return nil, ErrCorrupt
+	}
+	if fs.fat, err = d.read(fatOff, int(need+1)); err != nil {
+		return nil, err
+	}
+
+	root := &fatNode{
+		fs:   fs,
+		ino:  1,
+		mode: ModeDir | 0755,
+	}
+	root.parent = root
+	if fs.bits == 32 {
+		root.cluster = le32(bs[44:])
+		if err := root.mapClusters(); err != nil {
+			return nil, err
+		}
+	} else {
+		// The root directory has a fixed place, before the clusters.
+		size := rootEntries * 32
+		root.extents = []extent{{0, (reserved + nfats*fatSize) * sectorSize, size}}
+		root.size = size
+	}
+	fs.root = root
+	return fs, nil
+}
+
+func (fs *fatFS) Type() string { return "fat" }
+func (fs *fatFS) Root() Node   { return fs.root }
+
+// next returns the cluster after c in a chain, and whether c is the last.
+func (fs *fatFS) next(c uint32) (uint32, bool, error) {
+	var v, eoc uint32
+	switch fs.bits {
+	case 12:
+		v = uint32(le16(fs.fat[c+c/2:]))
+		if c%2 == 1 {
+			v >>= 4
+		}
+		v &= 0xfff
+		eoc = 0xff8
+	case 16:
+		v = uint32(le16(fs.fat[2*c:]))
+		eoc = 0xfff8
+	case 32:
+		v = le32(fs.fat[4*c:]) & 0x0fffffff
+		eoc = 0x0ffffff8
+	}
+	if v >= eoc {
+		return 0, true, nil
+	}
+	if !fs.validCluster(v) {
+		return 0, false, ErrCorrupt
+	}
+	return v, false, nil
+}
+
+func (fs *fatFS) validCluster(c uint32) bool {
+	return c >= 2 && c-2 < fs.nclusters
+}
+
+func (fs *fatFS) clusterOff(c uint32) int64 {
+	return fs.dataOff + int64(c-2)*fs.clusterSize
+}
+
+// mapClusters reads the chain of clusters of n. The size of a directory is
+// that of its clusters.
+func (n *fatNode) mapClusters() error {
+	if n.extents != nil {
+		return nil
+	}
+	fs := n.fs
+	extents := []extent{}
+	var off int64
+	if n.cluster != 0 {
+		c := n.cluster
+		if !fs.validCluster(c) {
+			return ErrCorrupt
+		}
+		for i := uint32(0); n.mode&ModeDir != 0 || off < n.size; i++ {
+			if i >= fs.nclusters {
+				// A loop.
+				return ErrCorrupt
+			}
+			extents = appendExtent(extents, off, fs.clusterOff(c), fs.clusterSize)
+			off += fs.clusterSize
+			next, last, err := fs.next(c)
+			if err != nil {
+				return err
+			}
+			if last {
+				break
+			}
+			c = next
+		}
+	}
+	if n.mode&ModeDir != 0 {
+		n.size = off
+	} else if off < n.size {
+		return ErrCorrupt
+	}
+	n.extents = extents
+	return nil
+}
+
+func (n *fatNode) readDir() error {
+	if n.mode&ModeDir == 0 {
+		return syscall.ENOTDIR
+	}
+	if n.entries != nil {
+		return nil
+	}
+	if err := n.mapClusters(); err != nil {
+		return err
+	}
+	if n.size > 1<<30 {
+		return ErrCorrupt
+	}
+	data := make([]byte, n.size)
+	if _, err := readExtents(n.fs.dev, n.extents, n.size, data, 0); err != nil && len(data) > 0 {
+		return err
+	}
+
+	e := entries{}
+	var long []uint16 // Of a long name in entries preceding the short one.
+	var sum byte      // Checksum of the short name in the long name entries.
+	var seq int       // Expected sequence number of the next long name entry.
+	for off := 0; off+32 <= len(data); off += 32 {
+		de := data[off : off+32]
+		if de[0] == 0 {
+			break
+		}
+		if de[0] == 0xe5 {
+			long = nil
+			continue
+		}
+		attr := de[11]
+		if attr&0x3f == fatAttrLongName {
+			ord := int(de[0] & 0x1f)
+			if de[0]&0x40 != 0 {
+				long = make([]uint16, 13*ord)
+				sum = de[13]
+				seq = ord
+			}
+			if long == nil || ord != seq || ord == 0 || de[13] != sum {
+				long = nil
+				continue
+			}
+			seq--
+			chars := long[13*(ord-1):]
+			for i, o := range [...]int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				chars[i] = le16(de[o:])
+			}
+			continue
+		}
+		name := fatShortName(de)
+		if long != nil && seq == 0 && fatChecksum(de) == sum {
+			for i, c := range long {
+				if c == 0 {
+					long = long[:i]
+					break
+				}
+			}
+			name = string(utf16.Decode(long))
+		}
+		long = nil
+		if attr&fatAttrVolumeID != 0 || !validName(name) {
+			continue
+		}
+		if _, ok := e[name]; ok {
+			continue
+		}
+		devOff, _ := n.entryOff(int64(off))
+		c := &fatNode{
+			fs:      n.fs,
+			ino:     uint64(devOff),
+			size:    int64(le32(de[28:])),
+			modTime: fatTime(le16(de[24:]), le16(de[22:])),
+			cluster: uint32(le16(de[26:])),
+			parent:  n,
+		}
+		if n.fs.bits == 32 {
+			c.cluster |= uint32(le16(de[20:])) << 16
+		}
+		if attr&fatAttrDir != 0 {
+			if !n.fs.validCluster(c.cluster) {
+				return ErrCorrupt
+			}
+			c.mode = ModeDir | 0755
+			c.size = 0
+			c.ino = uint64(n.fs.clusterOff(c.cluster))
+		} else {
+			c.mode = 0644
+		}
+		if attr&fatAttrReadOnly != 0 {
+			c.mode &^= 0222
+		}
+		e[name] = c
+	}
+	n.entries = e
+	return nil
+}
+
+// entryOff returns the offset on the device of the directory entry at off
+// in n.
+func (n *fatNode) entryOff(off int64) (int64, bool) {
+	for _, e := range n.extents {
+		if off >= e.off && off < e.off+e.size {
+			return e.dev + off - e.off, true
+		}
+	}
+	return 0, false
+}
+
+// fatShortName returns the 8.3 name of directory entry de.
+func fatShortName(de []byte) string {
+	var b []byte
+	for i := 0; i < 11; i++ {
+		c := de[i]
+		if i == 0 && c == 0x05 {
+			c = 0xe5
+		}
+		if i == 8 {
+			b = trimSpace(b)
+			if de[8] != ' ' {
+				b = append(b, '.')
+			}
+		}
+		// The case of the base and extension.
+		if c >= 'A' && c <= 'Z' && (i < 8 && de[12]&0x08 != 0 || i >= 8 && de[12]&0x10 != 0) {
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return string(trimSpace(b))
+}
+
+func trimSpace(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == ' ' {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// fatChecksum returns the checksum of the short name of directory entry
+// de, as stored in its long name entries.
+func fatChecksum(de []byte) byte {
+	var sum byte
+	for _, c := range de[:11] {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+// fatTime returns the time of a date and time of a directory entry. FAT
+// stores local time, it is taken as UTC.
+func fatTime(date, tm uint16) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return time.Date(1980+int(date>>9), time.Month(date>>5&0xf), int(date&0x1f),
+		int(tm>>11), int(tm>>5&0x3f), 2*int(tm&0x1f), 0, time.UTC)
+}
+
+func (n *fatNode) Ino() uint64        { return n.ino }
+func (n *fatNode) Mode() uint32       { return n.mode }
+func (n *fatNode) Nlink() int         { return 1 }
+func (n *fatNode) ModTime() time.Time { return n.modTime }
+
+func (n *fatNode) Size() int64 {
+	if n.mode&ModeDir != 0 {
+		return 0
+	}
+	return n.size
+}
+
+// Lookup returns entry name of directory n. As on FAT itself, names
+// match without regard to ASCII case.
+func (n *fatNode) Lookup(name string) (Node, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case ".":
+		return n, nil
+	case "..":
+		return n.parent, nil
+	}
+	if c, ok := n.entries[name]; ok {
+		return c, nil
+	}
+	for s, c := range n.entries {
+		if equalFoldASCII(s, name) {
+			return c, nil
+		}
+	}
+	return nil, syscall.ENOENT
+}
+
+func equalFoldASCII(s, t string) bool {
+	if len(s) != len(t) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		a, b := s[i], t[i]
+		if a >= 'A' && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *fatNode) Names() ([]string, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	return n.entries.names(), nil
+}
+
+func (n *fatNode) ReadAt(b []byte, off int64) (int, error) {
+	if err := checkRead(n.mode); err != nil {
+		return 0, err
+	}
+	if err := n.mapClusters(); err != nil {
+		return 0, err
+	}
+	return readExtents(n.fs.dev, n.extents, n.size, b, off)
+}
+
+func (n *fatNode) Readlink() (string, error) {
+	return "", syscall.EINVAL
+}
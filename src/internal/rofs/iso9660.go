@@ -0,0 +1,502 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rofs
+
+import (
+	"syscall"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	isoSectorSize = 2048
+	isoFlagDir    = 0x02
+	isoFlagMulti  = 0x80 // More extents of the file follow.
+)
+
+type isoFS struct {
+	dev       *device
+	bs        int64 // Logical block size.
+	rockRidge bool
+	susp      int // Bytes to skip in each system use area.
+	joliet    bool
+	root      *isoNode
+}
+
+// isoNode is a file, directory or symbolic link. The ino of a directory is
+// the offset of its extent, that of another node the offset of its
+// directory record.
+type isoNode struct {
+	fs      *isoFS
+	ino     uint64
+	mode    uint32
+	size    int64
+	nlink   int
+	modTime time.Time
+	target  string // Of a symbolic link.
+	parent  *isoNode
+
+	extents []extent
+	entries entries // Of a directory, once read.
+}
+
+func mountISO9660(d *device) (FS, error) {
+	fs := &isoFS{dev: d}
+	var pvd, svd []byte
+	for s := int64(16); ; s++ {
+		if (s+1)*isoSectorSize > d.size {
+			if s == 16 {
+				return nil, ErrFormat
+			}
+			return nil, ErrCorrupt
+		}
+		vd, err := d.read(s*isoSectorSize, isoSectorSize)
+		if err != nil {
+			return nil, err
+		}
+		if string(vd[1:6]) != "CD001" {
+			if s == 16 {
+				return nil, ErrFormat
+			}
+			return nil, ErrCorrupt
+		}
+		switch vd[0] {
+		case 1:
+			if pvd == nil {
+				pvd = vd
+			}
+		case 2:
+			// Joliet, UCS-2 at level 1, 2 or 3.
+			esc := string(vd[88:91])
+			if svd == nil && (esc == "%/@" || esc == "%/C" || esc == "%/E") {
+				svd = vd
+			}
+		}
+		if vd[0] == 255 {
+			break
+		}
+	}
+	if pvd == nil {
+		return nil, ErrCorrupt
+	}
+	fs.bs = int64(le16(pvd[128:]))
+	switch fs.bs {
+	case 512, 1024, 2048:
+	default:
+		return nil, ErrCorrupt
+	}
+
+	root, err := fs.rootRecord(pvd)
+	if err != nil {
+		return nil, err
+	}
+	// Rock Ridge is announced by an SP entry in the first record of the
+	// root directory.
+	first := make([]byte, 255)
+	if root.size < int64(len(first)) {
+		return nil, ErrCorrupt
+	}
+	if _, err := readExtents(d, root.extents, root.size, first, 0); err != nil {
+		return nil, err
+	}
+	if su := isoSystemUse(first); len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef {
+		fs.rockRidge = true
+		fs.susp = int(su[6])
+	}
+	if !fs.rockRidge && svd != nil {
+		fs.joliet = true
+		fs.bs = int64(le16(svd[128:]))
+		if root, err = fs.rootRecord(svd); err != nil {
+			return nil, err
+		}
+	}
+	root.parent = root
+	fs.root = root
+	return fs, nil
+}
+
+// rootRecord returns the root directory of volume descriptor vd.
+func (fs *isoFS) rootRecord(vd []byte) (*isoNode, error) {
+	r := vd[156 : 156+34]
+	if r[0] != 34 || r[25]&isoFlagDir == 0 {
+		return nil, ErrCorrupt
+	}
+	n := &isoNode{
+		fs:      fs,
+		mode:    ModeDir | 0555,
+		size:    int64(le32(r[10:])),
+		nlink:   1,
+		modTime: isoTime(r[18:25]),
+	}
+	n.extents = []extent{{0, int64(le32(r[2:])) * fs.bs, n.size}}
+	n.ino = uint64(n.extents[0].dev)
+	return n, nil
+}
+
+func (fs *isoFS) Type() string { return "iso9660" }
+func (fs *isoFS) Root() Node   { return fs.root }
+
+// isoSystemUse returns the system use area of directory record r.
+func isoSystemUse(r []byte) []byte {
+	if len(r) < 34 || int(r[0]) > len(r) {
+		return nil
+	}
+	start := 33 + int(r[32])
+	if start%2 == 1 {
+		start++
+	}
+	if start > int(r[0]) {
+		return nil
+	}
+	return r[start:r[0]]
+}
+
+// isoTime returns the time of a directory record, or of a Rock Ridge TF
+// entry in short form.
+func isoTime(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return time.Time{}
+	}
+	// The offset from GMT is in 15 minute intervals.
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	t := time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+	return t.UTC()
+}
+
+// isoLongTime returns the time of a Rock Ridge TF entry in long form.
+func isoLongTime(b []byte) time.Time {
+	num := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v*10 + int(c-'0')
+		}
+		return v
+	}
+	zone := time.FixedZone("", int(int8(b[16]))*15*60)
+	t := time.Date(num(b[0:4]), time.Month(num(b[4:6])), num(b[6:8]), num(b[8:10]), num(b[10:12]), num(b[12:14]), num(b[14:16])*1e7, zone)
+	return t.UTC()
+}
+
+// isoRecord is the information from a directory record, with its Rock
+// Ridge entries.
+type isoRecord struct {
+	name     string
+	flags    byte
+	extent   int64
+	size     int64
+	modTime  time.Time
+	mode     uint32 // From a PX entry, if not 0.
+	nlink    int
+	child    int64 // Extent of a relocated directory, from a CL entry.
+	relocate bool  // Relocated directory, from an RE entry.
+
+	rrName   []byte // From NM entries.
+	isLink   bool
+	link     []byte // From SL entries.
+	linkDone bool   // Whether the last component in link is complete.
+}
+
+func (n *isoNode) readDir() error {
+	if n.mode&ModeDir == 0 {
+		return syscall.ENOTDIR
+	}
+	if n.entries != nil {
+		return nil
+	}
+	if n.size > 1<<30 {
+		return ErrCorrupt
+	}
+	data := make([]byte, n.size)
+	if _, err := readExtents(n.fs.dev, n.extents, n.size, data, 0); err != nil && len(data) > 0 {
+		return err
+	}
+
+	e := entries{}
+	var multi *isoNode // File with more extents to come.
+	for off := 0; off < len(data); {
+		reclen := int(data[off])
+		if reclen == 0 {
+			// Records do not cross sectors, the rest is padding.
+			off = (off/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if reclen < 34 || off+reclen > len(data) || 33+int(data[off+32]) > reclen {
+			return ErrCorrupt
+		}
+		r, err := n.fs.parseRecord(data[off : off+reclen])
+		if err != nil {
+			return err
+		}
+		recOff := n.extents[0].dev + int64(off)
+		off += reclen
+
+		if multi != nil {
+			// A continuation of the file of the previous record.
+			multi.extents = appendExtent(multi.extents, multi.size, r.extent*n.fs.bs, r.size)
+			multi.size += r.size
+			if r.flags&isoFlagMulti == 0 {
+				multi = nil
+			}
+			continue
+		}
+		if r.relocate || !validName(r.name) {
+			continue
+		}
+		c := &isoNode{
+			fs:      n.fs,
+			ino:     uint64(recOff),
+			mode:    0444,
+			size:    r.size,
+			nlink:   1,
+			modTime: r.modTime,
+			parent:  n,
+		}
+		c.extents = []extent{{0, r.extent * n.fs.bs, r.size}}
+		switch {
+		case r.child != 0:
+			// The directory is elsewhere, read its "." record.
+			dot, err := n.fs.dev.read(r.child*n.fs.bs, 255)
+			if err != nil {
+				return err
+			}
+			if int(dot[0]) < 34 {
+				return ErrCorrupt
+			}
+			dr, err := n.fs.parseRecord(dot[:dot[0]])
+			if err != nil {
+				return err
+			}
+			c.size = dr.size
+			c.extents = []extent{{0, r.child * n.fs.bs, dr.size}}
+			c.mode = ModeDir | 0555
+		case r.flags&isoFlagDir != 0:
+			c.mode = ModeDir | 0555
+		case r.isLink:
+			c.mode = ModeSymlink | 0777
+			c.target = string(r.link)
+			c.size = int64(len(c.target))
+			c.extents = []extent{}
+		}
+		if c.mode&ModeDir != 0 {
+			c.ino = uint64(c.extents[0].dev)
+		}
+		if r.mode != 0 {
+			// The type from the record itself takes precedence, the PX
+			// entry of a relocated directory describes a file.
+			typ := c.mode & ModeType
+			if typ == 0 {
+				typ = r.mode & ModeType
+			}
+			c.mode = typ | r.mode&^ModeType
+			c.nlink = r.nlink
+		}
+		if r.flags&isoFlagMulti != 0 && c.mode&ModeType == 0 {
+			multi = c
+		}
+		if _, ok := e[r.name]; !ok {
+			e[r.name] = c
+		}
+	}
+	n.entries = e
+	return nil
+}
+
+// parseRecord parses directory record r.
+func (fs *isoFS) parseRecord(r []byte) (*isoRecord, error) {
+	rec := &isoRecord{
+		flags:   r[25],
+		extent:  int64(le32(r[2:])),
+		size:    int64(le32(r[10:])),
+		modTime: isoTime(r[18:25]),
+	}
+	if rec.extent*fs.bs+rec.size > fs.dev.size {
+		return nil, ErrCorrupt
+	}
+	name := r[33 : 33+r[32]]
+	switch {
+	case len(name) == 1 && name[0] <= 1:
+		// "." or "..".
+	case fs.joliet:
+		u := make([]uint16, len(name)/2)
+		for i := range u {
+			u[i] = be16(name[2*i:])
+		}
+		rec.name = isoTrimVersion(string(utf16.Decode(u)), false)
+	default:
+		rec.name = isoTrimVersion(string(name), true)
+	}
+	if fs.rockRidge {
+		if err := fs.parseRockRidge(rec, isoSystemUse(r), 0); err != nil {
+			return nil, err
+		}
+		if rec.rrName != nil {
+			rec.name = string(rec.rrName)
+		}
+	}
+	return rec, nil
+}
+
+// isoTrimVersion removes the version and a trailing dot from name. Plain
+// ISO9660 names are upper case, lower is set to return them in lower case.
+func isoTrimVersion(name string, lower bool) string {
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == ';' {
+			name = name[:i]
+			break
+		}
+	}
+	if len(name) > 1 && name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	if lower {
+		b := []byte(name)
+		for i, c := range b {
+			if c >= 'A' && c <= 'Z' {
+				b[i] = c + 'a' - 'A'
+			}
+		}
+		name = string(b)
+	}
+	return name
+}
+
+// parseRockRidge reads the Rock Ridge entries in system use area su into
+// rec. Continuation areas are followed.
+func (fs *isoFS) parseRockRidge(rec *isoRecord, su []byte, depth int) error {
+	if depth > 16 {
+		return ErrCorrupt
+	}
+	if depth == 0 && len(su) >= fs.susp {
+		su = su[fs.susp:]
+	}
+	var cont []byte // Continuation area.
+	for len(su) >= 4 {
+		sig := string(su[:2])
+		l := int(su[2])
+		if l < 4 || l > len(su) {
+			break
+		}
+		e := su[:l]
+		su = su[l:]
+		switch {
+		case sig == "ST":
+			su = nil
+		case sig == "CE" && l >= 28:
+			off := int64(le32(e[4:]))*fs.bs + int64(le32(e[12:]))
+			size := int(le32(e[20:]))
+			if size > 64<<10 {
+				return ErrCorrupt
+			}
+			var err error
+			if cont, err = fs.dev.read(off, size); err != nil {
+				return err
+			}
+		case sig == "NM" && l >= 5:
+			if e[4]&0x06 != 0 {
+				// Current or parent directory.
+				continue
+			}
+			rec.rrName = append(rec.rrName, e[5:]...)
+		case sig == "PX" && l >= 36:
+			rec.mode = unixMode(le32(e[4:]))
+			rec.nlink = int(le32(e[12:]))
+		case sig == "SL" && l >= 5:
+			for c := e[5:]; len(c) >= 2; {
+				flags, clen := c[0], int(c[1])
+				if 2+clen > len(c) {
+					return ErrCorrupt
+				}
+				if rec.linkDone && len(rec.link) > 0 && rec.link[len(rec.link)-1] != '/' {
+					rec.link = append(rec.link, '/')
+				}
+				switch {
+				case flags&0x02 != 0:
+					rec.link = append(rec.link, '.')
+				case flags&0x04 != 0:
+					rec.link = append(rec.link, ".."...)
+				case flags&0x08 != 0:
+					rec.link = append(rec.link, '/')
+				default:
+					rec.link = append(rec.link, c[2:2+clen]...)
+				}
+				rec.linkDone = flags&0x01 == 0
+				c = c[2+clen:]
+			}
+			rec.isLink = true
+		case sig == "TF" && l >= 5:
+			flags := e[4]
+			size := 7
+			if flags&0x80 != 0 {
+				size = 17
+			}
+			t := e[5:]
+			// Creation, then modification time.
+			if flags&0x01 != 0 && len(t) >= size {
+				t = t[size:]
+			}
+			if flags&0x02 != 0 && len(t) >= size {
+				if size == 7 {
+					rec.modTime = isoTime(t)
+				} else {
+					rec.modTime = isoLongTime(t)
+				}
+			}
+		case sig == "CL" && l >= 12:
+			rec.child = int64(le32(e[4:]))
+		case sig == "RE":
+			rec.relocate = true
+		}
+	}
+	if cont != nil {
+		return fs.parseRockRidge(rec, cont, depth+1)
+	}
+	return nil
+}
+
+func (n *isoNode) Ino() uint64        { return n.ino }
+func (n *isoNode) Mode() uint32       { return n.mode }
+func (n *isoNode) Nlink() int         { return n.nlink }
+func (n *isoNode) ModTime() time.Time { return n.modTime }
+
+func (n *isoNode) Size() int64 {
+	if n.mode&ModeDir != 0 {
+		return 0
+	}
+	return n.size
+}
+
+func (n *isoNode) Lookup(name string) (Node, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case ".":
+		return n, nil
+	case "..":
+		return n.parent, nil
+	}
+	return n.entries.lookup(name)
+}
+
+func (n *isoNode) Names() ([]string, error) {
+	if err := n.readDir(); err != nil {
+		return nil, err
+	}
+	return n.entries.names(), nil
+}
+
+func (n *isoNode) ReadAt(b []byte, off int64) (int, error) {
+	if err := checkRead(n.mode); err != nil {
+		return 0, err
+	}
+	return readExtents(n.fs.dev, n.extents, n.size, b, off)
+}
+
+func (n *isoNode) Readlink() (string, error) {
+	if n.mode&ModeSymlink == 0 {
+		return "", syscall.EINVAL
+	}
+	return n.target, nil
+}
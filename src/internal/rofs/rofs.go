@@ -0,0 +1,304 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rofs reads the file systems of standard disk images: FAT12,
+// FAT16 and FAT32, ext2 (and ext3 and ext4 without a journal to recover),
+// and ISO9660 with the Rock Ridge and Joliet extensions. Package os mounts
+// them read-only in solo5hvt guests.
+//
+// Errors are syscall.Errno values, ErrFormat for an image in an unknown
+// format, or ErrCorrupt for a damaged image. Nodes cache what they read
+// from the device. An FS is not safe for concurrent use.
+package rofs
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Mode bits of nodes, as in os.FileMode.
+const (
+	ModeDir        = 1 << 31
+	ModeSymlink    = 1 << 27
+	ModeDevice     = 1 << 26
+	ModeNamedPipe  = 1 << 25
+	ModeSocket     = 1 << 24
+	ModeSetuid     = 1 << 23
+	ModeSetgid     = 1 << 22
+	ModeCharDevice = 1 << 21
+	ModeSticky     = 1 << 20
+	ModePerm       = 0777
+
+	ModeType = ModeDir | ModeSymlink | ModeDevice | ModeNamedPipe | ModeSocket | ModeCharDevice
+)
+
+var (
+	// ErrFormat is returned when mounting an image in an unknown format.
+	ErrFormat = errors.New("rofs: unknown file system format")
+
+	// ErrCorrupt is returned for a damaged image.
+	ErrCorrupt = errors.New("rofs: corrupt file system")
+
+	// ErrUnsupported is returned when mounting an image that uses
+	// features that are not implemented.
+	ErrUnsupported = errors.New("rofs: unsupported file system features")
+)
+
+// FS is a mounted file system.
+type FS interface {
+	// Type returns the format of the file system: "fat", "ext2" or
+	// "iso9660".
+	Type() string
+
+	// Root returns the root directory.
+	Root() Node
+}
+
+// Node is a file, directory or symbolic link.
+type Node interface {
+	// Ino returns a number that is unique for the node within the file
+	// system.
+	Ino() uint64
+
+	// Mode returns the type and permission bits.
+	Mode() uint32
+
+	// Size returns the length of a file, or of the target of a symbolic
+	// link.
+	Size() int64
+
+	Nlink() int
+	ModTime() time.Time
+
+	// Lookup returns the entry name of a directory. Name ".." is the
+	// directory the node was looked up in, the parent of the root is the
+	// root itself.
+	Lookup(name string) (Node, error)
+
+	// Names returns the sorted names of the entries of a directory.
+	Names() ([]string, error)
+
+	// ReadAt reads from a regular file, as io.ReaderAt.
+	ReadAt(b []byte, off int64) (int, error)
+
+	// Readlink returns the target of a symbolic link.
+	Readlink() (string, error)
+}
+
+// Mount detects the format of the image on dev, which has size bytes, and
+// mounts it. Reads from dev are in whole blocks of blockSize bytes.
+func Mount(dev io.ReaderAt, size int64, blockSize int) (FS, error) {
+	if blockSize <= 0 {
+		return nil, syscall.EINVAL
+	}
+	d := &device{r: dev, size: size, bs: int64(blockSize)}
+	for _, mount := range []func(*device) (FS, error){mountExt2, mountISO9660, mountFAT} {
+		fs, err := mount(d)
+		if err != ErrFormat {
+			return fs, err
+		}
+	}
+	return nil, ErrFormat
+}
+
+// device reads at any offset from a device that reads whole blocks.
+type device struct {
+	r    io.ReaderAt
+	size int64
+	bs   int64
+}
+
+// readAt reads len(p) bytes at off. Reading past the end of the device is
+// an ErrCorrupt, the file system refers to data that is not there.
+func (d *device) readAt(p []byte, off int64) error {
+	end := off + int64(len(p))
+	if off < 0 || end < off || end > d.size {
+		return ErrCorrupt
+	}
+	start := off - off%d.bs
+	if rem := end % d.bs; rem != 0 {
+		end += d.bs - rem
+	}
+	if end > d.size {
+		end = d.size
+	}
+	buf := p
+	if start != off || end != off+int64(len(p)) {
+		buf = make([]byte, end-start)
+	}
+	if n, err := d.r.ReadAt(buf, start); n != len(buf) {
+		if err == nil || err == io.EOF {
+			err = ErrCorrupt
+		}
+		return err
+	}
+	if start != off || len(buf) != len(p) {
+		copy(p, buf[off-start:])
+	}
+	return nil
+}
+
+// read returns n bytes at off.
+func (d *device) read(off int64, n int) ([]byte, error) {
+	p := make([]byte, n)
+	if err := d.readAt(p, off); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// An extent maps a range of a file to a range of the device.
+type extent struct {
+	off  int64 // In the file.
+	dev  int64 // On the device, or -1 for a hole.
+	size int64
+}
+
+// readExtents reads from the file made of extents, sorted by off and
+// covering size bytes, as io.ReaderAt. Data not in an extent reads as zeros.
+func readExtents(d *device, extents []extent, size int64, b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	n := 0
+	for n < len(b) {
+		pos := off + int64(n)
+		if pos >= size {
+			return n, io.EOF
+		}
+		m := int64(len(b) - n)
+		if m > size-pos {
+			m = size - pos
+		}
+		i := sort.Search(len(extents), func(i int) bool {
+			return extents[i].off+extents[i].size > pos
+		})
+		switch {
+		case i == len(extents):
+			// Hole at the end.
+		case extents[i].off > pos:
+			// Hole before extent i.
+			if m > extents[i].off-pos {
+				m = extents[i].off - pos
+			}
+		default:
+			e := extents[i]
+			if m > e.off+e.size-pos {
+				m = e.off + e.size - pos
+			}
+			if e.dev >= 0 {
+				if err := d.readAt(b[n:n+int(m)], e.dev+pos-e.off); err != nil {
+					return n, err
+				}
+				n += int(m)
+				continue
+			}
+		}
+		for i := range b[n : n+int(m)] {
+			b[n+i] = 0
+		}
+		n += int(m)
+	}
+	return n, nil
+}
+
+// appendExtent adds the next size bytes of a file at dev, merging with the
+// last extent when contiguous.
+func appendExtent(extents []extent, off, dev, size int64) []extent {
+	if l := len(extents); l > 0 {
+		e := &extents[l-1]
+		if e.off+e.size == off && (e.dev < 0 && dev < 0 || e.dev >= 0 && e.dev+e.size == dev) {
+			e.size += size
+			return extents
+		}
+	}
+	return append(extents, extent{off, dev, size})
+}
+
+// entries are the entries of a directory, by name.
+type entries map[string]Node
+
+func (e entries) names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e entries) lookup(name string) (Node, error) {
+	if n, ok := e[name]; ok {
+		return n, nil
+	}
+	return nil, syscall.ENOENT
+}
+
+// validName reports whether name can be a directory entry.
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' || name[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// unixMode returns the mode bits for Unix mode m, as in a stat structure.
+func unixMode(m uint32) uint32 {
+	mode := m & ModePerm
+	switch m & 0170000 {
+	case 0040000:
+		mode |= ModeDir
+	case 0120000:
+		mode |= ModeSymlink
+	case 0020000:
+		mode |= ModeDevice | ModeCharDevice
+	case 0060000:
+		mode |= ModeDevice
+	case 0010000:
+		mode |= ModeNamedPipe
+	case 0140000:
+		mode |= ModeSocket
+	}
+	if m&04000 != 0 {
+		mode |= ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= ModeSticky
+	}
+	return mode
+}
+
+// checkRead checks that a node with mode can be read with ReadAt.
+func checkRead(mode uint32) error {
+	if mode&ModeDir != 0 {
+		return syscall.EISDIR
+	}
+	if mode&ModeType != 0 {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+func le16(b []byte) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+func le32(b []byte) uint32 {
+	return uint32(le16(b)) | uint32(le16(b[2:]))<<16
+}
+
+func be16(b []byte) uint16 {
+	return uint16(b[1]) | uint16(b[0])<<8
+}
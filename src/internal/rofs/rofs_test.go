@@ -0,0 +1,647 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rofs_test
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	. "internal/rofs"
+)
+
+// The ext2 and ext4 images in testdata hold the tree described by
+// testFiles, created with:
+//
+//	mke2fs -t ext2 -b 1024 -N 32 -d tree -E root_owner=0:0 ext2.img 1M
+//	mke2fs -t ext4 -O ^has_journal -b 1024 -N 32 -d tree -E root_owner=0:0 ext4.img 1M
+//
+// The FAT and ISO9660 images are made by the tests.
+
+type testFile struct {
+	name   string
+	mode   uint32
+	data   string // Contents, or target of a symbolic link.
+	noFAT  bool   // Not on FAT, which has no symbolic links or modes.
+	noISO9 bool   // Not on plain ISO9660, which has no symbolic links.
+}
+
+var testMtime = time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var testFiles = []testFile{
+	{name: "hello.txt", mode: 0644, data: "hello, world\n"},
+	{name: "dir", mode: ModeDir | 0755},
+	{name: "dir/sub", mode: ModeDir | 0755},
+	{name: "dir/sub/deep.txt", mode: 0644, data: "deep\n"},
+	{name: "big", mode: 0644, data: bigData()},
+	{name: "empty", mode: 0644},
+	{name: "secret", mode: 0600, data: "secret\n", noFAT: true},
+	{name: "link", mode: ModeSymlink | 0777, data: "hello.txt", noFAT: true, noISO9: true},
+	{name: "longlink", mode: ModeSymlink | 0777, data: "dir/sub/" + strings.Repeat("x", 70), noFAT: true, noISO9: true},
+}
+
+func bigData() string {
+	b := make([]byte, 300000)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return string(b)
+}
+
+// memDevice is a device in memory that must be read in whole blocks.
+type memDevice struct {
+	data []byte
+	bs   int
+}
+
+func (d *memDevice) ReadAt(p []byte, off int64) (int, error) {
+	if off%int64(d.bs) != 0 || len(p)%d.bs != 0 {
+		panic("unaligned read")
+	}
+	if off >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func mount(t *testing.T, image []byte, bs int) FS {
+	t.Helper()
+	fs, err := Mount(&memDevice{image, bs}, int64(len(image)), bs)
+	if err != nil {
+		t.Fatalf("mount: %v", err)
+	}
+	return fs
+}
+
+func walk(t *testing.T, fs FS, name string) Node {
+	t.Helper()
+	n := fs.Root()
+	for _, elem := range strings.Split(name, "/") {
+		c, err := n.Lookup(elem)
+		if err != nil {
+			t.Fatalf("lookup %s in %s: %v", elem, name, err)
+		}
+		n = c
+	}
+	return n
+}
+
+// checkTree checks that fs holds testFiles. The modes are only checked if
+// modes is set.
+func checkTree(t *testing.T, fs FS, skip func(f testFile) bool, modes bool) {
+	t.Helper()
+	var rootNames []string
+	for _, f := range testFiles {
+		if skip(f) {
+			continue
+		}
+		if !strings.Contains(f.name, "/") {
+			rootNames = append(rootNames, f.name)
+		}
+		n := walk(t, fs, f.name)
+		mode := n.Mode()
+		if mode&ModeType != f.mode&ModeType || modes && mode != f.mode {
+			t.Errorf("%s: mode %o, want %o", f.name, mode, f.mode)
+		}
+		if !n.ModTime().Equal(testMtime) {
+			t.Errorf("%s: mtime %v, want %v", f.name, n.ModTime(), testMtime)
+		}
+		switch {
+		case mode&ModeDir != 0:
+			if _, err := n.ReadAt(make([]byte, 1), 0); err != syscall.EISDIR {
+				t.Errorf("%s: read of directory: %v", f.name, err)
+			}
+		case mode&ModeSymlink != 0:
+			target, err := n.Readlink()
+			if err != nil || target != f.data {
+				t.Errorf("%s: readlink: %q, %v, want %q", f.name, target, err, f.data)
+			}
+		default:
+			if n.Size() != int64(len(f.data)) {
+				t.Errorf("%s: size %d, want %d", f.name, n.Size(), len(f.data))
+			}
+			data, err := ioutil.ReadAll(io.NewSectionReader(n, 0, n.Size()+1))
+			if err != nil || string(data) != f.data {
+				t.Errorf("%s: read %d bytes, %v, want %d bytes", f.name, len(data), err, len(f.data))
+			}
+			// An unaligned read crossing blocks.
+			if len(f.data) > 5000 {
+				b := make([]byte, 3000)
+				if _, err := n.ReadAt(b, 4000); err != nil || string(b) != f.data[4000:7000] {
+					t.Errorf("%s: bad read at offset 4000: %v", f.name, err)
+				}
+			}
+		}
+	}
+
+	names, err := fs.Root().Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range rootNames {
+		found := false
+		for _, s := range names {
+			found = found || s == name
+		}
+		if !found {
+			t.Errorf("root: names %q, missing %q", names, name)
+		}
+	}
+
+	sub := walk(t, fs, "dir/sub")
+	if p, err := sub.Lookup(".."); err != nil || p.Ino() != walk(t, fs, "dir").Ino() {
+		t.Errorf("dir/sub/..: %v, not dir", err)
+	}
+	if p, err := fs.Root().Lookup(".."); err != nil || p.Ino() != fs.Root().Ino() {
+		t.Errorf("/..: %v, not root", err)
+	}
+	if _, err := fs.Root().Lookup("nonexistent"); err != syscall.ENOENT {
+		t.Errorf("lookup of nonexistent: %v", err)
+	}
+	if _, err := walk(t, fs, "hello.txt").Names(); err != syscall.ENOTDIR {
+		t.Errorf("names of file: %v", err)
+	}
+}
+
+func readGzip(t *testing.T, name string) []byte {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExt2(t *testing.T) {
+	for _, name := range []string{"ext2", "ext4"} {
+		t.Run(name, func(t *testing.T) {
+			image := readGzip(t, "testdata/"+name+".img.gz")
+			fs := mount(t, image, 512)
+			if fs.Type() != "ext2" {
+				t.Fatalf("type %q", fs.Type())
+			}
+			checkTree(t, fs, func(testFile) bool { return false }, true)
+		})
+	}
+}
+
+func TestFAT(t *testing.T) {
+	for _, bits := range []int{16, 32} {
+		image := fatImage(bits)
+		fs := mount(t, image, 512)
+		if fs.Type() != "fat" {
+			t.Fatalf("type %q", fs.Type())
+		}
+		checkTree(t, fs, func(f testFile) bool { return f.noFAT }, true)
+
+		for _, name := range []string{"Long File Name.txt", "ünïcode ☃.txt"} {
+			data, err := ioutil.ReadAll(io.NewSectionReader(walk(t, fs, name), 0, 100))
+			if err != nil || string(data) != name {
+				t.Errorf("FAT%d: %s: %q, %v", bits, name, data, err)
+			}
+		}
+		// Names match regardless of case, as on FAT.
+		walk(t, fs, "DIR/Sub/DEEP.TXT")
+		names, _ := fs.Root().Names()
+		if len(names) != 6 {
+			t.Errorf("FAT%d: root has %q", bits, names)
+		}
+	}
+}
+
+func TestISO9660(t *testing.T) {
+	for _, ext := range []string{"", "rockridge", "joliet"} {
+		name := ext
+		if name == "" {
+			name = "plain"
+		}
+		t.Run(name, func(t *testing.T) {
+			fs := mount(t, isoImage(ext), 2048)
+			if fs.Type() != "iso9660" {
+				t.Fatalf("type %q", fs.Type())
+			}
+			checkTree(t, fs, func(f testFile) bool {
+				return ext != "rockridge" && (f.noISO9 || f.name == "secret")
+			}, ext == "rockridge")
+			if ext != "" {
+				n := walk(t, fs, "Mixed Case.txt")
+				if n.Size() != 0 {
+					t.Errorf("Mixed Case.txt: size %d", n.Size())
+				}
+			}
+		})
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	image := make([]byte, 1<<20)
+	if _, err := Mount(&memDevice{image, 512}, int64(len(image)), 512); err != ErrFormat {
+		t.Fatalf("mount of zeros: %v, want ErrFormat", err)
+	}
+}
+
+// fatImage returns a FAT16 or FAT32 image with testFiles, and files with
+// long names, of 512 byte clusters.
+func fatImage(bits int) []byte {
+	const sectorSize = 512
+	var reserved, rootEntries, nclusters int
+	switch bits {
+	case 16:
+		reserved, rootEntries, nclusters = 1, 512, 5000
+	case 32:
+		reserved, rootEntries, nclusters = 32, 0, 65600
+	}
+	fatSize := ((nclusters+2)*bits/8 + sectorSize - 1) / sectorSize
+	rootSectors := rootEntries * 32 / sectorSize
+	dataSector := reserved + 2*fatSize + rootSectors
+	total := dataSector + nclusters
+	image := make([]byte, total*sectorSize)
+
+	b := image
+	b[0], b[1], b[2] = 0xeb, 0x58, 0x90
+	le := binary.LittleEndian
+	le.PutUint16(b[11:], sectorSize)
+	b[13] = 1 // Sectors per cluster.
+	le.PutUint16(b[14:], uint16(reserved))
+	b[16] = 2
+	le.PutUint16(b[17:], uint16(rootEntries))
+	le.PutUint32(b[32:], uint32(total))
+	b[21] = 0xf8
+	if bits == 16 {
+		le.PutUint16(b[22:], uint16(fatSize))
+	} else {
+		le.PutUint32(b[36:], uint32(fatSize))
+		le.PutUint32(b[44:], 2) // Root cluster.
+	}
+	b[510], b[511] = 0x55, 0xaa
+
+	next := 2 // Next free cluster.
+	setFAT := func(c, v int) {
+		for i := 0; i < 2; i++ {
+			off := (reserved+i*fatSize)*sectorSize + c*bits/8
+			if bits == 16 {
+				le.PutUint16(image[off:], uint16(v))
+			} else {
+				le.PutUint32(image[off:], uint32(v))
+			}
+		}
+	}
+	eoc := 1<<uint(bits) - 1
+	if bits == 32 {
+		eoc = 0x0fffffff
+	}
+	setFAT(0, 0xfff8)
+	setFAT(1, eoc)
+	// alloc writes data to new clusters, every other cluster if sparse,
+	// and returns the first.
+	alloc := func(data []byte, sparse bool) int {
+		if len(data) == 0 {
+			return 0
+		}
+		first, prev := 0, 0
+		for len(data) > 0 {
+			c := next
+			next++
+			if sparse {
+				next++
+			}
+			copy(image[(dataSector+c-2)*sectorSize:], data)
+			if len(data) > sectorSize {
+				data = data[sectorSize:]
+			} else {
+				data = nil
+			}
+			if prev == 0 {
+				first = c
+			} else {
+				setFAT(prev, c)
+			}
+			setFAT(c, eoc)
+			prev = c
+		}
+		return first
+	}
+
+	date := uint16(testMtime.Year()-1980)<<9 | uint16(testMtime.Month())<<5 | uint16(testMtime.Day())
+	tm := uint16(testMtime.Hour()) << 11
+	serial := 0
+	// entry returns the directory entries for name, with a long name if
+	// it is not in 8.3 format.
+	entry := func(name string, attr byte, cluster, size int) []byte {
+		short := make([]byte, 11)
+		var long []uint16
+		base, ext := name, ""
+		if i := strings.LastIndex(name, "."); i > 0 {
+			base, ext = name[:i], name[i+1:]
+		}
+		if name == "." || name == ".." {
+			base, ext = name, ""
+		}
+		var nt byte
+		if len(base) <= 8 && len(ext) <= 3 && base == strings.ToLower(base) && !strings.ContainsAny(name, " ☃ü") || name[0] == '.' {
+			copy(short, strings.ToUpper(base)+strings.Repeat(" ", 8-len(base)))
+			copy(short[8:], strings.ToUpper(ext)+strings.Repeat(" ", 3-len(ext)))
+			nt = 0x18
+		} else {
+			serial++
+			copy(short, []byte(strings.Repeat(" ", 11)))
+			copy(short, "LONG~"+string(rune('0'+serial)))
+			long = utf16.Encode([]rune(name))
+		}
+		var sum byte
+		for _, c := range short {
+			sum = (sum&1)<<7 + sum>>1 + c
+		}
+		var e []byte
+		n := (len(long) + 12) / 13
+		for ord := n; ord >= 1; ord-- {
+			le := make([]byte, 32)
+			le[0] = byte(ord)
+			if ord == n {
+				le[0] |= 0x40
+			}
+			le[11] = 0x0f
+			le[13] = sum
+			for i, o := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				j := 13*(ord-1) + i
+				var c uint16 = 0xffff
+				if j < len(long) {
+					c = long[j]
+				} else if j == len(long) {
+					c = 0
+				}
+				binary.LittleEndian.PutUint16(le[o:], c)
+			}
+			e = append(e, le...)
+		}
+		de := make([]byte, 32)
+		copy(de, short)
+		de[11] = attr
+		de[12] = nt
+		le.PutUint16(de[20:], uint16(cluster>>16))
+		le.PutUint16(de[22:], tm)
+		le.PutUint16(de[24:], date)
+		le.PutUint16(de[26:], uint16(cluster))
+		le.PutUint32(de[28:], uint32(size))
+		return append(e, de...)
+	}
+
+	// Directories are written last, their clusters are allocated first.
+	rootCluster := 2
+	if bits == 32 {
+		alloc(make([]byte, sectorSize), false)
+	}
+	dirCluster := alloc(make([]byte, sectorSize), false)
+	subCluster := alloc(make([]byte, sectorSize), false)
+
+	var root []byte
+	label := entry("VOLUME", 0x08, 0, 0)
+	root = append(root, label[len(label)-32:]...)
+	deleted := entry("gone.txt", 0, 0, 0)
+	deleted[0] = 0xe5
+	root = append(root, deleted...)
+	for _, f := range testFiles {
+		if f.noFAT || strings.Contains(f.name, "/") {
+			continue
+		}
+		if f.mode&ModeDir != 0 {
+			root = append(root, entry(f.name, 0x10, dirCluster, 0)...)
+			continue
+		}
+		c := alloc([]byte(f.data), f.name == "big")
+		root = append(root, entry(f.name, 0, c, len(f.data))...)
+	}
+	for _, name := range []string{"Long File Name.txt", "ünïcode ☃.txt"} {
+		c := alloc([]byte(name), false)
+		root = append(root, entry(name, 0, c, len(name))...)
+	}
+	rootParent := rootCluster
+	if bits == 32 {
+		copy(image[(dataSector+rootCluster-2)*sectorSize:], root)
+	} else {
+		copy(image[(reserved+2*fatSize)*sectorSize:], root)
+		rootParent = 0
+	}
+
+	deep := alloc([]byte("deep\n"), false)
+	var dir, sub []byte
+	dir = append(dir, entry(".", 0x10, dirCluster, 0)...)
+	dir = append(dir, entry("..", 0x10, rootParent, 0)...)
+	dir = append(dir, entry("sub", 0x10, subCluster, 0)...)
+	sub = append(sub, entry(".", 0x10, subCluster, 0)...)
+	sub = append(sub, entry("..", 0x10, dirCluster, 0)...)
+	sub = append(sub, entry("deep.txt", 0, deep, 5)...)
+	copy(image[(dataSector+dirCluster-2)*sectorSize:], dir)
+	copy(image[(dataSector+subCluster-2)*sectorSize:], sub)
+	return image
+}
+
+// isoImage returns an ISO9660 image with testFiles, and an empty file
+// Mixed Case.txt, with extensions "rockridge" or "joliet", or none.
+func isoImage(ext string) []byte {
+	const ss = 2048
+	image := make([]byte, 64*ss)
+	next := 20 // Next free sector.
+	alloc := func(data []byte) int {
+		if len(data) == 0 {
+			return 0
+		}
+		s := next
+		n := (len(data) + ss - 1) / ss
+		for s+n > len(image)/ss {
+			image = append(image, make([]byte, len(image))...)
+		}
+		copy(image[s*ss:], data)
+		next += n
+		return s
+	}
+	both32 := func(b []byte, v int) {
+		binary.LittleEndian.PutUint32(b, uint32(v))
+		binary.BigEndian.PutUint32(b[4:], uint32(v))
+	}
+	both16 := func(b []byte, v int) {
+		binary.LittleEndian.PutUint16(b, uint16(v))
+		binary.BigEndian.PutUint16(b[2:], uint16(v))
+	}
+	record := func(extent, size int, flags byte, name []byte, su []byte) []byte {
+		n := 33 + len(name)
+		if n%2 == 1 {
+			n++
+		}
+		r := make([]byte, n+len(su))
+		r[0] = byte(len(r))
+		both32(r[2:], extent)
+		both32(r[10:], size)
+		r[18] = byte(testMtime.Year() - 1900)
+		r[19] = byte(testMtime.Month())
+		r[20] = byte(testMtime.Day())
+		r[21] = byte(testMtime.Hour() + 2)
+		r[24] = 8 // GMT+2.
+		r[25] = flags
+		both16(r[28:], 1)
+		r[32] = byte(len(name))
+		copy(r[33:], name)
+		copy(r[n:], su)
+		return r
+	}
+	rr := func(name string, mode uint32, target string) []byte {
+		if ext != "rockridge" {
+			return nil
+		}
+		var su []byte
+		if name != "" {
+			su = append(su, "NM"...)
+			su = append(su, byte(5+len(name)), 1, 0)
+			su = append(su, name...)
+		}
+		px := make([]byte, 44)
+		copy(px, "PX")
+		px[2], px[3] = 44, 1
+		unix := mode & 0777
+		switch {
+		case mode&ModeDir != 0:
+			unix |= 0040000
+		case mode&ModeSymlink != 0:
+			unix |= 0120000
+		default:
+			unix |= 0100000
+		}
+		both32(px[4:], int(unix))
+		both32(px[12:], 1)
+		su = append(su, px...)
+		if target != "" {
+			// Components, with the first split over two.
+			var comps []byte
+			for i, c := range strings.Split(target, "/") {
+				if i == 0 && len(c) > 1 {
+					comps = append(comps, 1, 1, c[0])
+					c = c[1:]
+				}
+				comps = append(comps, 0, byte(len(c)))
+				comps = append(comps, c...)
+			}
+			su = append(su, "SL"...)
+			su = append(su, byte(5+len(comps)), 1, 0)
+			su = append(su, comps...)
+		}
+		tf := make([]byte, 12)
+		copy(tf, "TF")
+		tf[2], tf[3], tf[4] = 12, 1, 0x02
+		copy(tf[5:], []byte{byte(testMtime.Year() - 1900), byte(testMtime.Month()), byte(testMtime.Day()), byte(testMtime.Hour()), 0, 0, 0})
+		return append(su, tf...)
+	}
+	isoName := func(name string, dir bool) []byte {
+		if ext == "joliet" {
+			var b []byte
+			for _, c := range utf16.Encode([]rune(name)) {
+				b = append(b, byte(c>>8), byte(c))
+			}
+			return b
+		}
+		if dir {
+			return []byte(strings.ToUpper(name))
+		}
+		return []byte(strings.ToUpper(name) + ";1")
+	}
+
+	type dir struct {
+		sector  int
+		records [][]byte
+	}
+	newDir := func() *dir {
+		return &dir{sector: alloc(make([]byte, ss))}
+	}
+	root, d, sub := newDir(), newDir(), newDir()
+	dirs := map[string]*dir{"": root, "dir": d, "dir/sub": sub}
+	add := func(parent string, name string, r []byte) {
+		dirs[parent].records = append(dirs[parent].records, r)
+	}
+	for _, f := range testFiles {
+		if ext != "rockridge" && (f.noISO9 || f.name == "secret") {
+			continue
+		}
+		parent, name := "", f.name
+		if i := strings.LastIndex(f.name, "/"); i >= 0 {
+			parent, name = f.name[:i], f.name[i+1:]
+		}
+		switch {
+		case f.mode&ModeDir != 0:
+			add(parent, name, record(dirs[f.name].sector, ss, 2, isoName(name, true), rr(name, f.mode, "")))
+		case f.mode&ModeSymlink != 0:
+			add(parent, name, record(0, 0, 0, isoName(name, false), rr(name, f.mode, f.data)))
+		case f.name == "big":
+			// In two extents.
+			first := 100 * ss
+			s := alloc([]byte(f.data))
+			add(parent, name, record(s, first, 0x80, isoName(name, false), rr(name, f.mode, "")))
+			add(parent, name, record(s+first/ss, len(f.data)-first, 0, isoName(name, false), rr(name, f.mode, "")))
+		default:
+			add(parent, name, record(alloc([]byte(f.data)), len(f.data), 0, isoName(name, false), rr(name, f.mode, "")))
+		}
+	}
+	if ext != "" {
+		add("", "Mixed Case.txt", record(0, 0, 0, isoName("Mixed Case.txt", false), rr("Mixed Case.txt", 0644, "")))
+	}
+
+	parents := map[*dir]*dir{root: root, d: root, sub: d}
+	for _, dd := range []*dir{root, d, sub} {
+		var su []byte
+		if dd == root && ext == "rockridge" {
+			su = []byte{'S', 'P', 7, 1, 0xbe, 0xef, 0}
+		}
+		su = append(su, rr("", ModeDir|0755, "")...)
+		var b []byte
+		b = append(b, record(dd.sector, ss, 2, []byte{0}, su)...)
+		b = append(b, record(parents[dd].sector, ss, 2, []byte{1}, nil)...)
+		for _, r := range dd.records {
+			b = append(b, r...)
+		}
+		copy(image[dd.sector*ss:], b)
+	}
+
+	vd := func(s int, typ byte) []byte {
+		b := image[s*ss : (s+1)*ss]
+		b[0] = typ
+		copy(b[1:], "CD001")
+		b[6] = 1
+		return b
+	}
+	pvd := vd(16, 1)
+	both32(pvd[80:], len(image)/ss)
+	both16(pvd[128:], ss)
+	copy(pvd[156:], record(root.sector, ss, 2, []byte{0}, nil))
+	term := 17
+	if ext == "joliet" {
+		svd := vd(17, 2)
+		copy(svd[88:], "%/E")
+		both16(svd[128:], ss)
+		copy(svd[156:], record(root.sector, ss, 2, []byte{0}, nil))
+		// The primary volume descriptor would have its own directories
+		// with 8.3 names, it is not used.
+		copy(pvd[156:], record(0, ss, 2, []byte{0}, nil))
+		term = 18
+	}
+	vd(term, 255)
+	return image
+}
@@ -0,0 +1,372 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package solo5fs implements a small crash-safe file system on a block
+// device, for persistent storage in solo5hvt guests. Package os mounts it
+// in the guest, go tool solo5fs creates and inspects images on the host.
+//
+// The file system is copy-on-write. Committed file data is never
+// overwritten in place, changed blocks are written to free blocks instead.
+// The metadata, all inodes and directories, is kept in memory and written
+// as a whole on each commit, to free blocks as well. A commit ends with
+// writing one of two superblocks, alternately, pointing at the new
+// metadata. After a crash, the valid superblock with the highest generation
+// describes the last complete commit, and no block it references has been
+// overwritten since.
+//
+// Blocks 0 and 1 hold the superblocks. The metadata is a chain of blocks,
+// each starting with the number of the next. Free space is not stored, it
+// is computed when mounting.
+//
+// Errors are syscall.Errno values, or ErrCorrupt for a damaged image.
+// An FS is not safe for concurrent use.
+package solo5fs
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+)
+
+// BlockSize is the size of a block of the file system. The block size of
+// the device must divide it.
+const BlockSize = 4096
+
+// Mode bits of inodes, as in os.FileMode.
+const (
+	ModeDir     = 1 << 31
+	ModeSymlink = 1 << 27
+	ModeSetuid  = 1 << 23
+	ModeSetgid  = 1 << 22
+	ModeSticky  = 1 << 20
+	ModePerm    = 0777
+
+	ModeType = ModeDir | ModeSymlink
+)
+
+// MaxNameLen is the maximum length of a name in a directory.
+const MaxNameLen = 255
+
+// ErrCorrupt is returned when mounting a damaged or unknown image.
+var ErrCorrupt = errors.New("solo5fs: corrupt file system")
+
+// Device is the block device an FS is stored on. Reads and writes are in
+// whole blocks of BlockSize bytes. If the device caches writes, it must
+// also implement Syncer.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Syncer is implemented by a Device that caches writes. Sync writes the
+// cached writes to stable storage. It is called before and after the
+// superblock is written, so the superblock never refers to blocks that are
+// not yet stored.
+type Syncer interface {
+	Sync() error
+}
+
+// FS is a mounted file system.
+type FS struct {
+	dev     Device
+	nblocks uint64
+	gen     uint64 // Generation of the last commit.
+	nextIno uint64
+	root    *Inode
+	dirty   bool // Whether there are changes to commit.
+
+	used     bitmap   // Blocks that are not free.
+	fresh    bitmap   // Blocks allocated since the last commit.
+	released []uint64 // Committed blocks no longer in use, free after the next commit.
+	meta     []uint64 // Blocks of the committed metadata.
+	nfree    uint64
+	rover    uint64 // Where the search for a free block starts.
+
+	buf  []byte // Scratch block.
+	zero []byte
+}
+
+// firstBlock is the first block after the superblocks.
+const firstBlock = 2
+
+// minBlocks is the minimum size of a file system.
+const minBlocks = 16
+
+// Format writes an empty file system with a root directory to dev, which
+// has size bytes.
+func Format(dev Device, size int64) error {
+	nblocks := uint64(size / BlockSize)
+	if size < 0 || nblocks < minBlocks {
+		return syscall.EINVAL
+	}
+	fs := newFS(dev, nblocks)
+	fs.nextIno = 1
+	fs.root = fs.newInode(ModeDir | 0755)
+	fs.root.nlink = 1
+	fs.root.parent = fs.root
+
+	// Clear the superblocks of a previous file system.
+	for b := uint64(0); b < firstBlock; b++ {
+		if err := fs.writeBlock(b, fs.zero); err != nil {
+			return err
+		}
+	}
+	return fs.Sync()
+}
+
+// Mount reads the file system from dev, which has size bytes.
+func Mount(dev Device, size int64) (*FS, error) {
+	var best *superblock
+	buf := make([]byte, BlockSize)
+	for b := int64(0); b < firstBlock; b++ {
+		if _, err := dev.ReadAt(buf, b*BlockSize); err != nil {
+			return nil, err
+		}
+		sb, ok := parseSuperblock(buf)
+		if ok && (best == nil || sb.gen > best.gen) {
+			best = &sb
+		}
+	}
+	if best == nil || best.nblocks < minBlocks || best.nblocks > uint64(size/BlockSize) || best.nextIno == 0 {
+		return nil, ErrCorrupt
+	}
+
+	fs := newFS(dev, best.nblocks)
+	fs.gen = best.gen
+	fs.nextIno = best.nextIno
+	data, err := fs.readMeta(best)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.decode(data); err != nil {
+		return nil, err
+	}
+	fs.dirty = false
+	return fs, nil
+}
+
+func newFS(dev Device, nblocks uint64) *FS {
+	fs := &FS{
+		dev:     dev,
+		nblocks: nblocks,
+		used:    newBitmap(nblocks),
+		fresh:   newBitmap(nblocks),
+		nfree:   nblocks,
+		rover:   firstBlock,
+		buf:     make([]byte, BlockSize),
+		zero:    make([]byte, BlockSize),
+	}
+	for b := uint64(0); b < firstBlock; b++ {
+		fs.use(b)
+	}
+	for b := nblocks; b < uint64(len(fs.used))*64; b++ {
+		// Past the end, for findClear.
+		fs.used.set(b)
+	}
+	return fs
+}
+
+// Root returns the root directory.
+func (fs *FS) Root() *Inode {
+	return fs.root
+}
+
+// Generation returns the number of the last commit.
+func (fs *FS) Generation() uint64 {
+	return fs.gen
+}
+
+// Blocks returns the size of the file system and the number of free
+// blocks. Blocks released since the last commit are not yet free.
+func (fs *FS) Blocks() (total, free uint64) {
+	return fs.nblocks, fs.nfree
+}
+
+// Sync commits all changes: the metadata is written, followed by the
+// superblock. Blocks released since the previous commit become free.
+func (fs *FS) Sync() error {
+	if !fs.dirty && fs.gen > 0 {
+		return nil
+	}
+	data := fs.encode()
+
+	n := (len(data) + metaPayload - 1) / metaPayload
+	blocks := make([]uint64, 0, n)
+	for len(blocks) < n {
+		b, err := fs.alloc(0, false)
+		if err != nil {
+			for _, b := range blocks {
+				fs.free(b)
+			}
+			return err
+		}
+		blocks = append(blocks, b)
+	}
+	err := fs.writeMeta(blocks, data)
+	if err == nil {
+		err = fs.syncDevice()
+	}
+	if err != nil {
+		for _, b := range blocks {
+			fs.free(b)
+		}
+		return err
+	}
+	sb := superblock{
+		gen:        fs.gen + 1,
+		nblocks:    fs.nblocks,
+		metaBlock:  blocks[0],
+		metaLength: uint64(len(data)),
+		metaCRC:    crc32c(data),
+		nextIno:    fs.nextIno,
+	}
+	err = fs.writeBlock(sb.gen%firstBlock, sb.marshal())
+	if err == nil {
+		err = fs.syncDevice()
+	}
+	if err != nil {
+		for _, b := range blocks {
+			fs.free(b)
+		}
+		return err
+	}
+
+	// The new state is committed, what only the old state used can be
+	// reused.
+	fs.gen = sb.gen
+	for _, b := range fs.meta {
+		fs.free(b)
+	}
+	for _, b := range fs.released {
+		fs.free(b)
+	}
+	fs.meta = blocks
+	fs.released = nil
+	fs.fresh.clearAll()
+	fs.dirty = false
+	return nil
+}
+
+// use marks block b as in use.
+func (fs *FS) use(b uint64) {
+	fs.used.set(b)
+	fs.nfree--
+}
+
+// free marks block b as free.
+func (fs *FS) free(b uint64) {
+	fs.used.clear(b)
+	fs.fresh.clear(b)
+	fs.nfree++
+}
+
+// release gives up block b of a file. A block that is not committed is
+// free immediately, a committed one only after the next commit.
+func (fs *FS) release(b uint64) {
+	if fs.fresh.get(b) {
+		fs.free(b)
+	} else {
+		fs.released = append(fs.released, b)
+	}
+}
+
+// alloc returns a free block, preferably hint, and marks it fresh. For file
+// data, some blocks are kept in reserve for the next commit of metadata.
+// When the file system is full, a commit may free released blocks.
+func (fs *FS) alloc(hint uint64, data bool) (uint64, error) {
+	reserve := uint64(0)
+	if data {
+		reserve = uint64(len(fs.meta)) + 4
+		if fs.nfree <= reserve && len(fs.released) > 0 {
+			if err := fs.Sync(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if fs.nfree <= reserve {
+		return 0, syscall.ENOSPC
+	}
+	if hint < firstBlock || hint >= fs.nblocks {
+		hint = fs.rover
+	}
+	b, ok := fs.used.findClear(hint, firstBlock)
+	if !ok {
+		return 0, syscall.ENOSPC
+	}
+	fs.use(b)
+	fs.fresh.set(b)
+	fs.rover = b + 1
+	return b, nil
+}
+
+func (fs *FS) readBlock(b uint64, p []byte) error {
+	_, err := fs.dev.ReadAt(p[:BlockSize], int64(b)*BlockSize)
+	return err
+}
+
+// syncDevice writes the writes cached by the device to stable storage.
+func (fs *FS) syncDevice() error {
+	if s, ok := fs.dev.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (fs *FS) writeBlock(b uint64, p []byte) error {
+	_, err := fs.dev.WriteAt(p[:BlockSize], int64(b)*BlockSize)
+	return err
+}
+
+func (fs *FS) newInode(mode uint32) *Inode {
+	n := &Inode{
+		fs:      fs,
+		ino:     fs.nextIno,
+		mode:    mode,
+		modTime: time.Now(),
+	}
+	fs.nextIno++
+	if mode&ModeDir != 0 {
+		n.entries = map[string]*Inode{}
+	}
+	fs.dirty = true
+	return n
+}
+
+// A bitmap has a bit for each block.
+type bitmap []uint64
+
+func newBitmap(n uint64) bitmap {
+	return make(bitmap, (n+63)/64)
+}
+
+func (m bitmap) get(i uint64) bool { return m[i/64]&(1<<(i%64)) != 0 }
+func (m bitmap) set(i uint64)      { m[i/64] |= 1 << (i % 64) }
+func (m bitmap) clear(i uint64)    { m[i/64] &^= 1 << (i % 64) }
+
+func (m bitmap) clearAll() {
+	for i := range m {
+		m[i] = 0
+	}
+}
+
+// findClear returns the first clear bit at or after start, wrapping around
+// to min. The bits at the end of the last word must be set.
+func (m bitmap) findClear(start, min uint64) (uint64, bool) {
+	for i := start; i < uint64(len(m))*64; i++ {
+		if m[i/64] == ^uint64(0) {
+			i |= 63
+			continue
+		}
+		if !m.get(i) {
+			return i, true
+		}
+	}
+	for i := min; i < start; i++ {
+		if !m.get(i) {
+			return i, true
+		}
+	}
+	return 0, false
+}
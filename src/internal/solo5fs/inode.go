@@ -0,0 +1,479 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package solo5fs
+
+import (
+	"io"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// MaxLinkLen is the maximum length of the target of a symbolic link.
+const MaxLinkLen = BlockSize - 1
+
+// Inode is a file, directory or symbolic link.
+type Inode struct {
+	fs      *FS
+	ino     uint64
+	mode    uint32
+	modTime time.Time
+	nlink   int   // Number of directory entries for the inode.
+	size    int64 // Of the contents, or the target of a symbolic link.
+	opens   int   // Number of Open calls without Close.
+
+	blocks  []uint64          // Of a regular file, (size+BlockSize-1)/BlockSize.
+	target  string            // Of a symbolic link.
+	entries map[string]*Inode // Of a directory.
+	parent  *Inode            // Of a directory.
+}
+
+// Ino returns the inode number, unique within the file system.
+func (n *Inode) Ino() uint64 { return n.ino }
+
+// Mode returns the type and permission bits.
+func (n *Inode) Mode() uint32 { return n.mode }
+
+// ModTime returns the modification time.
+func (n *Inode) ModTime() time.Time { return n.modTime }
+
+// Nlink returns the number of directory entries for the inode.
+func (n *Inode) Nlink() int { return n.nlink }
+
+// Size returns the length of a file, or of the target of a symbolic link.
+func (n *Inode) Size() int64 { return n.size }
+
+// IsDir reports whether n is a directory.
+func (n *Inode) IsDir() bool { return n.mode&ModeDir != 0 }
+
+// IsRegular reports whether n is a regular file.
+func (n *Inode) IsRegular() bool { return n.mode&ModeType == 0 }
+
+// Chmod changes the permission bits of n.
+func (n *Inode) Chmod(mode uint32) {
+	const bits = ModePerm | ModeSetuid | ModeSetgid | ModeSticky
+	n.mode = n.mode&^bits | mode&bits
+	n.fs.dirty = true
+}
+
+// SetModTime changes the modification time of n.
+func (n *Inode) SetModTime(t time.Time) {
+	n.modTime = t
+	n.fs.dirty = true
+}
+
+// Open records that n is in use. The contents of a file that is removed
+// while in use remain readable until the matching Close.
+func (n *Inode) Open() {
+	n.opens++
+}
+
+// Close ends a use of n started with Open.
+func (n *Inode) Close() {
+	n.opens--
+	n.freeUnused()
+}
+
+// freeUnused releases the blocks of a file that is no longer linked or in
+// use.
+func (n *Inode) freeUnused() {
+	if n.nlink > 0 || n.opens > 0 {
+		return
+	}
+	for _, b := range n.blocks {
+		n.fs.release(b)
+	}
+	n.blocks = nil
+}
+
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return syscall.EINVAL
+	}
+	if len(name) > MaxNameLen {
+		return syscall.ENAMETOOLONG
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' || name[i] == 0 {
+			return syscall.EINVAL
+		}
+	}
+	return nil
+}
+
+// touch marks directory n as changed.
+func (n *Inode) touch() {
+	n.modTime = time.Now()
+	n.fs.dirty = true
+}
+
+// Lookup returns the entry name of directory n. Name ".." is the parent,
+// the parent of the root is the root itself.
+func (n *Inode) Lookup(name string) (*Inode, error) {
+	if !n.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+	switch name {
+	case ".":
+		return n, nil
+	case "..":
+		return n.parent, nil
+	}
+	c, ok := n.entries[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return c, nil
+}
+
+// Names returns the sorted names of the entries of directory n.
+func (n *Inode) Names() []string {
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// link adds c as name to directory n.
+func (n *Inode) link(name string, c *Inode) {
+	n.entries[name] = c
+	c.nlink++
+	if c.IsDir() {
+		c.parent = n
+	}
+	n.touch()
+}
+
+// unlink removes name from directory n.
+func (n *Inode) unlink(name string) {
+	c := n.entries[name]
+	delete(n.entries, name)
+	c.nlink--
+	c.freeUnused()
+	n.touch()
+}
+
+// canAdd checks that name can be added to directory n.
+func (n *Inode) canAdd(name string) error {
+	if !n.IsDir() {
+		return syscall.ENOTDIR
+	}
+	if n.nlink == 0 {
+		return syscall.ENOENT
+	}
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if _, ok := n.entries[name]; ok {
+		return syscall.EEXIST
+	}
+	return nil
+}
+
+// Create adds a new empty file or directory to directory n. The type in
+// mode must be 0 or ModeDir.
+func (n *Inode) Create(name string, mode uint32) (*Inode, error) {
+	if mode&ModeType != 0 && mode&ModeType != ModeDir {
+		return nil, syscall.EINVAL
+	}
+	if err := n.canAdd(name); err != nil {
+		return nil, err
+	}
+	c := n.fs.newInode(mode)
+	n.link(name, c)
+	return c, nil
+}
+
+// Symlink adds a new symbolic link to target to directory n.
+func (n *Inode) Symlink(name, target string) (*Inode, error) {
+	if err := n.canAdd(name); err != nil {
+		return nil, err
+	}
+	if len(target) > MaxLinkLen {
+		return nil, syscall.ENAMETOOLONG
+	}
+	c := n.fs.newInode(ModeSymlink | 0777)
+	c.target = target
+	c.size = int64(len(target))
+	n.link(name, c)
+	return c, nil
+}
+
+// Link adds existing file c to directory n.
+func (n *Inode) Link(name string, c *Inode) error {
+	if c.fs != n.fs {
+		return syscall.EXDEV
+	}
+	if c.IsDir() {
+		return syscall.EPERM
+	}
+	if err := n.canAdd(name); err != nil {
+		return err
+	}
+	n.link(name, c)
+	return nil
+}
+
+// Remove removes name from directory n. Directories must be empty.
+func (n *Inode) Remove(name string) error {
+	c, err := n.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if c.IsDir() && len(c.entries) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	n.unlink(name)
+	return nil
+}
+
+// Rename moves entry oldname of directory n to newname in directory
+// newdir, replacing an existing entry if it has the same type and is not a
+// non-empty directory.
+func (n *Inode) Rename(oldname string, newdir *Inode, newname string) error {
+	c, err := n.Lookup(oldname)
+	if err != nil {
+		return err
+	}
+	if newdir.fs != n.fs {
+		return syscall.EXDEV
+	}
+	if !newdir.IsDir() {
+		return syscall.ENOTDIR
+	}
+	if newdir.nlink == 0 {
+		return syscall.ENOENT
+	}
+	if err := checkName(oldname); err != nil {
+		return err
+	}
+	if err := checkName(newname); err != nil {
+		return err
+	}
+	old, exists := newdir.entries[newname]
+	if exists {
+		switch {
+		case old == c:
+			return nil
+		case c.IsDir() && !old.IsDir():
+			return syscall.ENOTDIR
+		case !c.IsDir() && old.IsDir():
+			return syscall.EISDIR
+		case old.IsDir() && len(old.entries) > 0:
+			return syscall.ENOTEMPTY
+		}
+	}
+	if c.IsDir() {
+		for d := newdir; d != n.fs.root; d = d.parent {
+			if d == c {
+				// Cannot move a directory into itself.
+				return syscall.EINVAL
+			}
+		}
+	}
+	if exists {
+		newdir.unlink(newname)
+	}
+	newdir.link(newname, c)
+	n.unlink(oldname)
+	return nil
+}
+
+// Readlink returns the target of symbolic link n.
+func (n *Inode) Readlink() (string, error) {
+	if n.mode&ModeSymlink == 0 {
+		return "", syscall.EINVAL
+	}
+	return n.target, nil
+}
+
+func (n *Inode) checkRegular() error {
+	if n.IsDir() {
+		return syscall.EISDIR
+	}
+	if !n.IsRegular() {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// ReadAt reads from file n at offset off, as io.ReaderAt.
+func (n *Inode) ReadAt(b []byte, off int64) (int, error) {
+	if err := n.checkRegular(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	fs := n.fs
+	nr := 0
+	for nr < len(b) {
+		pos := off + int64(nr)
+		if pos >= n.size {
+			return nr, io.EOF
+		}
+		blk := n.blocks[pos/BlockSize]
+		lo := int(pos % BlockSize)
+		m := BlockSize - lo
+		if m > len(b)-nr {
+			m = len(b) - nr
+		}
+		if int64(m) > n.size-pos {
+			m = int(n.size - pos)
+		}
+		if lo == 0 && m == BlockSize {
+			if err := fs.readBlock(blk, b[nr:nr+m]); err != nil {
+				return nr, err
+			}
+		} else {
+			if err := fs.readBlock(blk, fs.buf); err != nil {
+				return nr, err
+			}
+			copy(b[nr:nr+m], fs.buf[lo:])
+		}
+		nr += m
+	}
+	return nr, nil
+}
+
+// WriteAt writes to file n at offset off, as io.WriterAt. Writing past the
+// end of the file extends it, with zeros in any gap.
+func (n *Inode) WriteAt(b []byte, off int64) (int, error) {
+	if err := n.checkRegular(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	if off+int64(len(b)) < off || (off+int64(len(b)))/BlockSize >= int64(n.fs.nblocks) {
+		return 0, syscall.EFBIG
+	}
+	if off > n.size {
+		if err := n.grow(off); err != nil {
+			return 0, err
+		}
+	}
+	fs := n.fs
+	nw := 0
+	for nw < len(b) {
+		pos := off + int64(nw)
+		i := int(pos / BlockSize)
+		lo := int(pos % BlockSize)
+		m := BlockSize - lo
+		if m > len(b)-nw {
+			m = len(b) - nw
+		}
+		data := b[nw : nw+m]
+		if m != BlockSize {
+			// Partial block, merge with the current contents. Past the
+			// end of the file, a block reads as zeros.
+			if i < len(n.blocks) {
+				if err := fs.readBlock(n.blocks[i], fs.buf); err != nil {
+					return nw, err
+				}
+			} else {
+				copy(fs.buf, fs.zero)
+			}
+			copy(fs.buf[lo:], data)
+			data = fs.buf
+		}
+		if err := n.writeBlock(i, data); err != nil {
+			return nw, err
+		}
+		nw += m
+		if pos+int64(m) > n.size {
+			n.size = pos + int64(m)
+		}
+	}
+	n.modTime = time.Now()
+	fs.dirty = true
+	return nw, nil
+}
+
+// writeBlock writes block i of file n, which is at most one past the
+// end of the file. A committed block is not overwritten, the data goes to
+// a new block that replaces it.
+func (n *Inode) writeBlock(i int, data []byte) error {
+	fs := n.fs
+	if i < len(n.blocks) && fs.fresh.get(n.blocks[i]) {
+		return fs.writeBlock(n.blocks[i], data)
+	}
+	hint := uint64(0)
+	if i > 0 {
+		hint = n.blocks[i-1] + 1
+	}
+	b, err := fs.alloc(hint, true)
+	if err != nil {
+		return err
+	}
+	if err := fs.writeBlock(b, data); err != nil {
+		fs.free(b)
+		return err
+	}
+	if i < len(n.blocks) {
+		fs.release(n.blocks[i])
+		n.blocks[i] = b
+	} else {
+		n.blocks = append(n.blocks, b)
+	}
+	return nil
+}
+
+// grow extends file n to size with zeros. The part of the last block past
+// the end of the file is always zero.
+func (n *Inode) grow(size int64) error {
+	for int64(len(n.blocks))*BlockSize < size {
+		if err := n.writeBlock(len(n.blocks), n.fs.zero); err != nil {
+			return err
+		}
+		n.size = int64(len(n.blocks)) * BlockSize
+	}
+	n.size = size
+	return nil
+}
+
+// Truncate changes the size of file n.
+func (n *Inode) Truncate(size int64) error {
+	if err := n.checkRegular(); err != nil {
+		return err
+	}
+	if size < 0 {
+		return syscall.EINVAL
+	}
+	if size/BlockSize >= int64(n.fs.nblocks) {
+		return syscall.EFBIG
+	}
+	defer func() {
+		n.modTime = time.Now()
+		n.fs.dirty = true
+	}()
+	if size >= n.size {
+		return n.grow(size)
+	}
+
+	nb := int((size + BlockSize - 1) / BlockSize)
+	if tail := int(size % BlockSize); tail != 0 {
+		// Keep the part past the end of the file zero.
+		fs := n.fs
+		if err := fs.readBlock(n.blocks[nb-1], fs.buf); err != nil {
+			return err
+		}
+		copy(fs.buf[tail:], fs.zero)
+		if err := n.writeBlock(nb-1, fs.buf); err != nil {
+			return err
+		}
+	}
+	for _, b := range n.blocks[nb:] {
+		n.fs.release(b)
+	}
+	n.blocks = n.blocks[:nb]
+	n.size = size
+	return nil
+}
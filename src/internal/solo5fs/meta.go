@@ -0,0 +1,412 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package solo5fs
+
+import (
+	"time"
+)
+
+// On-disk format. All integers are little-endian.
+//
+// Superblock, in blocks 0 and 1:
+//
+//	magic      [8]byte  "solo5fs\x00"
+//	version    uint32   1
+//	blockSize  uint32   BlockSize
+//	nblocks    uint64   size of the file system
+//	gen        uint64   generation of the commit, stored in block gen%2
+//	metaBlock  uint64   first block of the metadata
+//	metaLength uint64   length of the metadata in bytes
+//	metaCRC    uint32   CRC-32C of the metadata
+//	pad        uint32
+//	nextIno    uint64   next inode number to use
+//	crc        uint32   CRC-32C of the fields above
+//
+// Metadata block:
+//
+//	next    uint64   next block of the metadata, 0 for the last
+//	payload [BlockSize-8]byte
+//
+// Metadata, the inodes reachable from the root, root first:
+//
+//	count uint64
+//	inodes, each:
+//		ino     uint64
+//		mode    uint32   as in os.FileMode
+//		modTime int64    nanoseconds since the Unix epoch
+//		size    int64
+//		regular file: extents covering (size+BlockSize-1)/BlockSize blocks
+//			count uint32
+//			extents, each: start uint64, length uint32
+//		symbolic link:
+//			target [size]byte
+//		directory:
+//			count uint32
+//			entries, each: length uint8, name [length]byte, ino uint64
+
+const (
+	magic         = "solo5fs\x00"
+	version       = 1
+	superblockLen = 64
+	metaPayload   = BlockSize - 8
+)
+
+type superblock struct {
+	nblocks    uint64
+	gen        uint64
+	metaBlock  uint64
+	metaLength uint64
+	metaCRC    uint32
+	nextIno    uint64
+}
+
+func (sb *superblock) marshal() []byte {
+	b := make([]byte, BlockSize)
+	copy(b, magic)
+	put32(b[8:], version)
+	put32(b[12:], BlockSize)
+	put64(b[16:], sb.nblocks)
+	put64(b[24:], sb.gen)
+	put64(b[32:], sb.metaBlock)
+	put64(b[40:], sb.metaLength)
+	put32(b[48:], sb.metaCRC)
+	put64(b[56:], sb.nextIno)
+	put32(b[superblockLen:], crc32c(b[:superblockLen]))
+	return b
+}
+
+func parseSuperblock(b []byte) (sb superblock, ok bool) {
+	if string(b[:8]) != magic || get32(b[8:]) != version || get32(b[12:]) != BlockSize {
+		return sb, false
+	}
+	if get32(b[superblockLen:]) != crc32c(b[:superblockLen]) {
+		return sb, false
+	}
+	sb = superblock{
+		nblocks:    get64(b[16:]),
+		gen:        get64(b[24:]),
+		metaBlock:  get64(b[32:]),
+		metaLength: get64(b[40:]),
+		metaCRC:    get32(b[48:]),
+		nextIno:    get64(b[56:]),
+	}
+	return sb, true
+}
+
+// readMeta reads the metadata of sb, marking its blocks in use.
+func (fs *FS) readMeta(sb *superblock) ([]byte, error) {
+	if sb.metaLength > (fs.nblocks-firstBlock)*metaPayload {
+		return nil, ErrCorrupt
+	}
+	data := make([]byte, 0, sb.metaLength)
+	next := sb.metaBlock
+	for uint64(len(data)) < sb.metaLength {
+		if next < firstBlock || next >= fs.nblocks || fs.used.get(next) {
+			return nil, ErrCorrupt
+		}
+		if err := fs.readBlock(next, fs.buf); err != nil {
+			return nil, err
+		}
+		fs.use(next)
+		fs.meta = append(fs.meta, next)
+		n := sb.metaLength - uint64(len(data))
+		if n > metaPayload {
+			n = metaPayload
+		}
+		data = append(data, fs.buf[8:8+n]...)
+		next = get64(fs.buf)
+	}
+	if crc32c(data) != sb.metaCRC {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+// writeMeta writes data to blocks. It does not use fs.buf, a commit can
+// happen in the middle of a write to a file.
+func (fs *FS) writeMeta(blocks []uint64, data []byte) error {
+	buf := make([]byte, BlockSize)
+	for i, b := range blocks {
+		next := uint64(0)
+		if i+1 < len(blocks) {
+			next = blocks[i+1]
+		}
+		put64(buf, next)
+		n := copy(buf[8:], data)
+		data = data[n:]
+		copy(buf[8+n:], fs.zero)
+		if err := fs.writeBlock(b, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the metadata for the inodes reachable from the root.
+func (fs *FS) encode() []byte {
+	var inodes []*Inode
+	seen := map[*Inode]bool{}
+	var walk func(n *Inode)
+	walk = func(n *Inode) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		inodes = append(inodes, n)
+		for _, name := range n.Names() {
+			walk(n.entries[name])
+		}
+	}
+	walk(fs.root)
+
+	var b []byte
+	b = append64(b, uint64(len(inodes)))
+	for _, n := range inodes {
+		b = append64(b, n.ino)
+		b = append32(b, n.mode)
+		b = append64(b, uint64(n.modTime.UnixNano()))
+		b = append64(b, uint64(n.size))
+		switch {
+		case n.mode&ModeDir != 0:
+			names := n.Names()
+			b = append32(b, uint32(len(names)))
+			for _, name := range names {
+				b = append(b, uint8(len(name)))
+				b = append(b, name...)
+				b = append64(b, n.entries[name].ino)
+			}
+		case n.mode&ModeSymlink != 0:
+			b = append(b, n.target...)
+		default:
+			var extents [][2]uint64
+			for _, blk := range n.blocks {
+				if l := len(extents); l > 0 && extents[l-1][0]+extents[l-1][1] == blk && extents[l-1][1] < 1<<32-1 {
+					extents[l-1][1]++
+				} else {
+					extents = append(extents, [2]uint64{blk, 1})
+				}
+			}
+			b = append32(b, uint32(len(extents)))
+			for _, e := range extents {
+				b = append64(b, e[0])
+				b = append32(b, uint32(e[1]))
+			}
+		}
+	}
+	return b
+}
+
+// decode reads the inodes from the metadata, and marks their blocks in
+// use.
+func (fs *FS) decode(data []byte) error {
+	d := decoder{data: data}
+	count := d.uint64()
+	if count == 0 || count > uint64(len(data)) {
+		return ErrCorrupt
+	}
+	inodes := map[uint64]*Inode{}
+	type entry struct {
+		dir  *Inode
+		name string
+		ino  uint64
+	}
+	var entries []entry
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		n := &Inode{
+			fs:      fs,
+			ino:     d.uint64(),
+			mode:    d.uint32(),
+			modTime: time.Unix(0, int64(d.uint64())),
+			size:    int64(d.uint64()),
+		}
+		if n.ino == 0 || n.ino >= fs.nextIno || inodes[n.ino] != nil || n.size < 0 {
+			return ErrCorrupt
+		}
+		inodes[n.ino] = n
+		switch n.mode & ModeType {
+		case ModeDir:
+			n.entries = map[string]*Inode{}
+			ne := d.uint32()
+			for j := uint32(0); j < ne && d.err == nil; j++ {
+				name := string(d.bytes(int(d.uint8())))
+				entries = append(entries, entry{n, name, d.uint64()})
+			}
+		case ModeSymlink:
+			if n.size > MaxLinkLen {
+				return ErrCorrupt
+			}
+			n.target = string(d.bytes(int(n.size)))
+		case 0:
+			nb := (n.size + BlockSize - 1) / BlockSize
+			if uint64(nb) > fs.nblocks {
+				return ErrCorrupt
+			}
+			n.blocks = make([]uint64, 0, nb)
+			ne := d.uint32()
+			for j := uint32(0); j < ne && d.err == nil; j++ {
+				start, length := d.uint64(), uint64(d.uint32())
+				if length == 0 || start < firstBlock || start+length > fs.nblocks || start+length < start {
+					return ErrCorrupt
+				}
+				for b := start; b < start+length; b++ {
+					if fs.used.get(b) {
+						return ErrCorrupt
+					}
+					fs.use(b)
+					n.blocks = append(n.blocks, b)
+				}
+			}
+			if int64(len(n.blocks)) != nb {
+				return ErrCorrupt
+			}
+		default:
+			return ErrCorrupt
+		}
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return ErrCorrupt
+	}
+
+	fs.root = inodes[1]
+	if fs.root == nil || fs.root.mode&ModeDir == 0 {
+		return ErrCorrupt
+	}
+	fs.root.parent = fs.root
+	fs.root.nlink = 1
+	for _, e := range entries {
+		c := inodes[e.ino]
+		if c == nil || c == fs.root || checkName(e.name) != nil || e.dir.entries[e.name] != nil {
+			return ErrCorrupt
+		}
+		if c.mode&ModeDir != 0 {
+			if c.parent != nil {
+				return ErrCorrupt
+			}
+			c.parent = e.dir
+		}
+		e.dir.entries[e.name] = c
+		c.nlink++
+	}
+	for _, n := range inodes {
+		if n.nlink == 0 {
+			return ErrCorrupt
+		}
+	}
+	// Directories are reachable from the root: with one parent each
+	// and all inodes linked, a cycle would leave some unreachable.
+	reached := 0
+	var walk func(n *Inode)
+	walk = func(n *Inode) {
+		reached++
+		for _, c := range n.entries {
+			if c.mode&ModeDir != 0 {
+				walk(c)
+			}
+		}
+	}
+	walk(fs.root)
+	dirs := 0
+	for _, n := range inodes {
+		if n.mode&ModeDir != 0 {
+			dirs++
+		}
+	}
+	if reached != dirs {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.data) {
+		d.err = ErrCorrupt
+		d.data = nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return get32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return get64(b)
+	}
+	return 0
+}
+
+func get32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func get64(b []byte) uint64 {
+	return uint64(get32(b)) | uint64(get32(b[4:]))<<32
+}
+
+func put32(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func put64(b []byte, v uint64) {
+	put32(b, uint32(v))
+	put32(b[4:], uint32(v>>32))
+}
+
+func append32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func append64(b []byte, v uint64) []byte {
+	return append32(append32(b, uint32(v)), uint32(v>>32))
+}
+
+// crc32c returns the CRC-32 of b with the Castagnoli polynomial. Package
+// hash/crc32 is not used, package os cannot depend on it.
+func crc32c(b []byte) uint32 {
+	c := ^uint32(0)
+	for _, x := range b {
+		c = crcTable[byte(c)^x] ^ c>>8
+	}
+	return ^c
+}
+
+var crcTable = makeCRCTable()
+
+func makeCRCTable() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i)
+		for j := 0; j < 8; j++ {
+			if c&1 != 0 {
+				c = c>>1 ^ 0x82f63b78
+			} else {
+				c >>= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}
@@ -0,0 +1,337 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package solo5fs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	. "internal/solo5fs"
+)
+
+// memDevice is a device in memory. After limit writes, further writes are
+// silently lost, as in a crash.
+type memDevice struct {
+	data   []byte
+	writes int
+	limit  int
+}
+
+func newMemDevice(size int) *memDevice {
+	return &memDevice{data: make([]byte, size), limit: -1}
+}
+
+func (d *memDevice) ReadAt(p []byte, off int64) (int, error) {
+	if off%BlockSize != 0 || len(p)%BlockSize != 0 {
+		panic("unaligned read")
+	}
+	if off >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, d.data[off:]), nil
+}
+
+func (d *memDevice) WriteAt(p []byte, off int64) (int, error) {
+	if off%BlockSize != 0 || len(p)%BlockSize != 0 {
+		panic("unaligned write")
+	}
+	if off+int64(len(p)) > int64(len(d.data)) {
+		return 0, syscall.ENOSPC
+	}
+	if d.limit >= 0 && d.writes >= d.limit {
+		return len(p), nil
+	}
+	d.writes++
+	return copy(d.data[off:], p), nil
+}
+
+func (d *memDevice) size() int64 {
+	return int64(len(d.data))
+}
+
+func mustMount(t *testing.T, d *memDevice) *FS {
+	t.Helper()
+	fs, err := Mount(d, d.size())
+	if err != nil {
+		t.Fatalf("mount: %v", err)
+	}
+	return fs
+}
+
+// dump returns the contents of the file system, for comparison.
+func dump(t *testing.T, fs *FS) string {
+	t.Helper()
+	var b bytes.Buffer
+	var walk func(dir *Inode, path string)
+	walk = func(dir *Inode, path string) {
+		for _, name := range dir.Names() {
+			n, err := dir.Lookup(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(&b, "%s/%s %o %d %d", path, name, n.Mode(), n.Size(), n.Nlink())
+			switch {
+			case n.IsDir():
+				b.WriteString("\n")
+				walk(n, path+"/"+name)
+			case n.IsRegular():
+				data := make([]byte, n.Size())
+				if _, err := n.ReadAt(data, 0); err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				fmt.Fprintf(&b, " %q\n", data)
+			default:
+				target, _ := n.Readlink()
+				fmt.Fprintf(&b, " -> %s\n", target)
+			}
+		}
+	}
+	walk(fs.Root(), "")
+	return b.String()
+}
+
+func TestMount(t *testing.T) {
+	d := newMemDevice(256 * BlockSize)
+	if err := Format(d, d.size()); err != nil {
+		t.Fatal(err)
+	}
+	fs := mustMount(t, d)
+	root := fs.Root()
+	dir, err := root.Create("dir", ModeDir|0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := dir.Create("file", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte("0123456789"), 2000)
+	if _, err := f.WriteAt(big, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("hello"), 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Link("hardlink", f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Symlink("link", "dir/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Create("dir", 0644); err != syscall.EEXIST {
+		t.Fatalf("create existing: got %v, want EEXIST", err)
+	}
+	if err := root.Remove("dir"); err != syscall.ENOTEMPTY {
+		t.Fatalf("remove non-empty: got %v, want ENOTEMPTY", err)
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	want := dump(t, fs)
+
+	fs2 := mustMount(t, d)
+	if got := dump(t, fs2); got != want {
+		t.Fatalf("after mount:\n%s\nwant:\n%s", got, want)
+	}
+	if fs2.Generation() != fs.Generation() {
+		t.Fatalf("generation %d, want %d", fs2.Generation(), fs.Generation())
+	}
+	_, free := fs.Blocks()
+	_, free2 := fs2.Blocks()
+	if free != free2 {
+		t.Fatalf("%d free blocks after mount, want %d", free2, free)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	d := newMemDevice(64 * BlockSize)
+	if err := Format(d, d.size()); err != nil {
+		t.Fatal(err)
+	}
+	fs := mustMount(t, d)
+	f, err := fs.Root().Create("f", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{'x'}, 3*BlockSize), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(BlockSize + 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("y"), 2*BlockSize); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, 2*BlockSize+1)
+	copy(want, bytes.Repeat([]byte{'x'}, 10))
+	want[2*BlockSize] = 'y'
+	got := make([]byte, len(want)+10)
+	n, err := f.ReadAt(got, 0)
+	if n != len(want) || err != io.EOF || !bytes.Equal(got[:n], want) {
+		t.Fatalf("read %d, %v, contents equal %v", n, err, bytes.Equal(got[:n], want))
+	}
+}
+
+func TestFull(t *testing.T) {
+	d := newMemDevice(32 * BlockSize)
+	if err := Format(d, d.size()); err != nil {
+		t.Fatal(err)
+	}
+	fs := mustMount(t, d)
+	f, err := fs.Root().Create("f", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := bytes.Repeat([]byte{1}, BlockSize)
+	var size int64
+	for {
+		if _, err := f.WriteAt(block, size); err == syscall.ENOSPC {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		size += BlockSize
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// Overwriting committed blocks needs free blocks, released blocks
+	// are reused after a commit.
+	if _, err := f.WriteAt(block, 0); err != syscall.ENOSPC {
+		t.Fatalf("overwrite of full file system: got %v, want ENOSPC", err)
+	}
+	size -= 2 * BlockSize
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		for off := int64(0); off < size; off += BlockSize {
+			if _, err := f.WriteAt(block, off); err != nil {
+				t.Fatalf("overwrite %d at %d: %v", i, off, err)
+			}
+		}
+	}
+	if err := fs.Root().Remove("f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// Left in use: the two superblocks and one block of metadata.
+	if total, free := fs.Blocks(); free != total-3 {
+		t.Fatalf("%d of %d blocks free after remove", free, total)
+	}
+}
+
+// TestCrash checks that after a crash at any write, the file system mounts
+// and holds the state of the last commit.
+func TestCrash(t *testing.T) {
+	steps := []func(fs *FS) error{
+		func(fs *FS) error {
+			_, err := fs.Root().Create("a", ModeDir|0755)
+			return err
+		},
+		func(fs *FS) error {
+			a, _ := fs.Root().Lookup("a")
+			f, err := a.Create("f", 0644)
+			if err != nil {
+				return err
+			}
+			_, err = f.WriteAt(bytes.Repeat([]byte("abc"), 5000), 0)
+			return err
+		},
+		func(fs *FS) error {
+			a, _ := fs.Root().Lookup("a")
+			f, _ := a.Lookup("f")
+			_, err := f.WriteAt([]byte("overwritten"), 100)
+			return err
+		},
+		func(fs *FS) error {
+			a, _ := fs.Root().Lookup("a")
+			return a.Rename("f", fs.Root(), "g")
+		},
+		func(fs *FS) error {
+			g, _ := fs.Root().Lookup("g")
+			return g.Truncate(5)
+		},
+		func(fs *FS) error {
+			return fs.Root().Remove("a")
+		},
+	}
+
+	// Run once without crashing, for the states and number of writes.
+	d := newMemDevice(64 * BlockSize)
+	if err := Format(d, d.size()); err != nil {
+		t.Fatal(err)
+	}
+	formatWrites := d.writes
+	states := map[uint64]string{}
+	fs := mustMount(t, d)
+	states[fs.Generation()] = dump(t, fs)
+	for _, step := range steps {
+		if err := step(fs); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		states[fs.Generation()] = dump(t, fs)
+	}
+
+	for limit := formatWrites; limit <= d.writes; limit++ {
+		d := newMemDevice(64 * BlockSize)
+		d.limit = limit
+		if err := Format(d, d.size()); err != nil {
+			t.Fatal(err)
+		}
+		fs := mustMount(t, d)
+		for _, step := range steps {
+			if err := step(fs); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		fs = mustMount(t, d)
+		want, ok := states[fs.Generation()]
+		if !ok {
+			t.Fatalf("crash after %d writes: unknown generation %d", limit, fs.Generation())
+		}
+		if got := dump(t, fs); got != want {
+			t.Fatalf("crash after %d writes, generation %d:\n%s\nwant:\n%s", limit, fs.Generation(), got, want)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	d := newMemDevice(64 * BlockSize)
+	if _, err := Mount(d, d.size()); err != ErrCorrupt {
+		t.Fatalf("mount of empty device: got %v, want ErrCorrupt", err)
+	}
+	if err := Format(d, d.size()); err != nil {
+		t.Fatal(err)
+	}
+	fs := mustMount(t, d)
+	// Damage the metadata of the only commit. The superblock of generation
+	// gen is in block gen%2, the first block of metadata at offset 32.
+	sb := d.data[fs.Generation()%2*BlockSize:]
+	meta := binary.LittleEndian.Uint64(sb[32:])
+	d.data[meta*BlockSize+20] ^= 1
+	if _, err := Mount(d, d.size()); err != ErrCorrupt {
+		t.Fatalf("mount with damaged metadata: got %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package solo5lease keeps the DHCP leases of the network devices of a
+// solo5hvt guest. The network stack records them with Set, package
+// syscall/solo5 reports them with LookupLease.
+package solo5lease
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease is syscall/solo5.Lease.
+type Lease struct {
+	Addr    [4]byte
+	Mask    [4]byte
+	Router  [4]byte
+	DNS     [][4]byte
+	Domain  string
+	Server  [4]byte
+	Start   time.Time
+	Expires time.Time
+}
+
+var leases struct {
+	sync.Mutex
+	m map[string]Lease
+}
+
+// Set records l as the current lease of the device with name, nil if the
+// device has no lease.
+func Set(name string, l *Lease) {
+	leases.Lock()
+	defer leases.Unlock()
+	if l == nil {
+		delete(leases.m, name)
+		return
+	}
+	if leases.m == nil {
+		leases.m = map[string]Lease{}
+	}
+	lc := *l
+	lc.DNS = append([][4]byte(nil), l.DNS...)
+	leases.m[name] = lc
+}
+
+// Lookup returns the current lease of the device with name.
+func Lookup(name string) (Lease, bool) {
+	leases.Lock()
+	defer leases.Unlock()
+	l, ok := leases.m[name]
+	l.DNS = append([][4]byte(nil), l.DNS...)
+	return l, ok
+}
@@ -0,0 +1,31 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package solo5lease_test
+
+import (
+	. "internal/solo5lease"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	dns := [][4]byte{{10, 0, 0, 1}}
+	Set("net0", &Lease{Addr: [4]byte{10, 0, 0, 2}, DNS: dns})
+	dns[0][3] = 2
+	l, ok := Lookup("net0")
+	if !ok || l.Addr != [4]byte{10, 0, 0, 2} || len(l.DNS) != 1 || l.DNS[0] != [4]byte{10, 0, 0, 1} {
+		t.Fatalf("lookup got %v %v, want copy of lease", l, ok)
+	}
+	l.DNS[0][3] = 3
+	if l, _ := Lookup("net0"); l.DNS[0][3] != 1 {
+		t.Fatalf("lookup returned the recorded name servers")
+	}
+	if _, ok := Lookup("net1"); ok {
+		t.Fatalf("lookup of other device found lease")
+	}
+	Set("net0", nil)
+	if _, ok := Lookup("net0"); ok {
+		t.Fatalf("lookup found cleared lease")
+	}
+}
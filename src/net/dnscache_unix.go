@@ -0,0 +1,170 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris solo5hvt
+
+// DNS response cache, see RFC 2308 for negative caching.
+
+package net
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsCacheEnabled enables caching of DNS responses. It is only enabled by
+// default on solo5hvt: other systems usually have a caching resolver nearby,
+// a guest makes a full round trip to the name server for every lookup.
+var dnsCacheEnabled = runtime.GOOS == "solo5hvt"
+
+const (
+	dnsCacheSize   = 256            // maximum number of cached responses
+	dnsCacheMaxTTL = 24 * time.Hour // upper limit for the time a response is cached
+)
+
+type dnsCacheKey struct {
+	server string
+	name   string
+	qtype  dnsmessage.Type
+	class  dnsmessage.Class
+}
+
+type dnsCacheEntry struct {
+	p       dnsmessage.Parser // positioned at the answer section
+	h       dnsmessage.Header
+	expires time.Time
+}
+
+// A dnsCache holds the responses to questions sent to a server, until their
+// TTL expires.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[dnsCacheKey]dnsCacheEntry
+}
+
+var dnsResponses dnsCache
+
+func newDNSCacheKey(server string, q dnsmessage.Question) dnsCacheKey {
+	return dnsCacheKey{server, q.Name.String(), q.Type, q.Class}
+}
+
+// get returns the cached response to q from server, if any.
+func (c *dnsCache) get(server string, q dnsmessage.Question) (dnsmessage.Parser, dnsmessage.Header, bool) {
+	if !dnsCacheEnabled {
+		return dnsmessage.Parser{}, dnsmessage.Header{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := newDNSCacheKey(server, q)
+	e, ok := c.entries[k]
+	if !ok {
+		return dnsmessage.Parser{}, dnsmessage.Header{}, false
+	}
+	if !time.Now().Before(e.expires) {
+		delete(c.entries, k)
+		return dnsmessage.Parser{}, dnsmessage.Header{}, false
+	}
+	return e.p, e.h, true
+}
+
+// put adds response p with header h to the question q from server. Parser p
+// must be positioned at the answer section. Responses without a TTL are not
+// cached.
+func (c *dnsCache) put(server string, q dnsmessage.Question, p dnsmessage.Parser, h dnsmessage.Header) {
+	if !dnsCacheEnabled {
+		return
+	}
+	ttl, ok := dnsResponseTTL(p, h)
+	if !ok || ttl <= 0 {
+		return
+	}
+	if ttl > dnsCacheMaxTTL {
+		ttl = dnsCacheMaxTTL
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[dnsCacheKey]dnsCacheEntry{}
+	}
+	if len(c.entries) >= dnsCacheSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= dnsCacheSize {
+		// Make room by dropping an arbitrary entry.
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[newDNSCacheKey(server, q)] = dnsCacheEntry{p, h, now.Add(ttl)}
+}
+
+// clear removes all cached responses.
+func (c *dnsCache) clear() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// dnsResponseTTL returns how long the response can be cached: the lowest TTL
+// of the answers, or for a name error or a response without answers, the
+// TTL of the SOA record in the authority section, limited by its minimum
+// field. Other responses are not cached.
+func dnsResponseTTL(p dnsmessage.Parser, h dnsmessage.Header) (time.Duration, bool) {
+	if h.RCode != dnsmessage.RCodeSuccess && h.RCode != dnsmessage.RCodeNameError {
+		return 0, false
+	}
+	var ttl uint32
+	n := 0
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return 0, false
+		}
+		if n == 0 || rh.TTL < ttl {
+			ttl = rh.TTL
+		}
+		n++
+		if err := p.SkipAnswer(); err != nil {
+			return 0, false
+		}
+	}
+	if h.RCode == dnsmessage.RCodeSuccess && n > 0 {
+		return time.Duration(ttl) * time.Second, true
+	}
+
+	for {
+		rh, err := p.AuthorityHeader()
+		if err != nil {
+			return 0, false
+		}
+		if rh.Type != dnsmessage.TypeSOA {
+			if err := p.SkipAuthority(); err != nil {
+				return 0, false
+			}
+			continue
+		}
+		soa, err := p.SOAResource()
+		if err != nil {
+			return 0, false
+		}
+		ttl = rh.TTL
+		if soa.MinTTL < ttl {
+			ttl = soa.MinTTL
+		}
+		return time.Duration(ttl) * time.Second, true
+	}
+}
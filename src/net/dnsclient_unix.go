@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris solo5hvt
 
 // DNS client: see RFC 1035.
 // Has to be linked into package net for Dial.
@@ -139,6 +139,9 @@ func dnsStreamRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte)
 // exchange sends a query on the connection and hopes for a response.
 func (r *Resolver) exchange(ctx context.Context, server string, q dnsmessage.Question, timeout time.Duration, useTCP bool) (dnsmessage.Parser, dnsmessage.Header, error) {
 	q.Class = dnsmessage.ClassINET
+	if p, h, ok := dnsResponses.get(server, q); ok {
+		return p, h, nil
+	}
 	id, udpReq, tcpReq, err := newRequest(q)
 	if err != nil {
 		return dnsmessage.Parser{}, dnsmessage.Header{}, errCannotMarshalDNSMessage
@@ -177,6 +180,7 @@ func (r *Resolver) exchange(ctx context.Context, server string, q dnsmessage.Que
 		if h.Truncated { // see RFC 5966
 			continue
 		}
+		dnsResponses.put(server, q, p, h)
 		return p, h, nil
 	}
 	return dnsmessage.Parser{}, dnsmessage.Header{}, errNoAnswerFromDNSServer
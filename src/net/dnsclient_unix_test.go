@@ -1753,3 +1753,94 @@ func TestDNSUseTCP(t *testing.T) {
 		t.Fatal("exchange failed:", err)
 	}
 }
+
+func TestDNSCache(t *testing.T) {
+	defer func(enabled bool) {
+		dnsCacheEnabled = enabled
+		dnsResponses.clear()
+	}(dnsCacheEnabled)
+	dnsCacheEnabled = true
+	dnsResponses.clear()
+
+	var mu sync.Mutex
+	queries := map[string]int{}
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		name := q.Questions[0].Name
+		mu.Lock()
+		queries[name.String()]++
+		mu.Unlock()
+		r := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 q.ID,
+				Response:           true,
+				RecursionAvailable: true,
+			},
+			Questions: q.Questions,
+		}
+		switch name.String() {
+		case "cached.golang.org.", "expired.golang.org.", "uncached.golang.org.":
+			ttl := uint32(60)
+			if name.String() == "uncached.golang.org." {
+				ttl = 0
+			}
+			r.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.AResource{A: TestAddr},
+			}}
+		case "missing.golang.org.":
+			r.RCode = dnsmessage.RCodeNameError
+			r.Authorities = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("golang.org."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 3600},
+				Body: &dnsmessage.SOAResource{
+					NS:     dnsmessage.MustNewName("ns.golang.org."),
+					MBox:   dnsmessage.MustNewName("hostmaster.golang.org."),
+					MinTTL: 30,
+				},
+			}}
+		default:
+			r.RCode = dnsmessage.RCodeNameError // without SOA
+		}
+		return r, nil
+	}}
+	r := Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	tests := []struct {
+		name    string
+		rcode   dnsmessage.RCode
+		queries int
+	}{
+		{"cached.golang.org.", dnsmessage.RCodeSuccess, 1},
+		{"expired.golang.org.", dnsmessage.RCodeSuccess, 2},
+		{"uncached.golang.org.", dnsmessage.RCodeSuccess, 2},
+		{"missing.golang.org.", dnsmessage.RCodeNameError, 1},
+		{"nosoa.golang.org.", dnsmessage.RCodeNameError, 2},
+	}
+	for _, tt := range tests {
+		q := mustQuestion(tt.name, dnsmessage.TypeA, dnsmessage.ClassINET)
+		for i := 0; i < 2; i++ {
+			p, h, err := r.exchange(context.Background(), "192.0.2.1:53", q, time.Second, useUDPOrTCP)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if h.RCode != tt.rcode {
+				t.Errorf("%s: got %v; want %v", tt.name, h.RCode, tt.rcode)
+			}
+			if tt.rcode == dnsmessage.RCodeSuccess {
+				if err := skipToAnswer(&p, dnsmessage.TypeA); err != nil {
+					t.Errorf("%s: %v", tt.name, err)
+				}
+			}
+			if tt.name == "expired.golang.org." {
+				dnsResponses.mu.Lock()
+				for k, e := range dnsResponses.entries {
+					e.expires = time.Now()
+					dnsResponses.entries[k] = e
+				}
+				dnsResponses.mu.Unlock()
+			}
+		}
+		if n := queries[tt.name]; n != tt.queries {
+			t.Errorf("%s: got %d queries; want %d", tt.name, n, tt.queries)
+		}
+	}
+}
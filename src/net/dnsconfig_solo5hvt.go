@@ -0,0 +1,72 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Resolver configuration for solo5hvt. A guest normally has no
+// /etc/resolv.conf. The name servers and search domains come from the boot
+// environment, or from DHCP and IPv6 router advertisements.
+
+package net
+
+import (
+	"internal/netstack"
+	"syscall"
+	"time"
+)
+
+func init() {
+	dnsSystemConfig = solo5DNSConfig
+}
+
+// solo5DNSConfig fills in conf from the environment variables SOLO5_DNS, a
+// comma-separated list of name server IP addresses, SOLO5_DNS_SEARCH, a
+// comma-separated list of search domains, and SOLO5_DNS_OPTIONS, a
+// space-separated list of options as in resolv.conf. Name servers and search
+// domains not set in the environment are taken from the network stack, as
+// learned with DHCP or router advertisements.
+func solo5DNSConfig(conf *dnsConfig) {
+	// The configuration of the network stack can change, with DHCP
+	// lease renewals and router advertisements. A new mtime makes the
+	// resolver read the configuration again, at most every 5 seconds.
+	conf.mtime = time.Now()
+
+	var servers []netstack.IP
+	var search []string
+	if s, err := netstack.Default(); err == nil {
+		servers, search = s.DNS()
+	}
+
+	if v, ok := syscall.Getenv("SOLO5_DNS"); ok {
+		for _, f := range splitAtBytes(v, ",") {
+			if ip, _ := parseIPZone(f); ip != nil {
+				conf.servers = append(conf.servers, JoinHostPort(f, "53"))
+			}
+		}
+	} else {
+		for _, ip := range servers {
+			conf.servers = append(conf.servers, JoinHostPort(IP(ip[:]).String(), "53"))
+		}
+	}
+	if len(conf.servers) > 3 {
+		conf.servers = conf.servers[:3] // as with resolv.conf
+	}
+	if len(conf.servers) == 0 {
+		conf.servers = defaultNS
+	}
+
+	if v, ok := syscall.Getenv("SOLO5_DNS_SEARCH"); ok {
+		search = splitAtBytes(v, ",")
+	}
+	for _, d := range search {
+		conf.search = append(conf.search, ensureRooted(d))
+	}
+	if len(conf.search) == 0 {
+		conf.search = dnsDefaultSearch()
+	}
+
+	if v, ok := syscall.Getenv("SOLO5_DNS_OPTIONS"); ok {
+		for _, s := range getFields(v) {
+			conf.setOption(s)
+		}
+	}
+}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris solo5hvt
 
 // Read system DNS config from /etc/resolv.conf
 
@@ -18,6 +18,11 @@ import (
 var (
 	defaultNS   = []string{"127.0.0.1:53", "[::1]:53"}
 	getHostname = os.Hostname // variable for testing
+
+	// dnsSystemConfig, if set, fills in conf when there is no
+	// resolv.conf file, on systems that have another source of
+	// configuration.
+	dnsSystemConfig func(conf *dnsConfig)
 )
 
 type dnsConfig struct {
@@ -44,6 +49,11 @@ func dnsReadConfig(filename string) *dnsConfig {
 		attempts: 2,
 	}
 	file, err := open(filename)
+	if err != nil && dnsSystemConfig != nil {
+		// Without resolv.conf, use the configuration of the system.
+		dnsSystemConfig(conf)
+		return conf
+	}
 	if err != nil {
 		conf.servers = defaultNS
 		conf.search = dnsDefaultSearch()
@@ -94,47 +104,7 @@ func dnsReadConfig(filename string) *dnsConfig {
 
 		case "options": // magic options
 			for _, s := range f[1:] {
-				switch {
-				case hasPrefix(s, "ndots:"):
-					n, _, _ := dtoi(s[6:])
-					if n < 0 {
-						n = 0
-					} else if n > 15 {
-						n = 15
-					}
-					conf.ndots = n
-				case hasPrefix(s, "timeout:"):
-					n, _, _ := dtoi(s[8:])
-					if n < 1 {
-						n = 1
-					}
-					conf.timeout = time.Duration(n) * time.Second
-				case hasPrefix(s, "attempts:"):
-					n, _, _ := dtoi(s[9:])
-					if n < 1 {
-						n = 1
-					}
-					conf.attempts = n
-				case s == "rotate":
-					conf.rotate = true
-				case s == "single-request" || s == "single-request-reopen":
-					// Linux option:
-					// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
-					// "By default, glibc performs IPv4 and IPv6 lookups in parallel [...]
-					//  This option disables the behavior and makes glibc
-					//  perform the IPv6 and IPv4 requests sequentially."
-					conf.singleRequest = true
-				case s == "use-vc" || s == "usevc" || s == "tcp":
-					// Linux (use-vc), FreeBSD (usevc) and OpenBSD (tcp) option:
-					// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
-					// "Sets RES_USEVC in _res.options.
-					//  This option forces the use of TCP for DNS resolutions."
-					// https://www.freebsd.org/cgi/man.cgi?query=resolv.conf&sektion=5&manpath=freebsd-release-ports
-					// https://man.openbsd.org/resolv.conf.5
-					conf.useTCP = true
-				default:
-					conf.unknownOpt = true
-				}
+				conf.setOption(s)
 			}
 
 		case "lookup":
@@ -156,6 +126,51 @@ func dnsReadConfig(filename string) *dnsConfig {
 	return conf
 }
 
+// setOption sets resolv.conf option s.
+func (conf *dnsConfig) setOption(s string) {
+	switch {
+	case hasPrefix(s, "ndots:"):
+		n, _, _ := dtoi(s[6:])
+		if n < 0 {
+			n = 0
+		} else if n > 15 {
+			n = 15
+		}
+		conf.ndots = n
+	case hasPrefix(s, "timeout:"):
+		n, _, _ := dtoi(s[8:])
+		if n < 1 {
+			n = 1
+		}
+		conf.timeout = time.Duration(n) * time.Second
+	case hasPrefix(s, "attempts:"):
+		n, _, _ := dtoi(s[9:])
+		if n < 1 {
+			n = 1
+		}
+		conf.attempts = n
+	case s == "rotate":
+		conf.rotate = true
+	case s == "single-request" || s == "single-request-reopen":
+		// Linux option:
+		// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
+		// "By default, glibc performs IPv4 and IPv6 lookups in parallel [...]
+		//  This option disables the behavior and makes glibc
+		//  perform the IPv6 and IPv4 requests sequentially."
+		conf.singleRequest = true
+	case s == "use-vc" || s == "usevc" || s == "tcp":
+		// Linux (use-vc), FreeBSD (usevc) and OpenBSD (tcp) option:
+		// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
+		// "Sets RES_USEVC in _res.options.
+		//  This option forces the use of TCP for DNS resolutions."
+		// https://www.freebsd.org/cgi/man.cgi?query=resolv.conf&sektion=5&manpath=freebsd-release-ports
+		// https://man.openbsd.org/resolv.conf.5
+		conf.useTCP = true
+	default:
+		conf.unknownOpt = true
+	}
+}
+
 // serverOffset returns an offset that can be used to determine
 // indices of servers in c.servers when making queries.
 // When the rotate option is enabled, this offset increases.
@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package net
+
+// The interface tables of solo5hvt, see interface_solo5hvt.go. Also built
+// on linux, so that they are tested on the host.
+
+// A netstackLink is an interface of the netstack stack, or a network
+// device of the solo5 manifest that the stack does not use.
+type netstackLink struct {
+	index   int // In the stack, 0 for a device the stack does not use.
+	name    string
+	mtu     int
+	mac     HardwareAddr // Nil for the loopback interface.
+	inStack bool
+	addrs   []*IPNet
+}
+
+// netstackInterfaceTable returns the interfaces of links, as
+// interfaceTable. The devices the stack does not use are down, and numbered
+// after the interfaces of the stack.
+func netstackInterfaceTable(links []netstackLink, ifindex int) ([]Interface, error) {
+	var ift []Interface
+	for _, l := range links {
+		if !l.inStack {
+			continue
+		}
+		fi := Interface{Index: l.index, MTU: l.mtu, Name: l.name, Flags: FlagUp}
+		if l.mac == nil {
+			fi.Flags |= FlagLoopback
+		} else {
+			fi.HardwareAddr = append(HardwareAddr(nil), l.mac...)
+			fi.Flags |= FlagBroadcast | FlagMulticast
+		}
+		ift = append(ift, fi)
+	}
+	for _, l := range links {
+		if l.inStack {
+			continue
+		}
+		ift = append(ift, Interface{
+			Index:        len(ift) + 1,
+			MTU:          l.mtu,
+			Name:         l.name,
+			HardwareAddr: append(HardwareAddr(nil), l.mac...),
+			Flags:        FlagBroadcast,
+		})
+	}
+	if ifindex == 0 {
+		return ift, nil
+	}
+	for _, fi := range ift {
+		if fi.Index == ifindex {
+			return []Interface{fi}, nil
+		}
+	}
+	return nil, errNoSuchInterface
+}
+
+// netstackInterfaceAddrTable returns the addresses of links, as
+// interfaceAddrTable.
+func netstackInterfaceAddrTable(links []netstackLink, ifi *Interface) []Addr {
+	var ifat []Addr
+	for _, l := range links {
+		if ifi != nil && ifi.Name != l.name {
+			continue
+		}
+		for _, a := range l.addrs {
+			ifat = append(ifat, a)
+		}
+	}
+	return ifat
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package net
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetstackInterfaceTable(t *testing.T) {
+	mac0 := HardwareAddr{2, 0, 0, 0, 0, 1}
+	mac1 := HardwareAddr{2, 0, 0, 0, 0, 2}
+	links := []netstackLink{
+		{index: 1, name: "lo", mtu: 65536, inStack: true, addrs: []*IPNet{
+			{IP: IPv4(127, 0, 0, 1).To4(), Mask: CIDRMask(8, 32)},
+			{IP: IPv6loopback, Mask: CIDRMask(128, 128)},
+		}},
+		{index: 2, name: "net0", mtu: 1500, mac: mac0, inStack: true, addrs: []*IPNet{
+			{IP: IPv4(10, 0, 0, 2).To4(), Mask: CIDRMask(24, 32)},
+		}},
+		{name: "capture", mtu: 1500, mac: mac1},
+	}
+	lo := Interface{Index: 1, MTU: 65536, Name: "lo", Flags: FlagUp | FlagLoopback}
+	net0 := Interface{Index: 2, MTU: 1500, Name: "net0", HardwareAddr: mac0, Flags: FlagUp | FlagBroadcast | FlagMulticast}
+	capture := Interface{Index: 3, MTU: 1500, Name: "capture", HardwareAddr: mac1, Flags: FlagBroadcast}
+
+	tests := []struct {
+		ifindex int
+		ift     []Interface
+		err     error
+	}{
+		{0, []Interface{lo, net0, capture}, nil},
+		{1, []Interface{lo}, nil},
+		{2, []Interface{net0}, nil},
+		{3, []Interface{capture}, nil},
+		{4, nil, errNoSuchInterface},
+	}
+	for _, tt := range tests {
+		ift, err := netstackInterfaceTable(links, tt.ifindex)
+		if !reflect.DeepEqual(ift, tt.ift) || err != tt.err {
+			t.Errorf("index %d: got %v, %v, want %v, %v", tt.ifindex, ift, err, tt.ift, tt.err)
+		}
+	}
+
+	ift, _ := netstackInterfaceTable(links, 2)
+	ift[0].HardwareAddr[0] = 0xff
+	if links[1].mac[0] != 2 {
+		t.Errorf("interface shares its hardware address with the stack")
+	}
+
+	addrs := []struct {
+		ifi   *Interface
+		addrs []Addr
+	}{
+		{nil, []Addr{links[0].addrs[0], links[0].addrs[1], links[1].addrs[0]}},
+		{&lo, []Addr{links[0].addrs[0], links[0].addrs[1]}},
+		{&net0, []Addr{links[1].addrs[0]}},
+		{&capture, nil},
+	}
+	for _, tt := range addrs {
+		ifat := netstackInterfaceAddrTable(links, tt.ifi)
+		if !reflect.DeepEqual(ifat, tt.addrs) {
+			t.Errorf("%v: got addrs %v, want %v", tt.ifi, ifat, tt.addrs)
+		}
+	}
+}
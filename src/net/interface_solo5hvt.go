@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/netstack"
+	"syscall"
+)
+
+// The interfaces are those of the netstack stack: the loopback interface
+// and the network devices of the solo5 manifest, with their configured
+// addresses. Network devices the stack does not use, because they are not
+// attached or were opened with package syscall/solo5, are listed after them
+// and are down. The tables are made in interface_netstack.go.
+
+// netstackLinks returns the interfaces of the stack, followed by the
+// network devices it does not use.
+func netstackLinks() ([]netstackLink, error) {
+	s, err := netstack.Default()
+	if err != nil {
+		return nil, err
+	}
+	var links []netstackLink
+	inStack := map[string]bool{}
+	for _, ifi := range s.Interfaces() {
+		inStack[ifi.Name] = true
+		l := netstackLink{index: ifi.Index, name: ifi.Name, mtu: ifi.MTU, inStack: true}
+		if !ifi.Loopback() {
+			l.mac = HardwareAddr(ifi.MAC[:])
+		}
+		for _, p := range ifi.Addrs() {
+			bits := 8 * IPv6len
+			if p.IP.Is4() {
+				bits = 8 * IPv4len
+			}
+			l.addrs = append(l.addrs, &IPNet{IP: ipFrom(p.IP), Mask: CIDRMask(p.Len, bits)})
+		}
+		links = append(links, l)
+	}
+	for _, d := range syscall.Devices() {
+		if d.Type != syscall.DevNetBasic || inStack[d.Name] {
+			continue
+		}
+		mac := d.MAC
+		links = append(links, netstackLink{name: d.Name, mtu: d.MTU, mac: HardwareAddr(mac[:])})
+	}
+	return links, nil
+}
+
+// If the ifindex is zero, interfaceTable returns mappings of all
+// network interfaces. Otherwise it returns a mapping of a specific
+// interface.
+func interfaceTable(ifindex int) ([]Interface, error) {
+	links, err := netstackLinks()
+	if err != nil {
+		return nil, err
+	}
+	return netstackInterfaceTable(links, ifindex)
+}
+
+// If the ifi is nil, interfaceAddrTable returns addresses for all
+// network interfaces. Otherwise it returns addresses for a specific
+// interface.
+func interfaceAddrTable(ifi *Interface) ([]Addr, error) {
+	links, err := netstackLinks()
+	if err != nil {
+		return nil, err
+	}
+	return netstackInterfaceAddrTable(links, ifi), nil
+}
+
+// interfaceMulticastAddrTable returns addresses for a specific
+// interface. The stack only receives IPv6 multicast for the all-nodes and
+// solicited-node addresses, the latter are not listed.
+func interfaceMulticastAddrTable(ifi *Interface) ([]Addr, error) {
+	if ifi.Flags&FlagMulticast == 0 {
+		return nil, nil
+	}
+	return []Addr{&IPAddr{IP: IPv6linklocalallnodes}}, nil
+}
@@ -148,6 +148,9 @@ func (fd *netFD) accept() (*netFD, error) {
 }
 
 func (fd *netFD) SetDeadline(t time.Time) error {
+	if fd.listener {
+		return fd.pfd.SetDeadline(t)
+	}
 	fd.r.SetReadDeadline(t)
 	fd.w.SetWriteDeadline(t)
 	return nil
@@ -0,0 +1,360 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Networking for solo5hvt, using the TCP/IP stack of package
+// internal/netstack on the network devices of the solo5 manifest.
+
+package net
+
+import (
+	"context"
+	"internal/netstack"
+	"internal/poll"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Network file descriptor.
+type netFD struct {
+	// One of the netstack endpoints is set.
+	tcp         *netstack.TCPConn
+	tcpListener *netstack.TCPListener
+	udp         *netstack.UDPConn
+
+	// immutable until Close
+	family      int
+	sotype      int
+	isConnected bool // handshake completed or use of association with peer
+	net         string
+	laddr       Addr
+	raddr       Addr
+
+	// for RawConn only, there is no file descriptor
+	pfd poll.FD
+}
+
+// The netstack endpoints bound to the unspecified address are for IPv4 and
+// IPv6, as with IPV6_V6ONLY=0 on Linux. There are no sockets to probe.
+func init() {
+	ipStackCaps.Once.Do(func() {
+		ipStackCaps.ipv4Enabled = true
+		ipStackCaps.ipv6Enabled = true
+		ipStackCaps.ipv4MappedIPv6Enabled = true
+	})
+}
+
+// socket returns a network file descriptor for a netstack endpoint.
+func socket(ctx context.Context, net string, family, sotype, proto int, ipv6only bool, laddr, raddr sockaddr, ctrlFn func(string, string, syscall.RawConn) error) (*netFD, error) {
+	s, err := netstack.Default()
+	if err != nil {
+		return nil, err
+	}
+	if family != syscall.AF_INET && family != syscall.AF_INET6 {
+		return nil, syscall.EAFNOSUPPORT
+	}
+	laddr, raddr = nilSockaddr(laddr), nilSockaddr(raddr)
+	fd := &netFD{family: family, sotype: sotype, net: net}
+	fd.pfd.Sysfd = -1
+	if ctrlFn != nil {
+		var addr string
+		if raddr != nil {
+			addr = raddr.String()
+		} else if laddr != nil {
+			addr = laddr.String()
+		}
+		c, err := newRawConn(fd)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctrlFn(net, addr, c); err != nil {
+			return nil, err
+		}
+	}
+
+	switch sotype {
+	case syscall.SOCK_STREAM:
+		var la, ra netstack.Addr
+		if laddr != nil {
+			if la, err = netstackAddr(laddr.(*TCPAddr).IP, laddr.(*TCPAddr).Port); err != nil {
+				return nil, err
+			}
+		}
+		la = familyAddr(family, la)
+		if raddr == nil {
+			fd.tcpListener, err = s.ListenTCP(la, listenerBacklog(), ipv6only)
+			if err != nil {
+				return nil, err
+			}
+			fd.laddr = tcpAddrFrom(fd.tcpListener.Addr())
+			return fd, nil
+		}
+		if ra, err = netstackAddr(raddr.(*TCPAddr).IP, raddr.(*TCPAddr).Port); err != nil {
+			return nil, err
+		}
+		fd.tcp, err = s.DialTCP(ctx, la, ra)
+		if err != nil {
+			return nil, err
+		}
+		fd.isConnected = true
+		fd.laddr = tcpAddrFrom(fd.tcp.LocalAddr())
+		fd.raddr = tcpAddrFrom(fd.tcp.RemoteAddr())
+		return fd, nil
+
+	case syscall.SOCK_DGRAM:
+		var la, ra netstack.Addr
+		if laddr != nil {
+			if la, err = netstackAddr(laddr.(*UDPAddr).IP, laddr.(*UDPAddr).Port); err != nil {
+				return nil, err
+			}
+		}
+		la = familyAddr(family, la)
+		if raddr != nil {
+			if ra, err = netstackAddr(raddr.(*UDPAddr).IP, raddr.(*UDPAddr).Port); err != nil {
+				return nil, err
+			}
+			if ra.IP == (netstack.IP{}) {
+				ra.IP = netstack.IPv4(0, 0, 0, 0)
+			}
+		}
+		fd.udp, err = s.ListenUDP(la, ra, ipv6only)
+		if err != nil {
+			return nil, err
+		}
+		fd.laddr = udpAddrFrom(fd.udp.LocalAddr())
+		if raddr != nil {
+			fd.isConnected = true
+			fd.raddr = udpAddrFrom(fd.udp.RemoteAddr())
+		}
+		return fd, nil
+	}
+	return nil, syscall.EPROTONOSUPPORT
+}
+
+// nilSockaddr returns nil for a nil *TCPAddr or *UDPAddr, which the dialers
+// pass when there is no local address.
+func nilSockaddr(a sockaddr) sockaddr {
+	switch a := a.(type) {
+	case *TCPAddr:
+		if a == nil {
+			return nil
+		}
+	case *UDPAddr:
+		if a == nil {
+			return nil
+		}
+	}
+	return a
+}
+
+// netstackAddr returns the netstack address for ip and port. A nil ip or
+// an unspecified IPv6 address is returned as the zero IP.
+func netstackAddr(ip IP, port int) (netstack.Addr, error) {
+	a := netstack.Addr{Port: port}
+	if len(ip) == 0 || ip.Equal(IPv6unspecified) {
+		return a, nil
+	}
+	var ok bool
+	if a.IP, ok = netstack.IPFromSlice(ip); !ok {
+		return a, syscall.EAFNOSUPPORT
+	}
+	return a, nil
+}
+
+// familyAddr returns the local address a for a socket of family. The
+// wildcard address of an AF_INET socket is 0.0.0.0, for IPv4 only, that of
+// an AF_INET6 socket is "::", as in ipToSockaddr.
+func familyAddr(family int, a netstack.Addr) netstack.Addr {
+	if a.IP.IsUnspecified() {
+		a.IP = netstack.IP{}
+		if family == syscall.AF_INET {
+			a.IP = netstack.IPv4(0, 0, 0, 0)
+		}
+	}
+	return a
+}
+
+func ipFrom(ip netstack.IP) IP {
+	if ip.Is4() {
+		return IPv4(ip[12], ip[13], ip[14], ip[15]).To4()
+	}
+	return append(IP(nil), ip[:]...)
+}
+
+func tcpAddrFrom(a netstack.Addr) *TCPAddr {
+	return &TCPAddr{IP: ipFrom(a.IP), Port: a.Port}
+}
+
+func udpAddrFrom(a netstack.Addr) *UDPAddr {
+	return &UDPAddr{IP: ipFrom(a.IP), Port: a.Port}
+}
+
+func sockaddrFrom(a netstack.Addr) syscall.Sockaddr {
+	if a.IP.Is4() {
+		sa := &syscall.SockaddrInet4{Port: a.Port}
+		copy(sa.Addr[:], a.IP[12:])
+		return sa
+	}
+	return &syscall.SockaddrInet6{Port: a.Port, Addr: a.IP}
+}
+
+func (fd *netFD) Read(p []byte) (n int, err error) {
+	switch {
+	case fd.tcp != nil:
+		return fd.tcp.Read(p)
+	case fd.udp != nil:
+		n, _, err = fd.udp.ReadFrom(p)
+		return n, err
+	}
+	return 0, syscall.ENOTCONN
+}
+
+func (fd *netFD) Write(p []byte) (nn int, err error) {
+	switch {
+	case fd.tcp != nil:
+		return fd.tcp.Write(p)
+	case fd.udp != nil:
+		return fd.udp.WriteTo(p, netstack.Addr{})
+	}
+	return 0, syscall.ENOTCONN
+}
+
+func (fd *netFD) Close() error {
+	var err error
+	switch {
+	case fd.tcp != nil:
+		err = fd.tcp.Close()
+	case fd.tcpListener != nil:
+		err = fd.tcpListener.Close()
+	case fd.udp != nil:
+		err = fd.udp.Close()
+	}
+	fd.pfd.Close()
+	return err
+}
+
+func (fd *netFD) closeRead() error {
+	if fd.tcp == nil {
+		return syscall.ENOTCONN
+	}
+	return fd.tcp.CloseRead()
+}
+
+func (fd *netFD) closeWrite() error {
+	if fd.tcp == nil {
+		return syscall.ENOTCONN
+	}
+	return fd.tcp.CloseWrite()
+}
+
+func (fd *netFD) accept() (*netFD, error) {
+	if fd.tcpListener == nil {
+		return nil, syscall.EINVAL
+	}
+	c, err := fd.tcpListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	nfd := &netFD{
+		tcp:         c,
+		family:      fd.family,
+		sotype:      fd.sotype,
+		isConnected: true,
+		net:         fd.net,
+		laddr:       tcpAddrFrom(c.LocalAddr()),
+		raddr:       tcpAddrFrom(c.RemoteAddr()),
+	}
+	nfd.pfd.Sysfd = -1
+	return nfd, nil
+}
+
+func (fd *netFD) SetDeadline(t time.Time) error {
+	if fd.tcpListener != nil {
+		return fd.tcpListener.SetDeadline(t)
+	}
+	fd.SetReadDeadline(t)
+	return fd.SetWriteDeadline(t)
+}
+
+func (fd *netFD) SetReadDeadline(t time.Time) error {
+	switch {
+	case fd.tcp != nil:
+		return fd.tcp.SetReadDeadline(t)
+	case fd.tcpListener != nil:
+		return fd.tcpListener.SetDeadline(t)
+	case fd.udp != nil:
+		return fd.udp.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (fd *netFD) SetWriteDeadline(t time.Time) error {
+	switch {
+	case fd.tcp != nil:
+		return fd.tcp.SetWriteDeadline(t)
+	case fd.udp != nil:
+		return fd.udp.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// sysSocket only reports which address families are supported. It is not
+// used, ipStackCaps is set by init.
+func sysSocket(family, sotype, proto int) (int, error) {
+	if family != syscall.AF_INET && family != syscall.AF_INET6 {
+		return -1, syscall.EAFNOSUPPORT
+	}
+	return -1, nil
+}
+
+func (fd *netFD) readFrom(p []byte) (n int, sa syscall.Sockaddr, err error) {
+	if fd.udp == nil {
+		return 0, nil, syscall.EOPNOTSUPP
+	}
+	n, from, err := fd.udp.ReadFrom(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, sockaddrFrom(from), nil
+}
+
+func (fd *netFD) readMsg(p []byte, oob []byte) (n, oobn, flags int, sa syscall.Sockaddr, err error) {
+	n, sa, err = fd.readFrom(p)
+	return n, 0, 0, sa, err
+}
+
+func (fd *netFD) writeTo(p []byte, sa syscall.Sockaddr) (n int, err error) {
+	if fd.udp == nil {
+		return 0, syscall.EOPNOTSUPP
+	}
+	var to netstack.Addr
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		to = netstack.Addr{IP: netstack.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		to = netstack.Addr{IP: sa.Addr, Port: sa.Port}
+	case nil:
+	default:
+		return 0, syscall.EAFNOSUPPORT
+	}
+	return fd.udp.WriteTo(p, to)
+}
+
+func (fd *netFD) writeMsg(p []byte, oob []byte, sa syscall.Sockaddr) (n int, oobn int, err error) {
+	if len(oob) > 0 {
+		return 0, 0, syscall.EOPNOTSUPP
+	}
+	n, err = fd.writeTo(p, sa)
+	return n, 0, err
+}
+
+func (fd *netFD) dup() (f *os.File, err error) {
+	return nil, syscall.ENOSYS
+}
+
+// concurrentThreadsLimit returns the number of threads we permit to
+// run concurrently doing DNS lookups.
+func concurrentThreadsLimit() int {
+	return 500
+}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build aix nacl js,wasm solaris
+// +build aix nacl js,wasm solaris solo5hvt
 
 package net
 
@@ -0,0 +1,118 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os
+
+import (
+	"io"
+	"syscall"
+)
+
+// Reads and writes of the block device files in /dev, see devfs_solo5hvt.go.
+// Devices only read and write whole blocks, so reads and writes at other
+// offsets and lengths go through a buffer of one block. Also built on
+// linux, so that it is tested on the host.
+
+// A blockDevice reads and writes whole blocks.
+type blockDevice interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// blockRange returns the part of b at off that is on a device of capacity
+// bytes, and the offset of the block of bs bytes that contains off.
+func blockRange(bs int, capacity int64, b []byte, off int64) ([]byte, int64) {
+	if max := capacity - off; int64(len(b)) > max {
+		b = b[:max]
+	}
+	return b, off - off%int64(bs)
+}
+
+// blockReadAt reads from dev, with blocks of bs bytes and capacity bytes,
+// at offset off.
+func blockReadAt(dev blockDevice, bs int, capacity int64, b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	if off >= capacity {
+		return 0, io.EOF
+	}
+	b, start := blockRange(bs, capacity, b, off)
+	var buf []byte
+	nr := 0
+	for nr < len(b) {
+		skip := int(off - start)
+		if skip == 0 && len(b)-nr >= bs {
+			// Whole blocks, directly into b.
+			m := (len(b) - nr) / bs * bs
+			if _, err := dev.ReadAt(b[nr:nr+m], start); err != nil {
+				return nr, err
+			}
+			nr += m
+			off += int64(m)
+			start += int64(m)
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, bs)
+		}
+		if _, err := dev.ReadAt(buf, start); err != nil {
+			return nr, err
+		}
+		m := copy(b[nr:], buf[skip:])
+		nr += m
+		off += int64(m)
+		start += int64(bs)
+	}
+	return nr, nil
+}
+
+// blockWriteAt writes to dev, with blocks of bs bytes and capacity bytes,
+// at offset off. Partial blocks are read, changed and written back. Writes
+// past the end of the device fail with ENOSPC.
+func blockWriteAt(dev blockDevice, bs int, capacity int64, b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	if off >= capacity {
+		return 0, syscall.ENOSPC
+	}
+	full := len(b)
+	b, start := blockRange(bs, capacity, b, off)
+	var buf []byte
+	nw := 0
+	for nw < len(b) {
+		skip := int(off - start)
+		if skip == 0 && len(b)-nw >= bs {
+			m := (len(b) - nw) / bs * bs
+			if _, err := dev.WriteAt(b[nw:nw+m], start); err != nil {
+				return nw, err
+			}
+			nw += m
+			off += int64(m)
+			start += int64(m)
+			continue
+		}
+		// A partial block: read, change and write back.
+		if buf == nil {
+			buf = make([]byte, bs)
+		}
+		if _, err := dev.ReadAt(buf, start); err != nil {
+			return nw, err
+		}
+		m := copy(buf[skip:], b[nw:])
+		if _, err := dev.WriteAt(buf, start); err != nil {
+			return nw, err
+		}
+		nw += m
+		off += int64(m)
+		start += int64(bs)
+	}
+	if nw < full {
+		return nw, syscall.ENOSPC
+	}
+	return nw, nil
+}
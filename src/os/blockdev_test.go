@@ -0,0 +1,110 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	. "os"
+	"syscall"
+	"testing"
+)
+
+// Tests of the block device files of solo5hvt, which are also built on
+// linux.
+
+// testBlockDevice is a device that, like a solo5 block device, only reads
+// and writes whole blocks.
+type testBlockDevice struct {
+	data []byte
+	bs   int
+}
+
+var errUnaligned = errors.New("unaligned block I/O")
+
+func (d *testBlockDevice) check(b []byte, off int64) error {
+	if off%int64(d.bs) != 0 || len(b)%d.bs != 0 || len(b) == 0 || off+int64(len(b)) > int64(len(d.data)) {
+		return errUnaligned
+	}
+	return nil
+}
+
+func (d *testBlockDevice) ReadAt(b []byte, off int64) (int, error) {
+	if err := d.check(b, off); err != nil {
+		return 0, err
+	}
+	return copy(b, d.data[off:]), nil
+}
+
+func (d *testBlockDevice) WriteAt(b []byte, off int64) (int, error) {
+	if err := d.check(b, off); err != nil {
+		return 0, err
+	}
+	return copy(d.data[off:], b), nil
+}
+
+func TestBlockReadWrite(t *testing.T) {
+	const bs, capacity = 512, 4 * 512
+	tests := []struct {
+		off int64
+		n   int
+		nr  int
+		err error // Of reads, writes return ENOSPC instead of EOF.
+	}{
+		{0, 0, 0, nil},
+		{0, 512, 512, nil},
+		{0, capacity, capacity, nil},
+		{0, 100, 100, nil},
+		{100, 100, 100, nil},
+		{500, 20, 20, nil},
+		{500, 1100, 1100, nil},
+		{512, 1024, 1024, nil},
+		{1000, 1048, 1048, nil},
+		{1000, 2000, 1048, nil},
+		{capacity - 1, 1, 1, nil},
+		{capacity - 1, 10, 1, nil},
+		{capacity, 10, 0, io.EOF},
+		{capacity + 512, 10, 0, io.EOF},
+		{-1, 10, 0, syscall.EINVAL},
+	}
+	for _, tt := range tests {
+		data := make([]byte, capacity)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		dev := &testBlockDevice{append([]byte(nil), data...), bs}
+
+		b := make([]byte, tt.n)
+		nr, err := BlockReadAt(dev, bs, capacity, b, tt.off)
+		if nr != tt.nr || err != tt.err {
+			t.Errorf("read %d at %d: got %d, %v, want %d, %v", tt.n, tt.off, nr, err, tt.nr, tt.err)
+		} else if nr > 0 && !bytes.Equal(b[:nr], data[tt.off:tt.off+int64(nr)]) {
+			t.Errorf("read %d at %d: wrong data", tt.n, tt.off)
+		}
+
+		for i := range b {
+			b[i] = 0xff
+		}
+		werr := tt.err
+		if werr == io.EOF || werr == nil && tt.nr < tt.n {
+			werr = syscall.ENOSPC
+		}
+		nw, err := BlockWriteAt(dev, bs, capacity, b, tt.off)
+		if nw != tt.nr || err != werr {
+			t.Errorf("write %d at %d: got %d, %v, want %d, %v", tt.n, tt.off, nw, err, tt.nr, werr)
+			continue
+		}
+		want := data
+		if nw > 0 {
+			copy(want[tt.off:], b[:nw])
+		}
+		if !bytes.Equal(dev.data, want) {
+			t.Errorf("write %d at %d: wrong data on device", tt.n, tt.off)
+		}
+	}
+}
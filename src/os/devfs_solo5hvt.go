@@ -0,0 +1,219 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+	"syscall/solo5"
+	"time"
+)
+
+// The block devices of the manifest are files in /dev, named after the
+// device, e.g. /dev/storage. Reads and writes at any offset and of any
+// length go to the block cache of the runtime, partial blocks are read,
+// changed and written back, see blockdev.go. File.Sync writes the changes in the cache to the
+// device. The size of a device file is the capacity of the device. Files
+// cannot be added to or removed from /dev.
+//
+// Reads and writes of a device are serialized, so that the partial blocks
+// of concurrent writes are not lost. They do not wait for I/O on other
+// devices.
+
+type devFS struct {
+	root *devNode
+}
+
+// A devNode is /dev, or a block device in it.
+type devNode struct {
+	fs  *devFS
+	ino uint64
+
+	mu      sync.Mutex // Protects mode and modTime.
+	mode    FileMode
+	modTime time.Time
+
+	entries map[string]*devNode // For /dev.
+
+	iomu sync.Mutex   // Serializes reads and writes of a device.
+	blk  *solo5.Block // For a device.
+	info solo5.BlockInfo
+}
+
+// mountDevFS mounts the block devices on /dev, if there are any.
+func mountDevFS() error {
+	fs := &devFS{}
+	now := time.Now()
+	fs.root = &devNode{fs: fs, ino: 1, mode: ModeDir | 0755, modTime: now, entries: map[string]*devNode{}}
+	for _, d := range solo5.Devices() {
+		if d.Type != solo5.BlockBasic || !d.Attached {
+			continue
+		}
+		blk, err := solo5.OpenBlock(d.Name)
+		if err != nil {
+			return err
+		}
+		fs.root.entries[d.Name] = &devNode{
+			fs:      fs,
+			ino:     uint64(len(fs.root.entries)) + 2,
+			mode:    ModeDevice | 0660,
+			modTime: now,
+			blk:     blk,
+			info:    d.Block,
+		}
+	}
+	if len(fs.root.entries) == 0 {
+		return nil
+	}
+	if err := mkdirMountPoint("/dev"); err != nil {
+		return err
+	}
+	return vfsMount("/dev", fs, fs.root, false)
+}
+
+func (fs *devFS) sync() error {
+	var err error
+	for _, n := range fs.root.entries {
+		if e := n.sync(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (n *devNode) fsys() fileSystem {
+	return n.fs
+}
+
+func (n *devNode) attr() vattr {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	a := vattr{
+		ino:     n.ino,
+		mode:    n.mode,
+		nlink:   1,
+		modTime: n.modTime,
+	}
+	if n.blk != nil {
+		a.size = n.info.Capacity
+	} else {
+		a.nlink = 2
+	}
+	return a
+}
+
+func (n *devNode) chmod(mode FileMode) error {
+	const bits = ModePerm | ModeSetuid | ModeSetgid | ModeSticky
+	n.mu.Lock()
+	n.mode = n.mode&^bits | mode&bits
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *devNode) chtimes(mtime time.Time) error {
+	n.mu.Lock()
+	n.modTime = mtime
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *devNode) lookup(name string) (vnode, error) {
+	switch name {
+	case ".", "..":
+		return n, nil
+	}
+	c, ok := n.entries[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return c, nil
+}
+
+func (n *devNode) names() ([]string, error) {
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// exists returns EEXIST if name exists, and EPERM otherwise, the error for
+// creating name.
+func (n *devNode) exists(name string) error {
+	if _, ok := n.entries[name]; ok {
+		return syscall.EEXIST
+	}
+	return syscall.EPERM
+}
+
+func (n *devNode) create(name string, mode FileMode) (vnode, error) {
+	return nil, n.exists(name)
+}
+
+func (n *devNode) symlink(name, target string) error {
+	return n.exists(name)
+}
+
+func (n *devNode) link(name string, c vnode) error {
+	return n.exists(name)
+}
+
+func (n *devNode) remove(name string) error {
+	if _, ok := n.entries[name]; !ok {
+		return syscall.ENOENT
+	}
+	return syscall.EPERM
+}
+
+func (n *devNode) rename(oldname string, newdir vnode, newname string) error {
+	return syscall.EPERM
+}
+
+func (n *devNode) open()  {}
+func (n *devNode) close() {}
+
+func (n *devNode) readAt(b []byte, off int64) (int, error) {
+	n.iomu.Lock()
+	defer n.iomu.Unlock()
+	nr, err := blockReadAt(n.blk, n.info.BlockSize, n.info.Capacity, b, off)
+	return nr, deviceErr(err)
+}
+
+func (n *devNode) writeAt(b []byte, off int64) (int, error) {
+	n.iomu.Lock()
+	defer n.iomu.Unlock()
+	nw, err := blockWriteAt(n.blk, n.info.BlockSize, n.info.Capacity, b, off)
+	return nw, deviceErr(err)
+}
+
+// appendAt fails, a device is full to its capacity.
+func (n *devNode) appendAt(b []byte) (int, int64, error) {
+	return 0, n.info.Capacity, syscall.ENOSPC
+}
+
+func (n *devNode) truncate(size int64) error {
+	return syscall.EINVAL
+}
+
+func (n *devNode) sync() error {
+	if n.blk == nil {
+		return nil
+	}
+	return deviceErr(n.blk.Sync())
+}
+
+func (n *devNode) readlink() (string, error) {
+	return "", syscall.EINVAL
+}
+
+// deviceErr returns the underlying error of a device error.
+func deviceErr(err error) error {
+	if de, ok := err.(*solo5.DeviceError); ok {
+		return de.Err
+	}
+	return err
+}
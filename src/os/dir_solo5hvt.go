@@ -10,9 +10,8 @@ import (
 
 // Auxiliary information if the File describes a directory
 type dirInfo struct {
-	buf  []byte // buffer for directory I/O
-	nbuf int    // length of buf; return value from Getdirentries
-	bufp int    // location of next record in buf.
+	names []string // names of the entries when reading started
+	pos   int      // index of the next name to return
 }
 
 const (
@@ -23,5 +22,61 @@ const (
 func (d *dirInfo) close() {}
 
 func (f *File) readdirnames(n int) (names []string, err error) {
-	return nil, syscall.ENOSYS
+	if f.node == nil {
+		return nil, &PathError{"readdirent", f.name, syscall.ENOTDIR}
+	}
+	if err := f.lock(); err != nil {
+		return nil, &PathError{"readdirent", f.name, err}
+	}
+	defer f.mu.Unlock()
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+	return f.readdirnamesLocked(n)
+}
+
+// readdirnamesLocked is readdirnames with f.mu and vfs.mu held.
+func (f *File) readdirnamesLocked(n int) (names []string, err error) {
+	if !f.node.attr().mode.IsDir() {
+		return nil, &PathError{"readdirent", f.name, syscall.ENOTDIR}
+	}
+	if f.dirinfo == nil {
+		names, err := f.node.names()
+		if err != nil {
+			return nil, &PathError{"readdirent", f.name, err}
+		}
+		f.dirinfo = &dirInfo{names: names}
+	}
+	return vfsNextNames(f.dirinfo.names, &f.dirinfo.pos, n)
+}
+
+func (f *File) readdir(n int) (fi []FileInfo, err error) {
+	if f.node == nil {
+		return nil, &PathError{"readdirent", f.name, syscall.ENOTDIR}
+	}
+	if err := f.lock(); err != nil {
+		return nil, &PathError{"readdirent", f.name, err}
+	}
+	defer f.mu.Unlock()
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+	for {
+		names, err := f.readdirnamesLocked(n)
+		for _, name := range names {
+			c, err := f.node.lookup(name)
+			if err != nil {
+				// Removed since reading started.
+				continue
+			}
+			if m := vfsMountedOn(c); m != nil {
+				c = m.root
+			}
+			fi = append(fi, vfsStatNode(c, name))
+		}
+		if err != nil || n <= 0 || len(fi) > 0 {
+			if fi == nil && err == nil {
+				fi = []FileInfo{}
+			}
+			return fi, err
+		}
+	}
 }
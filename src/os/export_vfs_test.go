@@ -0,0 +1,96 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os
+
+// Export the file system and standard streams of solo5hvt, see vfs.go and
+// stdio.go, for testing on the host.
+
+var (
+	VFSMkdir     = vfsMkdir
+	VFSRemove    = vfsRemove
+	VFSRename    = vfsRename
+	VFSLink      = vfsLink
+	VFSSymlink   = vfsSymlink
+	VFSReadlink  = vfsReadlink
+	VFSTruncate  = vfsTruncate
+	VFSChdir     = vfsChdirName
+	VFSGetwd     = vfsGetwd
+	VFSNextNames = vfsNextNames
+	BlockReadAt  = blockReadAt
+	BlockWriteAt = blockWriteAt
+
+	StdioFlag     = stdioFlag
+	StdioCutAtNUL = stdioCutAtNUL
+)
+
+// SetTestVFS replaces the file tree by a new tmpfs with a second tmpfs
+// mounted on /mnt, and returns a function restoring the old tree.
+func SetTestVFS() (restore func()) {
+	vfs.mu.Lock()
+	old := vfs.root
+	oldCwd := vfs.cwd
+	oldMounts := vfs.mounts
+	fs := newTmpFS()
+	vfsInit(fs, fs.root)
+	vfs.mu.Unlock()
+
+	if err := vfsMkdir("/mnt", 0755); err != nil {
+		panic(err)
+	}
+	mfs := newTmpFS()
+	if err := vfsMount("/mnt", mfs, mfs.root, false); err != nil {
+		panic(err)
+	}
+	return func() {
+		vfs.mu.Lock()
+		vfs.root = old
+		vfs.cwd = oldCwd
+		vfs.mounts = oldMounts
+		vfs.mu.Unlock()
+	}
+}
+
+// VFSNode is an open file or directory of the file tree.
+type VFSNode struct {
+	n vnode
+}
+
+func VFSOpen(name string, flag int, perm FileMode) (*VFSNode, error) {
+	n, err := vfsOpen(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &VFSNode{n}, nil
+}
+
+// VFSAttr returns the mode, size and number of links of name.
+func VFSAttr(name string, follow bool) (mode FileMode, size int64, nlink int, err error) {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+	n, err := vfsWalk(name, follow)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	a := n.attr()
+	return a.mode, a.size, a.nlink, nil
+}
+
+func (n *VFSNode) ReadAt(b []byte, off int64) (int, error)  { return n.n.readAt(b, off) }
+func (n *VFSNode) WriteAt(b []byte, off int64) (int, error) { return n.n.writeAt(b, off) }
+func (n *VFSNode) Append(b []byte) (int, int64, error)      { return n.n.appendAt(b) }
+func (n *VFSNode) Size() int64                              { return n.n.attr().size }
+func (n *VFSNode) Close()                                   { vfsClose(n.n) }
+
+func (n *VFSNode) Names() ([]string, error) {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+	return n.n.names()
+}
+
+func (n *VFSNode) SeekFrom(cur, offset int64, whence int) (int64, error) {
+	return vfsSeek(n.n, cur, offset, whence)
+}
@@ -1,7 +0,0 @@
-// +build !solo5hvt
-
-package os
-
-func (f *File) isFake() bool {
-	return false
-}
@@ -1,10 +1,56 @@
 package os
 
-// Full path to contents, eg "/etc/resolv.conf".
-var fakeFiles = map[string][]byte{}
-
-// Register a path with given contents.
-// A later os.Open() on the given path returns a file from which the original contents can be read.
+// AddFile registers a file with the given path and contents in the file
+// system, eg "/etc/resolv.conf". Missing parent directories are created.
+// An existing file is replaced. The file system takes ownership of data,
+// writes to the file change it. Files are added to the in-memory root file
+// system, also under the mount point of another file system.
 func AddFile(path string, data []byte) {
-	fakeFiles[path] = data
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	if err := tmpAddFile(path, data); err != nil {
+		panic(&PathError{"addfile", path, err})
+	}
+}
+
+func tmpAddFile(path string, data []byte) error {
+	dir := tmpfs.root
+	for {
+		for path != "" && path[0] == '/' {
+			path = path[1:]
+		}
+		i := 0
+		for i < len(path) && path[i] != '/' {
+			i++
+		}
+		elem := path[:i]
+		path = path[i:]
+		if elem == "" || isDotOrDotDot(elem) {
+			return ErrInvalid
+		}
+
+		n, ok := dir.entries[elem]
+		if path == "" {
+			if ok && !n.attr().mode.IsRegular() {
+				return ErrExist
+			}
+			if !ok {
+				n = tmpfs.newNode(0644)
+				dir.linkNode(elem, n)
+			}
+			n.mu.Lock()
+			n.data = data
+			n.static = false
+			n.mu.Unlock()
+			return nil
+		}
+		if !ok {
+			n = tmpfs.newNode(ModeDir | 0755)
+			dir.linkNode(elem, n)
+		} else if !n.isDir() {
+			return ErrExist
+		}
+		dir = n
+	}
 }
@@ -228,7 +228,7 @@ func (f *File) WriteString(s string) (n int, err error) {
 // bits (before umask).
 // If there is an error, it will be of type *PathError.
 func Mkdir(name string, perm FileMode) error {
-	e := syscall.Mkdir(fixLongPath(name), syscallMode(perm))
+	e := mkdir(fixLongPath(name), perm)
 
 	if e != nil {
 		return &PathError{"mkdir", name, e}
@@ -259,7 +259,7 @@ func setStickyBit(name string) error {
 // Chdir changes the current working directory to the named directory.
 // If there is an error, it will be of type *PathError.
 func Chdir(dir string) error {
-	if e := syscall.Chdir(dir); e != nil {
+	if e := chdir(dir); e != nil {
 		testlog.Open(dir) // observe likely non-existent directory
 		return &PathError{"chdir", dir, e}
 	}
@@ -5,22 +5,23 @@
 package os
 
 import (
-	"errors"
 	"internal/poll"
 	"io"
 	"runtime"
+	"sync"
 	"syscall"
 )
 
-var errFS = errors.New("almost no file system")
-
 // fixLongPath is a noop on non-Windows platforms.
 func fixLongPath(path string) string {
 	return path
 }
 
 func rename(oldname, newname string) error {
-	return errFS
+	if e := vfsRename(oldname, newname); e != nil {
+		return &LinkError{"rename", oldname, newname, e}
+	}
+	return nil
 }
 
 // file is the real representation of *File.
@@ -34,33 +35,36 @@ type file struct {
 	nonblock    bool     // whether we set nonblocking mode
 	stdoutOrErr bool     // whether this is stdout or stderr
 	appendMode  bool     // whether file is opened for appending
+	eofAtNUL    bool     // whether input ends at the first NUL byte, for stdin from a device
 
-	// if set, this is a builtin static file.
-	fake *fakeFile
-}
-
-type fakeFile struct {
-	Path   string
-	Offset int64
-}
+	// The file in the file system, nil for the standard streams.
+	node vnode
+	flag int // flags the file was opened with
 
-func (f *File) isFake() bool {
-	return f.fake != nil
+	// mu protects offset, dirinfo and closed. It is held during operations
+	// on node, so Close waits for them to finish.
+	mu     sync.Mutex
+	offset int64 // offset for read, write and seek
+	closed bool
 }
 
 // Fd returns the integer Unix file descriptor referencing the open file.
 // The file descriptor is valid only until f.Close is called or f is garbage collected.
-// On Unix systems this will cause the SetDeadline methods to stop working.
+// On solo5hvt, the standard streams have descriptors 0, 1 and 2, block
+// devices their solo5 handle, and other files have none, ^uintptr(0).
 func (f *File) Fd() uintptr {
 	if f == nil {
 		return ^(uintptr(0))
 	}
 
-	if f.isFake() {
+	if d, ok := f.node.(*devNode); ok && d.blk != nil {
+		// The solo5 handle, for syscall.Blkread and syscall.Blkwrite.
+		return d.blk.Fd()
+	}
+	if f.node != nil {
 		return ^(uintptr(0))
 	}
-
-	panic("File.Fd")
+	return uintptr(f.pfd.Sysfd)
 }
 
 // NewFile returns a new File with the given file descriptor and
@@ -97,7 +101,7 @@ func newFile(fd uintptr, name string, kind newFileKind) *File {
 		return nil
 	}
 	f := &File{&file{
-		pfd:         poll.FD{},
+		pfd:         poll.FD{Sysfd: fdi},
 		name:        name,
 		stdoutOrErr: fdi == 1 || fdi == 2,
 	}}
@@ -122,23 +126,16 @@ const DevNull = "/dev/null"
 // openFileNolog is the Unix implementation of OpenFile.
 // Changes here should be reflected in openFdAt, if relevant.
 func openFileNolog(name string, flag int, perm FileMode) (*File, error) {
-	if flag != O_RDONLY {
-		return nil, errFS
-	}
-
-	_, ok := fakeFiles[name]
-	if !ok {
-		return nil, ErrNotExist
-	}
-
-	f := &File{
-		file: &file{
-			fake: &fakeFile{
-				Path:   name,
-				Offset: 0,
-			},
-		},
+	n, e := vfsOpen(name, flag, perm)
+	if e != nil {
+		return nil, &PathError{"open", name, e}
 	}
+	f := &File{&file{
+		name: name,
+		node: n,
+		flag: flag,
+	}}
+	runtime.SetFinalizer(f.file, (*file).close)
 	return f, nil
 }
 
@@ -150,12 +147,27 @@ func (f *File) Close() error {
 	if f == nil {
 		return ErrInvalid
 	}
-	if f.isFake() {
-		return nil
+	f.mu.Lock()
+	closed := f.closed
+	f.closed = true
+	f.mu.Unlock()
+	if closed {
+		return &PathError{"close", f.name, ErrClosed}
 	}
 	return f.file.close()
 }
 
+// lock locks f for an operation on its node. It fails if f is closed,
+// also if that happened after checkValid.
+func (f *File) lock() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
 func (file *file) close() error {
 	if file == nil {
 		return syscall.EINVAL
@@ -163,6 +175,9 @@ func (file *file) close() error {
 	if file.dirinfo != nil {
 		file.dirinfo.close()
 	}
+	if file.node != nil {
+		vfsClose(file.node)
+	}
 
 	// no need for a finalizer anymore
 	runtime.SetFinalizer(file, nil)
@@ -172,69 +187,102 @@ func (file *file) close() error {
 // read reads up to len(b) bytes from the File.
 // It returns the number of bytes read and an error, if any.
 func (f *File) read(b []byte) (n int, err error) {
-	if f == nil {
-		return 0, syscall.EINVAL
-	}
-
-	if f.isFake() {
-		n, err = f.pread(b, f.fake.Offset)
-		if n > 0 {
-			f.fake.Offset += int64(n)
+	if f.node == nil {
+		if f.pfd.Sysfd == syscall.Stdin {
+			// Not redirected, see stdio_solo5hvt.go.
+			return 0, io.EOF
 		}
-		return
+		return 0, syscall.ENOTSUP
 	}
-
-	return 0, syscall.ENOTSUP
+	if f.flag&O_WRONLY != 0 {
+		return 0, syscall.EBADF
+	}
+	if err := f.lock(); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	n, err = readAtNode(f.node, b, f.offset)
+	if f.eofAtNUL {
+		n, err = stdioCutAtNUL(b, n, err)
+	}
+	f.offset += int64(n)
+	return n, err
 }
 
 // pread reads len(b) bytes from the File starting at byte offset off.
 // It returns the number of bytes read and the error, if any.
 // EOF is signaled by a zero count with err set to nil.
 func (f *File) pread(b []byte, off int64) (n int, err error) {
-	if f.isFake() {
-		buf := fakeFiles[f.fake.Path]
-		s := off
-		e := s + int64(len(b))
-		if e > int64(len(buf)) {
-			e = int64(len(buf))
-		}
-		if s > e {
-			s = e
-		}
-		n = int(e - s)
-		copy(b, buf[int(s):int(e)])
-		var err error
-		if n == 0 {
-			err = io.EOF
-		}
-		return n, err
+	if f.node == nil {
+		return 0, syscall.ENOTSUP
+	}
+	if f.flag&O_WRONLY != 0 {
+		return 0, syscall.EBADF
 	}
+	if err := f.lock(); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	return readAtNode(f.node, b, off)
+}
 
-	return 0, syscall.ENOTSUP
+// readAtNode reads from regular file n. Like a read system call, a partial
+// read does not return an error.
+func readAtNode(n vnode, b []byte, off int64) (int, error) {
+	if n.attr().mode.IsDir() {
+		return 0, syscall.EISDIR
+	}
+	nr, err := n.readAt(b, off)
+	if nr > 0 {
+		err = nil
+	}
+	return nr, err
 }
 
 // write writes len(b) bytes to the File.
 // It returns the number of bytes written and an error, if any.
 func (f *File) write(b []byte) (n int, err error) {
-	if f.isFake() {
-		return 0, syscall.ENOSYS
+	if f.node == nil {
+		switch f.pfd.Sysfd {
+		case syscall.Stdout:
+			syscall.ConsoleWrite(b)
+			return len(b), nil
+		case syscall.Stderr:
+			syscall.ConsoleWriteErr(b)
+			return len(b), nil
+		}
+		return 0, syscall.ENOTSUP
 	}
-
-	if f.file.stdoutOrErr {
-		runtime.Solo5Write(b)
-		return len(b), nil
+	if f.flag&(O_WRONLY|O_RDWR) == 0 {
+		return 0, syscall.EBADF
 	}
-	return 0, syscall.ENOTSUP
+	if err := f.lock(); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	if f.appendMode {
+		n, f.offset, err = f.node.appendAt(b)
+		return n, err
+	}
+	n, err = f.node.writeAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
 }
 
 // pwrite writes len(b) bytes to the File starting at byte offset off.
 // It returns the number of bytes written and an error, if any.
 func (f *File) pwrite(b []byte, off int64) (n int, err error) {
-	if f.isFake() {
-		return 0, syscall.ENOSYS
+	if f.node == nil {
+		return 0, syscall.ENOTSUP
 	}
-
-	return 0, syscall.ENOTSUP
+	if f.flag&(O_WRONLY|O_RDWR) == 0 {
+		return 0, syscall.EBADF
+	}
+	if err := f.lock(); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	return f.node.writeAt(b, off)
 }
 
 // seek sets the offset for the next Read or Write on file to offset, interpreted
@@ -242,56 +290,76 @@ func (f *File) pwrite(b []byte, off int64) (n int, err error) {
 // relative to the current offset, and 2 means relative to the end.
 // It returns the new offset and an error, if any.
 func (f *File) seek(offset int64, whence int) (ret int64, err error) {
-	if f.isFake() {
-		if whence == 0 {
-			f.fake.Offset = offset
-		} else if whence == 1 {
-			f.fake.Offset = f.fake.Offset + offset
-		} else {
-			buf := fakeFiles[f.fake.Path]
-			f.fake.Offset = int64(len(buf)) + offset
-		}
-		return f.fake.Offset, nil
+	if f.node == nil {
+		return 0, syscall.ENOTSUP
 	}
-
-	return 0, syscall.ENOTSUP
+	if err := f.lock(); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	ret, err = vfsSeek(f.node, f.offset, offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if f.dirinfo != nil && ret == 0 {
+		// Read the directory again from the start.
+		f.dirinfo = nil
+	}
+	f.offset = ret
+	return ret, nil
 }
 
 // Truncate changes the size of the named file.
 // If the file is a symbolic link, it changes the size of the link's target.
 // If there is an error, it will be of type *PathError.
 func Truncate(name string, size int64) error {
-	return syscall.ENOSYS
+	if e := vfsTruncate(name, size); e != nil {
+		return &PathError{"truncate", name, e}
+	}
+	return nil
 }
 
 // Remove removes the named file or (empty) directory.
 // If there is an error, it will be of type *PathError.
 func Remove(name string) error {
-	return syscall.ENOSYS
+	if e := vfsRemove(name); e != nil {
+		return &PathError{"remove", name, e}
+	}
+	return nil
 }
 
 func tempDir() string {
-	return "/"
+	dir := Getenv("TMPDIR")
+	if dir == "" {
+		dir = "/tmp"
+	}
+	return dir
 }
 
 // Link creates newname as a hard link to the oldname file.
 // If there is an error, it will be of type *LinkError.
 func Link(oldname, newname string) error {
-	return syscall.ENOSYS
+	if e := vfsLink(oldname, newname); e != nil {
+		return &LinkError{"link", oldname, newname, e}
+	}
+	return nil
 }
 
 // Symlink creates newname as a symbolic link to oldname.
 // If there is an error, it will be of type *LinkError.
 func Symlink(oldname, newname string) error {
-	return syscall.ENOSYS
-}
-
-func (f *File) readdir(n int) (fi []FileInfo, err error) {
-	return nil, syscall.ENOSYS
+	if e := vfsSymlink(oldname, newname); e != nil {
+		return &LinkError{"symlink", oldname, newname, e}
+	}
+	return nil
 }
 
 // Readlink returns the destination of the named symbolic link.
 // If there is an error, it will be of type *PathError.
 func Readlink(name string) (string, error) {
-	return "", syscall.ENOSYS
+	s, e := vfsReadlink(name)
+	if e != nil {
+		return "", &PathError{"readlink", name, e}
+	}
+	return s, nil
 }
@@ -374,6 +374,15 @@ func rename(oldname, newname string) error {
 	return nil
 }
 
+// mkdir and chdir do the system calls of Mkdir and Chdir in file.go.
+func mkdir(name string, perm FileMode) error {
+	return syscall.Mkdir(name, syscallMode(perm))
+}
+
+func chdir(dir string) error {
+	return syscall.Chdir(dir)
+}
+
 // See docs in file.go:Chmod.
 func chmod(name string, mode FileMode) error {
 	var d syscall.Dir
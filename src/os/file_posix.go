@@ -37,6 +37,15 @@ func chmod(name string, mode FileMode) error {
 	return nil
 }
 
+// mkdir and chdir do the system calls of Mkdir and Chdir in file.go.
+func mkdir(name string, perm FileMode) error {
+	return syscall.Mkdir(name, syscallMode(perm))
+}
+
+func chdir(dir string) error {
+	return syscall.Chdir(dir)
+}
+
 // See docs in file.go:(*File).Chmod.
 func (f *File) chmod(mode FileMode) error {
 	if err := f.checkValid("chmod"); err != nil {
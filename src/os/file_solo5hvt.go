@@ -29,12 +29,38 @@ func sigpipe() // implemented in package runtime
 
 // See docs in file.go:Chmod.
 func chmod(name string, mode FileMode) error {
-	return syscall.ENOSYS
+	if e := vfsChmod(name, mode); e != nil {
+		return &PathError{"chmod", name, e}
+	}
+	return nil
+}
+
+// mkdir and chdir implement Mkdir and Chdir in file.go on the file system
+// in package os, see vfs.go.
+func mkdir(name string, perm FileMode) error {
+	return vfsMkdir(name, perm)
+}
+
+func chdir(dir string) error {
+	return vfsChdirName(dir)
 }
 
 // See docs in file.go:(*File).Chmod.
 func (f *File) chmod(mode FileMode) error {
-	return syscall.ENOSYS
+	if err := f.checkValid("chmod"); err != nil {
+		return err
+	}
+	if f.node == nil {
+		return &PathError{"chmod", f.name, syscall.ENOSYS}
+	}
+	if e := f.lock(); e != nil {
+		return &PathError{"chmod", f.name, e}
+	}
+	defer f.mu.Unlock()
+	if e := f.node.chmod(mode); e != nil {
+		return &PathError{"chmod", f.name, e}
+	}
+	return nil
 }
 
 // Chown changes the numeric uid and gid of the named file.
@@ -44,8 +70,13 @@ func (f *File) chmod(mode FileMode) error {
 //
 // On Windows or Plan 9, Chown always returns the syscall.EWINDOWS or
 // EPLAN9 error, wrapped in *PathError.
+//
+// On solo5hvt, all files are owned by root and the owner cannot be changed.
 func Chown(name string, uid, gid int) error {
-	return syscall.ENOSYS
+	if e := vfsExists(name, true); e != nil {
+		return &PathError{"chown", name, e}
+	}
+	return nil
 }
 
 // Lchown changes the numeric uid and gid of the named file.
@@ -55,7 +86,10 @@ func Chown(name string, uid, gid int) error {
 // On Windows, it always returns the syscall.EWINDOWS error, wrapped
 // in *PathError.
 func Lchown(name string, uid, gid int) error {
-	return syscall.ENOSYS
+	if e := vfsExists(name, false); e != nil {
+		return &PathError{"lchown", name, e}
+	}
+	return nil
 }
 
 // Chown changes the numeric uid and gid of the named file.
@@ -64,21 +98,59 @@ func Lchown(name string, uid, gid int) error {
 // On Windows, it always returns the syscall.EWINDOWS error, wrapped
 // in *PathError.
 func (f *File) Chown(uid, gid int) error {
-	return syscall.ENOSYS
+	if err := f.checkValid("chown"); err != nil {
+		return err
+	}
+	if f.node == nil {
+		return &PathError{"chown", f.name, syscall.ENOSYS}
+	}
+	return nil
 }
 
 // Truncate changes the size of the file.
 // It does not change the I/O offset.
 // If there is an error, it will be of type *PathError.
 func (f *File) Truncate(size int64) error {
-	return syscall.ENOSYS
+	if err := f.checkValid("truncate"); err != nil {
+		return err
+	}
+	if f.node == nil {
+		return &PathError{"truncate", f.name, syscall.ENOSYS}
+	}
+	if e := f.lock(); e != nil {
+		return &PathError{"truncate", f.name, e}
+	}
+	defer f.mu.Unlock()
+	if f.node.attr().mode.IsDir() || f.flag&(O_WRONLY|O_RDWR) == 0 {
+		return &PathError{"truncate", f.name, syscall.EINVAL}
+	}
+	if size < 0 {
+		return &PathError{"truncate", f.name, syscall.EINVAL}
+	}
+	if e := f.node.truncate(size); e != nil {
+		return &PathError{"truncate", f.name, e}
+	}
+	return nil
 }
 
 // Sync commits the current contents of the file to stable storage.
 // Typically, this means flushing the file system's in-memory copy
 // of recently written data to disk.
 func (f *File) Sync() error {
-	return syscall.ENOSYS
+	if err := f.checkValid("sync"); err != nil {
+		return err
+	}
+	if f.node == nil {
+		return &PathError{"sync", f.name, syscall.ENOSYS}
+	}
+	if e := f.lock(); e != nil {
+		return &PathError{"sync", f.name, e}
+	}
+	defer f.mu.Unlock()
+	if e := f.node.sync(); e != nil {
+		return &PathError{"sync", f.name, e}
+	}
+	return nil
 }
 
 // Chtimes changes the access and modification times of the named
@@ -88,44 +160,64 @@ func (f *File) Sync() error {
 // less precise time unit.
 // If there is an error, it will be of type *PathError.
 func Chtimes(name string, atime time.Time, mtime time.Time) error {
-	return syscall.ENOSYS
+	if e := vfsChtimes(name, mtime); e != nil {
+		return &PathError{"chtimes", name, e}
+	}
+	return nil
 }
 
 // Chdir changes the current working directory to the file,
 // which must be a directory.
 // If there is an error, it will be of type *PathError.
 func (f *File) Chdir() error {
-	return syscall.ENOSYS
+	if err := f.checkValid("chdir"); err != nil {
+		return err
+	}
+	if f.node == nil {
+		return &PathError{"chdir", f.name, syscall.ENOTDIR}
+	}
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+	if e := vfsChdir(f.node); e != nil {
+		return &PathError{"chdir", f.name, e}
+	}
+	return nil
 }
 
 // setDeadline sets the read and write deadline.
 func (f *File) setDeadline(t time.Time) error {
-	if f.isFake() {
-		return syscall.ENOSYS
+	if err := f.checkValid("SetDeadline"); err != nil {
+		return err
+	}
+	if f.node != nil {
+		return ErrNoDeadline
 	}
 
 	panic("File.setDeadline")
-	return syscall.ENOSYS
 }
 
 // setReadDeadline sets the read deadline.
 func (f *File) setReadDeadline(t time.Time) error {
-	if f.isFake() {
-		return syscall.ENOSYS
+	if err := f.checkValid("SetReadDeadline"); err != nil {
+		return err
+	}
+	if f.node != nil {
+		return ErrNoDeadline
 	}
 
 	panic("File.setReadDeadline")
-	return syscall.ENOSYS
 }
 
 // setWriteDeadline sets the write deadline.
 func (f *File) setWriteDeadline(t time.Time) error {
-	if f.isFake() {
-		return syscall.ENOSYS
+	if err := f.checkValid("SetWriteDeadline"); err != nil {
+		return err
+	}
+	if f.node != nil {
+		return ErrNoDeadline
 	}
 
 	panic("File.setWriteDeadline")
-	return syscall.ENOSYS
 }
 
 // checkValid checks whether f is valid for use.
@@ -134,6 +226,12 @@ func (f *File) checkValid(op string) error {
 	if f == nil {
 		return ErrInvalid
 	}
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return &PathError{op, f.name, ErrClosed}
+	}
 	return nil
 }
 
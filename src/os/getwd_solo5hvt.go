@@ -4,6 +4,12 @@
 
 package os
 
+// Getwd returns a rooted path name corresponding to the
+// current directory.
 func Getwd() (dir string, err error) {
-	return "/", nil
+	dir, e := vfsGetwd()
+	if e != nil {
+		return "", NewSyscallError("getwd", e)
+	}
+	return dir, nil
 }
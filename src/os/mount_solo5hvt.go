@@ -0,0 +1,76 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"internal/rofs"
+	"internal/solo5fs"
+	"syscall"
+	"syscall/solo5"
+)
+
+// Block devices from the manifest are mounted at boot with environment
+// variable SOLO5_MOUNT_<name>, e.g. SOLO5_MOUNT_storage=/data, typically
+// set on the command line. A missing mount point is created. A device that
+// cannot be mounted stops the guest.
+//
+// Devices with a FAT, ext2 or ISO9660 file system are mounted read-only.
+// Other devices must hold a solo5fs file system, see cmd/solo5fs, which is
+// mounted read-write.
+
+// mountDevices mounts the block devices configured in the environment.
+func mountDevices() {
+	for _, d := range solo5.Devices() {
+		if d.Type != solo5.BlockBasic {
+			continue
+		}
+		dir, ok := syscall.Getenv("SOLO5_MOUNT_" + d.Name)
+		if !ok {
+			continue
+		}
+		if err := mountDevice(d, dir); err != nil {
+			panic(&PathError{"mount " + d.Name, dir, err})
+		}
+	}
+}
+
+func mountDevice(d solo5.Device, dir string) error {
+	if dir == "" || dir[0] != '/' {
+		return syscall.EINVAL
+	}
+	if err := mkdirMountPoint(dir); err != nil {
+		return err
+	}
+	dev, err := solo5.OpenBlock(d.Name)
+	if err != nil {
+		return err
+	}
+	err = mountReadOnly(dev, d.Block.Capacity, d.Block.BlockSize, dir)
+	if err == rofs.ErrFormat {
+		if solo5fs.BlockSize%d.Block.BlockSize != 0 {
+			err = syscall.EINVAL
+		} else {
+			err = mountSolo5fs(dev, d.Block.Capacity, dir)
+		}
+	}
+	if err != nil {
+		dev.Close()
+	}
+	return err
+}
+
+// mkdirMountPoint creates directory dir and its parents, as needed.
+func mkdirMountPoint(dir string) error {
+	for i := 1; i <= len(dir); i++ {
+		if i < len(dir) && dir[i] != '/' {
+			continue
+		}
+		err := vfsMkdir(dir[:i], 0755)
+		if err != nil && err != syscall.EEXIST {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import "syscall"
+
+// Pipe returns a connected pair of Files; reads from r return bytes written to w.
+// It returns the files and an error, if any.
+//
+// There are no pipes on solo5hvt, Pipe always returns an error.
+func Pipe() (r *File, w *File, err error) {
+	return nil, nil, NewSyscallError("pipe", syscall.ENOSYS)
+}
@@ -1,9 +0,0 @@
-package os
-
-import (
-	"syscall"
-)
-
-func removeAll(path string) error {
-	return syscall.ENOTSUP
-}
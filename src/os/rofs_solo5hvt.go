@@ -0,0 +1,156 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"internal/rofs"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A readOnlyFS is a FAT, ext2 or ISO9660 file system on a block device,
+// see package internal/rofs. All changes fail with EROFS.
+//
+// Package rofs is not safe for concurrent use, the methods of the nodes
+// that use it hold the lock of the file system.
+type readOnlyFS struct {
+	mu sync.Mutex
+	fs rofs.FS
+}
+
+type readOnlyNode struct {
+	fs *readOnlyFS
+	n  rofs.Node
+}
+
+func (fs *readOnlyFS) sync() error {
+	return nil
+}
+
+func (r readOnlyNode) fsys() fileSystem {
+	return r.fs
+}
+
+func (r readOnlyNode) attr() vattr {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	return vattr{
+		ino:     r.n.Ino(),
+		mode:    FileMode(r.n.Mode()),
+		size:    r.n.Size(),
+		nlink:   r.n.Nlink(),
+		modTime: r.n.ModTime(),
+	}
+}
+
+func (r readOnlyNode) chmod(mode FileMode) error {
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) chtimes(mtime time.Time) error {
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) lookup(name string) (vnode, error) {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	n, err := r.n.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyNode{r.fs, n}, nil
+}
+
+func (r readOnlyNode) names() ([]string, error) {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	return r.n.Names()
+}
+
+// exists returns EEXIST if name exists, and EROFS otherwise, the error for
+// creating name.
+func (r readOnlyNode) exists(name string) error {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	if _, err := r.n.Lookup(name); err == nil {
+		return syscall.EEXIST
+	}
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) create(name string, mode FileMode) (vnode, error) {
+	return nil, r.exists(name)
+}
+
+func (r readOnlyNode) symlink(name, target string) error {
+	return r.exists(name)
+}
+
+func (r readOnlyNode) link(name string, n vnode) error {
+	return r.exists(name)
+}
+
+func (r readOnlyNode) remove(name string) error {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	if _, err := r.n.Lookup(name); err != nil {
+		return err
+	}
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) rename(oldname string, newdir vnode, newname string) error {
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) open() {}
+
+func (r readOnlyNode) close() {}
+
+func (r readOnlyNode) readAt(b []byte, off int64) (int, error) {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	n, err := r.n.ReadAt(b, off)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r readOnlyNode) writeAt(b []byte, off int64) (int, error) {
+	return 0, syscall.EROFS
+}
+
+func (r readOnlyNode) appendAt(b []byte) (int, int64, error) {
+	return 0, 0, syscall.EROFS
+}
+
+func (r readOnlyNode) truncate(size int64) error {
+	return syscall.EROFS
+}
+
+func (r readOnlyNode) sync() error {
+	return nil
+}
+
+func (r readOnlyNode) readlink() (string, error) {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	return r.n.Readlink()
+}
+
+// mountReadOnly mounts the file system on dev, which has size bytes and
+// reads in blocks of blockSize bytes, read-only on directory dir. It returns
+// rofs.ErrFormat if dev holds no FAT, ext2 or ISO9660 file system.
+func mountReadOnly(dev io.ReaderAt, size int64, blockSize int, dir string) error {
+	fs, err := rofs.Mount(dev, size, blockSize)
+	if err != nil {
+		return err
+	}
+	rfs := &readOnlyFS{fs: fs}
+	return vfsMount(dir, rfs, readOnlyNode{rfs, fs.Root()}, true)
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// rootfsZip is a zip file with a tree of files, directories and symbolic
+// links, set by the linker with -solo5rootfs=dir. The tree is added to the
+// root file system at startup. Files are stored uncompressed, their data is
+// used in place until it is changed.
+var rootfsZip string
+
+var errRootfs = errors.New("bad embedded root file system")
+
+// loadRootfs adds the tree of rootfsZip to tmpfs.
+func loadRootfs() error {
+	z := rootfsZip
+	if z == "" {
+		return nil
+	}
+
+	// The end of central directory record, without a comment.
+	const endLen = 22
+	if len(z) < endLen || get32(z[len(z)-endLen:]) != 0x06054b50 {
+		return errRootfs
+	}
+	end := z[len(z)-endLen:]
+	nfiles := int(get16(end[10:]))
+	cd := int(get32(end[16:]))
+	if cd > len(z) {
+		return errRootfs
+	}
+
+	for i, off := 0, cd; i < nfiles; i++ {
+		const cdLen = 46
+		if off+cdLen > len(z) || get32(z[off:]) != 0x02014b50 {
+			return errRootfs
+		}
+		h := z[off : off+cdLen]
+		creator := get16(h[4:]) >> 8
+		method := get16(h[10:])
+		size := int(get32(h[20:]))
+		namelen := int(get16(h[28:]))
+		extralen := int(get16(h[30:]))
+		commentlen := int(get16(h[32:]))
+		attrs := get32(h[38:])
+		local := int(get32(h[42:]))
+		off += cdLen
+		if off+namelen > len(z) {
+			return errRootfs
+		}
+		name := z[off : off+namelen]
+		off += namelen + extralen + commentlen
+
+		// Skip the local header to the data.
+		const localLen = 30
+		if local+localLen > len(z) || get32(z[local:]) != 0x04034b50 {
+			return errRootfs
+		}
+		data := local + localLen + int(get16(z[local+26:])) + int(get16(z[local+28:]))
+		if method != 0 || creator != 3 || size < 0 || data+size > len(z) || size == 0xffffffff {
+			return errRootfs
+		}
+
+		n, err := rootfsNode(name, unixFileMode(attrs>>16))
+		if err != nil {
+			return &PathError{"rootfs", "/" + name, err}
+		}
+		switch {
+		case n.mode&ModeSymlink != 0:
+			n.target = z[data : data+size]
+		case n.mode.IsRegular():
+			n.data = stringBytes(z[data : data+size])
+			n.static = true
+		}
+	}
+	return nil
+}
+
+// rootfsNode returns the node for name in tmpfs with mode, creating it and
+// its parent directories as needed. The mode of an existing directory is
+// changed.
+func rootfsNode(name string, mode FileMode) (*tmpNode, error) {
+	for len(name) > 0 && name[len(name)-1] == '/' {
+		name = name[:len(name)-1]
+	}
+	dir := tmpfs.root
+	for {
+		i := 0
+		for i < len(name) && name[i] != '/' {
+			i++
+		}
+		elem := name[:i]
+		if elem == "" || isDotOrDotDot(elem) {
+			return nil, ErrInvalid
+		}
+		n, ok := dir.entries[elem]
+		if i == len(name) {
+			if ok && (!n.mode.IsDir() || !mode.IsDir()) {
+				return nil, ErrExist
+			}
+			if ok {
+				n.mode = mode
+			} else {
+				n = tmpfs.newNode(mode)
+				dir.linkNode(elem, n)
+			}
+			return n, nil
+		}
+		if !ok {
+			n = tmpfs.newNode(ModeDir | 0755)
+			dir.linkNode(elem, n)
+		} else if !n.mode.IsDir() {
+			return nil, ErrExist
+		}
+		dir = n
+		name = name[i+1:]
+	}
+}
+
+// unixFileMode returns the FileMode for Unix mode bits m, as stored in zip
+// files.
+func unixFileMode(m uint32) FileMode {
+	mode := FileMode(m & 0777)
+	switch m & 0170000 {
+	case 0040000:
+		mode |= ModeDir
+	case 0120000:
+		mode |= ModeSymlink
+	}
+	if m&syscall.S_ISUID != 0 {
+		mode |= ModeSetuid
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= ModeSetgid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= ModeSticky
+	}
+	return mode
+}
+
+// stringBytes returns the bytes of s without copying. They must not be
+// changed.
+func stringBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return (*[1 << 40]byte)(unsafe.Pointer(*(*uintptr)(unsafe.Pointer(&s))))[:len(s):len(s)]
+}
+
+func get16(b string) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+func get32(b string) uint32 {
+	return uint32(get16(b)) | uint32(get16(b[2:]))<<16
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"internal/solo5fs"
+	"sync"
+	"time"
+)
+
+// A diskFS is a persistent file system on a block device, see package
+// internal/solo5fs.
+//
+// Changes to the names in directories are committed to the device right
+// away. Changes to file contents, modes and times are committed with the
+// next change of names, on File.Sync, or on File.Close of any file of the
+// file system.
+//
+// Package solo5fs is not safe for concurrent use, all methods of the nodes
+// hold the lock of the file system.
+type diskFS struct {
+	mu sync.Mutex
+	fs *solo5fs.FS
+}
+
+type diskNode struct {
+	fs *diskFS
+	n  *solo5fs.Inode
+}
+
+func (fs *diskFS) sync() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.fs.Sync()
+}
+
+func (d diskNode) node(n *solo5fs.Inode) diskNode {
+	return diskNode{d.fs, n}
+}
+
+// commit commits the changes of the file system after a change of names.
+func (d diskNode) commit() error {
+	return d.fs.fs.Sync()
+}
+
+func (d diskNode) fsys() fileSystem {
+	return d.fs
+}
+
+func (d diskNode) attr() vattr {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return vattr{
+		ino:     d.n.Ino(),
+		mode:    FileMode(d.n.Mode()),
+		size:    d.n.Size(),
+		nlink:   d.n.Nlink(),
+		modTime: d.n.ModTime(),
+	}
+}
+
+func (d diskNode) chmod(mode FileMode) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	d.n.Chmod(uint32(mode))
+	return nil
+}
+
+func (d diskNode) chtimes(mtime time.Time) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	d.n.SetModTime(mtime)
+	return nil
+}
+
+func (d diskNode) lookup(name string) (vnode, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, err := d.n.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.node(n), nil
+}
+
+func (d diskNode) names() ([]string, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.n.Names(), nil
+}
+
+func (d diskNode) create(name string, mode FileMode) (vnode, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, err := d.n.Create(name, uint32(mode))
+	if err != nil {
+		return nil, err
+	}
+	return d.node(n), d.commit()
+}
+
+func (d diskNode) symlink(name, target string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	_, err := d.n.Symlink(name, target)
+	if err != nil {
+		return err
+	}
+	return d.commit()
+}
+
+func (d diskNode) link(name string, n vnode) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if err := d.n.Link(name, n.(diskNode).n); err != nil {
+		return err
+	}
+	return d.commit()
+}
+
+func (d diskNode) remove(name string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if err := d.n.Remove(name); err != nil {
+		return err
+	}
+	return d.commit()
+}
+
+func (d diskNode) rename(oldname string, newdir vnode, newname string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if err := d.n.Rename(oldname, newdir.(diskNode).n, newname); err != nil {
+		return err
+	}
+	return d.commit()
+}
+
+func (d diskNode) open() {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	d.n.Open()
+}
+
+func (d diskNode) close() {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	d.n.Close()
+	// There is no one to report an error to, a later commit will tell.
+	d.fs.fs.Sync()
+}
+
+func (d diskNode) readAt(b []byte, off int64) (int, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.n.ReadAt(b, off)
+}
+
+func (d diskNode) writeAt(b []byte, off int64) (int, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.n.WriteAt(b, off)
+}
+
+func (d diskNode) appendAt(b []byte) (int, int64, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	nw, err := d.n.WriteAt(b, d.n.Size())
+	return nw, d.n.Size(), err
+}
+
+func (d diskNode) truncate(size int64) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.n.Truncate(size)
+}
+
+func (d diskNode) sync() error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.fs.fs.Sync()
+}
+
+func (d diskNode) readlink() (string, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.n.Readlink()
+}
+
+// mountSolo5fs mounts the solo5fs file system on dev, which has size bytes,
+// on directory dir.
+func mountSolo5fs(dev solo5fs.Device, size int64, dir string) error {
+	fs, err := solo5fs.Mount(dev, size)
+	if err != nil {
+		return err
+	}
+	dfs := &diskFS{fs: fs}
+	return vfsMount(dir, dfs, diskNode{dfs, fs.Root()}, false)
+}
@@ -6,44 +6,36 @@ package os
 
 import (
 	"syscall"
-	"time"
 )
 
-var zeroTime time.Time
-
 // Stat returns the FileInfo structure describing file.
 // If there is an error, it will be of type *PathError.
 func (f *File) Stat() (FileInfo, error) {
 	if f == nil {
 		return nil, ErrInvalid
 	}
-	if f.isFake() {
-		return fakeStat(f.fake.Path)
+	if f.node == nil {
+		return nil, &PathError{"stat", f.name, syscall.ENOSYS}
 	}
-	return nil, syscall.ENOSYS
-}
-
-func fakeStat(path string) (FileInfo, error) {
-	buf, ok := fakeFiles[path]
-	if !ok {
-		return nil, ErrNotExist
-	}
-	st := &fileStat{
-		name:    path,
-		size:    int64(len(buf)),
-		mode:    0,
-		modTime: zeroTime,
-		sys:     syscall.Stat_t{},
-	}
-	return st, nil
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+	return vfsStatNode(f.node, f.name), nil
 }
 
 // statNolog stats a file with no test logging.
 func statNolog(name string) (FileInfo, error) {
-	return fakeStat(name)
+	fs, e := vfsStat(name, true)
+	if e != nil {
+		return nil, &PathError{"stat", name, e}
+	}
+	return fs, nil
 }
 
 // lstatNolog lstats a file with no test logging.
 func lstatNolog(name string) (FileInfo, error) {
-	return fakeStat(name)
+	fs, e := vfsStat(name, false)
+	if e != nil {
+		return nil, &PathError{"lstat", name, e}
+	}
+	return fs, nil
 }
@@ -0,0 +1,43 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os
+
+import (
+	"io"
+)
+
+// Redirection of the standard streams of solo5hvt, see stdio_solo5hvt.go.
+// Also built on linux, so that it is tested on the host.
+
+// stdioFlag returns the flags for opening the file of a redirected standard
+// stream, given the flag of the stream, O_RDONLY or O_WRONLY, and the mode
+// of the file if it exists. Output is appended to a regular file, which is
+// created if needed, and written from the start to a device.
+func stdioFlag(flag int, mode FileMode, exists bool) int {
+	if flag != O_RDONLY && (!exists || mode.IsRegular()) {
+		flag |= O_CREATE | O_APPEND
+	}
+	return flag
+}
+
+// stdioCutAtNUL returns the result of a read of n bytes into b from a
+// device, which ends at the first NUL byte.
+func stdioCutAtNUL(b []byte, n int, err error) (int, error) {
+	if n == 0 {
+		return n, err
+	}
+	for i, c := range b[:n] {
+		if c == 0 {
+			n = i
+			break
+		}
+	}
+	if n == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"syscall"
+)
+
+// Standard output and standard error go to the console, and standard input
+// is empty. At boot, after the block devices are mounted, each can be
+// redirected to a file with environment variables SOLO5_STDIN, SOLO5_STDOUT
+// and SOLO5_STDERR, e.g. SOLO5_STDIN=/dev/input to read the input from block
+// device input, or SOLO5_STDERR=/data/log to append errors to a file on a
+// mounted device. A file that cannot be opened stops the guest.
+//
+// A block device has no length of its own: input from a device ends at the
+// first NUL byte. Output to a device starts at its first byte, output to a
+// regular file is appended, creating the file if needed. Output of the
+// runtime, e.g. of panics, always goes to the console.
+//
+// With SOLO5_STDERR_PREFIX set, standard error on the console is told apart
+// from standard output by the prefix at the start of each line, see
+// syscall.ConsoleWriteErr.
+
+// redirectStdio redirects the standard streams configured in the
+// environment.
+func redirectStdio() {
+	redirect := func(f *File, env string, flag int) {
+		name, ok := syscall.Getenv(env)
+		if !ok {
+			return
+		}
+		if err := redirectFile(f, name, flag); err != nil {
+			panic(&PathError{"redirect " + f.name, name, err})
+		}
+	}
+	redirect(Stdin, "SOLO5_STDIN", O_RDONLY)
+	redirect(Stdout, "SOLO5_STDOUT", O_WRONLY)
+	redirect(Stderr, "SOLO5_STDERR", O_WRONLY)
+}
+
+// redirectFile makes standard stream f read from or write to file name.
+func redirectFile(f *File, name string, flag int) error {
+	if name == "" {
+		return syscall.ENOENT
+	}
+	var mode FileMode
+	fi, err := Stat(name)
+	if err == nil {
+		mode = fi.Mode()
+	}
+	flag = stdioFlag(flag, mode, err == nil)
+	n, err := vfsOpen(name, flag, 0644)
+	if err != nil {
+		return err
+	}
+	dev := n.attr().mode&ModeDevice != 0
+	f.node = n
+	f.flag = flag
+	f.appendMode = flag&O_APPEND != 0
+	f.eofAtNUL = dev && flag == O_RDONLY
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os_test
+
+import (
+	"io"
+	. "os"
+	"testing"
+)
+
+// Tests of the redirection of the standard streams of solo5hvt, which is
+// also built on linux.
+
+func TestStdioFlag(t *testing.T) {
+	tests := []struct {
+		flag   int
+		mode   FileMode
+		exists bool
+		want   int
+	}{
+		{O_RDONLY, 0644, true, O_RDONLY},
+		{O_RDONLY, ModeDevice | 0660, true, O_RDONLY},
+		{O_RDONLY, 0, false, O_RDONLY},
+		{O_WRONLY, 0644, true, O_WRONLY | O_CREATE | O_APPEND},
+		{O_WRONLY, 0, false, O_WRONLY | O_CREATE | O_APPEND},
+		{O_WRONLY, ModeDevice | 0660, true, O_WRONLY},
+		{O_WRONLY, ModeDir | 0755, true, O_WRONLY},
+	}
+	for _, tt := range tests {
+		if got := StdioFlag(tt.flag, tt.mode, tt.exists); got != tt.want {
+			t.Errorf("flag %#x, mode %v, exists %v: got %#x, want %#x", tt.flag, tt.mode, tt.exists, got, tt.want)
+		}
+	}
+}
+
+func TestStdioCutAtNUL(t *testing.T) {
+	tests := []struct {
+		data string
+		n    int
+		err  error
+		want int
+		werr error
+	}{
+		{"hello", 5, nil, 5, nil},
+		{"hel\x00lo", 6, nil, 3, nil},
+		{"hello\x00\x00", 5, nil, 5, nil}, // NUL past the bytes read.
+		{"\x00hello", 6, nil, 0, io.EOF},
+		{"\x00\x00", 2, nil, 0, io.EOF},
+		{"", 0, io.EOF, 0, io.EOF},
+		{"", 0, nil, 0, nil},
+	}
+	for _, tt := range tests {
+		n, err := StdioCutAtNUL([]byte(tt.data), tt.n, tt.err)
+		if n != tt.want || err != tt.werr {
+			t.Errorf("%q, %d, %v: got %d, %v, want %d, %v", tt.data, tt.n, tt.err, n, err, tt.want, tt.werr)
+		}
+	}
+}
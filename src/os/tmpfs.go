@@ -0,0 +1,329 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The root file system of a solo5hvt guest lives in memory, as a tree of
+// tmpNodes. It starts out with the root directory, /tmp, the tree embedded
+// with -solo5rootfs (see rootfs_solo5hvt.go), and the files registered with
+// AddFile, and is lost when the guest exits.
+//
+// The guest runs as root, so permissions are kept and reported, but not
+// enforced.
+//
+// The entries of directories, the parents of directories and the targets of
+// symbolic links are protected by vfs.mu. The attributes and data of a
+// node, which open files use without vfs.mu, by the node's mu.
+
+type tmpFS struct {
+	root    *tmpNode
+	lastIno uint64
+}
+
+type tmpNode struct {
+	fs  *tmpFS
+	ino uint64
+
+	mu      sync.Mutex
+	mode    FileMode
+	modTime time.Time
+	nlink   int    // number of directory entries for the node
+	data    []byte // contents of a regular file
+	static  bool   // data is read-only, copied on change
+
+	target  string              // destination of a symbolic link
+	entries map[string]*tmpNode // entries of a directory
+	parent  *tmpNode            // directory containing a directory
+}
+
+// tmpfs is the root file system.
+var tmpfs *tmpFS
+
+func newTmpFS() *tmpFS {
+	fs := &tmpFS{}
+	fs.root = fs.newNode(ModeDir | 0755)
+	fs.root.parent = fs.root
+	fs.root.nlink = 1
+	fs.root.linkNode("tmp", fs.newNode(ModeDir|ModeSticky|0777))
+	return fs
+}
+
+func (fs *tmpFS) sync() error {
+	return nil
+}
+
+func (fs *tmpFS) newNode(mode FileMode) *tmpNode {
+	fs.lastIno++
+	n := &tmpNode{
+		fs:      fs,
+		ino:     fs.lastIno,
+		mode:    mode,
+		modTime: time.Now(),
+	}
+	if mode.IsDir() {
+		n.entries = map[string]*tmpNode{}
+	}
+	return n
+}
+
+// linkNode adds c to directory n under name.
+func (n *tmpNode) linkNode(name string, c *tmpNode) {
+	n.entries[name] = c
+	n.touch()
+	c.mu.Lock()
+	c.nlink++
+	c.mu.Unlock()
+	if c.isDir() {
+		c.parent = n
+	}
+}
+
+// unlinkNode removes name from directory n.
+func (n *tmpNode) unlinkNode(name string) {
+	c := n.entries[name]
+	delete(n.entries, name)
+	n.touch()
+	c.mu.Lock()
+	c.nlink--
+	c.mu.Unlock()
+}
+
+// isDir reports whether n is a directory. The type of a node does not
+// change, so unlike the mode it needs no lock.
+func (n *tmpNode) isDir() bool {
+	return n.entries != nil
+}
+
+// touch sets the modification time of n to now.
+func (n *tmpNode) touch() {
+	n.mu.Lock()
+	n.modTime = time.Now()
+	n.mu.Unlock()
+}
+
+func (n *tmpNode) fsys() fileSystem {
+	return n.fs
+}
+
+func (n *tmpNode) attr() vattr {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	a := vattr{
+		ino:     n.ino,
+		mode:    n.mode,
+		nlink:   n.nlink,
+		modTime: n.modTime,
+	}
+	switch {
+	case n.mode.IsRegular():
+		a.size = int64(len(n.data))
+	case n.mode&ModeSymlink != 0:
+		a.size = int64(len(n.target))
+	}
+	return a
+}
+
+func (n *tmpNode) chmod(mode FileMode) error {
+	const bits = ModePerm | ModeSetuid | ModeSetgid | ModeSticky
+	n.mu.Lock()
+	n.mode = n.mode&^bits | mode&bits
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *tmpNode) chtimes(mtime time.Time) error {
+	n.mu.Lock()
+	n.modTime = mtime
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *tmpNode) lookup(name string) (vnode, error) {
+	switch name {
+	case ".":
+		return n, nil
+	case "..":
+		return n.parent, nil
+	}
+	c, ok := n.entries[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return c, nil
+}
+
+// names returns the sorted names of the entries of directory n.
+func (n *tmpNode) names() ([]string, error) {
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (n *tmpNode) create(name string, mode FileMode) (vnode, error) {
+	if _, ok := n.entries[name]; ok {
+		return nil, syscall.EEXIST
+	}
+	c := n.fs.newNode(mode)
+	n.linkNode(name, c)
+	return c, nil
+}
+
+func (n *tmpNode) symlink(name, target string) error {
+	if _, ok := n.entries[name]; ok {
+		return syscall.EEXIST
+	}
+	c := n.fs.newNode(ModeSymlink | 0777)
+	c.target = target
+	n.linkNode(name, c)
+	return nil
+}
+
+func (n *tmpNode) link(name string, c vnode) error {
+	if _, ok := n.entries[name]; ok {
+		return syscall.EEXIST
+	}
+	n.linkNode(name, c.(*tmpNode))
+	return nil
+}
+
+func (n *tmpNode) remove(name string) error {
+	c, ok := n.entries[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if c.isDir() && len(c.entries) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	n.unlinkNode(name)
+	return nil
+}
+
+func (n *tmpNode) rename(oldname string, newdir vnode, newname string) error {
+	c, ok := n.entries[oldname]
+	if !ok {
+		return syscall.ENOENT
+	}
+	ndir := newdir.(*tmpNode)
+	old, exists := ndir.entries[newname]
+	if exists {
+		if old == c {
+			return nil
+		}
+		if old.isDir() {
+			return syscall.EEXIST
+		}
+		if c.isDir() {
+			return syscall.ENOTDIR
+		}
+	}
+	if c.isDir() {
+		for d := ndir; d != n.fs.root; d = d.parent {
+			if d == c {
+				// Cannot move a directory into itself.
+				return syscall.EINVAL
+			}
+		}
+	}
+	if exists {
+		ndir.unlinkNode(newname)
+	}
+	n.unlinkNode(oldname)
+	ndir.linkNode(newname, c)
+	return nil
+}
+
+func (n *tmpNode) open()  {}
+func (n *tmpNode) close() {}
+
+func (n *tmpNode) readAt(b []byte, off int64) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if off >= int64(len(n.data)) {
+		return 0, io.EOF
+	}
+	return copy(b, n.data[off:]), nil
+}
+
+func (n *tmpNode) writeAt(b []byte, off int64) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.writeAtLocked(b, off)
+}
+
+func (n *tmpNode) appendAt(b []byte) (int, int64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	nw, err := n.writeAtLocked(b, int64(len(n.data)))
+	return nw, int64(len(n.data)), err
+}
+
+// writeAtLocked writes to regular file n at offset off, growing it as
+// needed. n.mu must be held.
+func (n *tmpNode) writeAtLocked(b []byte, off int64) (int, error) {
+	end := off + int64(len(b))
+	if end < off || int64(int(end)) != end {
+		return 0, syscall.EFBIG
+	}
+	if end > int64(len(n.data)) {
+		n.truncateLocked(end)
+	}
+	n.own()
+	copy(n.data[off:], b)
+	n.modTime = time.Now()
+	return len(b), nil
+}
+
+func (n *tmpNode) truncate(size int64) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.truncateLocked(size)
+}
+
+// truncateLocked changes the size of regular file n. New data reads as
+// zeros. n.mu must be held.
+func (n *tmpNode) truncateLocked(size int64) error {
+	if int64(int(size)) != size {
+		return syscall.EFBIG
+	}
+	n.own()
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.modTime = time.Now()
+	return nil
+}
+
+// own makes the data of regular file n writable. n.mu must be held.
+func (n *tmpNode) own() {
+	if n.static {
+		n.data = append([]byte(nil), n.data...)
+		n.static = false
+	}
+}
+
+func (n *tmpNode) sync() error {
+	return nil
+}
+
+func (n *tmpNode) readlink() (string, error) {
+	return n.target, nil
+}
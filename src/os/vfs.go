@@ -0,0 +1,640 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os
+
+import (
+	"io"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The file tree of a solo5hvt guest is made of mounted file systems. The
+// root is an in-memory tmpfs, see tmpfs.go. The block devices are in /dev,
+// see devfs_solo5hvt.go. Other file systems are mounted on directories at
+// boot, see mount_solo5hvt.go. This file and tmpfs.go are also built on
+// linux, so that they are tested on the host.
+//
+// Names are resolved here, one element at a time, following symbolic links
+// and crossing mount points. File systems only see single names within a
+// directory. Errors are syscall.Errno values, the callers wrap them in a
+// PathError or LinkError.
+//
+// The names in the tree are protected by vfs.mu, held for writing while
+// they change and for reading while they are resolved. The data and
+// attributes of nodes are not, so that I/O on one file does not hold up the
+// rest of the tree: open files call attr, chmod, chtimes, readAt, writeAt,
+// appendAt, truncate and sync without vfs.mu, and file systems synchronize
+// these themselves.
+
+// A fileSystem is a mounted file system.
+type fileSystem interface {
+	// sync writes all changes to stable storage.
+	sync() error
+}
+
+// A vnode is a file, directory or symbolic link in a file system. Only the
+// methods for its type are called.
+type vnode interface {
+	fsys() fileSystem
+	attr() vattr
+	chmod(mode FileMode) error
+	chtimes(mtime time.Time) error
+
+	// For directories. Names are single elements, not "." or "..",
+	// except that lookup returns the parent for "..".
+	lookup(name string) (vnode, error)
+	names() ([]string, error)
+	create(name string, mode FileMode) (vnode, error) // Regular file or directory.
+	symlink(name, target string) error
+	link(name string, n vnode) error
+	remove(name string) error
+	rename(oldname string, newdir vnode, newname string) error
+
+	// For regular files. Data of a removed file stays readable until the
+	// last close.
+	open()
+	close()
+	readAt(b []byte, off int64) (int, error)
+	writeAt(b []byte, off int64) (int, error)
+	appendAt(b []byte) (n int, end int64, err error) // Writes at the end, returns the new end.
+	truncate(size int64) error
+	sync() error
+
+	// For symbolic links.
+	readlink() (string, error)
+}
+
+type vattr struct {
+	ino     uint64
+	mode    FileMode
+	size    int64
+	nlink   int
+	modTime time.Time
+}
+
+type mount struct {
+	fs       fileSystem
+	root     vnode
+	covered  vnode // Directory fs is mounted on, nil for the root.
+	dev      uint64
+	readOnly bool
+}
+
+var vfs struct {
+	mu     sync.RWMutex
+	root   vnode
+	cwd    vnode
+	mounts []*mount
+}
+
+// vfsMaxSymlinks is the number of symbolic links followed while resolving
+// a name before giving up with ELOOP, as on Linux.
+const vfsMaxSymlinks = 40
+
+// vfsInit makes fs, with root directory root, the root file system.
+func vfsInit(fs fileSystem, root vnode) {
+	vfs.root = root
+	vfs.cwd = root
+	vfs.mounts = []*mount{{fs: fs, root: root, dev: 1}}
+}
+
+func sameNode(a, b vnode) bool {
+	return a.fsys() == b.fsys() && a.attr().ino == b.attr().ino
+}
+
+// vfsMountOf returns the mount of the file system of n.
+func vfsMountOf(n vnode) *mount {
+	fs := n.fsys()
+	for _, m := range vfs.mounts {
+		if m.fs == fs {
+			return m
+		}
+	}
+	panic("os: vnode of unmounted file system")
+}
+
+// vfsMountedOn returns the mount on directory n, or nil.
+func vfsMountedOn(n vnode) *mount {
+	for _, m := range vfs.mounts {
+		if m.covered != nil && sameNode(m.covered, n) {
+			return m
+		}
+	}
+	return nil
+}
+
+// vfsMount mounts fs with root directory root on directory dir. Files of a
+// read-only mount cannot be opened for writing.
+func vfsMount(dir string, fs fileSystem, root vnode, readOnly bool) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	n, err := vfsWalk(dir, true)
+	if err != nil {
+		return err
+	}
+	if !n.attr().mode.IsDir() {
+		return syscall.ENOTDIR
+	}
+	if vfsMountedOn(n) != nil || sameNode(n, vfs.root) {
+		return syscall.EBUSY
+	}
+	m := &mount{
+		fs:       fs,
+		root:     root,
+		covered:  n,
+		dev:      uint64(len(vfs.mounts)) + 1,
+		readOnly: readOnly,
+	}
+	vfs.mounts = append(vfs.mounts, m)
+	return nil
+}
+
+// vfsWalk returns the node for name. Relative names start at the working
+// directory. Symbolic links are followed, except in the last element of
+// name if follow is false.
+func vfsWalk(name string, follow bool) (vnode, error) {
+	links := 0
+	return vfsWalkFrom(vfs.cwd, name, follow, &links)
+}
+
+func vfsWalkFrom(n vnode, name string, follow bool, links *int) (vnode, error) {
+	if name == "" {
+		return nil, syscall.ENOENT
+	}
+	if name[0] == '/' {
+		n = vfs.root
+	}
+	if name[len(name)-1] == '/' {
+		// The last element must be a directory, also when it is a
+		// symbolic link.
+		name += "."
+	}
+	for name != "" {
+		elem := name
+		name = ""
+		for i := 0; i < len(elem); i++ {
+			if elem[i] == '/' {
+				elem, name = elem[:i], elem[i+1:]
+				break
+			}
+		}
+
+		if !n.attr().mode.IsDir() {
+			return nil, syscall.ENOTDIR
+		}
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if m := vfsMountOf(n); m.covered != nil && sameNode(n, m.root) {
+				n = m.covered
+			}
+		}
+		c, err := n.lookup(elem)
+		if err != nil {
+			return nil, err
+		}
+		if m := vfsMountedOn(c); m != nil {
+			c = m.root
+		}
+		if c.attr().mode&ModeSymlink != 0 && (follow || name != "") {
+			*links++
+			if *links > vfsMaxSymlinks {
+				return nil, syscall.ELOOP
+			}
+			target, err := c.readlink()
+			if err != nil {
+				return nil, err
+			}
+			c, err = vfsWalkFrom(n, target, true, links)
+			if err != nil {
+				return nil, err
+			}
+		}
+		n = c
+	}
+	return n, nil
+}
+
+// vfsWalkParent returns the directory containing name, and the last element
+// of name. Trailing slashes in name are ignored.
+func vfsWalkParent(name string) (dir vnode, base string, err error) {
+	i := len(name)
+	for i > 1 && name[i-1] == '/' {
+		i--
+	}
+	name = name[:i]
+	if name == "" {
+		return nil, "", syscall.ENOENT
+	}
+
+	dirname := "."
+	base = name
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '/' {
+			dirname, base = name[:i], name[i+1:]
+			if dirname == "" {
+				dirname = "/"
+			}
+			if base == "" {
+				base = "."
+			}
+			break
+		}
+	}
+	dir, err = vfsWalk(dirname, true)
+	if err != nil {
+		return nil, "", err
+	}
+	a := dir.attr()
+	if !a.mode.IsDir() {
+		return nil, "", syscall.ENOTDIR
+	}
+	if a.nlink == 0 {
+		// Removed, but still the working directory.
+		return nil, "", syscall.ENOENT
+	}
+	return dir, base, nil
+}
+
+func isDotOrDotDot(name string) bool {
+	return name == "." || name == ".."
+}
+
+// vfsLookupEntry returns the entry base of dir, without following a
+// symbolic link or crossing a mount point.
+func vfsLookupEntry(dir vnode, base string) (vnode, error) {
+	if isDotOrDotDot(base) {
+		return nil, syscall.EINVAL
+	}
+	return dir.lookup(base)
+}
+
+// vfsBusy reports whether n is the root or a mount point.
+func vfsBusy(n vnode) bool {
+	return sameNode(n, vfs.root) || vfsMountedOn(n) != nil
+}
+
+// vfsCreateMode returns the mode for a new node with permissions perm,
+// after applying the umask.
+func vfsCreateMode(typ, perm FileMode) FileMode {
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	perm &= ModePerm | ModeSetuid | ModeSetgid | ModeSticky
+	return typ | perm&^FileMode(umask&0777)
+}
+
+func vfsOpen(name string, flag int, perm FileMode) (vnode, error) {
+	if flag&O_CREATE != 0 {
+		vfs.mu.Lock()
+		defer vfs.mu.Unlock()
+	} else {
+		vfs.mu.RLock()
+		defer vfs.mu.RUnlock()
+	}
+
+	n, err := vfsWalk(name, true)
+	if err == syscall.ENOENT && flag&O_CREATE != 0 {
+		dir, base, err := vfsWalkParent(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := vfsLookupEntry(dir, base); err == nil {
+			// A dangling symbolic link.
+			if flag&O_EXCL != 0 {
+				return nil, syscall.EEXIST
+			}
+			return nil, syscall.ENOENT
+		}
+		if name[len(name)-1] == '/' {
+			return nil, syscall.EISDIR
+		}
+		n, err = dir.create(base, vfsCreateMode(0, perm))
+		if err != nil {
+			return nil, err
+		}
+		n.open()
+		return n, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if flag&O_CREATE != 0 && flag&O_EXCL != 0 {
+		return nil, syscall.EEXIST
+	}
+	writable := flag&(O_WRONLY|O_RDWR) != 0
+	if n.attr().mode.IsDir() {
+		if writable || flag&O_TRUNC != 0 {
+			return nil, syscall.EISDIR
+		}
+		return n, nil
+	}
+	if writable && vfsMountOf(n).readOnly {
+		return nil, syscall.EROFS
+	}
+	if writable && flag&O_TRUNC != 0 && n.attr().mode.IsRegular() {
+		if err := n.truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	n.open()
+	return n, nil
+}
+
+// vfsSeek returns the offset of an open file of n after a seek to offset
+// relative to whence, from the current offset cur.
+func vfsSeek(n vnode, cur, offset int64, whence int) (int64, error) {
+	var ret int64
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = cur + offset
+	case io.SeekEnd:
+		ret = n.attr().size + offset
+	default:
+		return 0, syscall.EINVAL
+	}
+	if ret < 0 {
+		return 0, syscall.EINVAL
+	}
+	return ret, nil
+}
+
+// vfsNextNames returns the next n names of the directory listing names,
+// from *pos on, and advances *pos, as File.Readdirnames does.
+func vfsNextNames(names []string, pos *int, n int) ([]string, error) {
+	names = names[*pos:]
+	if n > 0 {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(names) {
+			names = names[:n]
+		}
+	}
+	*pos += len(names)
+	return names[:len(names):len(names)], nil
+}
+
+// vfsClose ends the use of n by an open file.
+func vfsClose(n vnode) {
+	if !n.attr().mode.IsDir() {
+		n.close()
+	}
+}
+
+func vfsMkdir(name string, perm FileMode) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	dir, base, err := vfsWalkParent(name)
+	if err != nil {
+		return err
+	}
+	if isDotOrDotDot(base) {
+		return syscall.EEXIST
+	}
+	_, err = dir.create(base, vfsCreateMode(ModeDir, perm))
+	return err
+}
+
+func vfsRemove(name string) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	dir, base, err := vfsWalkParent(name)
+	if err != nil {
+		return err
+	}
+	n, err := vfsLookupEntry(dir, base)
+	if err != nil {
+		return err
+	}
+	if vfsBusy(n) {
+		return syscall.EBUSY
+	}
+	return dir.remove(base)
+}
+
+func vfsRename(oldname, newname string) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	odir, obase, err := vfsWalkParent(oldname)
+	if err != nil {
+		return err
+	}
+	n, err := vfsLookupEntry(odir, obase)
+	if err != nil {
+		return err
+	}
+	ndir, nbase, err := vfsWalkParent(newname)
+	if err != nil {
+		return err
+	}
+	if isDotOrDotDot(nbase) {
+		return syscall.EINVAL
+	}
+	if vfsBusy(n) {
+		return syscall.EBUSY
+	}
+	if old, err := vfsLookupEntry(ndir, nbase); err == nil {
+		if sameNode(old, n) {
+			return nil
+		}
+		if old.attr().mode.IsDir() {
+			// Like rename on Unix, see file_unix.go.
+			return syscall.EEXIST
+		}
+	}
+	if odir.fsys() != ndir.fsys() {
+		return syscall.EXDEV
+	}
+	return odir.rename(obase, ndir, nbase)
+}
+
+func vfsLink(oldname, newname string) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	n, err := vfsWalk(oldname, false)
+	if err != nil {
+		return err
+	}
+	if n.attr().mode.IsDir() {
+		return syscall.EPERM
+	}
+	dir, base, err := vfsWalkParent(newname)
+	if err != nil {
+		return err
+	}
+	if isDotOrDotDot(base) {
+		return syscall.EEXIST
+	}
+	if n.fsys() != dir.fsys() {
+		return syscall.EXDEV
+	}
+	return dir.link(base, n)
+}
+
+func vfsSymlink(oldname, newname string) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	dir, base, err := vfsWalkParent(newname)
+	if err != nil {
+		return err
+	}
+	if isDotOrDotDot(base) {
+		return syscall.EEXIST
+	}
+	return dir.symlink(base, oldname)
+}
+
+func vfsReadlink(name string) (string, error) {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	n, err := vfsWalk(name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.attr().mode&ModeSymlink == 0 {
+		return "", syscall.EINVAL
+	}
+	return n.readlink()
+}
+
+func vfsTruncate(name string, size int64) error {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	n, err := vfsWalk(name, true)
+	if err != nil {
+		return err
+	}
+	if n.attr().mode.IsDir() {
+		return syscall.EISDIR
+	}
+	if size < 0 {
+		return syscall.EINVAL
+	}
+	return n.truncate(size)
+}
+
+func vfsChmod(name string, mode FileMode) error {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	n, err := vfsWalk(name, true)
+	if err != nil {
+		return err
+	}
+	return n.chmod(mode)
+}
+
+func vfsChtimes(name string, mtime time.Time) error {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	n, err := vfsWalk(name, true)
+	if err != nil {
+		return err
+	}
+	return n.chtimes(mtime)
+}
+
+// vfsExists returns nil if name exists.
+func vfsExists(name string, follow bool) error {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	_, err := vfsWalk(name, follow)
+	return err
+}
+
+// vfsChdirName changes the working directory to directory name.
+func vfsChdirName(name string) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	n, err := vfsWalk(name, true)
+	if err != nil {
+		return err
+	}
+	return vfsChdir(n)
+}
+
+// vfsChdir changes the working directory to n. vfs.mu must be held for
+// writing.
+func vfsChdir(n vnode) error {
+	if !n.attr().mode.IsDir() {
+		return syscall.ENOTDIR
+	}
+	vfs.cwd = n
+	return nil
+}
+
+// vfsGetwd returns the absolute name of the working directory.
+func vfsGetwd() (string, error) {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	dir := ""
+	n := vfs.cwd
+	for !sameNode(n, vfs.root) {
+		if n.attr().nlink == 0 {
+			return "", syscall.ENOENT
+		}
+		if m := vfsMountOf(n); m.covered != nil && sameNode(n, m.root) {
+			n = m.covered
+			continue
+		}
+		parent, err := n.lookup("..")
+		if err != nil {
+			return "", err
+		}
+		names, err := parent.names()
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, name := range names {
+			if c, err := parent.lookup(name); err == nil && sameNode(c, n) {
+				dir = "/" + name + dir
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", syscall.ENOENT
+		}
+		n = parent
+	}
+	if dir == "" {
+		dir = "/"
+	}
+	return dir, nil
+}
+
+// vfsSync writes the changes of all file systems to stable storage.
+func vfsSync() error {
+	vfs.mu.RLock()
+	mounts := vfs.mounts
+	vfs.mu.RUnlock()
+
+	var err error
+	for _, m := range mounts {
+		if e := m.fs.sync(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"syscall"
+)
+
+func init() {
+	tmpfs = newTmpFS()
+	vfsInit(tmpfs, tmpfs.root)
+	if err := loadRootfs(); err != nil {
+		panic(err)
+	}
+	if err := mountDevFS(); err != nil {
+		panic(&PathError{"mount", "/dev", err})
+	}
+	mountDevices()
+	redirectStdio()
+}
+
+// vfsStatNode returns the FileInfo of n. vfs.mu must be held.
+func vfsStatNode(n vnode, name string) *fileStat {
+	a := n.attr()
+	mode := syscallMode(a.mode)
+	switch {
+	case a.mode.IsDir():
+		mode |= syscall.S_IFDIR
+	case a.mode&ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	case a.mode&ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	mtime := a.modTime.UnixNano()
+	return &fileStat{
+		name:    basename(name),
+		size:    a.size,
+		mode:    a.mode,
+		modTime: a.modTime,
+		sys: syscall.Stat_t{
+			Dev:       int64(vfsMountOf(n).dev),
+			Ino:       a.ino,
+			Mode:      mode,
+			Nlink:     uint32(a.nlink),
+			Size:      a.size,
+			Blksize:   blockSize,
+			Blocks:    int32((a.size + 511) / 512),
+			Mtime:     mtime / 1e9,
+			MtimeNsec: mtime % 1e9,
+		},
+	}
+}
+
+func vfsStat(name string, follow bool) (*fileStat, error) {
+	vfs.mu.RLock()
+	defer vfs.mu.RUnlock()
+
+	n, err := vfsWalk(name, follow)
+	if err != nil {
+		return nil, err
+	}
+	return vfsStatNode(n, name), nil
+}
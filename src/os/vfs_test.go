@@ -0,0 +1,359 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package os_test
+
+import (
+	"io"
+	. "os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// Tests of the file system of solo5hvt, which is also built on linux.
+
+func vfsCreate(t *testing.T, name, data string) {
+	t.Helper()
+	n, err := VFSOpen(name, O_RDWR|O_CREATE|O_EXCL, 0644)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	defer n.Close()
+	if _, err := n.WriteAt([]byte(data), 0); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestVFSOps(t *testing.T) {
+	defer SetTestVFS()()
+	if err := VFSMkdir("/a", 0755); err != nil {
+		t.Fatal(err)
+	}
+	vfsCreate(t, "/a/f", "hello")
+	vfsCreate(t, "/a/k", "k")
+	vfsCreate(t, "/mnt/g", "world")
+
+	tests := []struct {
+		name string
+		fn   func() error
+		err  error
+	}{
+		{"mkdir", func() error { return VFSMkdir("/a/d", 0755) }, nil},
+		{"mkdir exists", func() error { return VFSMkdir("/a/d", 0755) }, syscall.EEXIST},
+		{"mkdir dot", func() error { return VFSMkdir("/a/.", 0755) }, syscall.EEXIST},
+		{"mkdir missing parent", func() error { return VFSMkdir("/a/x/y", 0755) }, syscall.ENOENT},
+		{"mkdir in file", func() error { return VFSMkdir("/a/f/y", 0755) }, syscall.ENOTDIR},
+		{"mkdir trailing slash", func() error { return VFSMkdir("/a/e/", 0755) }, nil},
+
+		{"symlink", func() error { return VFSSymlink("f", "/a/l") }, nil},
+		{"symlink exists", func() error { return VFSSymlink("x", "/a/l") }, syscall.EEXIST},
+		{"symlink loop", func() error { return VFSSymlink("l2", "/a/l1") }, nil},
+		{"symlink loop back", func() error { return VFSSymlink("l1", "/a/l2") }, nil},
+		{"truncate loop", func() error { return VFSTruncate("/a/l1", 0) }, syscall.ELOOP},
+		{"mkdir dangling", func() error { return VFSMkdir("/a/l1/x", 0755) }, syscall.ELOOP},
+
+		{"link", func() error { return VFSLink("/a/f", "/a/h") }, nil},
+		{"link exists", func() error { return VFSLink("/a/f", "/a/h") }, syscall.EEXIST},
+		{"link directory", func() error { return VFSLink("/a/d", "/a/d2") }, syscall.EPERM},
+		{"link across mounts", func() error { return VFSLink("/a/f", "/mnt/f") }, syscall.EXDEV},
+		{"link missing", func() error { return VFSLink("/a/nope", "/a/n") }, syscall.ENOENT},
+
+		{"rename", func() error { return VFSRename("/a/h", "/a/h2") }, nil},
+		{"rename onto same file", func() error { return VFSRename("/a/h2", "/a/f") }, nil}, // Does nothing.
+		{"rename onto file", func() error { return VFSRename("/a/k", "/a/h2") }, nil},
+		{"rename onto directory", func() error { return VFSRename("/a/f", "/a/d") }, syscall.EEXIST},
+		{"rename directory onto file", func() error { return VFSRename("/a/e", "/a/f") }, syscall.ENOTDIR},
+		{"rename into itself", func() error { return VFSRename("/a", "/a/d/a") }, syscall.EINVAL},
+		{"rename across mounts", func() error { return VFSRename("/mnt/g", "/a/g") }, syscall.EXDEV},
+		{"rename mount point", func() error { return VFSRename("/mnt", "/m") }, syscall.EBUSY},
+		{"rename missing", func() error { return VFSRename("/a/nope", "/a/n") }, syscall.ENOENT},
+		{"rename to dot", func() error { return VFSRename("/a/f", "/a/.") }, syscall.EINVAL},
+
+		{"truncate", func() error { return VFSTruncate("/a/l", 2) }, nil},
+		{"truncate grow", func() error { return VFSTruncate("/mnt/g", 8) }, nil},
+		{"truncate directory", func() error { return VFSTruncate("/a", 0) }, syscall.EISDIR},
+		{"truncate negative", func() error { return VFSTruncate("/a/f", -1) }, syscall.EINVAL},
+
+		{"remove not empty", func() error { return VFSRemove("/a") }, syscall.ENOTEMPTY},
+		{"remove mount point", func() error { return VFSRemove("/mnt") }, syscall.EBUSY},
+		{"remove root", func() error { return VFSRemove("/") }, syscall.EINVAL},
+		{"remove dot", func() error { return VFSRemove("/a/.") }, syscall.EINVAL},
+		{"remove directory", func() error { return VFSRemove("/a/e") }, nil},
+		{"remove symlink", func() error { return VFSRemove("/a/l1") }, nil},
+		{"remove missing", func() error { return VFSRemove("/a/l1") }, syscall.ENOENT},
+		{"remove link", func() error { return VFSRemove("/a/h2") }, nil},
+	}
+	for _, tt := range tests {
+		if err := tt.fn(); err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	attrs := []struct {
+		name   string
+		follow bool
+		mode   FileMode
+		size   int64
+		nlink  int
+		err    error
+	}{
+		{"/a", true, ModeDir | 0755, 0, 1, nil},
+		{"/a/f", true, 0644, 2, 1, nil},
+		{"/a/l", true, 0644, 2, 1, nil},
+		{"/a/l", false, ModeSymlink | 0777, 1, 1, nil},
+		{"/a/h", true, 0, 0, 0, syscall.ENOENT},
+		{"/a/h2", true, 0, 0, 0, syscall.ENOENT},
+		{"/a/k", true, 0, 0, 0, syscall.ENOENT},
+		{"/a/e", true, 0, 0, 0, syscall.ENOENT},
+		{"/a/f/", true, 0, 0, 0, syscall.ENOTDIR},
+		{"/a/d/../f", true, 0644, 2, 1, nil},
+		{"/mnt/../a/f", true, 0644, 2, 1, nil},
+		{"/mnt/g", true, 0644, 8, 1, nil},
+	}
+	for _, tt := range attrs {
+		mode, size, nlink, err := VFSAttr(tt.name, tt.follow)
+		if err != tt.err {
+			t.Errorf("attr %s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if mode&^ModePerm != tt.mode&^ModePerm || size != tt.size || nlink != tt.nlink {
+			t.Errorf("attr %s: got mode %v, size %d, nlink %d, want %v, %d, %d", tt.name, mode, size, nlink, tt.mode, tt.size, tt.nlink)
+		}
+	}
+
+	if s, err := VFSReadlink("/a/l"); err != nil || s != "f" {
+		t.Errorf(`readlink /a/l: got %q, %v, want "f", nil`, s, err)
+	}
+	if _, err := VFSReadlink("/a/f"); err != syscall.EINVAL {
+		t.Errorf("readlink /a/f: got error %v, want EINVAL", err)
+	}
+
+	n, err := VFSOpen("/a/f", O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	b := make([]byte, 10)
+	if m, err := n.ReadAt(b, 0); m != 2 || string(b[:m]) != "he" || err != nil {
+		t.Errorf("read /a/f: got %d, %q, %v, want 2, \"he\", nil", m, b[:m], err)
+	}
+	if _, err := n.ReadAt(b, 2); err != io.EOF {
+		t.Errorf("read /a/f at end: got error %v, want EOF", err)
+	}
+}
+
+func TestVFSOpen(t *testing.T) {
+	defer SetTestVFS()()
+	vfsCreate(t, "/tmp/f", "data")
+	if err := VFSSymlink("missing", "/tmp/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VFSSymlink("/tmp/f", "/tmp/l"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		flag int
+		err  error
+		size int64
+	}{
+		{"/tmp/f", O_RDONLY, nil, 4},
+		{"/tmp/l", O_RDONLY, nil, 4},
+		{"/tmp/f", O_CREATE | O_EXCL | O_WRONLY, syscall.EEXIST, 0},
+		{"/tmp/missing", O_RDONLY, syscall.ENOENT, 0},
+		{"/tmp/dangling", O_CREATE | O_WRONLY, syscall.ENOENT, 0},
+		{"/tmp/dangling", O_CREATE | O_EXCL | O_WRONLY, syscall.EEXIST, 0},
+		{"/tmp/new/", O_CREATE | O_WRONLY, syscall.EISDIR, 0},
+		{"/tmp", O_WRONLY, syscall.EISDIR, 0},
+		{"/tmp", O_RDONLY, nil, 0},
+		{"/tmp/l", O_WRONLY | O_TRUNC, nil, 0},
+		{"/tmp/new", O_CREATE | O_WRONLY, nil, 0},
+	}
+	for _, tt := range tests {
+		n, err := VFSOpen(tt.name, tt.flag, 0644)
+		if err != tt.err {
+			t.Errorf("open %s, %#x: got error %v, want %v", tt.name, tt.flag, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if size := n.Size(); size != tt.size {
+			t.Errorf("open %s, %#x: got size %d, want %d", tt.name, tt.flag, size, tt.size)
+		}
+		n.Close()
+	}
+}
+
+func TestVFSSeek(t *testing.T) {
+	defer SetTestVFS()()
+	vfsCreate(t, "/tmp/f", "0123456789")
+	n, err := VFSOpen("/tmp/f", O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	tests := []struct {
+		cur, off int64
+		whence   int
+		ret      int64
+		err      error
+	}{
+		{0, 5, io.SeekStart, 5, nil},
+		{3, 5, io.SeekStart, 5, nil},
+		{3, 5, io.SeekCurrent, 8, nil},
+		{3, -3, io.SeekCurrent, 0, nil},
+		{3, -4, io.SeekCurrent, 0, syscall.EINVAL},
+		{0, 0, io.SeekEnd, 10, nil},
+		{0, -10, io.SeekEnd, 0, nil},
+		{0, 5, io.SeekEnd, 15, nil},
+		{0, -11, io.SeekEnd, 0, syscall.EINVAL},
+		{0, -1, io.SeekStart, 0, syscall.EINVAL},
+		{0, 0, 3, 0, syscall.EINVAL},
+	}
+	for _, tt := range tests {
+		ret, err := n.SeekFrom(tt.cur, tt.off, tt.whence)
+		if ret != tt.ret || err != tt.err {
+			t.Errorf("seek %d from %d, whence %d: got %d, %v, want %d, %v", tt.off, tt.cur, tt.whence, ret, err, tt.ret, tt.err)
+		}
+	}
+}
+
+func TestVFSReaddir(t *testing.T) {
+	defer SetTestVFS()()
+	for _, name := range []string{"c", "a", "b"} {
+		vfsCreate(t, "/tmp/"+name, "")
+	}
+	if err := VFSMkdir("/tmp/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	n, err := VFSOpen("/tmp", O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	names, err := n.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("names: got %q, want %q", names, want)
+	}
+
+	tests := []struct {
+		pos, n int
+		names  []string
+		err    error
+	}{
+		{0, -1, []string{"a", "b", "c", "d"}, nil},
+		{0, 0, []string{"a", "b", "c", "d"}, nil},
+		{0, 3, []string{"a", "b", "c"}, nil},
+		{3, 3, []string{"d"}, nil},
+		{4, 3, nil, io.EOF},
+		{4, 0, []string{}, nil},
+	}
+	for _, tt := range tests {
+		pos := tt.pos
+		got, err := VFSNextNames(names, &pos, tt.n)
+		if !reflect.DeepEqual(got, tt.names) || err != tt.err {
+			t.Errorf("next %d names from %d: got %q, %v, want %q, %v", tt.n, tt.pos, got, err, tt.names, tt.err)
+		}
+		if want := tt.pos + len(tt.names); pos != want {
+			t.Errorf("next %d names from %d: got position %d, want %d", tt.n, tt.pos, pos, want)
+		}
+	}
+}
+
+func TestVFSGetwd(t *testing.T) {
+	defer SetTestVFS()()
+	if err := VFSMkdir("/mnt/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, wd string
+	}{
+		{"/", "/"},
+		{"/tmp", "/tmp"},
+		{"/mnt/d", "/mnt/d"},
+		{"..", "/mnt"},
+		{"..", "/"},
+	}
+	for _, tt := range tests {
+		if err := VFSChdir(tt.dir); err != nil {
+			t.Fatalf("chdir %s: %v", tt.dir, err)
+		}
+		if wd, err := VFSGetwd(); wd != tt.wd || err != nil {
+			t.Errorf("chdir %s: got wd %q, %v, want %q", tt.dir, wd, err, tt.wd)
+		}
+	}
+	if err := VFSChdir("/mnt/d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VFSRemove("/mnt/d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VFSGetwd(); err != syscall.ENOENT {
+		t.Errorf("getwd of removed directory: got error %v, want ENOENT", err)
+	}
+	if err := VFSMkdir("x", 0755); err != syscall.ENOENT {
+		t.Errorf("mkdir in removed directory: got error %v, want ENOENT", err)
+	}
+}
+
+// TestVFSConcurrent checks that writes to files do not race with each
+// other or with changes of names, see the race detector.
+func TestVFSConcurrent(t *testing.T) {
+	defer SetTestVFS()()
+	vfsCreate(t, "/tmp/f", "")
+	const writers, writes = 4, 100
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := VFSOpen("/tmp/f", O_WRONLY|O_APPEND, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer n.Close()
+			for j := 0; j < writes; j++ {
+				if _, _, err := n.Append([]byte("x")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < writes; j++ {
+			if err := VFSLink("/tmp/f", "/tmp/g"); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, _, _, err := VFSAttr("/tmp/g", true); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := VFSRemove("/tmp/g"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if _, size, nlink, err := VFSAttr("/tmp/f", true); size != writers*writes || nlink != 1 || err != nil {
+		t.Errorf("got size %d, nlink %d, error %v, want %d, 1, nil", size, nlink, err, writers*writes)
+	}
+}
@@ -0,0 +1,509 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Block cache. On solo5hvt, every read or write of a device block is a
+// hypercall, a VM exit, and package syscall reads and writes block devices
+// through this cache instead, see blkcache_solo5hvt.go. Blocks are kept in
+// LRU order up to the size of the cache. Writes only change the cache:
+// changed blocks are written to the device on sync, when they are evicted,
+// and at exit. A read that misses right after the previous read of the
+// device also reads the blocks that follow, in the same device read, so
+// sequential reads hit the cache.
+//
+// c.lock is not held during device I/O. A page with I/O in progress is
+// busy, and goroutines that need it park on the page until it is done.
+// Nothing is allocated with c.lock held either: pages are allocated before
+// it is taken, and the hash table of pages is allocated once, by init.
+//
+// The cache does no hypercalls itself, the device is a blkDevice, so it is
+// built and tested on all systems.
+
+// blkCacheReadahead is the default number of blocks to read ahead.
+const blkCacheReadahead = 16
+
+// blkMaxHandles is the number of device handles for which the cache
+// detects sequential reads. Solo5 handles are below 64.
+const blkMaxHandles = 64
+
+// Solo5 result codes.
+const (
+	blkOK      = 0
+	blkInvalid = 2
+)
+
+// blkDevice does the device I/O for a blkCache.
+type blkDevice interface {
+	// read and write transfer one or more consecutive blocks, and return
+	// a solo5 result code.
+	read(handle int, p []byte, off int64) int64
+	write(handle int, p []byte, off int64) int64
+
+	// info returns the capacity and block size of a block device.
+	info(handle int) (capacity int64, blockSize int, ok bool)
+}
+
+type blkCache struct {
+	lock mutex
+
+	dev       blkDevice
+	size      int64 // in bytes, 0 disables the cache
+	readahead int   // in blocks
+
+	hash    []*blkPage           // pages by blkKey, chained through blkPage.hnext
+	lru     blkPage              // sentinel of the list of pages, most recently used first
+	changed blkPage              // sentinel of the list of dirty pages, oldest first
+	next    [blkMaxHandles]int64 // per device, the offset after the last read
+	stats   blkCacheStats
+}
+
+type blkKey struct {
+	handle int
+	off    int64
+}
+
+type blkPage struct {
+	blkKey
+	data         []byte
+	dirty        bool
+	busy         bool     // device I/O in progress, data must not be used
+	waiters      gList    // goroutines parked until busy is cleared
+	hnext        *blkPage // in the hash chain
+	prev, next   *blkPage // in the LRU list
+	cprev, cnext *blkPage // in the list of dirty pages
+}
+
+// blkCacheStats is runtime/debug.BlockCacheStats, keep in sync.
+type blkCacheStats struct {
+	Size       int64
+	Used       int64
+	Dirty      int64
+	Hits       uint64
+	Misses     uint64
+	Readahead  uint64
+	Writebacks uint64
+	Evictions  uint64
+}
+
+// init sets up an empty cache of size bytes on dev, reading ahead up to
+// readahead blocks. It must be called before the cache is used, and only
+// once.
+func (c *blkCache) init(dev blkDevice, size int64, readahead int) {
+	c.dev = dev
+	c.size = size
+	c.readahead = readahead
+	c.lru.next = &c.lru
+	c.lru.prev = &c.lru
+	c.changed.cnext = &c.changed
+	c.changed.cprev = &c.changed
+	if size <= 0 {
+		return
+	}
+	// About 4 pages of 512 bytes per hash chain.
+	n := 16
+	for int64(n) < size/2048 {
+		n *= 2
+	}
+	c.hash = make([]*blkPage, n)
+}
+
+// bucket returns the hash chain for block k of bs bytes.
+func (c *blkCache) bucket(k blkKey, bs int) **blkPage {
+	h := uint(k.off/int64(bs)) + uint(k.handle)*0x9e3779b9
+	return &c.hash[h&uint(len(c.hash)-1)]
+}
+
+// check returns the capacity and block size of the device for an I/O of n
+// bytes at off, or a block size of 0 if the I/O is not of a single block on
+// the device.
+func (c *blkCache) check(handle int, n int, off int64) (int64, int) {
+	capacity, bs, ok := c.dev.info(handle)
+	if !ok || n != bs || off < 0 || off%int64(bs) != 0 || off > capacity-int64(bs) {
+		return 0, 0
+	}
+	return capacity, bs
+}
+
+// lookup returns the page for block k of bs bytes, or nil.
+//
+// c.lock must be held.
+func (c *blkCache) lookup(k blkKey, bs int) *blkPage {
+	pg := *c.bucket(k, bs)
+	for pg != nil && pg.blkKey != k {
+		pg = pg.hnext
+	}
+	return pg
+}
+
+// get returns the page for block k of bs bytes, or nil, waiting while it is
+// busy.
+//
+// c.lock must be held.
+func (c *blkCache) get(k blkKey, bs int) *blkPage {
+	for {
+		pg := c.lookup(k, bs)
+		if pg == nil || !pg.busy {
+			return pg
+		}
+		c.wait(pg)
+	}
+}
+
+// wait parks the goroutine until busy page pg is done. c.lock is released
+// while parked, and held again on return. pg may have been removed from the
+// cache by then.
+//
+// c.lock must be held.
+func (c *blkCache) wait(pg *blkPage) {
+	pg.waiters.push(getg())
+	goparkunlock(&c.lock, waitReasonIOWait, traceEvGoBlock, 1)
+	lock(&c.lock)
+}
+
+// done clears busy of pg, and moves the goroutines waiting for it to ready.
+// They are made runnable by blkReady once c.lock is released.
+//
+// c.lock must be held.
+func (c *blkCache) done(pg *blkPage, ready *gList) {
+	pg.busy = false
+	for !pg.waiters.empty() {
+		ready.push(pg.waiters.pop())
+	}
+}
+
+// blkReady makes the goroutines of ready runnable.
+func blkReady(ready *gList) {
+	for !ready.empty() {
+		goready(ready.pop(), 1)
+	}
+}
+
+// readaheadBlocks returns the number of blocks to read ahead after a miss
+// of the block of bs bytes at off of device handle: none unless the read
+// follows the previous read of the device.
+//
+// c.lock must be held.
+func (c *blkCache) readaheadBlocks(handle int, off int64, bs int, capacity int64) int {
+	if uint(handle) >= uint(len(c.next)) || c.next[handle] != off {
+		return 0
+	}
+	n := c.readahead
+	if max := int(c.size / int64(bs) / 4); n > max {
+		n = max
+	}
+	if max := int((capacity-off)/int64(bs)) - 1; n > max {
+		n = max
+	}
+	return n
+}
+
+// readBlock reads the block at off from device handle into p.
+func (c *blkCache) readBlock(handle int, p []byte, off int64) int64 {
+	capacity, bs := c.check(handle, len(p), off)
+	if bs == 0 {
+		return blkInvalid
+	}
+	if c.size < int64(bs) {
+		return c.dev.read(handle, p, off)
+	}
+	k := blkKey{handle, off}
+	var pages []*blkPage
+	lock(&c.lock)
+	for {
+		if pg := c.get(k, bs); pg != nil {
+			c.stats.Hits++
+			c.setNext(handle, off+int64(bs))
+			copy(p, pg.data)
+			c.use(pg)
+			unlock(&c.lock)
+			return blkOK
+		}
+		if pages != nil {
+			break
+		}
+		n := 1 + c.readaheadBlocks(handle, off, bs, capacity)
+		unlock(&c.lock)
+		pages = newBlkPages(k, bs, n)
+		lock(&c.lock)
+	}
+	c.stats.Misses++
+	c.setNext(handle, off+int64(bs))
+
+	// Read ahead up to the first block that is in the cache already.
+	n := 1
+	for n < len(pages) && c.lookup(pages[n].blkKey, bs) == nil {
+		n++
+	}
+	pages = pages[:n]
+	for _, pg := range pages {
+		c.insert(pg)
+	}
+	var ready gList
+	if !c.evict() {
+		for _, pg := range pages {
+			c.remove(pg)
+			c.done(pg, &ready)
+		}
+		unlock(&c.lock)
+		blkReady(&ready)
+		return c.dev.read(handle, p, off)
+	}
+	unlock(&c.lock)
+
+	ahead := n - 1
+	var r int64
+	if ahead == 0 {
+		r = c.dev.read(handle, pages[0].data, off)
+	} else {
+		buf := make([]byte, n*bs)
+		if r = c.dev.read(handle, buf, off); r == blkOK {
+			for i, pg := range pages {
+				copy(pg.data, buf[i*bs:])
+			}
+		} else {
+			// The failure may be in the blocks read ahead.
+			ahead = 0
+			r = c.dev.read(handle, pages[0].data, off)
+		}
+	}
+	if r == blkOK {
+		copy(p, pages[0].data)
+	}
+
+	lock(&c.lock)
+	for i, pg := range pages {
+		if r != blkOK || i > ahead {
+			c.remove(pg)
+		}
+		c.done(pg, &ready)
+	}
+	if r == blkOK {
+		c.stats.Readahead += uint64(ahead)
+	}
+	unlock(&c.lock)
+	blkReady(&ready)
+	return r
+}
+
+// setNext records that the next sequential read of device handle is at off.
+//
+// c.lock must be held.
+func (c *blkCache) setNext(handle int, off int64) {
+	if uint(handle) < uint(len(c.next)) {
+		c.next[handle] = off
+	}
+}
+
+// writeBlock writes p to the block at off of device handle.
+func (c *blkCache) writeBlock(handle int, p []byte, off int64) int64 {
+	_, bs := c.check(handle, len(p), off)
+	if bs == 0 {
+		return blkInvalid
+	}
+	if c.size < int64(bs) {
+		return c.dev.write(handle, p, off)
+	}
+	k := blkKey{handle, off}
+	var pg *blkPage
+	lock(&c.lock)
+	for {
+		if cpg := c.get(k, bs); cpg != nil {
+			copy(cpg.data, p)
+			c.markDirty(cpg)
+			c.use(cpg)
+			unlock(&c.lock)
+			return blkOK
+		}
+		if pg != nil {
+			break
+		}
+		unlock(&c.lock)
+		pg = newBlkPages(k, bs, 1)[0]
+		copy(pg.data, p)
+		lock(&c.lock)
+	}
+	c.insert(pg)
+	ok := c.evict()
+	if ok {
+		c.markDirty(pg)
+	} else {
+		c.remove(pg)
+	}
+	var ready gList
+	c.done(pg, &ready)
+	unlock(&c.lock)
+	blkReady(&ready)
+	if !ok {
+		return c.dev.write(handle, p, off)
+	}
+	return blkOK
+}
+
+// sync writes the changed blocks of device handle, or of all devices if
+// handle is -1, to the device. It waits for write backs in progress, and
+// returns the result of the first failed write.
+func (c *blkCache) sync(handle int) int64 {
+	lock(&c.lock)
+	defer unlock(&c.lock)
+	for {
+		var pg, busy *blkPage
+		for p := c.changed.cnext; p != &c.changed; p = p.cnext {
+			if handle != -1 && p.handle != handle {
+				continue
+			}
+			if !p.busy {
+				pg = p
+				break
+			}
+			busy = p
+		}
+		if pg == nil && busy == nil {
+			return blkOK
+		}
+		if pg == nil {
+			c.wait(busy)
+			continue
+		}
+		if r := c.writeback(pg); r != blkOK {
+			return r
+		}
+	}
+}
+
+// flush writes all changed blocks to the devices, without changing the
+// cache. It is called by exit when c.lock is free. Nothing runs after it,
+// so it neither waits for busy pages nor takes c.lock, and must not have
+// write barriers.
+//
+//go:nowritebarrierrec
+func (c *blkCache) flush() {
+	if c.hash == nil {
+		return
+	}
+	for pg := c.changed.cnext; pg != &c.changed; pg = pg.cnext {
+		c.dev.write(pg.handle, pg.data, pg.off)
+	}
+}
+
+// writeback writes dirty page pg to the device. The page is busy while
+// c.lock is released for the write, and goroutines that waited for it are
+// readied after.
+//
+// c.lock must be held.
+func (c *blkCache) writeback(pg *blkPage) int64 {
+	pg.busy = true
+	unlock(&c.lock)
+	r := c.dev.write(pg.handle, pg.data, pg.off)
+	lock(&c.lock)
+	if r == blkOK {
+		pg.dirty = false
+		pg.cprev.cnext = pg.cnext
+		pg.cnext.cprev = pg.cprev
+		pg.cprev, pg.cnext = nil, nil
+		c.stats.Dirty -= int64(len(pg.data))
+		c.stats.Writebacks++
+	}
+	var ready gList
+	c.done(pg, &ready)
+	if !ready.empty() {
+		unlock(&c.lock)
+		blkReady(&ready)
+		lock(&c.lock)
+	}
+	return r
+}
+
+// markDirty marks pg as changed.
+//
+// c.lock must be held.
+func (c *blkCache) markDirty(pg *blkPage) {
+	if pg.dirty {
+		return
+	}
+	pg.dirty = true
+	pg.cprev = c.changed.cprev
+	pg.cnext = &c.changed
+	c.changed.cprev.cnext = pg
+	c.changed.cprev = pg
+	c.stats.Dirty += int64(len(pg.data))
+}
+
+// newBlkPages returns n busy pages for the blocks of bs bytes from k on, to
+// be added to the cache. It allocates, so c.lock must not be held.
+func newBlkPages(k blkKey, bs int, n int) []*blkPage {
+	pages := make([]*blkPage, n)
+	for i := range pages {
+		k := blkKey{k.handle, k.off + int64(i*bs)}
+		pages[i] = &blkPage{blkKey: k, data: make([]byte, bs), busy: true}
+	}
+	return pages
+}
+
+// insert adds busy page pg to the cache. The cache may exceed its size
+// until evict is called. The caller makes the page available with done.
+//
+// c.lock must be held.
+func (c *blkCache) insert(pg *blkPage) {
+	b := c.bucket(pg.blkKey, len(pg.data))
+	pg.hnext = *b
+	*b = pg
+	c.stats.Used += int64(len(pg.data))
+	c.use(pg)
+}
+
+// evict drops the least recently used pages until the cache fits its size,
+// writing back changed pages first. Busy pages are skipped, so the cache can
+// exceed its size while I/O is in progress. It returns false if a changed
+// page cannot be written.
+//
+// c.lock must be held. It is released while pages are written back.
+func (c *blkCache) evict() bool {
+	for c.stats.Used > c.size {
+		pg := c.lru.prev
+		for pg != &c.lru && pg.busy {
+			pg = pg.prev
+		}
+		if pg == &c.lru {
+			return true
+		}
+		if pg.dirty {
+			if c.writeback(pg) != blkOK {
+				return false
+			}
+			continue
+		}
+		c.remove(pg)
+		c.stats.Evictions++
+	}
+	return true
+}
+
+// remove drops clean page pg from the cache.
+//
+// c.lock must be held.
+func (c *blkCache) remove(pg *blkPage) {
+	b := c.bucket(pg.blkKey, len(pg.data))
+	for *b != pg {
+		b = &(*b).hnext
+	}
+	*b = pg.hnext
+	pg.prev.next = pg.next
+	pg.next.prev = pg.prev
+	c.stats.Used -= int64(len(pg.data))
+}
+
+// use moves pg to the front of the LRU list.
+//
+// c.lock must be held.
+func (c *blkCache) use(pg *blkPage) {
+	if pg.prev != nil {
+		pg.prev.next = pg.next
+		pg.next.prev = pg.prev
+	}
+	pg.prev = &c.lru
+	pg.next = c.lru.next
+	c.lru.next.prev = pg
+	c.lru.next = pg
+}
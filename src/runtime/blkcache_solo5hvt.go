@@ -0,0 +1,104 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// The block cache of the solo5 block devices, see blkcache.go.
+//
+// The size is set with environment variable SOLO5_BLOCKCACHE in bytes, with
+// an optional K, M or G suffix, 0 disables the cache. The default is 1/32 of
+// the memory of the guest. SOLO5_READAHEAD sets the number of blocks to
+// read ahead, 0 disables readahead. runtime/debug.ReadBlockCacheStats
+// reports how well the cache works.
+var blkcache blkCache
+
+// solo5BlockDevice is the blkDevice of the solo5 hypercalls.
+type solo5BlockDevice struct{}
+
+func (solo5BlockDevice) read(handle int, p []byte, off int64) int64 {
+	return solo5Blkread(handle, p, off)
+}
+
+func (solo5BlockDevice) write(handle int, p []byte, off int64) int64 {
+	return solo5Blkwrite(handle, p, off)
+}
+
+func (solo5BlockDevice) info(handle int) (capacity int64, blockSize int, ok bool) {
+	return solo5BlockInfo(handle)
+}
+
+// blkcacheConfigure sets up the block cache for the solo5 devices, from the
+// environment.
+func blkcacheConfigure() {
+	size := int64(memoryLimit / 32)
+	if s := gogetenv("SOLO5_BLOCKCACHE"); s != "" {
+		n, ok := parseByteSize(s)
+		if !ok {
+			print("runtime: bad SOLO5_BLOCKCACHE ", s, "\n")
+		} else {
+			size = n
+		}
+	}
+	readahead := blkCacheReadahead
+	if s := gogetenv("SOLO5_READAHEAD"); s != "" {
+		n, ok := atoi(s)
+		if !ok || n < 0 {
+			print("runtime: bad SOLO5_READAHEAD ", s, "\n")
+		} else {
+			readahead = n
+		}
+	}
+	blkcache.init(solo5BlockDevice{}, size, readahead)
+}
+
+// Block I/O of package syscall goes through the block cache.
+
+//go:linkname syscall_blkread syscall.blkread
+func syscall_blkread(handle int, p []byte, off int64) int64 {
+	return blkcache.readBlock(handle, p, off)
+}
+
+//go:linkname syscall_blkwrite syscall.blkwrite
+func syscall_blkwrite(handle int, p []byte, off int64) int64 {
+	return blkcache.writeBlock(handle, p, off)
+}
+
+//go:linkname syscall_blksync syscall.blksync
+func syscall_blksync(handle int) int64 {
+	return blkcache.sync(handle)
+}
+
+//go:linkname readBlockCacheStats runtime/debug.readBlockCacheStats
+func readBlockCacheStats(stats unsafe.Pointer) {
+	lock(&blkcache.lock)
+	s := blkcache.stats
+	s.Size = blkcache.size
+	unlock(&blkcache.lock)
+	*(*blkCacheStats)(stats) = s
+}
+
+// parseByteSize parses a size in bytes with an optional K, M or G suffix.
+func parseByteSize(s string) (int64, bool) {
+	shift := uint(0)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K', 'k':
+			shift = 10
+		case 'M', 'm':
+			shift = 20
+		case 'G', 'g':
+			shift = 30
+		}
+		if shift > 0 {
+			s = s[:n-1]
+		}
+	}
+	v, ok := atoi(s)
+	if !ok || v < 0 || int64(v) > 1<<40>>shift {
+		return 0, false
+	}
+	return int64(v) << shift, true
+}
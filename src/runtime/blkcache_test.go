@@ -0,0 +1,178 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"bytes"
+	. "runtime"
+	"testing"
+)
+
+func TestBlkCacheWriteBack(t *testing.T) {
+	b := NewBlkCache(make([]byte, 64*512), 4*512, 0)
+	p := bytes.Repeat([]byte{1}, 512)
+	for i := 0; i < 4; i++ {
+		if !b.Write(p, int64(i*512)) {
+			t.Fatalf("write %d failed", i)
+		}
+	}
+	if b.Writes != 0 || b.Dev[0] != 0 {
+		t.Fatalf("writes went to the device before sync")
+	}
+	if s := b.Stats(); s.Dirty != 4*512 || s.Used != 4*512 {
+		t.Fatalf("stats %+v, want 4 dirty blocks", s)
+	}
+
+	// A fifth block evicts the least recently used, which is written back.
+	if !b.Write(p, 4*512) {
+		t.Fatalf("write 4 failed")
+	}
+	if b.Writes != 1 || b.Dev[0] != 1 || b.Dev[512] != 0 {
+		t.Fatalf("got %d writes, want write back of block 0 only", b.Writes)
+	}
+
+	if !b.Sync() {
+		t.Fatalf("sync failed")
+	}
+	if b.Writes != 5 || !bytes.Equal(b.Dev[:5*512], bytes.Repeat([]byte{1}, 5*512)) {
+		t.Fatalf("got %d writes after sync, want 5", b.Writes)
+	}
+	if s := b.Stats(); s.Dirty != 0 || s.Writebacks != 5 || s.Evictions != 1 {
+		t.Fatalf("stats %+v after sync", s)
+	}
+
+	// Reads of cached blocks hit, including of blocks only written.
+	q := make([]byte, 512)
+	if !b.Read(q, 4*512) || !bytes.Equal(p, q) || b.Reads != 0 {
+		t.Fatalf("read of cached block went to device or is wrong")
+	}
+	if s := b.Stats(); s.Hits != 1 || s.Misses != 0 {
+		t.Fatalf("stats %+v, want 1 hit", s)
+	}
+}
+
+func TestBlkCacheRead(t *testing.T) {
+	dev := make([]byte, 64*512)
+	for i := range dev {
+		dev[i] = byte(i / 512)
+	}
+	b := NewBlkCache(dev, 32*512, 0)
+	p := make([]byte, 512)
+	for n := 0; n < 2; n++ {
+		for i := 0; i < 10; i++ {
+			if !b.Read(p, int64(i*512)) || p[0] != byte(i) {
+				t.Fatalf("read %d: got block %d", i, p[0])
+			}
+		}
+	}
+	if s := b.Stats(); s.Misses != 10 || s.Hits != 10 || s.Used != 10*512 {
+		t.Fatalf("stats %+v, want 10 misses and 10 hits", s)
+	}
+	if b.Reads != 10 {
+		t.Fatalf("got %d device reads, want 10", b.Reads)
+	}
+
+	// Reads that are not single blocks on the device fail.
+	if b.Read(p[:100], 0) || b.Read(p, 100) || b.Read(p, int64(len(dev))) {
+		t.Fatalf("invalid read succeeded")
+	}
+}
+
+func TestBlkCacheReadahead(t *testing.T) {
+	dev := make([]byte, 64*512)
+	for i := range dev {
+		dev[i] = byte(i / 512)
+	}
+	b := NewBlkCache(dev, 32*512, 4)
+	p := make([]byte, 512)
+	read := func(i int) {
+		t.Helper()
+		if !b.Read(p, int64(i*512)) || p[0] != byte(i) {
+			t.Fatalf("read %d: got block %d", i, p[0])
+		}
+	}
+
+	// Sequential reads from the start read 4 blocks ahead, in one device
+	// read per miss.
+	for i := 0; i < 10; i++ {
+		read(i)
+	}
+	if s := b.Stats(); s.Misses != 2 || s.Hits != 8 || s.Readahead != 8 || b.Reads != 2 {
+		t.Fatalf("stats %+v and %d device reads, want 2 misses that read ahead", s, b.Reads)
+	}
+
+	// Other reads do not read ahead.
+	read(40)
+	read(37)
+	if s := b.Stats(); s.Misses != 4 || s.Readahead != 8 || b.Reads != 4 {
+		t.Fatalf("stats %+v and %d device reads, want no readahead", s, b.Reads)
+	}
+
+	// Readahead stops at the first block in the cache.
+	read(38)
+	read(39)
+	read(40)
+	if s := b.Stats(); s.Misses != 5 || s.Readahead != 9 || b.Reads != 5 {
+		t.Fatalf("stats %+v and %d device reads, want readahead of 1 block", s, b.Reads)
+	}
+
+	// And at the end of the device.
+	for i := 60; i < 64; i++ {
+		read(i)
+	}
+	if s := b.Stats(); s.Readahead != 11 || b.Reads != 7 {
+		t.Fatalf("stats %+v and %d device reads, want readahead up to the end", s, b.Reads)
+	}
+}
+
+func TestBlkCacheWait(t *testing.T) {
+	dev := make([]byte, 8*512)
+	for i := range dev {
+		dev[i] = byte(i / 512)
+	}
+	b := NewBlkCache(dev, 8*512, 0)
+	started := make(chan bool, 2)
+	release := make(chan bool)
+	b.ReadHook = func() {
+		started <- true
+		<-release
+	}
+	done := make(chan byte, 2)
+	read := func() {
+		p := make([]byte, 512)
+		if !b.Read(p, 3*512) {
+			p[0] = 0xff
+		}
+		done <- p[0]
+	}
+
+	// A second read of a block that is being read waits for the first.
+	go read()
+	<-started
+	go read()
+	for !b.Waiting(3 * 512) {
+		Gosched()
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if v := <-done; v != 3 {
+			t.Fatalf("read got block %d, want 3", v)
+		}
+	}
+	if s := b.Stats(); s.Misses != 1 || s.Hits != 1 || b.Reads != 1 {
+		t.Fatalf("stats %+v and %d device reads, want 1 miss and 1 hit", s, b.Reads)
+	}
+}
+
+func TestBlkCacheDisabled(t *testing.T) {
+	b := NewBlkCache(make([]byte, 8*512), 0, 0)
+	p := make([]byte, 512)
+	b.Write(p, 0)
+	b.Read(p, 512)
+	b.Read(p, 1024)
+	if b.Writes != 1 || b.Reads != 2 {
+		t.Fatalf("got %d writes and %d reads, want I/O straight to device", b.Writes, b.Reads)
+	}
+}
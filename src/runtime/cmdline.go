@@ -0,0 +1,123 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Parser of the boot command line of solo5hvt, see cmdline_solo5hvt.go. It
+// is built on all systems so that it is tested on the host. The command line
+// is split into words like a POSIX shell does, without any expansion:
+//
+//	- Words are separated by spaces, tabs and newlines.
+//	- A backslash quotes the next character, a backslash-newline is removed.
+//	- Single quotes quote everything up to the next single quote.
+//	- Double quotes quote everything up to the next double quote, except
+//	  that a backslash still quotes $, `, ", \ and newline.
+//
+// The leading words set environment variables, either as NAME=value like in
+// a shell, or as -env NAME=value. An optional -- ends them, and is needed if
+// the first argument of the program looks like NAME=value. The remaining
+// words are the arguments of the program.
+
+// cmdlineSplit splits s into words. On a syntax error, it returns a
+// message and the offset in s where the error was found.
+func cmdlineSplit(s string) (words []string, msg string, pos int) {
+	var w []byte
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n':
+			if inWord {
+				words = append(words, string(w))
+				w = w[:0]
+				inWord = false
+			}
+		case '\\':
+			if i+1 == len(s) {
+				return nil, "backslash at end", i
+			}
+			i++
+			if s[i] != '\n' {
+				w = append(w, s[i])
+				inWord = true
+			}
+		case '\'':
+			start := i
+			for i++; i < len(s) && s[i] != '\''; i++ {
+				w = append(w, s[i])
+			}
+			if i == len(s) {
+				return nil, "unterminated single quote", start
+			}
+			inWord = true
+		case '"':
+			start := i
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					switch s[i+1] {
+					case '$', '`', '"', '\\':
+						i++
+					case '\n':
+						i++
+						continue
+					}
+				}
+				w = append(w, s[i])
+			}
+			if i == len(s) {
+				return nil, "unterminated double quote", start
+			}
+			inWord = true
+		default:
+			w = append(w, c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, string(w))
+	}
+	return words, "", 0
+}
+
+// cmdlineIsAssignment returns whether w is a shell variable assignment,
+// NAME=value.
+func cmdlineIsAssignment(w string) bool {
+	i := index(w, "=")
+	if i <= 0 {
+		return false
+	}
+	for j := 0; j < i; j++ {
+		c := w[j]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (j == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// cmdlineEnv splits words into the environment variables that lead them
+// and the arguments of the program. On a syntax error, it returns a message.
+func cmdlineEnv(words []string) (env, args []string, msg string) {
+	for len(words) > 0 {
+		w := words[0]
+		if w == "-env" {
+			if len(words) == 1 {
+				return nil, nil, "-env without NAME=value"
+			}
+			w = words[1]
+			if !cmdlineIsAssignment(w) {
+				return nil, nil, "-env " + w + ": not NAME=value"
+			}
+			words = words[2:]
+		} else if cmdlineIsAssignment(w) {
+			words = words[1:]
+		} else {
+			break
+		}
+		env = append(env, w)
+	}
+	if len(words) > 0 && words[0] == "--" {
+		words = words[1:]
+	}
+	return env, words, ""
+}
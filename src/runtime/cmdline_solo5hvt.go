@@ -0,0 +1,95 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// Boot command line. The tender passes the arguments after the unikernel as
+// a single string, joined by spaces. It is split into words and environment
+// variables by the parser in cmdline.go.
+//
+// Environment variables for the runtime, such as GODEBUG, GOGC and
+// GOTRACEBACK, are applied by schedinit like on other systems, before the
+// scheduler starts. They are checked here, so that a mistake stops the
+// guest with a message instead of being ignored.
+
+// solo5envs sets envs and argslice from the boot command line.
+func solo5envs() {
+	cmdline := gostring((*byte)(unsafe.Pointer(solo5BootInfo.Cmdline)))
+	words, msg, pos := cmdlineSplit(cmdline)
+	if msg != "" {
+		cmdlineFatal(cmdline, pos, msg)
+	}
+
+	env, args, msg := cmdlineEnv(words)
+	if msg != "" {
+		cmdlineFatal(cmdline, -1, msg)
+	}
+	for _, w := range env {
+		i := index(w, "=")
+		if msg := cmdlineCheckEnv(w[:i], w[i+1:]); msg != "" {
+			cmdlineFatal(cmdline, -1, w+": "+msg)
+		}
+	}
+	envs = append([]string{}, env...)
+	argslice = append([]string{"solo5hvt"}, args...)
+}
+
+// cmdlineFatal prints msg about the command line and exits. If pos is not
+// negative, it is the offset in cmdline of the problem.
+func cmdlineFatal(cmdline string, pos int, msg string) {
+	print("runtime: bad boot command line: ", msg)
+	if pos >= 0 {
+		print(" at offset ", pos)
+	}
+	print("\n\t", cmdline, "\n")
+	exit(2)
+}
+
+// cmdlineCheckEnv checks the value of the environment variables that
+// configure the runtime. It returns a message if the value is not valid.
+func cmdlineCheckEnv(name, value string) string {
+	switch name {
+	case "GOGC":
+		if _, ok := atoi32(value); !ok && value != "off" {
+			return "not a percentage or off"
+		}
+	case "GOMAXPROCS":
+		if value != "1" {
+			return "solo5hvt has a single CPU, only 1 is supported"
+		}
+	case "GOTRACEBACK":
+		switch value {
+		case "", "none", "single", "all", "system", "crash":
+		default:
+			if _, ok := atoi32(value); !ok {
+				return "not none, single, all, system, crash or a level"
+			}
+		}
+	case "GODEBUG":
+		for p := value; p != ""; {
+			field := p
+			if i := index(p, ","); i >= 0 {
+				field, p = p[:i], p[i+1:]
+			} else {
+				p = ""
+			}
+			i := index(field, "=")
+			if i < 0 {
+				return field + " is not name=value"
+			}
+			key, val := field[:i], field[i+1:]
+			known := key == "memprofilerate"
+			for _, v := range dbgvars {
+				known = known || v.name == key
+			}
+			// Other names are for packages outside the runtime.
+			if _, ok := atoi(val); known && !ok {
+				return field + " is not a number"
+			}
+		}
+	}
+	return ""
+}
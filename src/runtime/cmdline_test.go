@@ -0,0 +1,113 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"reflect"
+	. "runtime"
+	"testing"
+)
+
+func TestCmdlineSplit(t *testing.T) {
+	tests := []struct {
+		in    string
+		words []string
+		msg   string
+		pos   int
+	}{
+		{"", nil, "", 0},
+		{" \t\n ", nil, "", 0},
+		{"a b\tc\nd", []string{"a", "b", "c", "d"}, "", 0},
+		{"  a   b  ", []string{"a", "b"}, "", 0},
+
+		// Quoting.
+		{`'a b' "c d"`, []string{"a b", "c d"}, "", 0},
+		{`a'b c'd`, []string{"ab cd"}, "", 0},
+		{`'a"b' "a'b"`, []string{`a"b`, "a'b"}, "", 0},
+		{`'' ""`, []string{"", ""}, "", 0},
+		{`a '' b`, []string{"a", "", "b"}, "", 0},
+		{`'$x \n'`, []string{`$x \n`}, "", 0},
+
+		// Backslashes.
+		{`a\ b`, []string{"a b"}, "", 0},
+		{`\'a\"`, []string{`'a"`}, "", 0},
+		{`\\`, []string{`\`}, "", 0},
+		{"a\\\nb", []string{"ab"}, "", 0},
+		{"a \\\n b", []string{"a", "b"}, "", 0},
+		{`"\$ \` + "`" + ` \" \\ \a"`, []string{"$ ` \" \\ \\a"}, "", 0},
+		{"\"a\\\nb\"", []string{"ab"}, "", 0},
+
+		// Errors.
+		{`a\`, nil, "backslash at end", 1},
+		{`a 'b c`, nil, "unterminated single quote", 2},
+		{`a "b c`, nil, "unterminated double quote", 2},
+		{`"a\"`, nil, "unterminated double quote", 0},
+	}
+	for _, tt := range tests {
+		words, msg, pos := CmdlineSplit(tt.in)
+		if !reflect.DeepEqual(words, tt.words) || msg != tt.msg || pos != tt.pos {
+			t.Errorf("CmdlineSplit(%q) = %q, %q, %d, want %q, %q, %d", tt.in, words, msg, pos, tt.words, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestCmdlineIsAssignment(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"A=b", true},
+		{"A=", true},
+		{"_a1=b=c", true},
+		{"GODEBUG=gctrace=1", true},
+		{"=b", false},
+		{"A", false},
+		{"1A=b", false},
+		{"A-B=c", false},
+		{"A.B=c", false},
+		{"-env", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := CmdlineIsAssignment(tt.in); got != tt.want {
+			t.Errorf("CmdlineIsAssignment(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCmdlineEnv(t *testing.T) {
+	tests := []struct {
+		words []string
+		env   []string
+		args  []string
+		msg   string
+	}{
+		{nil, nil, nil, ""},
+		{[]string{"a", "b"}, nil, []string{"a", "b"}, ""},
+		{[]string{"A=1", "B=2", "a"}, []string{"A=1", "B=2"}, []string{"a"}, ""},
+		{[]string{"-env", "A=1", "B=2"}, []string{"A=1", "B=2"}, []string{}, ""},
+
+		// Words that look like NAME=value after the first argument, or
+		// after --, are arguments.
+		{[]string{"A=1", "a", "B=2"}, []string{"A=1"}, []string{"a", "B=2"}, ""},
+		{[]string{"A=1", "--", "B=2"}, []string{"A=1"}, []string{"B=2"}, ""},
+		{[]string{"--", "-env", "A=1"}, nil, []string{"-env", "A=1"}, ""},
+		{[]string{"--", "--"}, nil, []string{"--"}, ""},
+		{[]string{"a", "--"}, nil, []string{"a", "--"}, ""},
+		{[]string{"A=1", "--"}, []string{"A=1"}, []string{}, ""},
+		{[]string{"", "A=1"}, nil, []string{"", "A=1"}, ""},
+
+		// Errors.
+		{[]string{"-env"}, nil, nil, "-env without NAME=value"},
+		{[]string{"-env", "a"}, nil, nil, "-env a: not NAME=value"},
+		{[]string{"A=1", "-env", "--"}, nil, nil, "-env --: not NAME=value"},
+	}
+	for _, tt := range tests {
+		env, args, msg := CmdlineEnv(tt.words)
+		if !reflect.DeepEqual(env, tt.env) || !reflect.DeepEqual(args, tt.args) || msg != tt.msg {
+			t.Errorf("CmdlineEnv(%q) = %q, %q, %q, want %q, %q, %q", tt.words, env, args, msg, tt.env, tt.args, tt.msg)
+		}
+	}
+}
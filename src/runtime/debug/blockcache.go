@@ -0,0 +1,28 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+// BlockCacheStats describes the block cache of the runtime on solo5hvt,
+// through which block devices are read and written.
+type BlockCacheStats struct {
+	Size       int64  // Maximum size in bytes, 0 if the cache is disabled.
+	Used       int64  // Bytes of cached blocks.
+	Dirty      int64  // Bytes of changed blocks not yet written to the device.
+	Hits       uint64 // Block reads from the cache.
+	Misses     uint64 // Block reads from the device.
+	Readahead  uint64 // Blocks read ahead of sequential reads.
+	Writebacks uint64 // Changed blocks written to the device.
+	Evictions  uint64 // Blocks dropped from the cache to make room.
+}
+
+// ReadBlockCacheStats reads statistics about the block cache into stats.
+// The size of the cache is set with environment variable SOLO5_BLOCKCACHE,
+// in bytes with an optional K, M or G suffix, and the number of blocks read
+// ahead with SOLO5_READAHEAD. Elsewhere than on solo5hvt, all statistics
+// are zero.
+func ReadBlockCacheStats(stats *BlockCacheStats) {
+	*stats = BlockCacheStats{}
+	readBlockCacheStats(stats)
+}
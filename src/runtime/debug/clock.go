@@ -0,0 +1,20 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"time"
+)
+
+// WallClock reports how the wall clock is kept in sync with the host where
+// the runtime keeps it itself, on solo5hvt. Offset is the wall clock minus
+// the monotonic clock. Slew is the correction from the last synchronization
+// that is still being applied, gradually, to the offset. Drift is how much
+// slower the monotonic clock ran than the host clock between the last two
+// synchronizations, in parts per billion. Elsewhere WallClock returns zeros.
+func WallClock() (offset, slew time.Duration, drift int64) {
+	o, s, d := readWallClock()
+	return time.Duration(o), time.Duration(s), d
+}
@@ -100,6 +100,18 @@ func FreeOSMemory() {
 	freeOSMemory()
 }
 
+// MemoryLimit returns the amount of memory available to the program, and
+// the headroom: how much of it the heap can still grow into, including
+// memory the runtime holds but does not use. A limit is only known where
+// the runtime manages all memory, on solo5hvt. Elsewhere MemoryLimit
+// returns 0, 0.
+//
+// As the heap approaches the limit, garbage collections are triggered more
+// often, regardless of the SetGCPercent setting.
+func MemoryLimit() (limit, headroom uint64) {
+	return readMemoryLimit()
+}
+
 // SetMaxStack sets the maximum amount of memory that
 // can be used by a single goroutine stack.
 // If any goroutine exceeds this limit while growing its stack,
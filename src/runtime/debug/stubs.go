@@ -15,3 +15,6 @@ func setMaxStack(int) int
 func setGCPercent(int32) int32
 func setPanicOnFault(bool) bool
 func setMaxThreads(int) int
+func readMemoryLimit() (uint64, uint64)
+func readWallClock() (int64, int64, int64)
+func readBlockCacheStats(*BlockCacheStats)
@@ -34,6 +34,10 @@ var Fastlog2 = fastlog2
 var Atoi = atoi
 var Atoi32 = atoi32
 
+var CmdlineSplit = cmdlineSplit
+var CmdlineIsAssignment = cmdlineIsAssignment
+var CmdlineEnv = cmdlineEnv
+
 var Nanotime = nanotime
 
 var PhysHugePageSize = physHugePageSize
@@ -715,3 +719,173 @@ func RunGetgThreadSwitchTest() {
 		panic("g1 != g3")
 	}
 }
+
+// BlkCache is a block cache on a device in memory, with 512-byte blocks.
+type BlkCache struct {
+	c blkCache
+	BlkDevice
+}
+
+// BlkDevice is the device of a BlkCache. ReadHook, if set, is called by
+// every device read.
+type BlkDevice struct {
+	Dev           []byte
+	Reads, Writes int
+	ReadHook      func()
+}
+
+type BlkCacheStats blkCacheStats
+
+func NewBlkCache(dev []byte, size int64, readahead int) *BlkCache {
+	b := &BlkCache{BlkDevice: BlkDevice{Dev: dev}}
+	b.c.init(&b.BlkDevice, size, readahead)
+	return b
+}
+
+func (d *BlkDevice) read(handle int, p []byte, off int64) int64 {
+	if d.ReadHook != nil {
+		d.ReadHook()
+	}
+	d.Reads++
+	copy(p, d.Dev[off:])
+	return blkOK
+}
+
+func (d *BlkDevice) write(handle int, p []byte, off int64) int64 {
+	d.Writes++
+	copy(d.Dev[off:], p)
+	return blkOK
+}
+
+func (d *BlkDevice) info(handle int) (int64, int, bool) {
+	return int64(len(d.Dev)), 512, handle == 1
+}
+
+func (b *BlkCache) Read(p []byte, off int64) bool {
+	return b.c.readBlock(1, p, off) == blkOK
+}
+
+func (b *BlkCache) Write(p []byte, off int64) bool {
+	return b.c.writeBlock(1, p, off) == blkOK
+}
+
+func (b *BlkCache) Sync() bool {
+	return b.c.sync(-1) == blkOK
+}
+
+func (b *BlkCache) Stats() BlkCacheStats {
+	lock(&b.c.lock)
+	defer unlock(&b.c.lock)
+	return BlkCacheStats(b.c.stats)
+}
+
+// Waiting reports whether goroutines wait for the busy block at off.
+func (b *BlkCache) Waiting(off int64) bool {
+	lock(&b.c.lock)
+	defer unlock(&b.c.lock)
+	pg := b.c.lookup(blkKey{1, off}, 512)
+	return pg != nil && !pg.waiters.empty()
+}
+
+const MemPoison = memPoison
+
+// MemList is a memList on pages of a buffer.
+type MemList struct {
+	l   memList
+	buf []byte
+}
+
+func NewMemList(npages int) *MemList {
+	m := &MemList{buf: make([]byte, (npages+1)*memPageSize)}
+	start := memPageRound(uintptr(unsafe.Pointer(&m.buf[0])))
+	m.l.init(start, start+uintptr(npages)*memPageSize)
+	return m
+}
+
+func (m *MemList) SetPoison() {
+	m.l.setPoison()
+}
+
+func (m *MemList) addr(page int) uintptr {
+	return m.l.start + uintptr(page)*memPageSize
+}
+
+// Alloc allocates npages at page, or anywhere if page is -1, like
+// sysReserve and sysMap. It returns the first page, or -1.
+func (m *MemList) Alloc(page, npages int) int {
+	var v uintptr
+	if page >= 0 {
+		v = m.addr(page)
+	}
+	n := uintptr(npages) * memPageSize
+	p := m.l.alloc(v, n)
+	m.l.check()
+	if p == nil {
+		return -1
+	}
+	m.l.touch(uintptr(p) + n)
+	return int((uintptr(p) - m.l.start) / memPageSize)
+}
+
+// Free releases npages at page, like sysFree.
+func (m *MemList) Free(page, npages int) {
+	m.l.release(m.addr(page), uintptr(npages)*memPageSize)
+	m.l.check()
+}
+
+// Unused marks npages at page unused, like sysUnused.
+func (m *MemList) Unused(page, npages int) {
+	m.l.unused(m.addr(page), uintptr(npages)*memPageSize)
+}
+
+// Fill sets npages at page to x.
+func (m *MemList) Fill(page, npages int, x uint64) {
+	memFill(m.addr(page), uintptr(npages)*memPageSize, x)
+}
+
+// Holds reports whether npages at page are filled with x, not counting the
+// headers of free ranges.
+func (m *MemList) Holds(page, npages int, x uint64) bool {
+	for a := m.addr(page); a < m.addr(page+npages); a += 8 {
+		hdr := false
+		for p := m.l.head.ptr(); p != nil; p = p.next.ptr() {
+			if start := uintptr(unsafe.Pointer(p)); a >= start && a < start+unsafe.Sizeof(*p) {
+				hdr = true
+			}
+		}
+		if !hdr && *(*uint64)(unsafe.Pointer(a)) != x {
+			return false
+		}
+	}
+	return true
+}
+
+// Ranges returns the first and end page of the free ranges.
+func (m *MemList) Ranges() [][2]int {
+	var l [][2]int
+	for p := m.l.head.ptr(); p != nil; p = p.next.ptr() {
+		start := int((uintptr(unsafe.Pointer(p)) - m.l.start) / memPageSize)
+		l = append(l, [2]int{start, start + int(p.size/memPageSize)})
+	}
+	return l
+}
+
+const (
+	WallSlewRate  = wallSlewRate
+	WallStepLimit = wallStepLimit
+)
+
+var (
+	TSCScale    = tscScale
+	TSCNanotime = tscNanotime
+)
+
+// WallClock is the wall clock arithmetic of solo5hvt.
+type WallClock struct {
+	w wallClockState
+}
+
+func (w *WallClock) Read(now int64) int64         { return w.w.read(now) }
+func (w *WallClock) Sync(now, host int64)         { w.w.sync(now, host) }
+func (w *WallClock) Offset() (offset, slew int64) { return w.w.offset, w.w.slew }
+func (w *WallClock) Drift() int64                 { return w.w.drift }
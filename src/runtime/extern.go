@@ -121,6 +121,10 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	schedtrace: setting schedtrace=X causes the scheduler to emit a single line to standard
 	error every X milliseconds, summarizing the scheduler state.
 
+	solo5mempoison: setting solo5mempoison=1 causes the memory allocator of solo5hvt
+	to fill free and unused memory with a poison value, and to check that it is
+	unchanged when the memory is used again.
+
 	tracebackancestors: setting tracebackancestors=N extends tracebacks with the stacks at
 	which goroutines were created, where N limits the number of ancestor goroutines to
 	report. This also extends the information returned by runtime.Stack. Ancestor's goroutine
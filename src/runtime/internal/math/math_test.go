@@ -77,3 +77,21 @@ func BenchmarkMulUintptr(b *testing.B) {
 		}
 	})
 }
+
+func TestMul64(t *testing.T) {
+	tests := []struct {
+		x, y, hi, lo uint64
+	}{
+		{0, 0, 0, 0},
+		{1 << 32, 1 << 32, 1, 0},
+		{1<<64 - 1, 2, 1, 1<<64 - 2},
+		{1<<64 - 1, 1<<64 - 1, 1<<64 - 2, 1},
+		{0x123456789abcdef0, 0xfedcba9876543210, 0x121fa00ad77d7422, 0x236d88fe5618cf00},
+	}
+	for _, test := range tests {
+		hi, lo := Mul64(test.x, test.y)
+		if hi != test.hi || lo != test.lo {
+			t.Errorf("Mul64(%#x, %#x) = %#x, %#x, want %#x, %#x", test.x, test.y, hi, lo, test.hi, test.lo)
+		}
+	}
+}
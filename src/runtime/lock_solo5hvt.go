@@ -2,6 +2,15 @@
 
 package runtime
 
+import (
+	"runtime/internal/atomic"
+)
+
+// solo5hvt is single-threaded. When no goroutine is runnable, the scheduler
+// calls beforeIdle, which blocks in the poll hypercall until the next deadline
+// of a sleeping goroutine, or until a device is ready. There is no sysmon
+// thread, sysmonpoll does its work whenever the runtime gets control.
+
 const (
 	mutex_unlocked = 0
 	mutex_locked   = 1
@@ -17,7 +26,7 @@ const (
 
 func lock(l *mutex) {
 	if l.key == mutex_locked {
-		// js/wasm is single-threaded so we should never
+		// solo5hvt is single-threaded so we should never
 		// observe this.
 		throw("self deadlock")
 	}
@@ -41,6 +50,8 @@ func unlock(l *mutex) {
 	l.key = mutex_unlocked
 }
 
+// One-time notifications.
+
 type noteWithTimeout struct {
 	gp       *g
 	deadline int64
@@ -56,7 +67,6 @@ func noteclear(n *note) {
 }
 
 func notewakeup(n *note) {
-	// gp := getg()
 	if n.key == note_woken {
 		throw("notewakeup - double wakeup")
 	}
@@ -68,15 +78,14 @@ func notewakeup(n *note) {
 }
 
 func notesleep(n *note) {
-	throw("notesleep not supported by js")
+	throw("notesleep not supported by solo5hvt")
 }
 
 func notetsleep(n *note, ns int64) bool {
-	throw("notetsleep not supported by js")
+	throw("notetsleep not supported by solo5hvt")
 	return false
 }
 
-// XXX
 // same as runtime·notetsleep, but called on user g (not g0)
 func notetsleepg(n *note, ns int64) bool {
 	gp := getg()
@@ -84,81 +93,35 @@ func notetsleepg(n *note, ns int64) bool {
 		throw("notetsleepg on g0")
 	}
 
-	const net0handle = 1
-	const net0ready = 1 << net0handle
-	packet := make([]byte, 1500)
-
-	for ns > 0 {
-		t0 := nanotime()
-
-		length, ret := solo5Netread(net0handle, packet)
-		// println("netreader, length=", length, ", ret=", ret)
-		switch ret {
-		case s5ok:
-			println("netreader, packet length=", length)
-			// xxx hand off to network stack
-		case s5again:
-			// println("netreader, err again")
-			readySet, events := solo5Poll(uint64(ns))
-			println("notetsleepg, readyset=", readySet, "events=", events)
-		case s5invalid:
-			throw("netreader s5invalid")
-		case s5unspec:
-			throw("netreader s5unspec")
-		default:
-			println("netreader, error", ret)
-			throw("netreader unknown error")
-		}
-		ns -= nanotime() - t0
-
-		/*
-			t0 := nanotime()
-			readySet, events := solo5Poll(uint64(ns))
-			println("notetsleepg, readyset=", readySet, "events=", events)
-			if events > 0 && readySet != 0 {
-				println("readying netreader")
-				goready(netreaderG, 1)
-				gopark(nil, nil, waitReasonSleep, traceEvNone, 1)
-				println("back in notetsleepg")
-			}
-			ns -= nanotime() - t0
-		*/
-
-		/*
-			deadline := nanotime() + ns
-
-			id := scheduleTimeoutEvent(delay)
-			mp := acquirem()
-			notes[n] = gp
-			notesWithTimeout[n] = noteWithTimeout{gp: gp, deadline: deadline}
-			releasem(mp)
-
-			gopark(nil, nil, waitReasonSleep, traceEvNone, 1)
-
-			clearTimeoutEvent(id) // note might have woken early, clear timeout
-			mp = acquirem()
-			delete(notes, n)
-			delete(notesWithTimeout, n)
-			releasem(mp)
-
-			return n.key == note_woken
-		*/
-	}
+	if ns >= 0 {
+		deadline := nanotime() + ns
 
-	/*
-		for n.key != note_woken {
-			mp := acquirem()
-			notes[n] = gp
-			releasem(mp)
+		mp := acquirem()
+		notes[n] = gp
+		notesWithTimeout[n] = noteWithTimeout{gp: gp, deadline: deadline}
+		releasem(mp)
 
-			gopark(nil, nil, waitReasonZero, traceEvNone, 1)
+		gopark(nil, nil, waitReasonSleep, traceEvNone, 1)
 
-			mp = acquirem()
-			delete(notes, n)
-			releasem(mp)
-		}
-	*/
+		mp = acquirem()
+		delete(notes, n)
+		delete(notesWithTimeout, n)
+		releasem(mp)
 
+		return n.key == note_woken
+	}
+
+	for n.key != note_woken {
+		mp := acquirem()
+		notes[n] = gp
+		releasem(mp)
+
+		gopark(nil, nil, waitReasonZero, traceEvNone, 1)
+
+		mp = acquirem()
+		delete(notes, n)
+		releasem(mp)
+	}
 	return true
 }
 
@@ -173,43 +136,44 @@ func checkTimeouts() {
 	}
 }
 
-func beforeIdle() bool {
-	return false
-}
-
-/*
-XXX
+// pollForever is the timeout for solo5Poll when no goroutine has a deadline.
+const pollForever = 1<<63 - 1
 
-var netreaderG *g
-
-func init() {
-	go netreader()
-}
+// beforeIdle gets called by the scheduler if no goroutine is awake.
+// We block in the poll hypercall until the earliest deadline of a sleeping
+// goroutine has passed or a device is ready, and resume those goroutines.
+// The poll also ends in time for sysmonpoll to force a periodic GC.
+// If nothing can ever wake up, we return false and the scheduler will
+// detect the deadlock.
+func beforeIdle() bool {
+	if len(notesWithTimeout) == 0 && netpollWaiters == 0 {
+		return false
+	}
 
-func netreader() {
-	netreaderG = getg()
-
-	const net0handle = 1
-	const net0ready = 1<<net0handle
-	packet := make([]byte, 1500)
-	for {
-		length, ret := solo5Netread(net0handle, packet)
-		// println("netreader, length=", length, ", ret=", ret)
-		switch ret {
-		case s5ok:
-			println("netreader, packet length=", length)
-			// xxx hand off to network stack
-		case s5again:
-			// println("netreader, err again")
-			gopark(nil, nil, waitReasonIOWait, traceEvGoBlockNet, 1)
-		case s5invalid:
-			panic("netreader s5invalid")
-		case s5unspec:
-			panic("netreader s5unspec")
-		default:
-			print("netreader, error %x", ret)
-			panic("netreader unknown error")
+	now := nanotime()
+	timeout := int64(pollForever)
+	for n, nt := range notesWithTimeout {
+		if n.key != note_cleared {
+			continue
+		}
+		if d := nt.deadline - now; d < timeout {
+			timeout = d
+		}
+	}
+	if lastgc := int64(atomic.Load64(&memstats.last_gc_nanotime)); gcpercent >= 0 && lastgc != 0 && forcegc.idle != 0 {
+		if d := lastgc + forcegcperiod - now; d < timeout {
+			timeout = d
 		}
 	}
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	readySet, _ := solo5Poll(uint64(timeout))
+	atomic.Store64(&sched.lastpoll, uint64(nanotime()))
+	checkTimeouts()
+	list := netpollReadySet(readySet)
+	injectglist(&list)
+	sysmonpoll()
+	return true
 }
-*/
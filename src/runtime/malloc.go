@@ -207,7 +207,10 @@ const (
 	// we further limit it to 31 bits.
 	//
 	// WebAssembly currently has a limit of 4GB linear memory.
-	heapAddrBits = (_64bit*(1-sys.GoarchWasm)*(1-sys.GoosAix))*48 + (1-_64bit+sys.GoarchWasm)*(32-(sys.GoarchMips+sys.GoarchMipsle)) + 60*sys.GoosAix
+	//
+	// On solo5hvt, the heap is in the guest's physical memory, which
+	// is identity mapped and smaller than 4GB.
+	heapAddrBits = (_64bit*(1-sys.GoarchWasm)*(1-sys.GoosAix)*(1-sys.GoosSolo5hvt))*48 + (1-_64bit+sys.GoarchWasm+sys.GoosSolo5hvt)*(32-(sys.GoarchMips+sys.GoarchMipsle)) + 60*sys.GoosAix
 
 	// maxAlloc is the maximum size of an allocation. On 64-bit,
 	// it's theoretically possible to allocate 1<<heapAddrBits bytes. On
@@ -228,6 +231,7 @@ const (
 	//       */64-bit         48        64MB           1    4M (32MB)
 	//     aix/64-bit         60       256MB        4096    4M (32MB)
 	// windows/64-bit         48         4MB          64    1M  (8MB)
+	//  solo5hvt/amd64         32         4MB           1  1024  (8KB)
 	//       */32-bit         32         4MB           1  1024  (4KB)
 	//     */mips(le)         31         4MB           1   512  (2KB)
 
@@ -243,12 +247,16 @@ const (
 	// This is particularly important with the race detector,
 	// since it significantly amplifies the cost of committed
 	// memory.
+	//
+	// On solo5hvt, arenas are 4MB too. All memory of the guest is
+	// charged to the program, and a large arena would have to fit in
+	// the guest's memory twice over to be aligned.
 	heapArenaBytes = 1 << logHeapArenaBytes
 
 	// logHeapArenaBytes is log_2 of heapArenaBytes. For clarity,
 	// prefer using heapArenaBytes where possible (we need the
 	// constant to compute some other constants).
-	logHeapArenaBytes = (6+20)*(_64bit*(1-sys.GoosWindows)*(1-sys.GoosAix)*(1-sys.GoarchWasm)) + (2+20)*(_64bit*sys.GoosWindows) + (2+20)*(1-_64bit) + (8+20)*sys.GoosAix + (2+20)*sys.GoarchWasm
+	logHeapArenaBytes = (6+20)*(_64bit*(1-sys.GoosWindows)*(1-sys.GoosAix)*(1-sys.GoarchWasm)*(1-sys.GoosSolo5hvt)) + (2+20)*(_64bit*sys.GoosWindows) + (2+20)*sys.GoosSolo5hvt + (2+20)*(1-_64bit) + (8+20)*sys.GoosAix + (2+20)*sys.GoarchWasm
 
 	// heapArenaBitmapBytes is the size of each heap arena's bitmap.
 	heapArenaBitmapBytes = heapArenaBytes / (sys.PtrSize * 8 / 2)
@@ -299,8 +307,9 @@ const (
 	// high addresses if viewed as unsigned).
 	//
 	// On other platforms, the user address space is contiguous
-	// and starts at 0, so no offset is necessary.
-	arenaBaseOffset uintptr = sys.GoarchAmd64 * (1 << 47)
+	// and starts at 0, so no offset is necessary. This includes
+	// solo5hvt, where the heap is in the low 4GB.
+	arenaBaseOffset uintptr = sys.GoarchAmd64 * (1 - sys.GoosSolo5hvt) * (1 << 47)
 
 	// Max number of threads to run garbage collection.
 	// 2, 3, and 4 are all plausible maximums depending
@@ -1114,6 +1123,9 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 		if t := (gcTrigger{kind: gcTriggerHeap}); t.test() {
 			gcStart(t)
 		}
+		if GOOS == "solo5hvt" {
+			sysmonpoll()
+		}
 	}
 
 	return x
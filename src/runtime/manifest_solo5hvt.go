@@ -0,0 +1,112 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// The manifest describes the devices of the application, see solo5's
+// mft_abi.h. It starts with a header, followed by nentries entries. Entry 0
+// is reserved. The runtime decodes the entries for the block cache, and for
+// package syscall with syscall_solo5Device.
+type manifest struct {
+	version  uint32
+	nentries uint32
+	entries  uint64 // mftEntry
+}
+
+// Device types, keep in sync with syscall.DevBlockBasic and
+// syscall.DevNetBasic.
+const (
+	manifestDevBlockBasic = 1
+	manifestDevNetBasic   = 2
+)
+
+const mftEntrySize = 68 + 4 + 16 + 8 + 1 + 7
+
+type mftEntry struct {
+	name     [68]byte // c string
+	etype    uint32
+	info     [16]byte // either mftBlockBasic or mftNetBasic
+	b        uint64   // private to the tender
+	attached bool
+	_        [7]byte
+}
+
+type mftBlockBasic struct {
+	capacity  uint64
+	blockSize uint16
+}
+
+type mftNetBasic struct {
+	mac [6]byte
+	mtu uint16
+}
+
+// mftLookup returns the manifest entry for device handle, or nil.
+func mftLookup(handle int) *mftEntry {
+	m := (*manifest)(unsafe.Pointer(solo5BootInfo.Manifest))
+	if handle <= 0 || handle >= int(m.nentries) {
+		return nil
+	}
+	p := uintptr(unsafe.Pointer(&m.entries))
+	p += uintptr(handle * mftEntrySize)
+	return (*mftEntry)(unsafe.Pointer(p))
+}
+
+// solo5BlockInfo returns the capacity and block size of the block device
+// with handle.
+func solo5BlockInfo(handle int) (capacity int64, blockSize int, ok bool) {
+	e := mftLookup(handle)
+	if e == nil || e.etype != manifestDevBlockBasic || !e.attached {
+		return 0, 0, false
+	}
+	info := (*mftBlockBasic)(unsafe.Pointer(&e.info))
+	return int64(info.capacity), int(info.blockSize), info.blockSize > 0
+}
+
+// solo5Device is syscall.Device, keep in sync.
+type solo5Device struct {
+	Name      string
+	Handle    int
+	Type      int
+	Attached  bool
+	Capacity  int64
+	BlockSize int
+	MAC       [6]byte
+	MTU       int
+}
+
+// syscall_solo5Device stores the device with handle in d, a *syscall.Device.
+// It returns false if the manifest has no entry for handle.
+//
+//go:linkname syscall_solo5Device syscall.solo5Device
+func syscall_solo5Device(handle int, d unsafe.Pointer) bool {
+	e := mftLookup(handle)
+	if e == nil {
+		return false
+	}
+	n := 0
+	for n < len(e.name) && e.name[n] != 0 {
+		n++
+	}
+	dev := solo5Device{
+		Name:     string(e.name[:n]),
+		Handle:   handle,
+		Type:     int(e.etype),
+		Attached: e.attached,
+	}
+	switch e.etype {
+	case manifestDevBlockBasic:
+		info := (*mftBlockBasic)(unsafe.Pointer(&e.info))
+		dev.Capacity = int64(info.capacity)
+		dev.BlockSize = int(info.blockSize)
+	case manifestDevNetBasic:
+		info := (*mftNetBasic)(unsafe.Pointer(&e.info))
+		dev.MAC = info.mac
+		dev.MTU = int(info.mtu)
+	}
+	*(*solo5Device)(d) = dev
+	return true
+}
@@ -4,20 +4,72 @@ import (
 	"unsafe"
 )
 
+// Guest memory allocator. The memory from the end of the kernel to the boot
+// stack at the top of memory is handed out in page ranges from memPages,
+// see memlist.go.
+//
+// With GODEBUG=solo5mempoison=1, free and unused memory is filled with
+// memPoison, and the poison is verified when the memory is reserved again.
+// This catches writes to memory after it was freed or released. The setting
+// is read once, by memDebugInit, as GODEBUG is only known after the heap
+// has started.
+
+const (
+	_PAGESIZE = memPageSize
+
+	// The tender starts the kernel with the stack at the top of memory.
+	// rt0_go uses the top 64KB as g0 stack.
+	bootStackSize = 64 << 10
+)
+
 var (
-	memoryNext uintptr
-	memoryEnd  uintptr
+	memoryStart uintptr // End of the kernel.
+	memoryEnd   uintptr // Start of the boot stack.
+
+	memlock  mutex
+	memPages memList
 )
 
-//go:nosplit
+// memInit puts all memory between the kernel and the boot stack on the free
+// list, and makes it the memory limit. Called from osinit.
+func memInit() {
+	if memoryEnd > 1<<heapAddrBits {
+		// The heap arena index does not cover more.
+		memoryEnd = 1 << heapAddrBits
+	}
+	memPages.init(memoryStart, memoryEnd)
+	memoryLimit = memPages.nfree
+}
+
+// memDebugInit starts poisoning memory if GODEBUG asks for it. Called by
+// schedinit after parsedebugvars.
+func memDebugInit() {
+	if debug.solo5mempoison != 0 {
+		lock(&memlock)
+		memPages.setPoison()
+		unlock(&memlock)
+	}
+}
+
+// sysAlloc allocates from the top of memory, and sysReserve from the bottom,
+// so runtime structures do not end up between heap arenas and keep the heap
+// from growing contiguously.
 func sysAlloc(n uintptr, sysStat *uint64) unsafe.Pointer {
-	p := sysReserve(nil, n)
-	sysMap(p, n, sysStat)
-	// println("sysAlloc, n=", n, " p=", p)
+	n = memPageRound(n)
+	lock(&memlock)
+	p := memPages.allocTop(n)
+	memPages.check()
+	unlock(&memlock)
+	if p != nil {
+		sysMap(p, n, sysStat)
+	}
 	return p
 }
 
+// sysUnused cannot return memory to the tender. The memory stays with the
+// heap, which will sysUsed it again before use.
 func sysUnused(v unsafe.Pointer, n uintptr) {
+	memPages.unused(uintptr(v), n)
 }
 
 func sysUsed(v unsafe.Pointer, n uintptr) {
@@ -26,27 +78,37 @@ func sysUsed(v unsafe.Pointer, n uintptr) {
 func sysHugePage(v unsafe.Pointer, n uintptr) {
 }
 
-//go:nosplit
 func sysFree(v unsafe.Pointer, n uintptr, sysStat *uint64) {
 	mSysStatDec(sysStat, n)
+	n = memPageRound(n)
+	lock(&memlock)
+	memPages.release(uintptr(v), n)
+	memPages.check()
+	unlock(&memlock)
 }
 
+// sysFault leaves the memory reserved, it is never reused.
 func sysFault(v unsafe.Pointer, n uintptr) {
+	memPages.unused(uintptr(v), n)
 }
 
 func sysReserve(v unsafe.Pointer, n uintptr) unsafe.Pointer {
-	if v != nil {
-		return nil
+	n = memPageRound(n)
+	if uintptr(v)&(_PAGESIZE-1) != 0 {
+		v = nil
 	}
-
-	if memoryNext+n > memoryEnd {
-		return nil
-	}
-	p := memoryNext
-	memoryNext += n
-	return unsafe.Pointer(p)
+	lock(&memlock)
+	p := memPages.alloc(uintptr(v), n)
+	memPages.check()
+	unlock(&memlock)
+	return p
 }
 
 func sysMap(v unsafe.Pointer, n uintptr, sysStat *uint64) {
+	// sysReserve has already allocated the memory,
+	// but has not adjusted stats.
 	mSysStatInc(sysStat, n)
+	lock(&memlock)
+	memPages.touch(uintptr(v) + n)
+	unlock(&memlock)
 }
@@ -0,0 +1,150 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// Memory limit. On solo5hvt, the runtime manages all memory of the guest,
+// and there is nothing beyond it: when the heap cannot grow, the program
+// dies. Knowing the limit, the pacer caps the heap goal so that GC runs
+// more often as the heap approaches the limit, whatever GOGC says. If the
+// heap still runs out of memory, printOOMReport tells where it went.
+
+// memoryLimit is the total memory available to the runtime, set by osinit.
+// memPages.nfree is the part not yet handed out by sysReserve.
+var memoryLimit uintptr
+
+// memoryLimitReserve is the fraction of the memory limit, as a shift, that
+// the heap goal keeps free for fragmentation and for memory that is not
+// counted in heap_live, such as stacks and mcaches.
+const memoryLimitReserve = 4
+
+// gcMemoryLimitGoal returns the largest heap goal that fits in the memory
+// limit. The heap can use its current arenas and the free memory, minus
+// the metadata of the arenas it would need for that.
+//
+// mheap_.lock must be held.
+func gcMemoryLimitGoal() uint64 {
+	free := uint64(memPages.nfree)
+	free -= free / heapArenaBytes * uint64(unsafe.Sizeof(heapArena{}))
+	avail := memstats.heap_sys + free
+	reserve := uint64(memoryLimit) >> memoryLimitReserve
+	if avail < reserve {
+		return 0
+	}
+	return avail - reserve
+}
+
+//go:linkname readMemoryLimit runtime/debug.readMemoryLimit
+func readMemoryLimit() (limit, headroom uint64) {
+	if memoryLimit == 0 {
+		return 0, 0
+	}
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		limit = uint64(memoryLimit)
+		headroom = uint64(memPages.nfree) + memstats.heap_idle
+		unlock(&mheap_.lock)
+	})
+	return limit, headroom
+}
+
+// oomSites is the number of allocation sites in the out of memory report.
+const oomSites = 10
+
+// printOOMReport prints the heap statistics and the allocation sites with
+// the most memory in use, after the heap failed to grow. The sizes per site
+// are estimated from the memory profile.
+//
+// mheap_.lock must be held. proflock is not acquired, this M may hold it
+// already, and the program is about to die anyway.
+func printOOMReport() {
+	print("runtime: memory limit ", memoryLimit, " bytes, ", memPages.nfree, " free\n")
+	print("runtime: heap: live ", memstats.heap_live, ", marked ", memstats.heap_marked, ", goal ", memstats.next_gc,
+		", in use ", memstats.heap_inuse, ", idle ", memstats.heap_idle, ", sys ", memstats.heap_sys, "\n")
+	print("runtime: other: stacks ", memstats.stacks_inuse, ", mspan ", memstats.mspan_sys, ", mcache ", memstats.mcache_sys,
+		", profile ", memstats.buckhash_sys, ", gc ", memstats.gc_sys, ", other ", memstats.other_sys, "\n")
+	print("runtime: ", memstats.numgc, " completed GC cycles\n")
+
+	if MemProfileRate <= 0 {
+		print("runtime: no allocation sites, memory profiling is disabled\n")
+		return
+	}
+	var top [oomSites]*bucket
+	var topBytes, topObjects [oomSites]uintptr
+	for b := mbuckets; b != nil; b = b.allnext {
+		mp := b.mp()
+		c := mp.active
+		for i := range mp.future {
+			c.add(&mp.future[i])
+		}
+		if c.alloc_bytes <= c.free_bytes || c.allocs <= c.frees {
+			continue
+		}
+		objects := c.allocs - c.frees
+		bytes := memProfScale(c.alloc_bytes-c.free_bytes, objects)
+		i := len(top)
+		for i > 0 && bytes > topBytes[i-1] {
+			i--
+		}
+		if i == len(top) {
+			continue
+		}
+		copy(top[i+1:], top[i:len(top)-1])
+		copy(topBytes[i+1:], topBytes[i:len(top)-1])
+		copy(topObjects[i+1:], topObjects[i:len(top)-1])
+		top[i], topBytes[i], topObjects[i] = b, bytes, objects
+	}
+
+	print("runtime: largest allocation sites, estimated from the memory profile:\n")
+	for i, b := range top {
+		if b == nil {
+			break
+		}
+		print("\n", topBytes[i], " bytes in use, ", topObjects[i], " sampled objects, allocated at\n")
+		for _, pc := range b.stk() {
+			f := findfunc(pc)
+			if !f.valid() {
+				print("?()\n\tpc=", hex(pc), "\n")
+				continue
+			}
+			file, line := funcline(f, pc-1)
+			print(funcname(f), "\n\t", file, ":", line, "\n")
+		}
+	}
+	print("\n")
+}
+
+// memProfScale estimates the bytes allocated, given the bytes of objects
+// sampled by the memory profiler. Like pprof, it divides by the probability
+// of an object of the average size being sampled.
+func memProfScale(bytes, objects uintptr) uintptr {
+	if MemProfileRate == 1 {
+		return bytes
+	}
+	avg := float64(bytes) / float64(objects)
+	p := 1 - expNeg(avg/float64(MemProfileRate))
+	if p <= 0 {
+		return bytes
+	}
+	return uintptr(float64(bytes) / p)
+}
+
+// expNeg returns an approximation of e**-x, for x >= 0. It halves x until
+// the first terms of the series are exact enough, and squares the result
+// back.
+func expNeg(x float64) float64 {
+	n := 0
+	for x > 1.0/1024 && n < 64 {
+		x /= 2
+		n++
+	}
+	e := 1 - x + x*x/2 - x*x*x/6
+	for ; n > 0; n-- {
+		e *= e
+	}
+	return e
+}
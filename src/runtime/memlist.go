@@ -0,0 +1,262 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// Free list of the guest memory allocator of solo5hvt, see mem_solo5hvt.go.
+// It is built on all systems so that it is tested on the host.
+//
+// The memory between start and end is handed out in page ranges. Free ranges
+// are kept in a list sorted by address, with the list header in the first
+// bytes of the range itself. Adjacent free ranges are merged, so memory
+// that is released can be allocated again, also at the hint addresses the
+// heap uses to grow its arenas contiguously.
+//
+// Allocated memory must be zero. Free ranges are zero, except for their
+// header. Memory at or above touched has never been used, so release only
+// clears the part of a range below it.
+//
+// With poison set, free and unused memory is filled with memPoison instead,
+// and the poison is verified when the memory is allocated again. This
+// catches writes to memory after it was freed or released.
+
+const (
+	memPageSize = 4 << 10
+	memPoison   = 0xdeadbeefdeadbeef
+)
+
+type memList struct {
+	start, end uintptr
+	head       memRangePtr // sorted in ascending order
+	nfree      uintptr     // bytes in the free ranges
+	touched    uintptr     // end of the highest range ever used
+	poison     bool
+}
+
+type memRange struct {
+	next memRangePtr
+	size uintptr
+}
+
+type memRangePtr uintptr
+
+func (p memRangePtr) ptr() *memRange   { return (*memRange)(unsafe.Pointer(p)) }
+func (p *memRangePtr) set(x *memRange) { *p = memRangePtr(unsafe.Pointer(x)) }
+
+// init makes the pages between start and end, which must be zero, one free
+// range.
+func (l *memList) init(start, end uintptr) {
+	start = memPageRound(start)
+	end &^= memPageSize - 1
+	if start >= end {
+		throw("no memory")
+	}
+	l.start = start
+	l.end = end
+	l.touched = start
+	p := (*memRange)(unsafe.Pointer(start))
+	p.next = 0
+	p.size = end - start
+	l.head.set(p)
+	l.nfree = p.size
+}
+
+// setPoison fills the free ranges with memPoison and keeps poisoning
+// memory from then on.
+func (l *memList) setPoison() {
+	for p := l.head.ptr(); p != nil; p = p.next.ptr() {
+		hdr := unsafe.Sizeof(*p)
+		memFill(uintptr(unsafe.Pointer(p))+hdr, p.size-hdr, memPoison)
+	}
+	l.poison = true
+}
+
+// alloc removes the range [v, v+n) from the free list and returns v. If v
+// is 0, the first free range large enough is used. alloc returns nil if the
+// memory is not free.
+func (l *memList) alloc(v, n uintptr) unsafe.Pointer {
+	prev := &l.head
+	for p := l.head.ptr(); p != nil; p = p.next.ptr() {
+		start := uintptr(unsafe.Pointer(p))
+		end := start + p.size
+		if v == 0 && p.size >= n {
+			v = start
+		}
+		if v != 0 && v < start {
+			return nil
+		}
+		if v == 0 || v+n > end {
+			prev = &p.next
+			continue
+		}
+
+		if l.poison {
+			memCheckPoison(p, v, n)
+		}
+		next := p.next
+		if v+n < end {
+			q := (*memRange)(unsafe.Pointer(v + n))
+			q.next = next
+			q.size = end - (v + n)
+			next.set(q)
+		}
+		if v > start {
+			p.size = v - start
+			p.next = next
+		} else {
+			*prev = next
+			*p = memRange{}
+		}
+		if l.poison {
+			memclrNoHeapPointers(unsafe.Pointer(v), n)
+		}
+		l.nfree -= n
+		return unsafe.Pointer(v)
+	}
+	return nil
+}
+
+// allocTop removes n bytes from the end of the last free range that is
+// large enough, and returns them. allocTop returns nil if there is no such
+// range.
+func (l *memList) allocTop(n uintptr) unsafe.Pointer {
+	var last *memRange
+	for p := l.head.ptr(); p != nil; p = p.next.ptr() {
+		if p.size >= n {
+			last = p
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return l.alloc(uintptr(unsafe.Pointer(last))+last.size-n, n)
+}
+
+// touch records that the memory up to end has been used.
+func (l *memList) touch(end uintptr) {
+	if end = memPageRound(end); end > l.touched {
+		l.touched = end
+	}
+}
+
+// unused poisons [v, v+n), memory that stays allocated but is not used
+// until it is written again.
+func (l *memList) unused(v, n uintptr) {
+	if l.poison {
+		memFill(v, n&^7, memPoison)
+	}
+}
+
+// release clears or poisons the range [v, v+n) and adds it to the free list.
+func (l *memList) release(v, n uintptr) {
+	if l.poison {
+		memFill(v, n, memPoison)
+	} else if v < l.touched {
+		end := v + n
+		if end > l.touched {
+			end = l.touched
+		}
+		memclrNoHeapPointers(unsafe.Pointer(v), end-v)
+	}
+	l.free(v, n)
+}
+
+// free adds the range [v, v+n) to the free list, merging it with the ranges
+// before and after it. The memory must already be zeroed or poisoned.
+func (l *memList) free(v, n uintptr) {
+	if v < l.start || v+n > l.end || v+n < v {
+		print("runtime: free of [", hex(v), ", ", hex(v+n), ") outside memory\n")
+		throw("mem: bad free")
+	}
+	prev := &l.head
+	var before *memRange
+	p := l.head.ptr()
+	for p != nil && uintptr(unsafe.Pointer(p)) < v {
+		before = p
+		prev = &p.next
+		p = p.next.ptr()
+	}
+	if before != nil && uintptr(unsafe.Pointer(before))+before.size > v || p != nil && v+n > uintptr(unsafe.Pointer(p)) {
+		print("runtime: free of [", hex(v), ", ", hex(v+n), ") overlaps free memory\n")
+		throw("mem: double free")
+	}
+
+	b := (*memRange)(unsafe.Pointer(v))
+	b.size = n
+	b.next.set(p)
+	if p != nil && v+n == uintptr(unsafe.Pointer(p)) {
+		b.size += p.size
+		b.next = p.next
+		l.clearHdr(p)
+	}
+	if before != nil && uintptr(unsafe.Pointer(before))+before.size == v {
+		before.size += b.size
+		before.next = b.next
+		l.clearHdr(b)
+	} else {
+		prev.set(b)
+	}
+	l.nfree += n
+}
+
+// clearHdr clears the header of a range that was merged into the range
+// before it.
+func (l *memList) clearHdr(p *memRange) {
+	if l.poison {
+		memFill(uintptr(unsafe.Pointer(p)), unsafe.Sizeof(*p), memPoison)
+	} else {
+		*p = memRange{}
+	}
+}
+
+// check verifies the free list when poisoning.
+func (l *memList) check() {
+	if !l.poison {
+		return
+	}
+	var total uintptr
+	for p := l.head.ptr(); p != nil; p = p.next.ptr() {
+		start := uintptr(unsafe.Pointer(p))
+		if start < l.start || start+p.size > l.end || p.size == 0 || p.size&(memPageSize-1) != 0 {
+			print("runtime: free range ", p, " of size ", p.size, "\n")
+			throw("mem: bad free range")
+		}
+		if p.next != 0 && start+p.size >= uintptr(p.next) {
+			print("runtime: ", p, "+", p.size, " >= ", unsafe.Pointer(p.next), "\n")
+			throw("mem: unordered or uncoalesced list")
+		}
+		total += p.size
+	}
+	if total != l.nfree {
+		print("runtime: free list has ", total, " bytes, expected ", l.nfree, "\n")
+		throw("mem: bad free count")
+	}
+}
+
+// memCheckPoison verifies that [v, v+n) in the free range p is still
+// poisoned, except for the header of p.
+func memCheckPoison(p *memRange, v, n uintptr) {
+	for a := v; a < v+n; a += 8 {
+		if a < uintptr(unsafe.Pointer(p))+unsafe.Sizeof(*p) {
+			continue
+		}
+		if *(*uint64)(unsafe.Pointer(a)) != memPoison {
+			print("runtime: value at addr ", hex(a), " in free range ", p, " of size ", p.size, " is not poison\n")
+			throw("mem: write to free memory")
+		}
+	}
+}
+
+// memFill sets the n bytes at v, a multiple of 8, to the repeated value x.
+func memFill(v, n uintptr, x uint64) {
+	for a := v; a < v+n; a += 8 {
+		*(*uint64)(unsafe.Pointer(a)) = x
+	}
+}
+
+func memPageRound(p uintptr) uintptr {
+	return (p + memPageSize - 1) &^ (memPageSize - 1)
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"fmt"
+	. "runtime"
+	"testing"
+)
+
+func checkMemRanges(t *testing.T, m *MemList, want string) {
+	t.Helper()
+	if got := fmt.Sprint(m.Ranges()); got != want {
+		t.Fatalf("free ranges %s, want %s", got, want)
+	}
+}
+
+func TestMemListCoalesce(t *testing.T) {
+	m := NewMemList(16)
+	checkMemRanges(t, m, "[[0 16]]")
+	if p := m.Alloc(-1, 16); p != 0 {
+		t.Fatalf("alloc of all memory got page %d", p)
+	}
+	checkMemRanges(t, m, "[]")
+	m.Fill(0, 16, 1)
+
+	// Frees merge with the free ranges before and after them.
+	m.Free(2, 2)
+	m.Free(6, 2)
+	checkMemRanges(t, m, "[[2 4] [6 8]]")
+	m.Free(4, 2)
+	checkMemRanges(t, m, "[[2 8]]")
+	m.Free(0, 2)
+	checkMemRanges(t, m, "[[0 8]]")
+	m.Free(12, 4)
+	checkMemRanges(t, m, "[[0 8] [12 16]]")
+	m.Free(8, 4)
+	checkMemRanges(t, m, "[[0 16]]")
+	if !m.Holds(0, 16, 0) {
+		t.Fatalf("free memory is not zero")
+	}
+
+	// Merged ranges can be allocated again, at a hint address.
+	if p := m.Alloc(4, 4); p != 4 {
+		t.Fatalf("alloc at page 4 got page %d", p)
+	}
+	checkMemRanges(t, m, "[[0 4] [8 16]]")
+	if p := m.Alloc(2, 4); p != -1 {
+		t.Fatalf("alloc of pages in use got page %d", p)
+	}
+	if p := m.Alloc(-1, 8); p != 8 {
+		t.Fatalf("alloc of 8 pages got page %d", p)
+	}
+	checkMemRanges(t, m, "[[0 4]]")
+}
+
+func TestMemListPoison(t *testing.T) {
+	m := NewMemList(16)
+	m.SetPoison()
+	if !m.Holds(0, 16, MemPoison) {
+		t.Fatalf("free memory is not poisoned")
+	}
+
+	// Allocated memory is zero, freed memory is poisoned again.
+	p := m.Alloc(-1, 4)
+	if !m.Holds(p, 4, 0) {
+		t.Fatalf("allocated memory is not zero")
+	}
+	m.Fill(p, 4, 1)
+	m.Free(p, 4)
+	checkMemRanges(t, m, "[[0 16]]")
+	if !m.Holds(0, 16, MemPoison) {
+		t.Fatalf("freed memory is not poisoned")
+	}
+
+	// So is unused memory.
+	m.Alloc(-1, 16)
+	m.Unused(4, 2)
+	if !m.Holds(4, 2, MemPoison) || !m.Holds(0, 4, 0) {
+		t.Fatalf("unused memory is not poisoned")
+	}
+
+	// The headers of merged ranges are poisoned too.
+	m.Free(8, 8)
+	m.Free(0, 8)
+	checkMemRanges(t, m, "[[0 16]]")
+	if !m.Holds(0, 16, MemPoison) {
+		t.Fatalf("merged free memory is not poisoned")
+	}
+}
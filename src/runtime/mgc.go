@@ -813,6 +813,22 @@ func gcSetTriggerRatio(triggerRatio float64) {
 		}
 	}
 
+	// Near the memory limit, lower the goal so the heap still fits,
+	// even if GC is off. The trigger keeps some distance to the goal.
+	// If the marked heap alone is over the limit, this collects
+	// continuously, in the hope that some of it is freed.
+	if memoryLimit != 0 {
+		if max := gcMemoryLimitGoal(); goal > max {
+			goal = max
+			if goal < memstats.heap_marked {
+				goal = memstats.heap_marked
+			}
+			if max := memstats.heap_marked + (goal-memstats.heap_marked)*7/8; trigger > max {
+				trigger = max
+			}
+		}
+	}
+
 	// Commit to the trigger and goal.
 	memstats.gc_trigger = trigger
 	memstats.next_gc = goal
@@ -1252,6 +1252,9 @@ func (h *mheap) grow(npage uintptr) bool {
 	v, size := h.sysAlloc(ask)
 	if v == nil {
 		print("runtime: out of memory: cannot allocate ", ask, "-byte block (", memstats.heap_sys, " in use)\n")
+		if memoryLimit != 0 {
+			printOOMReport()
+		}
 		return false
 	}
 
@@ -0,0 +1,94 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Network poller for solo5hvt.
+// The "file descriptors" are solo5 device handles, as found in the manifest.
+// The poll hypercall returns a set of handles with pending input, there is
+// no way to wait for a device to become writable: writes never block.
+// Readiness is level-triggered, a device stays in the ready set until all
+// pending input has been read.
+
+// Solo5 passes device readiness as a 64-bit set, with bit i for handle i.
+const maxDevices = 64
+
+// Poll descriptors of opened devices, indexed by solo5 handle.
+var netpollDevices [maxDevices]*pollDesc
+
+// netpollNoDevice is the fd of a pollDesc for which netpollopen failed
+// because the device was in use.
+const netpollNoDevice = ^uintptr(0)
+
+func netpollinit() {
+}
+
+func netpolldescriptor() uintptr {
+	return ^uintptr(0)
+}
+
+func netpollopen(fd uintptr, pd *pollDesc) int32 {
+	// Handle 0 is the reserved first manifest entry.
+	if fd == 0 || fd >= maxDevices {
+		return _EINVAL
+	}
+	if netpollDevices[fd] != nil {
+		// The caller closes pd after an error, and pd.fd is what
+		// poll_runtime_pollClose passes to netpollclose. Change it so
+		// that does not unregister the pollDesc using the device.
+		pd.fd = netpollNoDevice
+		return _EBUSY
+	}
+	netpollDevices[fd] = pd
+	return 0
+}
+
+// netpollclose unregisters the pollDesc of device fd. For a pollDesc that
+// did not get its device, fd is netpollNoDevice, and there is nothing to
+// unregister.
+func netpollclose(fd uintptr) int32 {
+	if fd == netpollNoDevice {
+		return 0
+	}
+	if fd >= maxDevices || netpollDevices[fd] == nil {
+		return _EINVAL
+	}
+	netpollDevices[fd] = nil
+	return 0
+}
+
+func netpollarm(pd *pollDesc, mode int) {
+	throw("runtime: unused")
+}
+
+// polls for ready devices
+// returns list of goroutines that become runnable
+func netpoll(block bool) gList {
+	var timeout uint64
+	if block {
+		timeout = pollForever
+	}
+	for {
+		readySet, _ := solo5Poll(timeout)
+		toRun := netpollReadySet(readySet)
+		if !block || !toRun.empty() {
+			return toRun
+		}
+	}
+}
+
+// netpollReadySet returns the goroutines waiting for input on the devices in
+// readySet, as returned by solo5Poll.
+func netpollReadySet(readySet uint64) gList {
+	var toRun gList
+	for fd := uintptr(1); readySet>>fd != 0 && fd < maxDevices; fd++ {
+		if readySet&(1<<fd) == 0 {
+			continue
+		}
+		if pd := netpollDevices[fd]; pd != nil {
+			netpollready(&toRun, pd, 'r')
+		}
+	}
+	return toRun
+}
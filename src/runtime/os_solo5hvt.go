@@ -4,9 +4,7 @@
 
 package runtime
 
-import (
-	"unsafe"
-)
+import "unsafe"
 
 type mOS struct{}
 type sigset uint32
@@ -14,31 +12,26 @@ type gsignalStack struct{}
 
 func osinit() {
 	ncpu = 1
-	physPageSize = 4 * 1024
-}
-
-//go:nosplit
-func getRandomData(r []byte) {
-	// xxx todo bug, need to actually set random data!
+	physPageSize = _PAGESIZE
+	memInit()
+	wallClockSync(nanotime(), int64(solo5Walltime()))
 }
 
 const _NSIG = 0
 
-func signame(sig uint32) string {
-	return ""
-}
-
 func initsig(preinit bool) {
 }
 
 func goenvs() {
 	solo5envs()
+	stderrPrefix = gogetenv("SOLO5_STDERR_PREFIX")
+	blkcacheConfigure()
 }
 
 // Called to initialize a new m (including the bootstrap m).
 // Called on the parent thread (main thread in case of bootstrap), can allocate memory.
 func mpreinit(mp *m) {
-	mp.gsignal = malg(2 * 1024)
+	mp.gsignal = malg(32 * 1024) // Stack for CPU exceptions.
 	mp.gsignal.m = mp
 }
 
@@ -62,6 +55,7 @@ func sigblock() {
 // Called to initialize a new m (including the bootstrap m).
 // Called on the new thread, can not allocate memory.
 func minit() {
+	trapinit()
 }
 
 // Called from dropm to undo the effect of an minit.
@@ -69,8 +63,9 @@ func minit() {
 func unminit() {
 }
 
+// crash exits instead of faulting, there is no core to dump.
 func crash() {
-	*(*int32)(nil) = 0
+	exit(2)
 }
 
 func setProcessCPUProfiler(hz int32) {}
@@ -105,6 +100,12 @@ const (
 	s5unspec
 )
 
+// Errno values returned to package syscall, keep in sync with errno_solo5hvt.go.
+const (
+	_EBUSY  = 16
+	_EINVAL = 22
+)
+
 type bootInfo struct {
 	MemSize      uintptr // memory size in bytes
 	KernelEnd    uintptr // address of the end of kernel
@@ -114,7 +115,6 @@ type bootInfo struct {
 }
 
 var solo5BootInfo *bootInfo
-var Solo5BootInfo *bootInfo
 
 //go:nosplit
 func solo5Walltime() (nsecs uint64) {
@@ -128,17 +128,6 @@ func solo5Puts(s string) {
 	KeepAlive(s)
 }
 
-// xxx do not export
-//go:nosplit
-func Solo5Write(buf []byte) {
-	var arg = struct {
-		data   uintptr
-		length uint64
-	}{uintptr(unsafe.Pointer(&buf[0])), uint64(len(buf))}
-	outl(hypercallPuts, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(&arg)
-}
-
 //go:nosplit
 func solo5Putp(p uintptr, n int) {
 	var arg = struct {
@@ -163,143 +152,112 @@ func solo5Poll(nsec uint64) (uint64, int64) {
 	return arg.readySet, arg.ret
 }
 
+// exit halts the guest. When the program exits normally, with os.Exit or by
+// returning from main, the changed blocks of the block cache are written to
+// the devices first. After a fatal error the state of the runtime is not to
+// be trusted, and changed blocks are lost.
+//
 //go:nosplit
-func solo5Blkwrite(handle, offset uint64, data []byte) int64 {
+func exit(code int32) {
+	if gp := getg(); gp != nil && gp.m != nil && gp == gp.m.curg && blkcache.lock.key == mutex_unlocked {
+		blkcache.flush()
+	}
 	var arg = struct {
 		// in
-		handle uint64
-		offset uint64
-		data   uintptr
-		length int64
-
-		// out
-		ret int64
-	}{handle, offset, uintptr(unsafe.Pointer(&data[0])), int64(len(data)), -1}
-	outl(hypercallBlkwrite, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(data)
-	return arg.ret
+		cookie     uintptr
+		exitStatus int64
+	}{0, int64(code)}
+	outl(hypercallHalt, uintptr(unsafe.Pointer(&arg)))
+	KeepAlive(&arg)
 }
 
 //go:nosplit
-func solo5Blkread(handle, offset uint64, data []byte) (int64, int64) {
+func solo5Blkread(handle int, p []byte, off int64) int64 {
 	var arg = struct {
 		// in
 		handle uint64
 		offset uint64
 		data   uintptr
-
-		// in/out
 		length int64
 
 		// out
 		ret int64
-	}{handle, offset, uintptr(unsafe.Pointer(&data[0])), int64(len(data)), 0}
+	}{uint64(handle), uint64(off), uintptr(unsafe.Pointer(&p[0])), int64(len(p)), 0}
 	outl(hypercallBlkread, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(data)
-	return arg.length, arg.ret
-}
-
-//go:nosplit
-func solo5Netwrite(handle uint64, data []byte) int64 {
-	var arg = struct {
-		// in
-		handle uint64
-		data   uintptr
-		length int64
-
-		// out
-		ret int64
-	}{handle, uintptr(unsafe.Pointer(&data[0])), int64(len(data)), -1}
-	outl(hypercallNetwrite, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(data)
+	KeepAlive(p)
 	return arg.ret
 }
 
 //go:nosplit
-func solo5Netread(handle uint64, data []byte) (int64, int64) {
+func solo5Blkwrite(handle int, p []byte, off int64) int64 {
 	var arg = struct {
 		// in
 		handle uint64
+		offset uint64
 		data   uintptr
-
-		// in/out
 		length int64
 
 		// out
 		ret int64
-	}{handle, uintptr(unsafe.Pointer(&data[0])), int64(len(data)), 0}
-	outl(hypercallNetread, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(data)
-	return arg.length, arg.ret
-}
-
-//go:nosplit
-func exit(code int32) {
-	var arg = struct {
-		// in
-		cookie     uintptr
-		exitStatus int64
-	}{0, int64(code)}
-	outl(hypercallHalt, uintptr(unsafe.Pointer(&arg)))
-	KeepAlive(&arg)
+	}{uint64(handle), uint64(off), uintptr(unsafe.Pointer(&p[0])), int64(len(p)), -1}
+	outl(hypercallBlkwrite, uintptr(unsafe.Pointer(&arg)))
+	KeepAlive(p)
+	return arg.ret
 }
 
 var buffer [512]byte
 var fmtbuf [32]byte
 
 var (
-	tscBase        uint64
-	nanotimeBase   uint64
-	walltimeOffset uint64 // offset from nanotime
-
-	// Nanotime is calculated as (tsc * tscMult) >> tscShift
-	// With "tsc" being the current tsc.
-	// And tscMult & tscShift calculated during initialization.
-	tscMult  uint32
-	tscShift uint8
+	// Nanotime is calculated as (tsc * tscMult) >> tscShift, with a
+	// 128-bit product, see tscNanotime. tscMult holds the 64 most
+	// significant bits of 1e9/CpuCycleFreq, and is calculated during
+	// initialization.
+	tscMult  uint64
+	tscShift uint
+
+	// lastNanotime is the last value returned by nanotime, which keeps
+	// the monotonic clock from going backwards if the TSC does.
+	lastNanotime int64
 )
 
 func nanotime() int64 {
-	tsc := uint64(cputicks())
-	tscDelta := tsc - tscBase
-	nanotimeBase += (tscDelta * uint64(tscMult)) >> tscShift
-	tscBase = tsc
-	return int64(nanotimeBase)
+	lastNanotime = tscNanotime(uint64(cputicks()), tscMult, tscShift, lastNanotime)
+	return lastNanotime
 }
 
+// walltime returns the wall clock, which is resynchronized with the host
+// every wallSyncPeriod, see wallclock.go.
 func walltime() (sec int64, nsec int32) {
-	ns := uint64(nanotime()) + walltimeOffset
-	sec = int64(ns / 1e9)
+	now := nanotime()
+	if now-wall.syncTime >= wallSyncPeriod {
+		wallClockSync(now, int64(solo5Walltime()))
+	}
+	ns := wallClock(now)
+	sec = ns / 1e9
 	nsec = int32(ns % 1e9)
 	return
 }
 
+//go:linkname syscall_walltime syscall.walltime
+func syscall_walltime() (sec int64, nsec int32) {
+	return walltime()
+}
+
 //go:nosplit
 func solo5init(bi *bootInfo) {
 	solo5BootInfo = bi
-	Solo5BootInfo = bi
-	memoryNext = bi.KernelEnd
-	memoryEnd = bi.MemSize
+	memoryStart = bi.KernelEnd
+	memoryEnd = bi.MemSize - bootStackSize
 
 	// Initialize time using TSC, from solo5.
-	tscShift = 32
-	const nanoseconds = 1e9
-	for tscShift > 0 && tscMult == 0 {
-		tmp := (nanoseconds << tscShift) / bi.CpuCycleFreq
-		if (tmp & 0xffffffff00000000) == 0 {
-			tscMult = uint32(tmp)
-		} else {
-			tscShift--
-		}
-	}
-	if tscMult == 0 {
+	if bi.CpuCycleFreq == 0 || bi.CpuCycleFreq >= 1<<63 {
 		solo5Puts("bad CpuCycleFreq\n")
 		exit(1)
 	}
+	tscMult, tscShift = tscScale(bi.CpuCycleFreq)
 
-	tscBase = uint64(cputicks())
-	nanotimeBase = (tscBase * uint64(tscMult)) >> tscShift // todo: use something like the mul64_32() from solo5?
-	walltimeOffset = solo5Walltime() - nanotimeBase
+	preemptTicks = bi.CpuCycleFreq * preemptCheckNS / 1e9
 
 	solo5Puts("solo5 init...\n")
 
@@ -384,89 +342,10 @@ func solo5init(bi *bootInfo) {
 	*/
 }
 
-func solo5LookupBlock(bi *bootInfo, name string) (handle uint64, info *mftBlockBasic) {
-	manifest := (*manifest)(unsafe.Pointer(bi.Manifest))
-	for i := uint32(1); i < manifest.nentries; i++ {
-		p := uintptr(unsafe.Pointer(&manifest.entries))
-		p += uintptr(i * mftEntrySize)
-		e := (*mftEntry)(unsafe.Pointer(p))
-		if e.etype != manifestDevBlockBasic {
-			continue
-		}
-		// xxx
-	}
-	return 0, nil
-}
-
-const mftEntrySize = 68 + 4 + 16 + 8 + 1 + 7
-
-const (
-	manifestDevBlockBasic = 1
-	manifestDevNetBasic   = 2
-	manifestReservedFrist = 1 << 30
-)
-
-type manifest struct {
-	version  uint32
-	nentries uint32
-	entries  uint64 // mftEntry
-}
-
-type mftEntry struct {
-	name  [68]byte // c string
-	etype uint32
-	info  uintptr // either mftBlockBasic or mftNetBasic
-}
-
-type mftBlockBasic struct {
-	capacity  uint64
-	blockSize uint16
-}
-
-type mftNetBasic struct {
-	mac [6]byte
-	mtu uint16
-}
-
 // xxx
 var noenv = []string{}
 var noargs = []string{}
 
-func split(s string) (t []string) {
-	for s != "" {
-		i := 0
-		for i < len(s) && s[i] != ' ' {
-			i++
-		}
-		t = append(t, s[:i])
-		if i < len(s) {
-			i++
-		}
-		s = s[i:]
-	}
-	return
-}
-
-func solo5envs() {
-	// solo5BootInfo.Cmdline looks like: -env KEY=value -env KEY=value -- arg1 arg2 ...
-
-	cmdline := gostring((*byte)(unsafe.Pointer(solo5BootInfo.Cmdline)))
-
-	t := split(cmdline)
-	envs = []string{}
-	for len(t) > 0 && t[0] == "-env" {
-		if len(t) == 1 {
-			panic("bad cmdline")
-		}
-		envs = append(envs, t[1])
-		t = t[2:]
-	}
-	if len(t) > 0 && t[0] == "--" {
-		t = t[1:]
-	}
-	argslice = append([]string{"solo5hvt"}, t...)
-}
-
 /*
 //go:nosplit
 func readblock() {
@@ -500,11 +379,52 @@ func usleep(usec uint32) {
 }
 
 func write(fd uintptr, p unsafe.Pointer, n int32) int32 {
-	solo5Putp(uintptr(p), int(n))
+	if fd == 2 && stderrPrefix != "" {
+		solo5PutErr((*[1 << 30]byte)(p)[:n:n])
+	} else {
+		solo5Putp(uintptr(p), int(n))
+	}
 	KeepAlive(p)
 	return 0
 }
 
+// Standard error and standard output both go to the console. With
+// SOLO5_STDERR_PREFIX set, the lines of standard error, including the
+// output of print and of panics, start with the prefix.
+var (
+	stderrPrefix  string
+	stderrMidLine bool // whether the last write to stderr ended without newline
+)
+
+// solo5PutErr writes b to the console as standard error.
+func solo5PutErr(b []byte) {
+	for len(b) > 0 {
+		if !stderrMidLine {
+			solo5Puts(stderrPrefix)
+		}
+		i := 0
+		for i < len(b) && b[i] != '\n' {
+			i++
+		}
+		if i < len(b) {
+			i++
+		}
+		solo5Putp(uintptr(unsafe.Pointer(&b[0])), i)
+		stderrMidLine = b[i-1] != '\n'
+		b = b[i:]
+	}
+}
+
+//go:linkname syscall_consoleWriteErr syscall.consoleWriteErr
+func syscall_consoleWriteErr(p []byte) {
+	if stderrPrefix != "" {
+		solo5PutErr(p)
+	} else if len(p) > 0 {
+		solo5Putp(uintptr(unsafe.Pointer(&p[0])), len(p))
+	}
+	KeepAlive(p)
+}
+
 func open(name *byte, mode, perm int32) int32 {
 	throw("open")
 	return 0
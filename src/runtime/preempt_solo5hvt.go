@@ -0,0 +1,42 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Preemption without timer interrupts. Code compiled with -gcflags=-tscpreempt
+// compares the cycle counter with preemptDeadline at the start of each
+// function and at each loop back-edge, and calls preemptcheck once the
+// deadline has passed. So goroutines that loop without calling the runtime
+// still let sysmonpoll run, and can be preempted at the end of their time
+// slice. The runtime itself is never compiled with the checks.
+
+var (
+	// preemptDeadline is the cycle counter value after which compiled
+	// code calls preemptcheck. It is read by the checks the compiler
+	// inserts.
+	preemptDeadline uint64
+
+	// preemptTicks is preemptCheckNS in cycle counter ticks, set by
+	// solo5init.
+	preemptTicks uint64
+)
+
+// preemptCheckNS is the time between calls to preemptcheck. It is the
+// shortest interval of sysmonpoll.
+const preemptCheckNS = 20 * 1000
+
+// preemptcheck is called by code compiled with -tscpreempt when
+// preemptDeadline has passed. It sets the next deadline, does the work of
+// sysmon and yields the processor if sysmonpoll asked the goroutine to.
+func preemptcheck() {
+	preemptDeadline = uint64(cputicks()) + preemptTicks
+	gp := getg()
+	if gp != gp.m.curg {
+		return
+	}
+	sysmonpoll()
+	if gp.preempt {
+		goschedguarded()
+	}
+}
@@ -553,6 +553,9 @@ func schedinit() {
 	goargs()
 	goenvs()
 	parsedebugvars()
+	if GOOS == "solo5hvt" {
+		memDebugInit()
+	}
 	gcinit()
 
 	sched.lastpoll = uint64(nanotime())
@@ -2143,6 +2146,10 @@ func execute(gp *g, inheritTime bool) {
 	gp.stackguard0 = gp.stack.lo + _StackGuard
 	if !inheritTime {
 		_g_.m.p.ptr().schedtick++
+		if GOOS == "solo5hvt" {
+			// Start of the time slice, for sysmonpoll.
+			_g_.m.p.ptr().sysmontick.schedwhen = nanotime()
+		}
 	}
 	_g_.m.curg = gp
 	gp.m = _g_.m
@@ -2183,6 +2190,9 @@ top:
 	if _p_.runSafePointFn != 0 {
 		runSafePointFn()
 	}
+	if GOOS == "solo5hvt" {
+		sysmonpoll()
+	}
 	if fingwait && fingwake {
 		if gp := wakefing(); gp != nil {
 			ready(gp, 0, true)
@@ -2484,6 +2494,9 @@ top:
 	if _g_.m.p.ptr().runSafePointFn != 0 {
 		runSafePointFn()
 	}
+	if GOOS == "solo5hvt" {
+		sysmonpoll()
+	}
 
 	var gp *g
 	var inheritTime bool
@@ -4378,6 +4391,59 @@ func sysmon() {
 	}
 }
 
+// sysmonpoll does the work of sysmon on solo5hvt, which has a single thread
+// and cannot run sysmon next to the goroutines. Instead, sysmonpoll is
+// called whenever the runtime gets control: from the scheduler, from the
+// idle poll in beforeIdle, and from mallocgc when it gets a new span. A
+// goroutine that has used up its time slice is preempted at its next
+// function call.
+//
+// Calls less than 20us apart, the shortest sleep of sysmon, return early.
+func sysmonpoll() {
+	_g_ := getg()
+	if _g_.m.locks != 0 || _g_.m.p == 0 {
+		return
+	}
+	now := nanotime()
+	if now-sysmonlast < 20*1000 {
+		return
+	}
+	sysmonlast = now
+
+	// wake goroutines whose sleep has ended
+	checkTimeouts()
+	// poll network if not polled for more than 10ms
+	lastpoll := int64(atomic.Load64(&sched.lastpoll))
+	if netpollinited() && lastpoll != 0 && lastpoll+10*1000*1000 < now {
+		atomic.Store64(&sched.lastpoll, uint64(now))
+		list := netpoll(false) // non-blocking - returns list of goroutines
+		injectglist(&list)
+	}
+	// preempt the running G if it's running for too long
+	if gp := _g_.m.curg; gp != nil && readgstatus(gp) == _Grunning {
+		if _g_.m.p.ptr().sysmontick.schedwhen+forcePreemptNS <= now {
+			gp.preempt = true
+			gp.stackguard0 = stackPreempt
+		}
+	}
+	// check if we need to force a GC
+	if t := (gcTrigger{kind: gcTriggerTime, now: now}); t.test() && atomic.Load(&forcegc.idle) != 0 {
+		lock(&forcegc.lock)
+		forcegc.idle = 0
+		var list gList
+		list.push(forcegc.g)
+		injectglist(&list)
+		unlock(&forcegc.lock)
+	}
+	if debug.schedtrace > 0 && sysmonlasttrace+int64(debug.schedtrace)*1000000 <= now {
+		sysmonlasttrace = now
+		schedtrace(debug.scheddetail > 0)
+	}
+}
+
+// Time of the last sysmonpoll and of its last schedtrace.
+var sysmonlast, sysmonlasttrace int64
+
 type sysmontick struct {
 	schedtick   uint32
 	schedwhen   int64
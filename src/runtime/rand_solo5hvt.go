@@ -0,0 +1,238 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import _ "unsafe" // for go:linkname
+
+// Random number generation for solo5hvt. There is no operating system to ask
+// for entropy, so the runtime keeps its own cryptographically secure
+// generator. It is used for getRandomData and, through syscall.GetRandom, by
+// crypto/rand.
+//
+// The generator is ChaCha20 with fast key erasure: each refill generates
+// csprngBlocks blocks of keystream, the first 32 bytes become the new key
+// and the rest is handed out, zeroing bytes as they are used. A compromise
+// of the state does not reveal earlier output.
+//
+// The key is seeded with RDSEED, or RDRAND if RDSEED is not available. Without
+// either, the seed is gathered from jitter in the time stamp counter while
+// doing work with varying timing. The key is reseeded from the hardware after
+// every csprngReseed bytes of output.
+
+const (
+	csprngBlocks = 4
+	csprngReseed = 1 << 20
+
+	cpuidRDRAND = 1 << 30 // CPUID leaf 1, ECX.
+	cpuidRDSEED = 1 << 18 // CPUID leaf 7, EBX.
+)
+
+// Implemented in sys_solo5hvt_amd64.s.
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func rdseed() (v uint64, ok bool)
+func rdrand() (v uint64, ok bool)
+
+var csprng struct {
+	lock mutex
+
+	init      bool
+	hasRDSEED bool
+	hasRDRAND bool
+
+	key    [8]uint32
+	buf    [csprngBlocks*64 - 32]byte
+	n      int // Unused bytes at the end of buf.
+	output int // Bytes generated since the last reseed.
+}
+
+// getRandomData fills r with random bytes.
+func getRandomData(r []byte) {
+	lock(&csprng.lock)
+	csprngRead(r)
+	unlock(&csprng.lock)
+}
+
+//go:linkname syscall_GetRandom syscall.GetRandom
+func syscall_GetRandom(r []byte) {
+	getRandomData(r)
+}
+
+// csprngRead fills r from the generator. csprng.lock must be held.
+func csprngRead(r []byte) {
+	if !csprng.init {
+		csprngInit()
+	}
+	for len(r) > 0 {
+		if csprng.n == 0 {
+			csprngRefill()
+		}
+		b := csprng.buf[len(csprng.buf)-csprng.n:]
+		n := copy(r, b)
+		for i := range b[:n] {
+			b[i] = 0
+		}
+		r = r[n:]
+		csprng.n -= n
+		csprng.output += n
+	}
+}
+
+func csprngInit() {
+	csprng.init = true
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID >= 1 {
+		_, _, ecx, _ := cpuid(1, 0)
+		csprng.hasRDRAND = ecx&cpuidRDRAND != 0
+	}
+	if maxID >= 7 {
+		_, ebx, _, _ := cpuid(7, 0)
+		csprng.hasRDSEED = ebx&cpuidRDSEED != 0
+	}
+	if !csprngHardwareSeed() {
+		csprngJitterSeed()
+	}
+}
+
+// csprngHardwareSeed mixes 256 bits from RDSEED or RDRAND into the key. It
+// returns false if neither instruction is available or keeps failing.
+func csprngHardwareSeed() bool {
+	var seed [4]uint64
+	for i := range seed {
+		v, ok := hardwareRandom()
+		if !ok {
+			return false
+		}
+		seed[i] = v
+	}
+	for i, v := range seed {
+		csprng.key[2*i] ^= uint32(v)
+		csprng.key[2*i+1] ^= uint32(v >> 32)
+	}
+	return true
+}
+
+// hardwareRandom returns 64 random bits from RDSEED, falling back to RDRAND.
+// Both can fail transiently when the hardware runs out of entropy.
+func hardwareRandom() (uint64, bool) {
+	if csprng.hasRDSEED {
+		for i := 0; i < 100; i++ {
+			if v, ok := rdseed(); ok {
+				return v, true
+			}
+			procyield(10)
+		}
+	}
+	if csprng.hasRDRAND {
+		for i := 0; i < 10; i++ {
+			if v, ok := rdrand(); ok {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// jitterBuf is memory touched by csprngJitterSeed, so the timing of its work
+// depends on cache and TLB state.
+var jitterBuf [4096]uint32
+
+// csprngJitterSeed seeds the key from the low bits of time stamp counter
+// differences while doing work of varying duration, in the spirit of
+// jitterentropy. The samples are folded into a 64-byte pool that is
+// scrambled with the ChaCha20 permutation after every 16 samples, and
+// the pool is mixed into the key.
+func csprngJitterSeed() {
+	var pool [16]uint32
+	pool[0] = uint32(solo5Walltime())
+	pool[1] = uint32(solo5Walltime() >> 32)
+	x := uint32(cputicks())
+	for i := 0; i < 16*1024; i++ {
+		t0 := cputicks()
+		// Wander through jitterBuf, the path depending on earlier timings.
+		for j := 0; j < 16+int(x&15); j++ {
+			k := x % uint32(len(jitterBuf))
+			jitterBuf[k] += x
+			x = (x*1664525 + 1013904223) ^ jitterBuf[(k*2654435761)%uint32(len(jitterBuf))]
+		}
+		d := uint64(cputicks() - t0)
+		x ^= uint32(d)
+		w := &pool[i%16]
+		*w = (*w<<7 | *w>>25) ^ uint32(d) ^ uint32(d>>32)
+		if i%16 == 15 {
+			chachaBlock(&pool, &pool)
+		}
+	}
+	for i := range csprng.key {
+		csprng.key[i] ^= pool[i] ^ pool[i+8]
+	}
+}
+
+// csprngRefill generates new keystream, rekeys the generator and fills buf.
+func csprngRefill() {
+	if csprng.output >= csprngReseed {
+		csprng.output = 0
+		if csprng.hasRDSEED || csprng.hasRDRAND {
+			csprngHardwareSeed()
+		}
+	}
+	var in, out [16]uint32
+	in[0], in[1], in[2], in[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574 // "expand 32-byte k"
+	copy(in[4:12], csprng.key[:])
+	var blocks [csprngBlocks * 64]byte
+	for i := 0; i < csprngBlocks; i++ {
+		in[12] = uint32(i) // Counter, the nonce in[13:16] is zero.
+		chachaBlock(&out, &in)
+		for j, v := range out {
+			b := blocks[i*64+j*4:]
+			b[0], b[1], b[2], b[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+		}
+	}
+	for i := range csprng.key {
+		b := blocks[i*4:]
+		csprng.key[i] = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	}
+	copy(csprng.buf[:], blocks[32:])
+	csprng.n = len(csprng.buf)
+	for i := range blocks {
+		blocks[i] = 0
+	}
+	for i := range in {
+		in[i], out[i] = 0, 0
+	}
+}
+
+// chachaBlock sets out to the ChaCha20 block function of in, as in RFC 7539,
+// section 2.3. Out and in may be the same.
+func chachaBlock(out, in *[16]uint32) {
+	x := *in
+	for i := 0; i < 10; i++ {
+		chachaQuarterRound(&x, 0, 4, 8, 12)
+		chachaQuarterRound(&x, 1, 5, 9, 13)
+		chachaQuarterRound(&x, 2, 6, 10, 14)
+		chachaQuarterRound(&x, 3, 7, 11, 15)
+		chachaQuarterRound(&x, 0, 5, 10, 15)
+		chachaQuarterRound(&x, 1, 6, 11, 12)
+		chachaQuarterRound(&x, 2, 7, 8, 13)
+		chachaQuarterRound(&x, 3, 4, 9, 14)
+	}
+	for i := range x {
+		out[i] = x[i] + in[i]
+	}
+}
+
+func chachaQuarterRound(x *[16]uint32, a, b, c, d int) {
+	x[a] += x[b]
+	x[d] ^= x[a]
+	x[d] = x[d]<<16 | x[d]>>16
+	x[c] += x[d]
+	x[b] ^= x[c]
+	x[b] = x[b]<<12 | x[b]>>20
+	x[a] += x[b]
+	x[d] ^= x[a]
+	x[d] = x[d]<<8 | x[d]>>24
+	x[c] += x[d]
+	x[b] ^= x[c]
+	x[b] = x[b]<<7 | x[b]>>25
+}
@@ -318,6 +318,7 @@ var debug struct {
 	scavenge           int32
 	scheddetail        int32
 	schedtrace         int32
+	solo5mempoison     int32 // for solo5hvt
 	tracebackancestors int32
 }
 
@@ -337,6 +338,7 @@ var dbgvars = []dbgVar{
 	{"scavenge", &debug.scavenge},
 	{"scheddetail", &debug.scheddetail},
 	{"schedtrace", &debug.schedtrace},
+	{"solo5mempoison", &debug.solo5mempoison},
 	{"tracebackancestors", &debug.tracebackancestors},
 }
 
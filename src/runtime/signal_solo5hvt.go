@@ -0,0 +1,203 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// There are no signals on solo5hvt. CPU exceptions are handled by the
+// runtime itself, see signal_solo5hvt_amd64.go. They are translated to the
+// signal and si_code a Linux kernel would deliver, so the fault handling
+// below works like in signal_unix.go and signal_sighandler.go.
+
+// sigTabT is the type of an entry in sigtable.
+type sigTabT struct {
+	flags int32
+	name  string
+}
+
+// Signal numbers and codes, as on Linux.
+const (
+	_SIGILL  = 0x4
+	_SIGTRAP = 0x5
+	_SIGBUS  = 0x7
+	_SIGFPE  = 0x8
+	_SIGSEGV = 0xb
+
+	_SI_KERNEL = 0x80
+
+	_ILL_ILLOPN = 0x2
+
+	_FPE_INTDIV = 0x1
+	_FPE_INTOVF = 0x2
+
+	_SEGV_MAPERR = 0x1
+	_SEGV_ACCERR = 0x2
+
+	_BUS_ADRERR = 0x2
+)
+
+var sigtable = [...]sigTabT{
+	/* 0 */ {0, "SIGNONE: no trap"},
+	/* 1 */ {0, "SIGHUP: terminal line hangup"},
+	/* 2 */ {0, "SIGINT: interrupt"},
+	/* 3 */ {0, "SIGQUIT: quit"},
+	/* 4 */ {_SigThrow, "SIGILL: illegal instruction"},
+	/* 5 */ {_SigThrow, "SIGTRAP: trace trap"},
+	/* 6 */ {0, "SIGABRT: abort"},
+	/* 7 */ {_SigPanic, "SIGBUS: bus error"},
+	/* 8 */ {_SigPanic, "SIGFPE: floating-point exception"},
+	/* 9 */ {0, "SIGKILL: kill"},
+	/* 10 */ {0, "SIGUSR1: user-defined signal 1"},
+	/* 11 */ {_SigPanic, "SIGSEGV: segmentation violation"},
+}
+
+func signame(sig uint32) string {
+	if sig >= uint32(len(sigtable)) {
+		return ""
+	}
+	return sigtable[sig].name
+}
+
+func sigpanic() {
+	g := getg()
+	if !canpanic(g) {
+		throw("unexpected signal during runtime execution")
+	}
+
+	switch g.sig {
+	case _SIGBUS:
+		if g.sigcode0 == _BUS_ADRERR && g.sigcode1 < 0x1000 {
+			panicmem()
+		}
+		// Support runtime/debug.SetPanicOnFault.
+		if g.paniconfault {
+			panicmem()
+		}
+		print("unexpected fault address ", hex(g.sigcode1), "\n")
+		throw("fault")
+	case _SIGSEGV:
+		if (g.sigcode0 == 0 || g.sigcode0 == _SEGV_MAPERR || g.sigcode0 == _SEGV_ACCERR) && g.sigcode1 < 0x1000 {
+			panicmem()
+		}
+		// Support runtime/debug.SetPanicOnFault.
+		if g.paniconfault {
+			panicmem()
+		}
+		print("unexpected fault address ", hex(g.sigcode1), "\n")
+		throw("fault")
+	case _SIGFPE:
+		switch g.sigcode0 {
+		case _FPE_INTDIV:
+			panicdivide()
+		case _FPE_INTOVF:
+			panicoverflow()
+		}
+		panicfloat()
+	}
+
+	if g.sig >= uint32(len(sigtable)) {
+		// can't happen: we looked up g.sig in sigtable to decide to call sigpanic
+		throw("unexpected signal value")
+	}
+	panic(errorString(sigtable[g.sig].name))
+}
+
+// trapgo is called by the exception stubs in sys_solo5hvt_amd64.s, on the
+// stack of m.gsignal but with g still set to the interrupted goroutine.
+// Like sigtrampgo, it switches to gsignal and calls the handler. When
+// trapgo returns, execution resumes at the program counter in f, which
+// the handler may have changed to sigpanic.
+//
+//go:nosplit
+//go:nowritebarrierrec
+func trapgo(f *trapFrame) {
+	if trapFatal(f.vector) {
+		// Possibly no usable stack or g, don't try to be clever.
+		solo5Puts("fatal error: ")
+		solo5Puts(trapNames[f.vector])
+		solo5Puts("\n")
+		exit(2)
+	}
+	g := getg()
+	if g == nil || g.m == nil || g.m.gsignal == nil {
+		solo5Puts("fatal error: ")
+		solo5Puts(trapNames[f.vector])
+		solo5Puts(" before runtime initialization\n")
+		exit(2)
+	}
+	if g == g.m.gsignal {
+		// The stack of the first exception was overwritten by this one.
+		solo5Puts("fatal error: ")
+		solo5Puts(trapNames[f.vector])
+		solo5Puts(" during exception handling\n")
+		exit(2)
+	}
+	setg(g.m.gsignal)
+	traphandler(f, g)
+	setg(g)
+}
+
+// traphandler handles a CPU exception that occurred in gp. It is a trimmed
+// down sighandler: the exception either becomes a panic in gp, or is fatal.
+//
+//go:nowritebarrierrec
+func traphandler(f *trapFrame, gp *g) {
+	_g_ := getg()
+	sig, code, addr := trapSignal(f)
+	c := &sigctxt{f, sig, code, addr}
+
+	flags := int32(_SigThrow)
+	if sig < uint32(len(sigtable)) && sigtable[sig].flags != 0 {
+		flags = sigtable[sig].flags
+	}
+	if flags&_SigPanic != 0 && gp.throwsplit {
+		// We can't safely sigpanic because it may grow the
+		// stack. Abort in the handler instead.
+		flags = _SigThrow
+	}
+	if isAbortPC(c.sigpc()) {
+		flags = _SigThrow
+	}
+	if flags&_SigPanic != 0 {
+		// Arrange the stack so that it looks like the point
+		// where the exception occurred made a call to the
+		// function sigpanic. Then set the PC to sigpanic.
+		gp.sig = sig
+		gp.sigcode0 = uintptr(c.sigcode())
+		gp.sigcode1 = uintptr(c.fault())
+		gp.sigpc = c.sigpc()
+
+		c.preparePanic(sig, gp)
+		return
+	}
+
+	_g_.m.throwing = 1
+	_g_.m.caughtsig.set(gp)
+
+	startpanic_m()
+
+	if sig != 0 {
+		print(sigtable[sig].name, "\n")
+	} else {
+		print(trapNames[f.vector], "\n")
+	}
+	print("PC=", hex(c.sigpc()), " m=", _g_.m.id, " sigcode=", c.sigcode(), "\n")
+	print("\n")
+
+	level, _, docrash := gotraceback()
+	if level > 0 {
+		goroutineheader(gp)
+		tracebacktrap(c.sigpc(), c.sigsp(), c.siglr(), gp)
+		tracebackothers(gp)
+		print("\n")
+		dumpregs(c)
+	}
+
+	if docrash {
+		crash()
+	}
+
+	printDebugLog()
+
+	exit(2)
+}
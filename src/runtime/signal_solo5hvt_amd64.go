@@ -0,0 +1,291 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// CPU exceptions on solo5hvt. The tender does not set up an interrupt
+// descriptor table, so the runtime installs its own. All 32 exception
+// vectors enter the stubs in sys_solo5hvt_amd64.s on the stack of
+// m.gsignal, switched to through interrupt stack table entry 1 of a task
+// state segment. The stubs save the registers in a trapFrame and call
+// trapgo. Exceptions that leave the machine in an unknown state, such as
+// a double fault, run on a separate static stack and are always fatal.
+//
+// Page 0 is unmapped by trapinit, so nil pointer dereferences fault.
+
+// trapFrame is the stack layout created by the exception stubs: the general
+// purpose registers, the vector number and error code, and the interrupt
+// frame pushed by the CPU.
+type trapFrame struct {
+	r15, r14, r13, r12, r11, r10, r9, r8 uint64
+	rdi, rsi, rbp, rbx, rdx, rcx, rax    uint64
+
+	vector, errcode uint64
+
+	rip, cs, rflags, rsp, ss uint64
+}
+
+// Exception vectors.
+const (
+	trapDE  = 0  // Divide error.
+	trapDB  = 1  // Debug.
+	trapNMI = 2  // Non-maskable interrupt.
+	trapBP  = 3  // Breakpoint.
+	trapOF  = 4  // Overflow.
+	trapBR  = 5  // BOUND range exceeded.
+	trapUD  = 6  // Invalid opcode.
+	trapNM  = 7  // Device not available.
+	trapDF  = 8  // Double fault.
+	trapTS  = 10 // Invalid TSS.
+	trapNP  = 11 // Segment not present.
+	trapSS  = 12 // Stack-segment fault.
+	trapGP  = 13 // General protection.
+	trapPF  = 14 // Page fault.
+	trapMF  = 16 // x87 floating-point error.
+	trapAC  = 17 // Alignment check.
+	trapMC  = 18 // Machine check.
+	trapXM  = 19 // SIMD floating-point exception.
+)
+
+var trapNames = [32]string{
+	trapDE:  "divide error",
+	trapDB:  "debug exception",
+	trapNMI: "non-maskable interrupt",
+	trapBP:  "breakpoint",
+	trapOF:  "overflow",
+	trapBR:  "bound range exceeded",
+	trapUD:  "invalid opcode",
+	trapNM:  "device not available",
+	trapDF:  "double fault",
+	9:       "coprocessor segment overrun",
+	trapTS:  "invalid TSS",
+	trapNP:  "segment not present",
+	trapSS:  "stack-segment fault",
+	trapGP:  "general protection fault",
+	trapPF:  "page fault",
+	15:      "reserved exception 15",
+	trapMF:  "x87 floating-point exception",
+	trapAC:  "alignment check",
+	trapMC:  "machine check",
+	trapXM:  "SIMD floating-point exception",
+	20:      "virtualization exception",
+	21:      "control protection exception",
+	22:      "reserved exception 22",
+	23:      "reserved exception 23",
+	24:      "reserved exception 24",
+	25:      "reserved exception 25",
+	26:      "reserved exception 26",
+	27:      "reserved exception 27",
+	28:      "hypervisor injection exception",
+	29:      "VMM communication exception",
+	30:      "security exception",
+	31:      "reserved exception 31",
+}
+
+// trapFatal reports whether an exception is handled without looking at the
+// state of the interrupted code.
+//
+//go:nosplit
+func trapFatal(vector uint64) bool {
+	return vector == trapNMI || vector == trapDF || vector == trapMC
+}
+
+// sigctxt describes an exception as the signal the Linux kernel would
+// deliver for it.
+type sigctxt struct {
+	f    *trapFrame
+	sig  uint32
+	code uint64
+	addr uint64
+}
+
+// trapSignal returns the signal, si_code and fault address for the exception
+// in f.
+func trapSignal(f *trapFrame) (sig uint32, code, addr uint64) {
+	switch f.vector {
+	case trapDE:
+		return _SIGFPE, _FPE_INTDIV, f.rip
+	case trapDB, trapBP:
+		return _SIGTRAP, _SI_KERNEL, 0
+	case trapOF, trapBR, trapTS, trapNP, trapGP:
+		return _SIGSEGV, _SI_KERNEL, 0
+	case trapUD:
+		return _SIGILL, _ILL_ILLOPN, f.rip
+	case trapSS, trapAC:
+		return _SIGBUS, _SI_KERNEL, 0
+	case trapPF:
+		if f.errcode&1 == 0 {
+			return _SIGSEGV, _SEGV_MAPERR, getcr2() // Page not present.
+		}
+		return _SIGSEGV, _SEGV_ACCERR, getcr2()
+	case trapMF, trapXM:
+		return _SIGFPE, 0, f.rip
+	}
+	return 0, 0, 0
+}
+
+func (c *sigctxt) rax() uint64 { return c.f.rax }
+func (c *sigctxt) rbx() uint64 { return c.f.rbx }
+func (c *sigctxt) rcx() uint64 { return c.f.rcx }
+func (c *sigctxt) rdx() uint64 { return c.f.rdx }
+func (c *sigctxt) rdi() uint64 { return c.f.rdi }
+func (c *sigctxt) rsi() uint64 { return c.f.rsi }
+func (c *sigctxt) rbp() uint64 { return c.f.rbp }
+func (c *sigctxt) rsp() uint64 { return c.f.rsp }
+func (c *sigctxt) r8() uint64  { return c.f.r8 }
+func (c *sigctxt) r9() uint64  { return c.f.r9 }
+func (c *sigctxt) r10() uint64 { return c.f.r10 }
+func (c *sigctxt) r11() uint64 { return c.f.r11 }
+func (c *sigctxt) r12() uint64 { return c.f.r12 }
+func (c *sigctxt) r13() uint64 { return c.f.r13 }
+func (c *sigctxt) r14() uint64 { return c.f.r14 }
+func (c *sigctxt) r15() uint64 { return c.f.r15 }
+
+//go:nosplit
+//go:nowritebarrierrec
+func (c *sigctxt) rip() uint64 { return c.f.rip }
+
+func (c *sigctxt) rflags() uint64  { return c.f.rflags }
+func (c *sigctxt) cs() uint64      { return c.f.cs }
+func (c *sigctxt) fs() uint64      { return 0 }
+func (c *sigctxt) gs() uint64      { return 0 }
+func (c *sigctxt) sigcode() uint64 { return c.code }
+func (c *sigctxt) sigaddr() uint64 { return c.addr }
+
+func (c *sigctxt) set_rip(x uint64) { c.f.rip = x }
+func (c *sigctxt) set_rsp(x uint64) { c.f.rsp = x }
+
+// Implemented in sys_solo5hvt_amd64.s. The privileged instructions are in
+// separate functions, so a tender running the guest outside of ring 0 can
+// replace them.
+
+//go:noescape
+func trapVectors(v *[32]uintptr)
+func sgdt() (base uintptr, limit uint16)
+func lgdt(base uintptr, limit uint16)
+func lidt(base uintptr, limit uint16)
+func ltr(sel uint16)
+func getcs() uint16
+func getcr2() uint64
+func getcr3() uint64
+func setcr3(v uint64)
+
+const (
+	trapGDTEntries  = 8       // Room for the tender's GDT and the TSS descriptor.
+	trapDFStackSize = 8 << 10 // Stack for fatal exceptions.
+)
+
+var trap struct {
+	gdt     [trapGDTEntries]uint64
+	tss     [26]uint32 // 64-bit task state segment, 104 bytes.
+	idt     [32][2]uint64
+	dfStack [trapDFStackSize]byte
+
+	// Page table for the first 2MB, after unmapping page 0. Twice the
+	// size needed, to find a 4KB aligned page table in it.
+	zeroPageTable [2 * 512]uint64
+}
+
+// trapinit installs the exception handlers, using the stack of
+// getg().m.gsignal. It is called from minit.
+func trapinit() {
+	_g_ := getg()
+
+	// Copy the tender's GDT and add a descriptor for the TSS.
+	base, limit := sgdt()
+	n := (uintptr(limit) + 1) / 8
+	if n > trapGDTEntries-2 {
+		throw("trapinit: GDT too large")
+	}
+	for i := uintptr(0); i < n; i++ {
+		trap.gdt[i] = *(*uint64)(unsafe.Pointer(base + i*8))
+	}
+	tss := uint64(uintptr(unsafe.Pointer(&trap.tss)))
+	tssLimit := uint64(unsafe.Sizeof(trap.tss) - 1)
+	trap.gdt[n] = tssLimit&0xffff | (tss&0xffffff)<<16 | 0x89<<40 | (tssLimit>>16)<<48 | (tss>>24&0xff)<<56 // Present, available 64-bit TSS.
+	trap.gdt[n+1] = tss >> 32
+
+	// IST1 for regular exceptions, IST2 for fatal ones. RSP0 for the
+	// switch to ring 0 is not used, but set it anyway.
+	sp := uint64(_g_.m.gsignal.stack.hi)
+	dfsp := uint64(uintptr(unsafe.Pointer(&trap.dfStack)) + trapDFStackSize)
+	trap.tss[1], trap.tss[2] = uint32(sp), uint32(sp>>32)
+	trap.tss[9], trap.tss[10] = uint32(sp), uint32(sp>>32)
+	trap.tss[11], trap.tss[12] = uint32(dfsp), uint32(dfsp>>32)
+	trap.tss[25] = uint32(unsafe.Sizeof(trap.tss)) << 16 // No I/O permission bitmap.
+
+	// Interrupt gates, present, in the current code segment. Only INT3 and
+	// INTO may be used by code with a lower privilege level.
+	var vectors [32]uintptr
+	trapVectors(&vectors)
+	cs := uint64(getcs())
+	for i, pc := range vectors {
+		pc := uint64(pc)
+		ist, attr := uint64(1), uint64(0x8e)
+		if trapFatal(uint64(i)) {
+			ist = 2
+		}
+		if i == trapBP || i == trapOF {
+			attr = 0xee
+		}
+		trap.idt[i][0] = pc&0xffff | cs<<16 | ist<<32 | attr<<40 | (pc>>16&0xffff)<<48
+		trap.idt[i][1] = pc >> 32
+	}
+
+	lgdt(uintptr(unsafe.Pointer(&trap.gdt)), uint16(unsafe.Sizeof(trap.gdt)-1))
+	ltr(uint16(n * 8))
+	lidt(uintptr(unsafe.Pointer(&trap.idt)), uint16(unsafe.Sizeof(trap.idt)-1))
+
+	unmapZeroPage()
+}
+
+// Page table entry bits.
+const (
+	ptePresent  = 1 << 0
+	ptePageSize = 1 << 7
+	pteAddr     = 0x000ffffffffff000
+	pteAddr2MB  = 0x000fffffffe00000
+	pteNX       = 1 << 63
+)
+
+// unmapZeroPage removes the mapping for the page at address 0, so nil pointer
+// dereferences cause a page fault. The tender identity maps memory, usually
+// with 2MB pages. The first 2MB page is split into 4KB pages.
+func unmapZeroPage() {
+	cr3 := getcr3()
+	pml4 := (*[512]uint64)(unsafe.Pointer(uintptr(cr3 & pteAddr)))
+	if pml4[0]&ptePresent == 0 {
+		return
+	}
+	pdpt := (*[512]uint64)(unsafe.Pointer(uintptr(pml4[0] & pteAddr)))
+	if pdpt[0]&ptePresent == 0 || pdpt[0]&ptePageSize != 0 {
+		// No mapping, or a 1GB page that we leave alone.
+		return
+	}
+	pd := (*[512]uint64)(unsafe.Pointer(uintptr(pdpt[0] & pteAddr)))
+	if pd[0]&ptePresent == 0 {
+		return
+	}
+	if pd[0]&ptePageSize == 0 {
+		pt := (*[512]uint64)(unsafe.Pointer(uintptr(pd[0] & pteAddr)))
+		pt[0] = 0
+	} else {
+		p := uintptr(unsafe.Pointer(&trap.zeroPageTable))
+		p = (p + 4095) &^ 4095
+		pt := (*[512]uint64)(unsafe.Pointer(p))
+		// Same flags as the 2MB page, except for the page size and
+		// PAT bits at different positions.
+		flags := pd[0]&0x17f | pd[0]&pteNX
+		addr := pd[0] & pteAddr2MB
+		for i := range pt {
+			pt[i] = addr + uint64(i)<<12 | flags
+		}
+		pt[0] = 0
+		pd[0] = uint64(p) | pd[0]&0x3f
+	}
+	// Reloading CR3 flushes the TLB.
+	setcr3(cr3)
+}
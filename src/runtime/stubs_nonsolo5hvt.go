@@ -0,0 +1,43 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !solo5hvt
+
+package runtime
+
+import "unsafe"
+
+// Only solo5hvt knows a memory limit, see memlimit_solo5hvt.go. Elsewhere
+// the pacer and the out of memory report ignore it.
+const memoryLimit = 0
+
+func gcMemoryLimitGoal() uint64 {
+	return 0
+}
+
+func printOOMReport() {
+}
+
+// Only the memory allocator of solo5hvt poisons memory, see mem_solo5hvt.go.
+func memDebugInit() {
+}
+
+//go:linkname readMemoryLimit runtime/debug.readMemoryLimit
+func readMemoryLimit() (limit, headroom uint64) {
+	return 0, 0
+}
+
+// Only on solo5hvt the runtime keeps the wall clock, see
+// wallclock_solo5hvt.go. Elsewhere the kernel does.
+//
+//go:linkname readWallClock runtime/debug.readWallClock
+func readWallClock() (offset, slew, drift int64) {
+	return 0, 0, 0
+}
+
+// Only solo5hvt uses the block cache, elsewhere its statistics are zero.
+//
+//go:linkname readBlockCacheStats runtime/debug.readBlockCacheStats
+func readBlockCacheStats(stats unsafe.Pointer) {
+}
@@ -34,3 +34,269 @@ TEXT runtime·settls(SB),NOSPLIT,$0
 // wrfsbase, not working in solo5 for me.
 //	BYTE $0xf3; BYTE $0x48; BYTE $0x0f; BYTE $0xae; BYTE $0xd0;
 //	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT runtime·cpuid(SB),NOSPLIT,$0-24
+	MOVL	eaxArg+0(FP), AX
+	MOVL	ecxArg+4(FP), CX
+	CPUID
+	MOVL	AX, eax+8(FP)
+	MOVL	BX, ebx+12(FP)
+	MOVL	CX, ecx+16(FP)
+	MOVL	DX, edx+20(FP)
+	RET
+
+// func rdseed() (v uint64, ok bool)
+TEXT runtime·rdseed(SB),NOSPLIT,$0-9
+	// RDSEED AX
+	BYTE $0x48; BYTE $0x0f; BYTE $0xc7; BYTE $0xf8
+	MOVQ	AX, v+0(FP)
+	SETCS	ok+8(FP)
+	RET
+
+// func rdrand() (v uint64, ok bool)
+TEXT runtime·rdrand(SB),NOSPLIT,$0-9
+	// RDRAND AX
+	BYTE $0x48; BYTE $0x0f; BYTE $0xc7; BYTE $0xf0
+	MOVQ	AX, v+0(FP)
+	SETCS	ok+8(FP)
+	RET
+
+// CPU exception entry points, see signal_solo5hvt_amd64.go. Each pushes an
+// error code (unless the CPU pushed one) and the vector number, and jumps to
+// trapcommon, which completes a trapFrame on the stack.
+#define TRAP(n) PUSHQ $0; PUSHQ $n; JMP trapcommon<>(SB)
+#define TRAPERR(n) PUSHQ $n; JMP trapcommon<>(SB)
+TEXT trap0<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(0)
+TEXT trap1<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(1)
+TEXT trap2<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(2)
+TEXT trap3<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(3)
+TEXT trap4<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(4)
+TEXT trap5<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(5)
+TEXT trap6<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(6)
+TEXT trap7<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(7)
+TEXT trap8<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(8)
+TEXT trap9<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(9)
+TEXT trap10<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(10)
+TEXT trap11<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(11)
+TEXT trap12<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(12)
+TEXT trap13<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(13)
+TEXT trap14<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(14)
+TEXT trap15<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(15)
+TEXT trap16<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(16)
+TEXT trap17<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(17)
+TEXT trap18<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(18)
+TEXT trap19<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(19)
+TEXT trap20<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(20)
+TEXT trap21<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(21)
+TEXT trap22<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(22)
+TEXT trap23<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(23)
+TEXT trap24<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(24)
+TEXT trap25<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(25)
+TEXT trap26<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(26)
+TEXT trap27<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(27)
+TEXT trap28<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(28)
+TEXT trap29<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(29)
+TEXT trap30<>(SB),NOSPLIT|NOFRAME,$0
+	TRAPERR(30)
+TEXT trap31<>(SB),NOSPLIT|NOFRAME,$0
+	TRAP(31)
+// The general purpose registers are saved for dumpregs and so the interrupted
+// code can be resumed. The floating point registers are not saved: execution
+// only resumes in sigpanic, which like any called function does not expect
+// them to be preserved.
+TEXT trapcommon<>(SB),NOSPLIT|NOFRAME,$0
+	PUSHQ	AX
+	PUSHQ	CX
+	PUSHQ	DX
+	PUSHQ	BX
+	PUSHQ	BP
+	PUSHQ	SI
+	PUSHQ	DI
+	PUSHQ	R8
+	PUSHQ	R9
+	PUSHQ	R10
+	PUSHQ	R11
+	PUSHQ	R12
+	PUSHQ	R13
+	PUSHQ	R14
+	PUSHQ	R15
+	CLD
+	MOVQ	SP, AX
+	SUBQ	$8, SP
+	MOVQ	AX, 0(SP)
+	CALL	runtime·trapgo(SB)
+	ADDQ	$8, SP
+	POPQ	R15
+	POPQ	R14
+	POPQ	R13
+	POPQ	R12
+	POPQ	R11
+	POPQ	R10
+	POPQ	R9
+	POPQ	R8
+	POPQ	DI
+	POPQ	SI
+	POPQ	BP
+	POPQ	BX
+	POPQ	DX
+	POPQ	CX
+	POPQ	AX
+	ADDQ	$16, SP // Vector and error code.
+	IRETQ
+
+// func trapVectors(v *[32]uintptr)
+TEXT runtime·trapVectors(SB),NOSPLIT,$0-8
+	MOVQ	v+0(FP), DI
+	MOVQ	$trap0<>(SB), AX
+	MOVQ	AX, 0(DI)
+	MOVQ	$trap1<>(SB), AX
+	MOVQ	AX, 8(DI)
+	MOVQ	$trap2<>(SB), AX
+	MOVQ	AX, 16(DI)
+	MOVQ	$trap3<>(SB), AX
+	MOVQ	AX, 24(DI)
+	MOVQ	$trap4<>(SB), AX
+	MOVQ	AX, 32(DI)
+	MOVQ	$trap5<>(SB), AX
+	MOVQ	AX, 40(DI)
+	MOVQ	$trap6<>(SB), AX
+	MOVQ	AX, 48(DI)
+	MOVQ	$trap7<>(SB), AX
+	MOVQ	AX, 56(DI)
+	MOVQ	$trap8<>(SB), AX
+	MOVQ	AX, 64(DI)
+	MOVQ	$trap9<>(SB), AX
+	MOVQ	AX, 72(DI)
+	MOVQ	$trap10<>(SB), AX
+	MOVQ	AX, 80(DI)
+	MOVQ	$trap11<>(SB), AX
+	MOVQ	AX, 88(DI)
+	MOVQ	$trap12<>(SB), AX
+	MOVQ	AX, 96(DI)
+	MOVQ	$trap13<>(SB), AX
+	MOVQ	AX, 104(DI)
+	MOVQ	$trap14<>(SB), AX
+	MOVQ	AX, 112(DI)
+	MOVQ	$trap15<>(SB), AX
+	MOVQ	AX, 120(DI)
+	MOVQ	$trap16<>(SB), AX
+	MOVQ	AX, 128(DI)
+	MOVQ	$trap17<>(SB), AX
+	MOVQ	AX, 136(DI)
+	MOVQ	$trap18<>(SB), AX
+	MOVQ	AX, 144(DI)
+	MOVQ	$trap19<>(SB), AX
+	MOVQ	AX, 152(DI)
+	MOVQ	$trap20<>(SB), AX
+	MOVQ	AX, 160(DI)
+	MOVQ	$trap21<>(SB), AX
+	MOVQ	AX, 168(DI)
+	MOVQ	$trap22<>(SB), AX
+	MOVQ	AX, 176(DI)
+	MOVQ	$trap23<>(SB), AX
+	MOVQ	AX, 184(DI)
+	MOVQ	$trap24<>(SB), AX
+	MOVQ	AX, 192(DI)
+	MOVQ	$trap25<>(SB), AX
+	MOVQ	AX, 200(DI)
+	MOVQ	$trap26<>(SB), AX
+	MOVQ	AX, 208(DI)
+	MOVQ	$trap27<>(SB), AX
+	MOVQ	AX, 216(DI)
+	MOVQ	$trap28<>(SB), AX
+	MOVQ	AX, 224(DI)
+	MOVQ	$trap29<>(SB), AX
+	MOVQ	AX, 232(DI)
+	MOVQ	$trap30<>(SB), AX
+	MOVQ	AX, 240(DI)
+	MOVQ	$trap31<>(SB), AX
+	MOVQ	AX, 248(DI)
+	RET
+
+// func sgdt() (base uintptr, limit uint16)
+TEXT runtime·sgdt(SB),NOSPLIT,$16-10
+	SGDT	0(SP)
+	MOVW	0(SP), AX
+	MOVW	AX, limit+8(FP)
+	MOVQ	2(SP), AX
+	MOVQ	AX, base+0(FP)
+	RET
+
+// func lgdt(base uintptr, limit uint16)
+TEXT runtime·lgdt(SB),NOSPLIT,$16-10
+	MOVW	limit+8(FP), AX
+	MOVW	AX, 0(SP)
+	MOVQ	base+0(FP), AX
+	MOVQ	AX, 2(SP)
+	LGDT	0(SP)
+	RET
+
+// func lidt(base uintptr, limit uint16)
+TEXT runtime·lidt(SB),NOSPLIT,$16-10
+	MOVW	limit+8(FP), AX
+	MOVW	AX, 0(SP)
+	MOVQ	base+0(FP), AX
+	MOVQ	AX, 2(SP)
+	LIDT	0(SP)
+	RET
+
+// func ltr(sel uint16)
+TEXT runtime·ltr(SB),NOSPLIT,$0-2
+	MOVW	sel+0(FP), AX
+	LTR	AX
+	RET
+
+// func getcs() uint16
+TEXT runtime·getcs(SB),NOSPLIT,$0-2
+	MOVW	CS, AX
+	MOVW	AX, ret+0(FP)
+	RET
+
+// func getcr2() uint64
+TEXT runtime·getcr2(SB),NOSPLIT,$0-8
+	MOVQ	CR2, AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// func getcr3() uint64
+TEXT runtime·getcr3(SB),NOSPLIT,$0-8
+	MOVQ	CR3, AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// func setcr3(v uint64)
+TEXT runtime·setcr3(SB),NOSPLIT,$0-8
+	MOVQ	v+0(FP), AX
+	MOVQ	AX, CR3
+	RET
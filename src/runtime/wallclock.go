@@ -0,0 +1,128 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "runtime/internal/math"
+
+// Clock arithmetic of solo5hvt, see wallclock_solo5hvt.go. It is built on
+// all systems so that it is tested on the host.
+//
+// On solo5hvt, walltime is nanotime plus an offset. The host wall clock is
+// only read every wallSyncPeriod, and in between the cycle counter and the
+// host clock drift apart. At each sync, small differences are slewed in at
+// wallSlewRate, so the wall clock keeps moving forward, only faster or
+// slower. Differences larger than wallStepLimit, e.g. after the host
+// suspended the guest, are stepped. nanotime itself is never adjusted.
+
+const (
+	wallSyncPeriod = 60 * 1000 * 1000 * 1000 // 1 minute
+	wallSlewRate   = 500                     // ppm, like adjtime
+	wallStepLimit  = 128 * 1000 * 1000       // 128ms, like ntpd
+)
+
+// A wallClockState is the wall clock as an offset from nanotime. All times
+// are in nanoseconds.
+type wallClockState struct {
+	offset   int64 // walltime minus nanotime, without the pending slew
+	slew     int64 // correction still to be slewed into offset
+	slewTime int64 // nanotime up to which the slew has been applied
+	syncTime int64 // nanotime of the last sync, 0 before the first
+	syncRaw  int64 // host walltime minus nanotime at the last sync
+	drift    int64 // how much slower nanotime runs than the host clock, in ppb
+}
+
+// read returns the wall clock at nanotime now.
+func (w *wallClockState) read(now int64) int64 {
+	w.applySlew(now)
+	return now + w.offset
+}
+
+// applySlew moves the part of the slew that is due at now into the offset.
+func (w *wallClockState) applySlew(now int64) {
+	if w.slew == 0 || now <= w.slewTime {
+		w.slewTime = now
+		return
+	}
+	adj := (now - w.slewTime) * wallSlewRate / 1e6
+	if adj == 0 {
+		return
+	}
+	if w.slew < 0 {
+		adj = -adj
+	}
+	if adj > 0 && adj >= w.slew || adj < 0 && adj <= w.slew {
+		adj = w.slew
+		w.slewTime = now
+	} else if adj > 0 {
+		w.slewTime += adj * 1e6 / wallSlewRate
+	} else {
+		w.slewTime += -adj * 1e6 / wallSlewRate
+	}
+	w.offset += adj
+	w.slew -= adj
+}
+
+// sync synchronizes the wall clock with host, the wall clock of the host,
+// read at nanotime now.
+func (w *wallClockState) sync(now, host int64) {
+	w.applySlew(now)
+	raw := host - now
+	if w.syncTime != 0 && now > w.syncTime {
+		d := raw - w.syncRaw
+		if d < wallStepLimit && d > -wallStepLimit {
+			w.drift = d * 1e9 / (now - w.syncTime)
+		}
+	}
+	w.syncTime = now
+	w.syncRaw = raw
+
+	diff := raw - w.offset
+	if diff >= wallStepLimit || diff <= -wallStepLimit {
+		w.offset = raw
+		w.slew = 0
+	} else {
+		w.slew = diff
+	}
+	w.slewTime = now
+}
+
+// tscScale returns the multiplier and shift that convert cycles of a
+// counter running at freq Hz to nanoseconds, see tscNanotime. The long
+// division stops when mult has 64 significant bits. freq must be in
+// [1, 1<<63).
+//
+//go:nosplit
+func tscScale(freq uint64) (mult uint64, shift uint) {
+	const nanoseconds = 1e9
+	mult = nanoseconds / freq
+	rem := nanoseconds % freq
+	for mult < 1<<63 {
+		mult <<= 1
+		rem <<= 1
+		if rem >= freq {
+			mult |= 1
+			rem -= freq
+		}
+		shift++
+	}
+	return mult, shift
+}
+
+// tscNanotime returns (tsc * mult) >> shift, with a 128-bit product, or
+// last if that is smaller, so that the monotonic clock does not go
+// backwards if the counter does.
+func tscNanotime(tsc, mult uint64, shift uint, last int64) int64 {
+	hi, lo := math.Mul64(tsc, mult)
+	var ns int64
+	if shift >= 64 {
+		ns = int64(hi >> (shift - 64))
+	} else {
+		ns = int64(hi<<(64-shift) | lo>>shift)
+	}
+	if ns < last {
+		return last
+	}
+	return ns
+}
@@ -0,0 +1,31 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import _ "unsafe" // for go:linkname
+
+// Wall clock synchronization, see wallclock.go.
+
+var wall wallClockState
+
+// wallClock returns the wall clock in nanoseconds at nanotime now.
+func wallClock(now int64) int64 {
+	return wall.read(now)
+}
+
+// wallClockSync synchronizes the wall clock with host, the wall clock of
+// the host in nanoseconds, read at nanotime now.
+func wallClockSync(now, host int64) {
+	wall.sync(now, host)
+}
+
+//go:linkname readWallClock runtime/debug.readWallClock
+func readWallClock() (offset, slew, drift int64) {
+	if wall.syncTime == 0 {
+		return 0, 0, 0
+	}
+	wall.applySlew(nanotime())
+	return wall.offset, wall.slew, wall.drift
+}
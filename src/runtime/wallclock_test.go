@@ -0,0 +1,158 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"math/bits"
+	. "runtime"
+	"testing"
+)
+
+const (
+	wallStart int64 = 1e9                     // nanotime of the first sync
+	wallHost  int64 = 1500000000 * 1000000000 // host wall clock at the first sync
+	wallMin   int64 = 60 * 1000000000
+)
+
+func TestWallClockStep(t *testing.T) {
+	var w WallClock
+	w.Sync(wallStart, wallHost)
+	if got := w.Read(wallStart); got != wallHost {
+		t.Fatalf("wall clock %d after first sync, want %d", got, wallHost)
+	}
+	if got := w.Read(wallStart + 1e9); got != wallHost+1e9 {
+		t.Fatalf("wall clock %d a second later, want %d", got, wallHost+1e9)
+	}
+
+	// Differences of at least WallStepLimit are stepped, forward and
+	// backward.
+	for _, d := range []int64{WallStepLimit, 5e9, -WallStepLimit, -5e9} {
+		now := wallStart + wallMin
+		host := w.Read(now) + d
+		w.Sync(now, host)
+		if got := w.Read(now); got != host {
+			t.Errorf("step %d: wall clock %d, want %d", d, got, host)
+		}
+		if _, slew := w.Offset(); slew != 0 {
+			t.Errorf("step %d: slew %d, want 0", d, slew)
+		}
+	}
+}
+
+func testWallClockSlew(t *testing.T, d int64) {
+	var w WallClock
+	w.Sync(wallStart, wallHost)
+	now := wallStart + wallMin
+	host := wallHost + wallMin + d
+	w.Sync(now, host)
+	if got := w.Read(now); got != host-d {
+		t.Fatalf("wall clock %d right after sync, want %d", got, host-d)
+	}
+	if _, slew := w.Offset(); slew != d {
+		t.Fatalf("slew %d, want %d", slew, d)
+	}
+	if drift, want := w.Drift(), d*1e9/wallMin; drift != want {
+		t.Errorf("drift %d ppb, want %d", drift, want)
+	}
+
+	// The wall clock runs faster or slower, but never goes backwards,
+	// until the slew has been applied.
+	const step = 1000000
+	slewed := int64(0)
+	last := w.Read(now)
+	for slewed != d {
+		now += step
+		wc := w.Read(now)
+		delta := wc - last - step
+		if delta < -step*WallSlewRate/1e6 || delta > step*WallSlewRate/1e6 {
+			t.Fatalf("wall clock advanced %dns in %dns", wc-last, step)
+		}
+		if d > 0 && delta < 0 || d < 0 && delta > 0 {
+			t.Fatalf("slew of %d applied in the wrong direction", d)
+		}
+		slewed += delta
+		last = wc
+	}
+	if want := (wallStart + wallMin) + wallAbs(d)*1e6/WallSlewRate; now != want {
+		t.Errorf("slew applied at %d, want %d", now, want)
+	}
+	if offset, slew := w.Offset(); offset != host-(wallStart+wallMin) || slew != 0 {
+		t.Errorf("offset %d and slew %d after slewing, want %d and 0", offset, slew, host-(wallStart+wallMin))
+	}
+	if got, want := w.Read(now+1e9), host+(now+1e9-(wallStart+wallMin)); got != want {
+		t.Errorf("wall clock %d after slewing, want %d", got, want)
+	}
+}
+
+func wallAbs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestWallClockSlewForward(t *testing.T) {
+	testWallClockSlew(t, 10000000)
+}
+
+func TestWallClockSlewBackward(t *testing.T) {
+	testWallClockSlew(t, -10000000)
+}
+
+func TestWallClockSlewSmallSteps(t *testing.T) {
+	// Reads too close together to slew a nanosecond do not lose the
+	// slew between them.
+	var w WallClock
+	w.Sync(wallStart, wallHost)
+	now := wallStart + wallMin
+	w.Sync(now, wallHost+wallMin-WallStepLimit/2)
+	start := now
+	last := w.Read(now)
+	for i := 0; i < 100000; i++ {
+		now += 1999
+		wc := w.Read(now)
+		if wc <= last {
+			t.Fatalf("wall clock went from %d to %d", last, wc)
+		}
+		last = wc
+	}
+	want := (now - start) * WallSlewRate / 1e6
+	if got := (now - start) - (last - (wallHost + wallMin)); got < want-1 || got > want {
+		t.Errorf("slewed %dns in %dns, want %d", got, now-start, want)
+	}
+}
+
+func TestTSCNanotime(t *testing.T) {
+	for _, freq := range []uint64{1, 1000000, 1000000000, 2000000000, 2399999999, 3000000000, 1<<63 - 1} {
+		mult, shift := TSCScale(freq)
+		if mult < 1<<63 {
+			t.Errorf("freq %d: multiplier %#x has less than 64 significant bits", freq, mult)
+		}
+		for _, tsc := range []uint64{0, 1, 999, 1e9, 3e9 + 7, 1 << 40, 3e9 * 3600 * 24 * 365, 1<<63 - 1} {
+			hi, lo := bits.Mul64(tsc, 1e9)
+			if hi >= freq {
+				continue
+			}
+			exact, _ := bits.Div64(hi, lo, freq)
+			if exact >= 1<<63 {
+				continue
+			}
+			want := int64(exact)
+			got := TSCNanotime(tsc, mult, shift, 0)
+			if got > want || got < want-1 {
+				t.Errorf("freq %d, tsc %d: nanotime %d, want %d", freq, tsc, got, want)
+			}
+		}
+	}
+
+	// The clock does not go backwards when the counter does.
+	mult, shift := TSCScale(1e9)
+	if got := TSCNanotime(5000, mult, shift, 6000); got != 6000 {
+		t.Errorf("nanotime %d after 6000 at tsc 5000, want 6000", got)
+	}
+	if got := TSCNanotime(7000, mult, shift, 6000); got != 7000 {
+		t.Errorf("nanotime %d after 6000 at tsc 7000, want 7000", got)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package syscall
+
+// Export the packet capture of solo5hvt, see pcap.go, for testing on the
+// host.
+
+const (
+	PcapIn        = pcapIn
+	PcapOut       = pcapOut
+	PcapHeaderLen = pcapHeaderLen
+	PcapRecordLen = pcapRecordLen
+)
+
+var (
+	PcapFileHeader = pcapFileHeader
+	PcapRecord     = pcapRecord
+	PcapAtoi       = pcapAtoi
+)
+
+// PcapMatch parses filter, with network devices netDevices, and reports
+// whether frame p on device handle, in direction dir, passes it.
+func PcapMatch(filter string, netDevices map[string]int, handle, dir int, p []byte) (match, ok bool) {
+	f := pcapFilter{proto: -1, port: -1}
+	ok = f.parse(filter, func(name string) (int, bool) {
+		h, ok := netDevices[name]
+		return h, ok
+	})
+	return ok && f.match(handle, dir, p), ok
+}
+
+type PcapRing struct {
+	r pcapRing
+}
+
+func NewPcapRing(size int) *PcapRing {
+	return &PcapRing{pcapRing{buf: make([]byte, size)}}
+}
+
+func (r *PcapRing) Add(rec []byte) { r.r.add(rec) }
+func (r *PcapRing) Bytes() []byte  { return r.r.appendTo(nil) }
+
+// PcapDisk captures to image, a block device with blocks of blockSize.
+type PcapDisk struct {
+	d pcapDisk
+}
+
+// NewPcapDisk returns a capture to image that calls written with the
+// offset of every block written.
+func NewPcapDisk(image []byte, blockSize int, written func(off int64)) *PcapDisk {
+	d := &PcapDisk{pcapDisk{
+		capacity: int64(len(image)),
+		block:    make([]byte, 0, blockSize),
+	}}
+	d.d.writeAt = func(b []byte, off int64) {
+		if len(b) != blockSize || off%int64(blockSize) != 0 || off+int64(len(b)) > int64(len(image)) {
+			panic("bad block write")
+		}
+		copy(image[off:], b)
+		written(off)
+	}
+	return d
+}
+
+func (d *PcapDisk) Write(b []byte) { d.d.write(b) }
+func (d *PcapDisk) Add(rec []byte) { d.d.add(rec) }
+func (d *PcapDisk) Full() bool     { return d.d.full }
@@ -0,0 +1,154 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// Solo5 hypercalls for device I/O, mirroring the unexported versions in
+// package runtime. Block devices are read and written through the block
+// cache of the runtime. Devices are identified by their handle, the index
+// of the device in the manifest.
+
+func outl(dx uint32, ax uintptr)
+
+const (
+	hypercallPuts     = 0x502
+	hypercallNetwrite = 0x506
+	hypercallNetread  = 0x507
+)
+
+const (
+	s5ok = iota
+	s5again
+	s5invalid
+	s5unspec
+)
+
+func solo5Errno(ret int64) error {
+	switch ret {
+	case s5ok:
+		return nil
+	case s5again:
+		return errEAGAIN
+	case s5invalid:
+		return errEINVAL
+	}
+	return EIO
+}
+
+// Netread reads a single frame from the network device into p.
+// If no frame is pending, EAGAIN is returned. Frames read and written can be
+// captured for debugging, see pcap_solo5hvt.go.
+func Netread(handle int, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, EINVAL
+	}
+	var arg = struct {
+		// in
+		handle uint64
+		data   uintptr
+
+		// in/out
+		length int64
+
+		// out
+		ret int64
+	}{uint64(handle), uintptr(unsafe.Pointer(&p[0])), int64(len(p)), 0}
+	outl(hypercallNetread, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(p)
+	if err := solo5Errno(arg.ret); err != nil {
+		return 0, err
+	}
+	pcapCapture(handle, pcapIn, p[:arg.length])
+	return int(arg.length), nil
+}
+
+// Netwrite writes p as a single frame to the network device.
+func Netwrite(handle int, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, EINVAL
+	}
+	pcapCapture(handle, pcapOut, p)
+	var arg = struct {
+		// in
+		handle uint64
+		data   uintptr
+		length int64
+
+		// out
+		ret int64
+	}{uint64(handle), uintptr(unsafe.Pointer(&p[0])), int64(len(p)), -1}
+	outl(hypercallNetwrite, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(p)
+	if err := solo5Errno(arg.ret); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Block I/O goes through the block cache of package runtime. The functions
+// return a solo5 result code.
+func blkread(handle int, p []byte, off int64) int64
+func blkwrite(handle int, p []byte, off int64) int64
+func blksync(handle int) int64
+
+// Blkread reads a single block at offset off from the block device into p.
+// The offset must be a multiple and len(p) equal to the block size of the device.
+func Blkread(handle int, p []byte, off int64) (n int, err error) {
+	if len(p) == 0 || off < 0 {
+		return 0, EINVAL
+	}
+	if err := solo5Errno(blkread(handle, p, off)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Blkwrite writes p as a single block at offset off to the block device.
+// The offset must be a multiple and len(p) equal to the block size of the device.
+// The block is written to the device by Blksync, when it is evicted from the
+// block cache, or when the program exits.
+func Blkwrite(handle int, p []byte, off int64) (n int, err error) {
+	if len(p) == 0 || off < 0 {
+		return 0, EINVAL
+	}
+	if err := solo5Errno(blkwrite(handle, p, off)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Blksync writes the blocks written to the block device that are still in
+// the block cache to the device.
+func Blksync(handle int) error {
+	return solo5Errno(blksync(handle))
+}
+
+// ConsoleWrite writes p to the console of the tender.
+func ConsoleWrite(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	var arg = struct {
+		data   uintptr
+		length uint64
+	}{uintptr(unsafe.Pointer(&p[0])), uint64(len(p))}
+	outl(hypercallPuts, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(p)
+}
+
+func consoleWriteErr(p []byte) // in runtime
+
+// ConsoleWriteErr writes p to the console of the tender as standard error.
+// If environment variable SOLO5_STDERR_PREFIX is set, each line starts with
+// its value, so the tender's output can be split in standard output and
+// standard error. The output of the runtime, e.g. of panics, is prefixed as
+// well.
+func ConsoleWriteErr(p []byte) {
+	consoleWriteErr(p)
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+// Device types in the solo5 manifest, keep in sync with the runtime.
+const (
+	DevBlockBasic = 1
+	DevNetBasic   = 2
+)
+
+// Device is a device from the solo5 manifest, as attached by the tender.
+// It is runtime.solo5Device, keep in sync.
+type Device struct {
+	Name     string
+	Handle   int // Index in the manifest, used for hypercalls.
+	Type     int
+	Attached bool
+
+	// For DevBlockBasic.
+	Capacity  int64 // In bytes.
+	BlockSize int
+
+	// For DevNetBasic.
+	MAC [6]byte
+	MTU int
+}
+
+// solo5Device stores the device with handle from the manifest in d. It
+// returns false if the manifest has no entry for handle. Implemented in the
+// runtime package, which decodes the manifest.
+func solo5Device(handle int, d *Device) bool
+
+// Devices returns the devices from the manifest, in manifest order.
+func Devices() []Device {
+	var l []Device
+	for i := 1; ; i++ {
+		var d Device
+		if !solo5Device(i, &d) {
+			return l
+		}
+		if d.Type == DevBlockBasic || d.Type == DevNetBasic {
+			l = append(l, d)
+		}
+	}
+}
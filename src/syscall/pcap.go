@@ -0,0 +1,296 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package syscall
+
+// The filter and the record framing of the packet capture of solo5hvt, see
+// pcap_solo5hvt.go. Also built on linux, so that they are tested on the host.
+
+const (
+	pcapMagic       = 0xa1b2c3d4
+	pcapLinkEther   = 1
+	pcapHeaderLen   = 24
+	pcapRecordLen   = 16
+	pcapDefaultSnap = 65535
+	pcapDefaultRing = 1 << 20
+
+	pcapIn  = 1
+	pcapOut = 2
+)
+
+type pcapFilter struct {
+	handle int // Network device, 0 for any.
+	dir    int // pcapIn or pcapOut, 0 for any.
+	etype  int // Ethernet type, 0 for any.
+	proto  int // IP protocol, -1 for any.
+	port   int // TCP or UDP port, -1 for any.
+}
+
+// parse adds the terms of s, joined by "+", to the filter. Function
+// netDevice returns the handle of the network device with a name.
+func (f *pcapFilter) parse(s string, netDevice func(name string) (handle int, ok bool)) bool {
+	for _, t := range pcapSplit(s, '+') {
+		switch t {
+		case "in":
+			f.dir = pcapIn
+		case "out":
+			f.dir = pcapOut
+		case "arp":
+			f.etype = 0x0806
+		case "ip":
+			f.etype = 0x0800
+		case "ip6":
+			f.etype = 0x86dd
+		case "tcp":
+			f.proto = 6
+		case "udp":
+			f.proto = 17
+		case "icmp":
+			f.proto = 1
+		default:
+			if len(t) > 5 && t[:5] == "port=" {
+				n, ok := pcapAtoi(t[5:])
+				if !ok || n > 0xffff {
+					return false
+				}
+				f.port = int(n)
+				continue
+			}
+			handle, ok := netDevice(t)
+			if !ok {
+				return false
+			}
+			f.handle = handle
+		}
+	}
+	return true
+}
+
+// match reports whether frame p on device handle, in direction dir, passes
+// the filter.
+func (f *pcapFilter) match(handle, dir int, p []byte) bool {
+	if f.handle != 0 && f.handle != handle || f.dir != 0 && f.dir != dir {
+		return false
+	}
+	if f.etype == 0 && f.proto < 0 && f.port < 0 {
+		return true
+	}
+	if len(p) < 14 {
+		return false
+	}
+	etype := int(p[12])<<8 | int(p[13])
+	if f.etype != 0 && f.etype != etype {
+		return false
+	}
+	if f.proto < 0 && f.port < 0 {
+		return true
+	}
+	ip := p[14:]
+	var proto int
+	var l4 []byte
+	switch {
+	case etype == 0x0800 && len(ip) >= 20:
+		proto = int(ip[9])
+		if n := int(ip[0]&0xf) * 4; n <= len(ip) && ip[6]&0x1f == 0 && ip[7] == 0 {
+			l4 = ip[n:]
+		}
+	case etype == 0x86dd && len(ip) >= 40:
+		proto = int(ip[6])
+		if proto == 58 {
+			proto = 1
+		}
+		l4 = ip[40:]
+	default:
+		return false
+	}
+	if f.proto >= 0 && f.proto != proto {
+		return false
+	}
+	if f.port >= 0 {
+		if proto != 6 && proto != 17 || len(l4) < 4 {
+			return false
+		}
+		src := int(l4[0])<<8 | int(l4[1])
+		dst := int(l4[2])<<8 | int(l4[3])
+		return src == f.port || dst == f.port
+	}
+	return true
+}
+
+// pcapFileHeader returns the pcap file header for snap length snap, with
+// room for n more bytes.
+func pcapFileHeader(snap, n int) []byte {
+	b := make([]byte, pcapHeaderLen, pcapHeaderLen+n)
+	put32le(b[0:], pcapMagic)
+	put16le(b[4:], 2) // Version 2.4.
+	put16le(b[6:], 4)
+	put32le(b[16:], uint32(snap))
+	put32le(b[20:], pcapLinkEther)
+	return b
+}
+
+// pcapRecord returns the pcap record of frame p, captured at time sec and
+// nsec, with at most snap bytes of the frame.
+func pcapRecord(sec int64, nsec int32, snap int, p []byte) []byte {
+	n := len(p)
+	if n > snap {
+		n = snap
+	}
+	rec := make([]byte, pcapRecordLen+n)
+	put32le(rec[0:], uint32(sec))
+	put32le(rec[4:], uint32(nsec/1000))
+	put32le(rec[8:], uint32(n))
+	put32le(rec[12:], uint32(len(p)))
+	copy(rec[pcapRecordLen:], p)
+	return rec
+}
+
+// A pcapRing is a ring buffer of pcap records.
+type pcapRing struct {
+	buf  []byte
+	head int // Offset of the oldest record.
+	used int
+}
+
+// add adds record rec, dropping the oldest records to make room.
+func (r *pcapRing) add(rec []byte) {
+	b := r.buf
+	if len(rec) > len(b) {
+		return
+	}
+	for r.used+len(rec) > len(b) {
+		var hdr [pcapRecordLen]byte
+		for i := range hdr {
+			hdr[i] = b[(r.head+i)%len(b)]
+		}
+		n := pcapRecordLen + int(le32(hdr[8:]))
+		r.head = (r.head + n) % len(b)
+		r.used -= n
+	}
+	o := (r.head + r.used) % len(b)
+	n := copy(b[o:], rec)
+	copy(b, rec[n:])
+	r.used += len(rec)
+}
+
+// appendTo appends the records, oldest first, to b.
+func (r *pcapRing) appendTo(b []byte) []byte {
+	if r.head+r.used <= len(r.buf) {
+		return append(b, r.buf[r.head:r.head+r.used]...)
+	}
+	b = append(b, r.buf[r.head:]...)
+	return append(b, r.buf[:r.used-(len(r.buf)-r.head)]...)
+}
+
+// A pcapDisk writes a capture to a block device, starting at offset 0. An
+// end marker, pcapRecordLen zero bytes, follows the last record.
+type pcapDisk struct {
+	writeAt  func(b []byte, off int64) // Writes whole blocks.
+	capacity int64
+	off      int64  // Bytes written.
+	block    []byte // Block at off, partially filled, with the block size as capacity.
+	full     bool
+}
+
+// add appends record rec, unless the device is full.
+func (d *pcapDisk) add(rec []byte) {
+	if d.full || d.off+int64(len(rec)) > d.capacity {
+		d.full = true
+		return
+	}
+	d.write(rec)
+}
+
+// write appends b. The current block is written after b, zero-filled, and
+// so is the next block if the end marker does not fit.
+func (d *pcapDisk) write(b []byte) {
+	for len(b) > 0 {
+		n := copy(d.block[len(d.block):cap(d.block)], b)
+		d.block = d.block[:len(d.block)+n]
+		d.off += int64(n)
+		b = b[n:]
+		if len(d.block) == cap(d.block) {
+			d.writeAt(d.block, d.off-int64(len(d.block)))
+			d.block = d.block[:0]
+		}
+	}
+	start := d.off - int64(len(d.block))
+	if start >= d.capacity {
+		return
+	}
+	blk := d.block[:cap(d.block)]
+	for i := len(d.block); i < len(blk); i++ {
+		blk[i] = 0
+	}
+	d.writeAt(blk, start)
+	if next := start + int64(len(blk)); len(blk)-len(d.block) < pcapRecordLen && next < d.capacity {
+		d.writeAt(make([]byte, len(blk)), next)
+	}
+}
+
+func pcapSplit(s string, sep byte) []string {
+	var l []string
+	for len(s) > 0 {
+		i := 0
+		for i < len(s) && s[i] != sep {
+			i++
+		}
+		if i > 0 {
+			l = append(l, s[:i])
+		}
+		if i < len(s) {
+			i++
+		}
+		s = s[i:]
+	}
+	return l
+}
+
+// pcapAtoi parses a non-negative decimal number with an optional K, M or G
+// suffix.
+func pcapAtoi(s string) (int64, bool) {
+	mult := int64(1)
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'K', 'k':
+			mult = 1 << 10
+		case 'M', 'm':
+			mult = 1 << 20
+		case 'G', 'g':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	if s == "" || len(s) > 12 {
+		return 0, false
+	}
+	var n int64
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(s[i]-'0')
+	}
+	return n * mult, true
+}
+
+func put16le(b []byte, v uint16) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+}
+
+func put32le(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import "sync"
+
+// Packet capture of the frames read and written with Netread and Netwrite,
+// for debugging. Capture is configured with GODEBUG settings:
+//
+//	solo5pcap=<target>         block device name from the manifest, or "mem"
+//	solo5pcapsnap=<n>          snap length, bytes captured per frame (65535)
+//	solo5pcapsize=<n>[K|M|G]   size of the ring buffer in memory (1M)
+//	solo5pcapfilter=<terms>    terms joined by "+", all must match
+//
+// Filter terms are the name of a network device, "in" or "out" for the
+// direction, "arp", "ip" or "ip6" for the ethernet type, "tcp", "udp" or
+// "icmp" for the IP protocol (icmp includes ICMPv6), and "port=<n>" for TCP
+// or UDP source or destination port n.
+//
+// Frames are stored in pcap format, with microsecond timestamps. On a block
+// device, the capture starts at offset 0 and stops when the device is full.
+// An end marker, 16 zero bytes, follows the last frame. The blocks go
+// through the block cache and reach the device on Blksync, on eviction, or
+// when the program exits normally; go tool solo5pcap extracts the capture
+// from the device image. In memory, the oldest frames are dropped to make
+// room for new ones, and Capture returns the frames.
+
+// Implemented in the runtime package.
+func walltime() (sec int64, nsec int32)
+
+var pcap struct {
+	once   sync.Once
+	mu     sync.Mutex
+	on     bool
+	snap   int
+	filter pcapFilter
+	disk   *pcapDisk // Block device, or nil.
+	ring   *pcapRing // Ring buffer in memory, or nil.
+}
+
+// pcapInit configures capture from GODEBUG.
+func pcapInit() {
+	v, _ := Getenv("GODEBUG")
+	target := ""
+	pcap.snap = pcapDefaultSnap
+	size := int64(pcapDefaultRing)
+	pcap.filter = pcapFilter{proto: -1, port: -1}
+	for _, kv := range pcapSplit(v, ',') {
+		key, val := kv, ""
+		for i := 0; i < len(kv); i++ {
+			if kv[i] == '=' {
+				key, val = kv[:i], kv[i+1:]
+				break
+			}
+		}
+		ok := true
+		switch key {
+		case "solo5pcap":
+			target = val
+		case "solo5pcapsnap":
+			var n int64
+			n, ok = pcapAtoi(val)
+			if ok && n > 0 {
+				pcap.snap = int(n)
+			}
+		case "solo5pcapsize":
+			size, ok = pcapAtoi(val)
+		case "solo5pcapfilter":
+			ok = pcap.filter.parse(val, pcapNetDevice)
+		default:
+			continue
+		}
+		if !ok {
+			pcapFail("bad GODEBUG " + kv)
+			return
+		}
+	}
+	if target == "" {
+		return
+	}
+
+	if target == "mem" {
+		if size < pcapHeaderLen+pcapRecordLen {
+			pcapFail("ring buffer too small")
+			return
+		}
+		pcap.ring = &pcapRing{buf: make([]byte, size-pcapHeaderLen)}
+		pcap.on = true
+		return
+	}
+	for _, d := range Devices() {
+		if d.Name != target {
+			continue
+		}
+		if d.Type != DevBlockBasic || !d.Attached || d.Capacity < int64(d.BlockSize) {
+			break
+		}
+		handle := d.Handle
+		pcap.disk = &pcapDisk{
+			writeAt:  func(b []byte, off int64) { Blkwrite(handle, b, off) },
+			capacity: d.Capacity,
+			block:    make([]byte, 0, d.BlockSize),
+		}
+		pcap.on = true
+		pcap.disk.write(pcapFileHeader(pcap.snap, 0))
+		return
+	}
+	pcapFail("no block device " + target)
+}
+
+func pcapFail(msg string) {
+	ConsoleWriteErr([]byte("solo5pcap: " + msg + "\n"))
+}
+
+// pcapNetDevice returns the handle of the network device with name.
+func pcapNetDevice(name string) (handle int, ok bool) {
+	for _, d := range Devices() {
+		if d.Name == name && d.Type == DevNetBasic {
+			return d.Handle, true
+		}
+	}
+	return 0, false
+}
+
+// pcapCapture records frame p, read from or written to network device
+// handle, if capture is enabled and the frame passes the filter.
+func pcapCapture(handle, dir int, p []byte) {
+	pcap.once.Do(pcapInit)
+	if !pcap.on || !pcap.filter.match(handle, dir, p) {
+		return
+	}
+	sec, nsec := walltime()
+	rec := pcapRecord(sec, nsec, pcap.snap, p)
+
+	pcap.mu.Lock()
+	defer pcap.mu.Unlock()
+	if pcap.ring != nil {
+		pcap.ring.add(rec)
+	} else {
+		pcap.disk.add(rec)
+	}
+}
+
+// Capture returns the frames captured in memory, with GODEBUG setting
+// solo5pcap=mem, as a pcap file. It returns nil if frames are not captured
+// in memory.
+func Capture() []byte {
+	pcap.once.Do(pcapInit)
+	if pcap.ring == nil {
+		return nil
+	}
+	pcap.mu.Lock()
+	defer pcap.mu.Unlock()
+	return pcap.ring.appendTo(pcapFileHeader(pcap.snap, pcap.ring.used))
+}
@@ -0,0 +1,285 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux solo5hvt
+
+package syscall_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestPcapRecord(t *testing.T) {
+	h := syscall.PcapFileHeader(128, 0)
+	if len(h) != syscall.PcapHeaderLen {
+		t.Fatalf("file header has length %d, want %d", len(h), syscall.PcapHeaderLen)
+	}
+	le := binary.LittleEndian
+	if m, major, minor, snap, link := le.Uint32(h), le.Uint16(h[4:]), le.Uint16(h[6:]), le.Uint32(h[16:]), le.Uint32(h[20:]); m != 0xa1b2c3d4 || major != 2 || minor != 4 || snap != 128 || link != 1 {
+		t.Errorf("file header %x", h)
+	}
+
+	p := make([]byte, 100)
+	for i := range p {
+		p[i] = byte(i)
+	}
+	for _, snap := range []int{1, 99, 100, 65535} {
+		rec := syscall.PcapRecord(1500000000, 123456789, snap, p)
+		n := snap
+		if n > len(p) {
+			n = len(p)
+		}
+		if len(rec) != syscall.PcapRecordLen+n {
+			t.Errorf("snap %d: record has length %d, want %d", snap, len(rec), syscall.PcapRecordLen+n)
+			continue
+		}
+		sec, usec, caplen, l := le.Uint32(rec), le.Uint32(rec[4:]), le.Uint32(rec[8:]), le.Uint32(rec[12:])
+		if sec != 1500000000 || usec != 123456 || caplen != uint32(n) || l != uint32(len(p)) {
+			t.Errorf("snap %d: record header sec %d usec %d caplen %d len %d", snap, sec, usec, caplen, l)
+		}
+		if !bytes.Equal(rec[syscall.PcapRecordLen:], p[:n]) {
+			t.Errorf("snap %d: record data differs", snap)
+		}
+	}
+}
+
+// pcapRecords returns records with data of length 1, 2, ..., n.
+func pcapRecords(n int) [][]byte {
+	var recs [][]byte
+	for i := 1; i <= n; i++ {
+		recs = append(recs, syscall.PcapRecord(int64(i), 0, 65535, bytes.Repeat([]byte{byte(i)}, i)))
+	}
+	return recs
+}
+
+func TestPcapRing(t *testing.T) {
+	recs := pcapRecords(20)
+	for _, size := range []int{17, 40, 64, 100, 1000} {
+		r := syscall.NewPcapRing(size)
+		var added [][]byte
+		for i, rec := range recs {
+			r.Add(rec)
+			if len(rec) <= size {
+				added = append(added, rec)
+			}
+
+			// The ring holds the newest records that fit. Records larger
+			// than the ring are not added.
+			var want []byte
+			for j := len(added) - 1; j >= 0; j-- {
+				if len(want)+len(added[j]) > size {
+					break
+				}
+				want = append(append([]byte(nil), added[j]...), want...)
+			}
+			if got := r.Bytes(); !bytes.Equal(got, want) {
+				t.Fatalf("size %d, after record %d:\ngot  %x\nwant %x", size, i, got, want)
+			}
+		}
+	}
+}
+
+// pcapParse returns the records of the capture in image, checking the file
+// header and the end marker.
+func pcapParse(image []byte) ([][]byte, error) {
+	if len(image) < syscall.PcapHeaderLen || !bytes.Equal(image[:syscall.PcapHeaderLen], syscall.PcapFileHeader(65535, 0)) {
+		return nil, fmt.Errorf("bad file header")
+	}
+	var recs [][]byte
+	b := image[syscall.PcapHeaderLen:]
+	zero := make([]byte, syscall.PcapRecordLen)
+	for len(b) >= syscall.PcapRecordLen && !bytes.Equal(b[:syscall.PcapRecordLen], zero) {
+		n := syscall.PcapRecordLen + int(binary.LittleEndian.Uint32(b[8:]))
+		if n > len(b) {
+			return nil, fmt.Errorf("record %d truncated", len(recs))
+		}
+		recs = append(recs, b[:n])
+		b = b[n:]
+	}
+	return recs, nil
+}
+
+func TestPcapDisk(t *testing.T) {
+	const bs = 64
+	recs := pcapRecords(40)
+	for _, blocks := range []int{1, 2, 5, 16} {
+		image := bytes.Repeat([]byte{0xff}, blocks*bs)
+		writes := 0
+		d := syscall.NewPcapDisk(image, bs, func(off int64) { writes++ })
+		d.Write(syscall.PcapFileHeader(65535, 0))
+		used := syscall.PcapHeaderLen
+		added := 0
+		for i, rec := range recs {
+			d.Add(rec)
+			if used+len(rec) <= len(image) && !d.Full() {
+				used += len(rec)
+				added++
+			} else if !d.Full() {
+				t.Fatalf("%d blocks: record %d does not fit but device is not full", blocks, i)
+			}
+
+			got, err := pcapParse(image)
+			if err != nil {
+				t.Fatalf("%d blocks, after record %d: %v", blocks, i, err)
+			}
+			if len(got) != added {
+				t.Fatalf("%d blocks, after record %d: parsed %d records, want %d", blocks, i, len(got), added)
+			}
+			for j := range got {
+				if !bytes.Equal(got[j], recs[j]) {
+					t.Fatalf("%d blocks: record %d differs", blocks, j)
+				}
+			}
+			// The end marker follows the last record when it fits.
+			if used+syscall.PcapRecordLen <= len(image) {
+				if m := image[used : used+syscall.PcapRecordLen]; !bytes.Equal(m, make([]byte, syscall.PcapRecordLen)) {
+					t.Fatalf("%d blocks, after record %d: end marker %x", blocks, i, m)
+				}
+			}
+		}
+		if !d.Full() {
+			t.Errorf("%d blocks: device not full", blocks)
+		}
+		n := writes
+		d.Add(recs[0])
+		if writes != n {
+			t.Errorf("%d blocks: record added to full device", blocks)
+		}
+	}
+}
+
+// Frames for the filter tests.
+
+func ether(etype uint16, payload []byte) []byte {
+	b := make([]byte, 14, 14+len(payload))
+	binary.BigEndian.PutUint16(b[12:], etype)
+	return append(b, payload...)
+}
+
+func ipv4(proto byte, frag uint16, l4 []byte) []byte {
+	b := make([]byte, 20, 20+len(l4))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[6:], frag)
+	b[9] = proto
+	return append(b, l4...)
+}
+
+func ipv6(next byte, l4 []byte) []byte {
+	b := make([]byte, 40, 40+len(l4))
+	b[0] = 0x60
+	b[6] = next
+	return append(b, l4...)
+}
+
+func ports(src, dst uint16) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b[0:], src)
+	binary.BigEndian.PutUint16(b[2:], dst)
+	return b
+}
+
+func TestPcapFilter(t *testing.T) {
+	devs := map[string]int{"net0": 1, "net1": 2}
+	var (
+		arp      = ether(0x0806, make([]byte, 28))
+		tcp4     = ether(0x0800, ipv4(6, 0, ports(1234, 80)))
+		udp4     = ether(0x0800, ipv4(17, 0, ports(53, 4000)))
+		icmp4    = ether(0x0800, ipv4(1, 0, make([]byte, 8)))
+		tcp6     = ether(0x86dd, ipv6(6, ports(80, 1234)))
+		udp6     = ether(0x86dd, ipv6(17, ports(4000, 53)))
+		icmp6    = ether(0x86dd, ipv6(58, make([]byte, 8)))
+		frag4    = ether(0x0800, ipv4(6, 0x0010, ports(1234, 80))) // Not the first fragment.
+		shortIP4 = ether(0x0800, make([]byte, 10))
+		shortTCP = ether(0x0800, ipv4(6, 0, []byte{0, 80}))
+		runt     = make([]byte, 10)
+	)
+	tests := []struct {
+		filter  string
+		handle  int
+		dir     int
+		frame   []byte
+		want    bool
+		wantErr bool
+	}{
+		{"", 1, syscall.PcapIn, runt, true, false},
+		{"", 2, syscall.PcapOut, tcp4, true, false},
+		{"net0", 1, syscall.PcapIn, tcp4, true, false},
+		{"net0", 2, syscall.PcapIn, tcp4, false, false},
+		{"net1+out", 2, syscall.PcapOut, arp, true, false},
+		{"net1+out", 2, syscall.PcapIn, arp, false, false},
+		{"in", 1, syscall.PcapIn, runt, true, false},
+		{"arp", 1, syscall.PcapIn, arp, true, false},
+		{"arp", 1, syscall.PcapIn, tcp4, false, false},
+		{"arp", 1, syscall.PcapIn, runt, false, false},
+		{"ip", 1, syscall.PcapIn, udp4, true, false},
+		{"ip", 1, syscall.PcapIn, udp6, false, false},
+		{"ip6", 1, syscall.PcapIn, udp6, true, false},
+		{"tcp", 1, syscall.PcapIn, tcp4, true, false},
+		{"tcp", 1, syscall.PcapIn, tcp6, true, false},
+		{"tcp", 1, syscall.PcapIn, udp4, false, false},
+		{"tcp", 1, syscall.PcapIn, arp, false, false},
+		{"tcp", 1, syscall.PcapIn, shortIP4, false, false},
+		{"udp+ip6", 1, syscall.PcapIn, udp6, true, false},
+		{"udp+ip6", 1, syscall.PcapIn, udp4, false, false},
+		{"icmp", 1, syscall.PcapIn, icmp4, true, false},
+		{"icmp", 1, syscall.PcapIn, icmp6, true, false},
+		{"icmp", 1, syscall.PcapIn, tcp6, false, false},
+		{"port=80", 1, syscall.PcapIn, tcp4, true, false},
+		{"port=80", 1, syscall.PcapIn, tcp6, true, false},
+		{"port=53", 1, syscall.PcapIn, udp4, true, false},
+		{"port=53", 1, syscall.PcapIn, udp6, true, false},
+		{"port=81", 1, syscall.PcapIn, tcp4, false, false},
+		{"port=80", 1, syscall.PcapIn, icmp4, false, false},
+		{"port=80", 1, syscall.PcapIn, frag4, false, false},
+		{"tcp", 1, syscall.PcapIn, frag4, true, false},
+		{"port=80", 1, syscall.PcapIn, shortTCP, false, false},
+		{"net0+in+ip+tcp+port=80", 1, syscall.PcapIn, tcp4, true, false},
+		{"net0+in+ip+tcp+port=80", 1, syscall.PcapIn, tcp6, false, false},
+		{"tcp++port=80+", 1, syscall.PcapIn, tcp4, true, false},
+		{"net2", 1, syscall.PcapIn, tcp4, false, true},
+		{"port=", 1, syscall.PcapIn, tcp4, false, true},
+		{"port=65536", 1, syscall.PcapIn, tcp4, false, true},
+		{"port=http", 1, syscall.PcapIn, tcp4, false, true},
+	}
+	for _, tt := range tests {
+		match, ok := syscall.PcapMatch(tt.filter, devs, tt.handle, tt.dir, tt.frame)
+		if ok == tt.wantErr {
+			t.Errorf("filter %q: parsed %v, want %v", tt.filter, ok, !tt.wantErr)
+			continue
+		}
+		if match != tt.want {
+			t.Errorf("filter %q, handle %d, dir %d, frame %x: match %v, want %v", tt.filter, tt.handle, tt.dir, tt.frame, match, tt.want)
+		}
+	}
+}
+
+func TestPcapAtoi(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int64
+		want bool
+	}{
+		{"0", 0, true},
+		{"65535", 65535, true},
+		{"16K", 16 << 10, true},
+		{"2m", 2 << 20, true},
+		{"1G", 1 << 30, true},
+		{"", 0, false},
+		{"K", 0, false},
+		{"-1", 0, false},
+		{"1.5M", 0, false},
+		{"1T", 0, false},
+		{"1234567890123", 0, false},
+	}
+	for _, tt := range tests {
+		n, ok := syscall.PcapAtoi(tt.s)
+		if n != tt.n || ok != tt.want {
+			t.Errorf("PcapAtoi(%q) = %d, %v, want %d, %v", tt.s, n, ok, tt.n, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solo5hvt
+
+package solo5
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+// ErrNoCapture is returned by WriteCapture when frames are not captured in
+// memory.
+var ErrNoCapture = errors.New("no packet capture in memory")
+
+// WriteCapture writes the network frames captured in memory to w, as a pcap
+// file that can be opened with tcpdump or Wireshark. Frames are captured in
+// a ring buffer in memory when GODEBUG has setting solo5pcap=mem. The size
+// of the buffer, 1M by default, is set with solo5pcapsize=<n>[K|M|G], the
+// number of bytes captured per frame with solo5pcapsnap=<n>, and the frames
+// to capture with solo5pcapfilter. The filter consists of terms joined by
+// "+" that must all match: a network device name, "in" or "out", "arp",
+// "ip", "ip6", "tcp", "udp", "icmp" and "port=<n>". For example:
+//
+//	GODEBUG=solo5pcap=mem,solo5pcapsnap=128,solo5pcapfilter=net0+tcp+port=80
+//
+// With solo5pcap=<name>, frames are captured to the block device with name
+// instead, see go tool solo5pcap.
+func WriteCapture(w io.Writer) error {
+	b := syscall.Capture()
+	if b == nil {
+		return ErrNoCapture
+	}
+	_, err := w.Write(b)
+	return err
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solo5hvt
+
+package solo5
+
+import (
+	"internal/solo5lease"
+	"time"
+)
+
+// A Lease is the configuration of a network device obtained with DHCP. The
+// network stack of package net records the leases it obtains, for devices
+// listed in environment variable SOLO5_DHCP.
+type Lease struct {
+	Addr    [4]byte
+	Mask    [4]byte
+	Router  [4]byte   // Default gateway, zero if none.
+	DNS     [][4]byte // Name servers.
+	Domain  string
+	Server  [4]byte   // The DHCP server that granted the lease.
+	Start   time.Time // When the lease was granted or last renewed.
+	Expires time.Time // Zero for a lease that does not expire.
+}
+
+// LookupLease returns the current lease of the network device with name.
+func LookupLease(name string) (Lease, bool) {
+	l, ok := solo5lease.Lookup(name)
+	return Lease(l), ok
+}
@@ -0,0 +1,293 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solo5hvt
+
+// Package solo5 gives access to the block and network devices of a solo5
+// unikernel, as declared in its manifest and attached by the tender.
+//
+// Devices are looked up by their name in the manifest. A block device is
+// accessed with ReadAt and WriteAt in whole blocks. A network device reads
+// and writes single Ethernet frames, reads block the goroutine until a frame
+// arrives.
+//
+// This package is EXPERIMENTAL. It is exempt from the Go compatibility promise.
+package solo5
+
+import (
+	"errors"
+	"internal/poll"
+	"io"
+	"syscall"
+	"time"
+)
+
+// DeviceType is the type of a device in the manifest.
+type DeviceType int
+
+const (
+	BlockBasic DeviceType = syscall.DevBlockBasic // Block device, solo5 type BLOCK_BASIC.
+	NetBasic   DeviceType = syscall.DevNetBasic   // Network device, solo5 type NET_BASIC.
+)
+
+func (t DeviceType) String() string {
+	switch t {
+	case BlockBasic:
+		return "BLOCK_BASIC"
+	case NetBasic:
+		return "NET_BASIC"
+	}
+	return "unknown"
+}
+
+// Device describes a device from the manifest.
+type Device struct {
+	Name     string
+	Type     DeviceType
+	Attached bool // Whether the tender attached the device.
+
+	Block BlockInfo // For BlockBasic.
+	Net   NetInfo   // For NetBasic.
+
+	handle int
+}
+
+// BlockInfo holds the properties of a block device.
+type BlockInfo struct {
+	Capacity  int64 // In bytes.
+	BlockSize int   // In bytes, the unit of reads and writes.
+}
+
+// NetInfo holds the properties of a network device.
+type NetInfo struct {
+	MAC [6]byte
+	MTU int // Maximum size of the payload of an Ethernet frame.
+}
+
+// ErrNotFound is returned when a device is not in the manifest, or not of
+// the requested type.
+var ErrNotFound = errors.New("device not found")
+
+// DeviceError records an error and the operation and device that caused it.
+type DeviceError struct {
+	Op     string
+	Device string
+	Err    error
+}
+
+func (e *DeviceError) Error() string {
+	return "solo5 " + e.Op + " " + e.Device + ": " + e.Err.Error()
+}
+
+func (e *DeviceError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether this error represents a timeout.
+func (e *DeviceError) Timeout() bool {
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// Devices returns the devices from the manifest, in manifest order.
+func Devices() []Device {
+	var l []Device
+	for _, d := range syscall.Devices() {
+		l = append(l, Device{
+			Name:     d.Name,
+			Type:     DeviceType(d.Type),
+			Attached: d.Attached,
+			Block:    BlockInfo{d.Capacity, d.BlockSize},
+			Net:      NetInfo{d.MAC, d.MTU},
+			handle:   d.Handle,
+		})
+	}
+	return l
+}
+
+// Lookup returns the device with name from the manifest.
+func Lookup(name string) (Device, error) {
+	for _, d := range Devices() {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Device{}, &DeviceError{"lookup", name, ErrNotFound}
+}
+
+func lookupType(op, name string, t DeviceType) (Device, error) {
+	d, err := Lookup(name)
+	if err != nil || d.Type != t {
+		return Device{}, &DeviceError{op, name, ErrNotFound}
+	}
+	if !d.Attached {
+		return Device{}, &DeviceError{op, name, syscall.ENODEV}
+	}
+	return d, nil
+}
+
+// Block is an opened block device. It implements io.ReaderAt and
+// io.WriterAt. Multiple goroutines may use a Block concurrently.
+type Block struct {
+	info Device
+	pfd  poll.FD
+}
+
+// OpenBlock opens the block device with name from the manifest.
+func OpenBlock(name string) (*Block, error) {
+	d, err := lookupType("open", name, BlockBasic)
+	if err != nil {
+		return nil, err
+	}
+	b := &Block{info: d}
+	b.pfd.Sysfd = d.handle
+	if err := b.pfd.Init("file", false); err != nil {
+		return nil, &DeviceError{"open", name, err}
+	}
+	return b, nil
+}
+
+// Device returns the manifest description of the device.
+func (b *Block) Device() Device {
+	return b.info
+}
+
+// Fd returns the handle of the device, for syscall.Blkread and
+// syscall.Blkwrite.
+func (b *Block) Fd() uintptr {
+	return uintptr(b.pfd.Sysfd)
+}
+
+// check verifies that an I/O of n bytes at off is in whole blocks.
+func (b *Block) check(n int, off int64) error {
+	bs := int64(b.info.Block.BlockSize)
+	if off < 0 || off%bs != 0 || int64(n)%bs != 0 {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes from the device at offset off. Both off and
+// len(p) must be multiples of the block size. Reads beyond the end of the
+// device return io.EOF.
+func (b *Block) ReadAt(p []byte, off int64) (n int, err error) {
+	if err := b.check(len(p), off); err != nil {
+		return 0, &DeviceError{"read", b.info.Name, err}
+	}
+	bs := b.info.Block.BlockSize
+	for n < len(p) {
+		if off >= b.info.Block.Capacity {
+			return n, io.EOF
+		}
+		if _, err := b.pfd.Pread(p[n:n+bs], off); err != nil {
+			return n, &DeviceError{"read", b.info.Name, err}
+		}
+		n += bs
+		off += int64(bs)
+	}
+	return n, nil
+}
+
+// WriteAt writes len(p) bytes to the device at offset off. Both off and
+// len(p) must be multiples of the block size. Writes beyond the end of the
+// device fail with ENOSPC.
+func (b *Block) WriteAt(p []byte, off int64) (n int, err error) {
+	if err := b.check(len(p), off); err != nil {
+		return 0, &DeviceError{"write", b.info.Name, err}
+	}
+	bs := b.info.Block.BlockSize
+	for n < len(p) {
+		if off >= b.info.Block.Capacity {
+			return n, &DeviceError{"write", b.info.Name, syscall.ENOSPC}
+		}
+		if _, err := b.pfd.Pwrite(p[n:n+bs], off); err != nil {
+			return n, &DeviceError{"write", b.info.Name, err}
+		}
+		n += bs
+		off += int64(bs)
+	}
+	return n, nil
+}
+
+// Sync writes the blocks written to the device that are still in the block
+// cache of the runtime to the device. Writes are cached until Sync, until
+// they are evicted from the cache, or until the program exits normally.
+func (b *Block) Sync() error {
+	if err := b.pfd.Fsync(); err != nil {
+		return &DeviceError{"sync", b.info.Name, err}
+	}
+	return nil
+}
+
+// Close closes the device. Pending reads and writes complete first.
+func (b *Block) Close() error {
+	if err := b.pfd.Close(); err != nil {
+		return &DeviceError{"close", b.info.Name, err}
+	}
+	return nil
+}
+
+// Net is an opened network device. A network device can only be opened
+// once, package net opens all network devices that are not yet opened on
+// first use.
+type Net struct {
+	info Device
+	pfd  poll.FD
+}
+
+// OpenNet opens the network device with name from the manifest. If the
+// device is already opened, the error is EBUSY.
+func OpenNet(name string) (*Net, error) {
+	d, err := lookupType("open", name, NetBasic)
+	if err != nil {
+		return nil, err
+	}
+	n := &Net{info: d}
+	n.pfd.Sysfd = d.handle
+	if err := n.pfd.Init("solo5", true); err != nil {
+		return nil, &DeviceError{"open", name, err}
+	}
+	return n, nil
+}
+
+// Device returns the manifest description of the device.
+func (n *Net) Device() Device {
+	return n.info
+}
+
+// ReadFrame reads a single Ethernet frame into p, blocking until a frame
+// arrives or the read deadline expires. The frame, without checksum, is at
+// most the MTU plus 14 bytes for the header. If p is too small, an error is
+// returned.
+func (n *Net) ReadFrame(p []byte) (int, error) {
+	m, err := n.pfd.Read(p)
+	if err != nil {
+		return 0, &DeviceError{"read", n.info.Name, err}
+	}
+	return m, nil
+}
+
+// WriteFrame writes p as a single Ethernet frame. Writes do not block.
+func (n *Net) WriteFrame(p []byte) error {
+	if _, err := n.pfd.Write(p); err != nil {
+		return &DeviceError{"write", n.info.Name, err}
+	}
+	return nil
+}
+
+// SetReadDeadline sets the deadline for ReadFrame. A zero time means no
+// deadline. After the deadline, reads fail with an error that has a Timeout
+// method returning true.
+func (n *Net) SetReadDeadline(t time.Time) error {
+	return n.pfd.SetReadDeadline(t)
+}
+
+// Close closes the device, unblocking readers. The device can be opened
+// again.
+func (n *Net) Close() error {
+	if err := n.pfd.Close(); err != nil {
+		return &DeviceError{"close", n.info.Name, err}
+	}
+	return nil
+}
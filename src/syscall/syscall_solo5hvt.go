@@ -350,6 +350,8 @@ func setTimeval(sec, usec int64) Timeval {
 	return Timeval{Sec: sec, Usec: usec}
 }
 
+// The file system of the guest is in package os, Mkdir and Chdir have no
+// system call to make.
 func Mkdir(path string, mode uint32) (err error) {
 	return ENOSYS
 }
@@ -357,3 +359,11 @@ func Mkdir(path string, mode uint32) (err error) {
 func Chdir(path string) (err error) {
 	return ENOSYS
 }
+
+func Unlink(path string) (err error) {
+	return ENOSYS
+}
+
+// GetRandom fills p with random bytes from the cryptographically secure
+// generator of the runtime. It is implemented in the runtime package.
+func GetRandom(p []byte)
@@ -10,7 +10,10 @@ import (
 	"syscall"
 )
 
-var timezoneZipData = []byte{}
+// timezoneZipData is the contents of /zoneinfo.zip. It is set by
+// SetTimezoneDB, or by the linker, which embeds $GOROOT/lib/time/zoneinfo.zip
+// unless told otherwise with -solo5zoneinfo, -solo5zones or -solo5nozoneinfo.
+var timezoneZipData string
 
 type openFile struct {
 	offset int
@@ -92,6 +95,9 @@ func readoff(f *openFile, buf []byte, s int) int {
 }
 
 // SetTimezoneDB sets the contents of the timezone zip file used for looking up time zones.
+// It replaces the database embedded by the linker.
+// The local time zone, from $TZ, is loaded when Local is first used and does not
+// change after that.
 func SetTimezoneDB(zipData []byte) {
-	timezoneZipData = zipData
+	timezoneZipData = string(zipData)
 }